@@ -0,0 +1,249 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: api/ai_query/v1/ai_query.proto
+
+package v1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	AIQueryService_QueryProducts_FullMethodName      = "/api.ai_query.v1.AIQueryService/QueryProducts"
+	AIQueryService_GetRecommendations_FullMethodName = "/api.ai_query.v1.AIQueryService/GetRecommendations"
+	AIQueryService_GetSimilarProducts_FullMethodName = "/api.ai_query.v1.AIQueryService/GetSimilarProducts"
+	AIQueryService_ClassifyProducts_FullMethodName   = "/api.ai_query.v1.AIQueryService/ClassifyProducts"
+)
+
+// AIQueryServiceClient is the client API for AIQueryService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// AIQueryService 智能商品查询服务，由 internal/service/ai_query 实现
+// 相关度和相似度由可替换的模型后端计算，默认使用本地确定性模型
+type AIQueryServiceClient interface {
+	// QueryProducts 自然语言搜索商品，支持过滤、排序，返回相关度和搜索建议
+	QueryProducts(ctx context.Context, in *QueryProductsRequest, opts ...grpc.CallOption) (*QueryProductsResponse, error)
+	// GetRecommendations 根据用户的历史订单推荐商品，没有历史订单时推荐热销商品
+	GetRecommendations(ctx context.Context, in *GetRecommendationsRequest, opts ...grpc.CallOption) (*GetRecommendationsResponse, error)
+	// GetSimilarProducts 按指定维度查找相似商品
+	GetSimilarProducts(ctx context.Context, in *GetSimilarProductsRequest, opts ...grpc.CallOption) (*GetSimilarProductsResponse, error)
+	// ClassifyProducts 按价格区间、分类或库存对商品分组
+	ClassifyProducts(ctx context.Context, in *ClassifyProductsRequest, opts ...grpc.CallOption) (*ClassifyProductsResponse, error)
+}
+
+type aIQueryServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAIQueryServiceClient(cc grpc.ClientConnInterface) AIQueryServiceClient {
+	return &aIQueryServiceClient{cc}
+}
+
+func (c *aIQueryServiceClient) QueryProducts(ctx context.Context, in *QueryProductsRequest, opts ...grpc.CallOption) (*QueryProductsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryProductsResponse)
+	err := c.cc.Invoke(ctx, AIQueryService_QueryProducts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIQueryServiceClient) GetRecommendations(ctx context.Context, in *GetRecommendationsRequest, opts ...grpc.CallOption) (*GetRecommendationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetRecommendationsResponse)
+	err := c.cc.Invoke(ctx, AIQueryService_GetRecommendations_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIQueryServiceClient) GetSimilarProducts(ctx context.Context, in *GetSimilarProductsRequest, opts ...grpc.CallOption) (*GetSimilarProductsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetSimilarProductsResponse)
+	err := c.cc.Invoke(ctx, AIQueryService_GetSimilarProducts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIQueryServiceClient) ClassifyProducts(ctx context.Context, in *ClassifyProductsRequest, opts ...grpc.CallOption) (*ClassifyProductsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ClassifyProductsResponse)
+	err := c.cc.Invoke(ctx, AIQueryService_ClassifyProducts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AIQueryServiceServer is the server API for AIQueryService service.
+// All implementations must embed UnimplementedAIQueryServiceServer
+// for forward compatibility.
+//
+// AIQueryService 智能商品查询服务，由 internal/service/ai_query 实现
+// 相关度和相似度由可替换的模型后端计算，默认使用本地确定性模型
+type AIQueryServiceServer interface {
+	// QueryProducts 自然语言搜索商品，支持过滤、排序，返回相关度和搜索建议
+	QueryProducts(context.Context, *QueryProductsRequest) (*QueryProductsResponse, error)
+	// GetRecommendations 根据用户的历史订单推荐商品，没有历史订单时推荐热销商品
+	GetRecommendations(context.Context, *GetRecommendationsRequest) (*GetRecommendationsResponse, error)
+	// GetSimilarProducts 按指定维度查找相似商品
+	GetSimilarProducts(context.Context, *GetSimilarProductsRequest) (*GetSimilarProductsResponse, error)
+	// ClassifyProducts 按价格区间、分类或库存对商品分组
+	ClassifyProducts(context.Context, *ClassifyProductsRequest) (*ClassifyProductsResponse, error)
+	mustEmbedUnimplementedAIQueryServiceServer()
+}
+
+// UnimplementedAIQueryServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAIQueryServiceServer struct{}
+
+func (UnimplementedAIQueryServiceServer) QueryProducts(context.Context, *QueryProductsRequest) (*QueryProductsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryProducts not implemented")
+}
+func (UnimplementedAIQueryServiceServer) GetRecommendations(context.Context, *GetRecommendationsRequest) (*GetRecommendationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRecommendations not implemented")
+}
+func (UnimplementedAIQueryServiceServer) GetSimilarProducts(context.Context, *GetSimilarProductsRequest) (*GetSimilarProductsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSimilarProducts not implemented")
+}
+func (UnimplementedAIQueryServiceServer) ClassifyProducts(context.Context, *ClassifyProductsRequest) (*ClassifyProductsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClassifyProducts not implemented")
+}
+func (UnimplementedAIQueryServiceServer) mustEmbedUnimplementedAIQueryServiceServer() {}
+func (UnimplementedAIQueryServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeAIQueryServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AIQueryServiceServer will
+// result in compilation errors.
+type UnsafeAIQueryServiceServer interface {
+	mustEmbedUnimplementedAIQueryServiceServer()
+}
+
+func RegisterAIQueryServiceServer(s grpc.ServiceRegistrar, srv AIQueryServiceServer) {
+	// If the following call pancis, it indicates UnimplementedAIQueryServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&AIQueryService_ServiceDesc, srv)
+}
+
+func _AIQueryService_QueryProducts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryProductsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIQueryServiceServer).QueryProducts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIQueryService_QueryProducts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIQueryServiceServer).QueryProducts(ctx, req.(*QueryProductsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIQueryService_GetRecommendations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRecommendationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIQueryServiceServer).GetRecommendations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIQueryService_GetRecommendations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIQueryServiceServer).GetRecommendations(ctx, req.(*GetRecommendationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIQueryService_GetSimilarProducts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSimilarProductsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIQueryServiceServer).GetSimilarProducts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIQueryService_GetSimilarProducts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIQueryServiceServer).GetSimilarProducts(ctx, req.(*GetSimilarProductsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIQueryService_ClassifyProducts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClassifyProductsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIQueryServiceServer).ClassifyProducts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIQueryService_ClassifyProducts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIQueryServiceServer).ClassifyProducts(ctx, req.(*ClassifyProductsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AIQueryService_ServiceDesc is the grpc.ServiceDesc for AIQueryService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AIQueryService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "api.ai_query.v1.AIQueryService",
+	HandlerType: (*AIQueryServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "QueryProducts",
+			Handler:    _AIQueryService_QueryProducts_Handler,
+		},
+		{
+			MethodName: "GetRecommendations",
+			Handler:    _AIQueryService_GetRecommendations_Handler,
+		},
+		{
+			MethodName: "GetSimilarProducts",
+			Handler:    _AIQueryService_GetSimilarProducts_Handler,
+		},
+		{
+			MethodName: "ClassifyProducts",
+			Handler:    _AIQueryService_ClassifyProducts_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "api/ai_query/v1/ai_query.proto",
+}
@@ -3,12 +3,14 @@ package main
 import (
 	"context"
 	"log"
+	"os"
 	"time"
 
 	pb "qaqmall/api/auth/v1"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
@@ -26,6 +28,9 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
+	// GenerateToken 仅限内部服务调用，凭证与服务端的 GRPC_SERVICE_TOKEN 一致
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-service-token", os.Getenv("GRPC_SERVICE_TOKEN"))
+
 	// 测试生成 token
 	tokenResp, err := client.GenerateToken(ctx, &pb.GenerateTokenRequest{
 		UserId: 1,
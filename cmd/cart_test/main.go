@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"log"
+	"os"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 
 	pb "qaqmall/api/cart/v1"
 )
@@ -23,6 +25,9 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// 以内部服务的身份调用，凭证与服务端的 GRPC_SERVICE_TOKEN 一致
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-service-token", os.Getenv("GRPC_SERVICE_TOKEN"))
+
 	// 测试用户ID
 	userID := uint64(1)
 
@@ -9,6 +9,7 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
@@ -54,6 +55,9 @@ func main() {
 
 	// 3. 测试获取用户信息
 	if loginResp != nil {
+		// 之后的调用都携带登录得到的token
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+loginResp.Token)
+
 		log.Println("\n测试获取用户信息...")
 		userInfo, err := client.GetUserInfo(ctx, &pb.GetUserInfoRequest{
 			UserId: loginResp.UserId,
@@ -96,9 +100,7 @@ func main() {
 		// 6. 测试删除用户
 		log.Println("\n测试删除用户...")
 		deleteResp, err := client.DeleteUser(ctx, &pb.DeleteUserRequest{
-			UserId:       loginResp.UserId,
-			OperatorId:   loginResp.UserId,
-			OperatorRole: loginResp.Role,
+			UserId: loginResp.UserId,
 		})
 		if err != nil {
 			log.Printf("删除用户失败: %v", err)
@@ -0,0 +1,969 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFile 默认配置文件路径，可通过环境变量 CONFIG_FILE 覆盖
+const DefaultConfigFile = "config/config.yaml"
+
+// Config 应用配置
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	JWT        JWTConfig        `yaml:"jwt"`
+	OpenAI     OpenAIConfig     `yaml:"openai"`
+	LLM        LLMConfig        `yaml:"llm"`
+	Retrieval  RetrievalConfig  `yaml:"retrieval"`
+	Guardrail  GuardrailConfig  `yaml:"guardrail"`
+	Redis      RedisConfig      `yaml:"redis"`
+	Revocation RevocationConfig `yaml:"revocation"`
+	Mail       MailConfig       `yaml:"mail"`
+	Account    AccountConfig    `yaml:"account"`
+	MFA        MFAConfig        `yaml:"mfa"`
+	// LoginProtection 登录防暴力破解
+	LoginProtection LoginProtectionConfig `yaml:"login_protection"`
+	RateLimit       RateLimitConfig       `yaml:"rate_limit"`
+	OIDC            OIDCConfig            `yaml:"oidc"`
+	RBAC            RBACConfig            `yaml:"rbac"`
+}
+
+// ServerConfig 服务器配置
+// TrustedProxies 为前置代理的地址或网段，只有来自这些地址的请求才会按 X-Forwarded-For 取客户端 IP，为空时不信任任何代理
+// GRPCServiceToken 内部服务调用 gRPC 时在 metadata 中携带的凭证（x-service-token），为空时不接受内部调用
+type ServerConfig struct {
+	Port             int      `yaml:"port"`
+	GRPCPort         int      `yaml:"grpc_port"`
+	GRPCServiceToken string   `yaml:"grpc_service_token"`
+	TrustedProxies   []string `yaml:"trusted_proxies"`
+}
+
+// DatabaseConfig 数据库配置
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Name     string `yaml:"name"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Params   string `yaml:"params"`
+}
+
+// JWT 签名算法
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+// JWTConfig JWT配置
+// Algorithm 为 HS256 时使用 Secret 签名和校验；为 RS256 或 EdDSA 时使用 Keys 中 kid 为 SigningKey 的私钥签名，
+// Keys 中的所有密钥都可用于校验，并通过 /.well-known/jwks.json 公开公钥
+// Expire 为 access token 的有效期；refresh token 每次刷新时轮换并顺延 RefreshExpire，但同一次登录最长持续 SessionMaxAge
+type JWTConfig struct {
+	Algorithm     string         `yaml:"algorithm"`
+	Secret        string         `yaml:"secret"`
+	SigningKey    string         `yaml:"signing_key"`
+	Keys          []JWTKeyConfig `yaml:"keys"`
+	Expire        time.Duration  `yaml:"expire"`
+	RenewBefore   time.Duration  `yaml:"renew_before"`
+	RefreshExpire time.Duration  `yaml:"refresh_expire"`
+	SessionMaxAge time.Duration  `yaml:"session_max_age"`
+	// Issuer、Audience 写入 token 的 iss、aud，校验时必须一致
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// Leeway 校验 exp、iat 时允许的时钟偏差
+	Leeway time.Duration `yaml:"leeway"`
+	// MFAChallengeExpire 开启二次验证的用户登录时，输入验证码的时限
+	MFAChallengeExpire time.Duration `yaml:"mfa_challenge_expire"`
+}
+
+// JWTKeyConfig 非对称签名密钥，PrivateKeyFile 和 PublicKeyFile 为 PEM 文件路径
+// 配置了私钥时公钥由私钥导出；只配置公钥的密钥只用于校验，用于轮换时保留旧密钥
+type JWTKeyConfig struct {
+	ID             string `yaml:"kid"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+// OpenAIConfig OpenAI配置
+type OpenAIConfig struct {
+	APIKey      string  `yaml:"api_key"`
+	APIURL      string  `yaml:"api_url"`
+	Model       string  `yaml:"model"`
+	Temperature float64 `yaml:"temperature"`
+}
+
+// LLM 后端类型
+const (
+	LLMProviderOpenAI = "openai"
+	LLMProviderOllama = "ollama"
+	LLMProviderFake   = "fake"
+)
+
+// LLMConfig 大模型调用配置
+// Provider 为 openai 时使用 OpenAIConfig，为 ollama 时使用 Ollama，为 fake 时使用进程内的假模型，不访问网络
+type LLMConfig struct {
+	Provider     string        `yaml:"provider"`
+	Timeout      time.Duration `yaml:"timeout"`
+	MaxRetries   int           `yaml:"max_retries"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+	Ollama       OllamaConfig  `yaml:"ollama"`
+	FakeReply    string        `yaml:"fake_reply"`
+	// HistoryTokenBudget 多轮会话中回放历史消息的 token 上限
+	HistoryTokenBudget int `yaml:"history_token_budget"`
+}
+
+// OllamaConfig Ollama配置
+type OllamaConfig struct {
+	APIURL      string  `yaml:"api_url"`
+	Model       string  `yaml:"model"`
+	Temperature float64 `yaml:"temperature"`
+}
+
+// 检索索引类型
+const (
+	RetrievalIndexBM25      = "bm25"
+	RetrievalIndexEmbedding = "embedding"
+)
+
+// 向量化后端类型
+const (
+	EmbedderHash   = "hash"
+	EmbedderOpenAI = "openai"
+)
+
+// RetrievalConfig AI助手的商品检索配置
+// Index 为 bm25 时使用进程内的 BM25 索引；为 embedding 时使用向量索引，由 Embedder 指定向量化后端
+type RetrievalConfig struct {
+	Index    string `yaml:"index"`
+	Embedder string `yaml:"embedder"`
+	// TopK 每次提问选出的相关商品数
+	TopK int `yaml:"top_k"`
+	// RefreshInterval 定期与数据库对齐索引的间隔，为0时只在启动时加载
+	RefreshInterval time.Duration   `yaml:"refresh_interval"`
+	Embedding       EmbeddingConfig `yaml:"embedding"`
+}
+
+// EmbeddingConfig 向量化配置，openai 后端使用 APIURL 和 Model（密钥复用 openai.api_key），hash 后端使用 Dimensions
+type EmbeddingConfig struct {
+	APIURL     string `yaml:"api_url"`
+	Model      string `yaml:"model"`
+	Dimensions int    `yaml:"dimensions"`
+}
+
+// GuardrailConfig AI助手的安全防护配置
+type GuardrailConfig struct {
+	// DailyTokenQuota 每个用户每天可用的 token 数，为0时不限制
+	DailyTokenQuota int `yaml:"daily_token_quota"`
+}
+
+// RedisConfig Redis 连接配置，也可以使用兼容 Redis 协议的服务
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+// token 吊销记录的存储后端
+const (
+	RevocationBackendDB    = "db"
+	RevocationBackendRedis = "redis"
+)
+
+// RevocationConfig 已吊销 access token 的存储配置
+// Cache 为 true 时在后端前使用进程内的布隆过滤器和 LRU 缓存，每隔 SyncInterval 从后端同步，
+// 其他实例吊销的token最迟在一个同步周期后生效
+type RevocationConfig struct {
+	Backend       string        `yaml:"backend"`
+	KeyPrefix     string        `yaml:"key_prefix"`
+	Cache         bool          `yaml:"cache"`
+	CacheSize     int           `yaml:"cache_size"`
+	SyncInterval  time.Duration `yaml:"sync_interval"`
+	SweepInterval time.Duration `yaml:"sweep_interval"`
+}
+
+// 邮件发送方式
+const (
+	MailDriverSMTP    = "smtp"
+	MailDriverConsole = "console"
+	MailDriverFile    = "file"
+)
+
+// MailConfig 邮件发送配置
+// Driver 为 smtp 时通过 SMTP 发送；为 console 时打印到标准输出；为 file 时写入 Dir 目录，后两者用于本地开发
+type MailConfig struct {
+	Driver string     `yaml:"driver"`
+	From   string     `yaml:"from"`
+	Dir    string     `yaml:"dir"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+}
+
+// SMTPConfig SMTP 服务器配置，Username 为空时不认证
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// AccountConfig 邮箱验证和找回密码配置
+// 邮件中的链接为 VerifyEmailURL、ResetPasswordURL 加上 token 参数，由前端页面取出 token 调用确认接口
+type AccountConfig struct {
+	VerifyEmailURL   string `yaml:"verify_email_url"`
+	ResetPasswordURL string `yaml:"reset_password_url"`
+	// TokenSecret 签名邮件中 token 的密钥
+	TokenSecret         string        `yaml:"token_secret"`
+	VerifyEmailExpire   time.Duration `yaml:"verify_email_expire"`
+	PasswordResetExpire time.Duration `yaml:"password_reset_expire"`
+	// ResendInterval 同一用户两次发送邮件的最短间隔
+	ResendInterval time.Duration `yaml:"resend_interval"`
+}
+
+// MFAConfig TOTP 二次验证配置
+// EncryptionKey 用于加密数据库中保存的 TOTP 密钥，修改后已绑定的验证器全部失效
+// RequireForAdmin 为 true 时 /admin 下的接口和 gRPC 中管理员的操作只接受登录时通过了二次验证的 token
+type MFAConfig struct {
+	Issuer          string `yaml:"issuer"`
+	EncryptionKey   string `yaml:"encryption_key"`
+	RequireForAdmin bool   `yaml:"require_for_admin"`
+}
+
+// LoginProtectionConfig 登录防暴力破解配置
+// 同一用户名或同一 IP 在 FailureWindow 内连续失败达到上限后锁定，锁定时长从 BaseLockout 开始每次失败翻倍，最长 MaxLockout
+type LoginProtectionConfig struct {
+	MaxFailures   int           `yaml:"max_failures"`
+	IPMaxFailures int           `yaml:"ip_max_failures"`
+	FailureWindow time.Duration `yaml:"failure_window"`
+	BaseLockout   time.Duration `yaml:"base_lockout"`
+	MaxLockout    time.Duration `yaml:"max_lockout"`
+}
+
+// RateLimitConfig 按客户端 IP 限制请求频率，AuthRequestsPerMinute 用于登录、注册、找回密码等未登录可用的接口
+type RateLimitConfig struct {
+	RequestsPerMinute     int `yaml:"requests_per_minute"`
+	AuthRequestsPerMinute int `yaml:"auth_requests_per_minute"`
+}
+
+// OIDCConfig 第三方登录（OpenID Connect）配置
+// StateExpire 为从跳转到身份提供方到回调之间的时限；Mock 为进程内的测试身份提供方，只用于本地开发和测试
+type OIDCConfig struct {
+	StateExpire time.Duration        `yaml:"state_expire"`
+	Providers   []OIDCProviderConfig `yaml:"providers"`
+	Mock        OIDCMockConfig       `yaml:"mock"`
+}
+
+// OIDCProviderConfig 一个身份提供方，Name 出现在登录和回调地址中
+// Issuer 用于获取 /.well-known/openid-configuration 并校验 id_token 的 iss；RedirectURL 必须与在身份提供方登记的回调地址一致
+// AllowSignup 为 true 时，没有关联账号的第三方用户登录时自动注册
+type OIDCProviderConfig struct {
+	Name         string   `yaml:"name"`
+	DisplayName  string   `yaml:"display_name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+	AllowSignup  bool     `yaml:"allow_signup"`
+}
+
+// OIDCMockConfig 进程内的测试身份提供方，开启后挂载在 Issuer 的路径下（默认为 /oidc/mock），Issuer 必须是对外的完整地址
+// 测试身份提供方不校验用户身份，任何人都能以任意用户登录，生产环境不要开启
+type OIDCMockConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+}
+
+// 授权策略变更的通知方式
+const (
+	RBACWatcherNone  = "none"
+	RBACWatcherRedis = "redis"
+)
+
+// RBACConfig 授权策略配置
+// 多实例部署时，Watcher 为 redis 时通过 Redis 的 Channel 通知其他实例重新加载策略；
+// ReloadInterval 大于0时每隔一段时间从数据库重新加载策略，用于没有 Redis 或消息丢失时兜底
+type RBACConfig struct {
+	Watcher        string        `yaml:"watcher"`
+	Channel        string        `yaml:"channel"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// Provider 按名称查找身份提供方
+func (o OIDCConfig) Provider(name string) (OIDCProviderConfig, bool) {
+	for _, p := range o.Providers {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return OIDCProviderConfig{}, false
+}
+
+// Addr 返回HTTP监听地址
+func (s ServerConfig) Addr() string {
+	return fmt.Sprintf(":%d", s.Port)
+}
+
+// GRPCAddr 返回gRPC监听地址
+func (s ServerConfig) GRPCAddr() string {
+	return fmt.Sprintf(":%d", s.GRPCPort)
+}
+
+// DSN 返回MySQL连接串
+func (d DatabaseConfig) DSN() string {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", d.User, d.Password, d.Host, d.Port, d.Name)
+	if d.Params != "" {
+		dsn += "?" + d.Params
+	}
+	return dsn
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:     8888,
+			GRPCPort: 50051,
+		},
+		Database: DatabaseConfig{
+			Host:   "127.0.0.1",
+			Port:   3306,
+			Name:   "qaqmall",
+			User:   "root",
+			Params: "charset=utf8mb4&parseTime=True&loc=Local",
+		},
+		JWT: JWTConfig{
+			Algorithm:          JWTAlgorithmHS256,
+			Expire:             15 * time.Minute,
+			RenewBefore:        5 * time.Minute,
+			RefreshExpire:      7 * 24 * time.Hour,
+			SessionMaxAge:      30 * 24 * time.Hour,
+			Issuer:             "qaqmall",
+			Audience:           "qaqmall",
+			Leeway:             30 * time.Second,
+			MFAChallengeExpire: 5 * time.Minute,
+		},
+		OpenAI: OpenAIConfig{
+			APIURL:      "https://api.openai.com/v1/chat/completions",
+			Model:       "gpt-3.5-turbo",
+			Temperature: 0.7,
+		},
+		LLM: LLMConfig{
+			Provider:     LLMProviderOpenAI,
+			Timeout:      30 * time.Second,
+			MaxRetries:   2,
+			RetryBackoff: 500 * time.Millisecond,
+			Ollama: OllamaConfig{
+				APIURL:      "http://localhost:11434/api/chat",
+				Model:       "qwen2.5",
+				Temperature: 0.7,
+			},
+			HistoryTokenBudget: 2000,
+		},
+		Retrieval: RetrievalConfig{
+			Index:           RetrievalIndexBM25,
+			Embedder:        EmbedderHash,
+			TopK:            8,
+			RefreshInterval: 10 * time.Minute,
+			Embedding: EmbeddingConfig{
+				APIURL:     "https://api.openai.com/v1/embeddings",
+				Model:      "text-embedding-3-small",
+				Dimensions: 256,
+			},
+		},
+		Guardrail: GuardrailConfig{
+			DailyTokenQuota: 200000,
+		},
+		Redis: RedisConfig{
+			Addr: "127.0.0.1:6379",
+		},
+		Revocation: RevocationConfig{
+			Backend:       RevocationBackendDB,
+			KeyPrefix:     "qaqmall:revoked:",
+			Cache:         true,
+			CacheSize:     10000,
+			SyncInterval:  30 * time.Second,
+			SweepInterval: 10 * time.Minute,
+		},
+		Mail: MailConfig{
+			Driver: MailDriverConsole,
+			From:   "qaqmall <no-reply@qaqmall.local>",
+			Dir:    "tmp/mail",
+			SMTP: SMTPConfig{
+				Port: 587,
+			},
+		},
+		Account: AccountConfig{
+			VerifyEmailURL:      "http://localhost:3000/verify-email",
+			ResetPasswordURL:    "http://localhost:3000/reset-password",
+			VerifyEmailExpire:   24 * time.Hour,
+			PasswordResetExpire: 30 * time.Minute,
+			ResendInterval:      time.Minute,
+		},
+		MFA: MFAConfig{
+			Issuer:          "qaqmall",
+			RequireForAdmin: true,
+		},
+		LoginProtection: LoginProtectionConfig{
+			MaxFailures:   5,
+			IPMaxFailures: 20,
+			FailureWindow: 15 * time.Minute,
+			BaseLockout:   time.Minute,
+			MaxLockout:    time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerMinute:     600,
+			AuthRequestsPerMinute: 20,
+		},
+		OIDC: OIDCConfig{
+			StateExpire: 10 * time.Minute,
+			Mock: OIDCMockConfig{
+				Issuer:   "http://localhost:8888/oidc/mock",
+				ClientID: "qaqmall",
+			},
+		},
+		RBAC: RBACConfig{
+			Watcher: RBACWatcherNone,
+			Channel: "qaqmall:casbin",
+		},
+	}
+}
+
+// Load 加载配置：默认值 -> 配置文件 -> 环境变量，最后进行校验
+// path 为空时使用 CONFIG_FILE 环境变量或默认路径，默认路径不存在时跳过文件加载
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	explicit := path != ""
+	if !explicit {
+		if envPath := os.Getenv("CONFIG_FILE"); envPath != "" {
+			path = envPath
+			explicit = true
+		} else {
+			path = DefaultConfigFile
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+		// 默认配置文件不存在时仅使用默认值和环境变量
+	default:
+		return nil, fmt.Errorf("读取配置文件 %s 失败: %v", path, err)
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// applyEnv 使用环境变量覆盖配置
+func (c *Config) applyEnv() error {
+	setString := func(key string, dst *string) {
+		if v, ok := os.LookupEnv(key); ok {
+			*dst = v
+		}
+	}
+	setInt := func(key string, dst *int) error {
+		if v, ok := os.LookupEnv(key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s 不是有效的整数: %v", key, err)
+			}
+			*dst = n
+		}
+		return nil
+	}
+	setDuration := func(key string, dst *time.Duration) error {
+		if v, ok := os.LookupEnv(key); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s 不是有效的时长: %v", key, err)
+			}
+			*dst = d
+		}
+		return nil
+	}
+
+	if err := setInt("SERVER_PORT", &c.Server.Port); err != nil {
+		return err
+	}
+	if err := setInt("GRPC_PORT", &c.Server.GRPCPort); err != nil {
+		return err
+	}
+	setString("GRPC_SERVICE_TOKEN", &c.Server.GRPCServiceToken)
+
+	setString("DB_HOST", &c.Database.Host)
+	if err := setInt("DB_PORT", &c.Database.Port); err != nil {
+		return err
+	}
+	setString("DB_NAME", &c.Database.Name)
+	setString("DB_USER", &c.Database.User)
+	setString("DB_PASSWORD", &c.Database.Password)
+	setString("DB_PARAMS", &c.Database.Params)
+
+	setString("JWT_ALGORITHM", &c.JWT.Algorithm)
+	setString("JWT_SECRET", &c.JWT.Secret)
+	setString("JWT_SIGNING_KEY", &c.JWT.SigningKey)
+	if err := setDuration("JWT_EXPIRE", &c.JWT.Expire); err != nil {
+		return err
+	}
+	if err := setDuration("JWT_RENEW_BEFORE", &c.JWT.RenewBefore); err != nil {
+		return err
+	}
+	if err := setDuration("JWT_REFRESH_EXPIRE", &c.JWT.RefreshExpire); err != nil {
+		return err
+	}
+	if err := setDuration("JWT_SESSION_MAX_AGE", &c.JWT.SessionMaxAge); err != nil {
+		return err
+	}
+	setString("JWT_ISSUER", &c.JWT.Issuer)
+	setString("JWT_AUDIENCE", &c.JWT.Audience)
+	if err := setDuration("JWT_LEEWAY", &c.JWT.Leeway); err != nil {
+		return err
+	}
+
+	setString("OPENAI_API_KEY", &c.OpenAI.APIKey)
+	setString("OPENAI_API_URL", &c.OpenAI.APIURL)
+	setString("OPENAI_MODEL", &c.OpenAI.Model)
+
+	setString("LLM_PROVIDER", &c.LLM.Provider)
+	if err := setDuration("LLM_TIMEOUT", &c.LLM.Timeout); err != nil {
+		return err
+	}
+	if err := setInt("LLM_MAX_RETRIES", &c.LLM.MaxRetries); err != nil {
+		return err
+	}
+	setString("OLLAMA_API_URL", &c.LLM.Ollama.APIURL)
+	setString("OLLAMA_MODEL", &c.LLM.Ollama.Model)
+	if err := setInt("LLM_HISTORY_TOKEN_BUDGET", &c.LLM.HistoryTokenBudget); err != nil {
+		return err
+	}
+
+	setString("RETRIEVAL_INDEX", &c.Retrieval.Index)
+	setString("RETRIEVAL_EMBEDDER", &c.Retrieval.Embedder)
+	if err := setInt("RETRIEVAL_TOP_K", &c.Retrieval.TopK); err != nil {
+		return err
+	}
+	setString("EMBEDDING_API_URL", &c.Retrieval.Embedding.APIURL)
+	setString("EMBEDDING_MODEL", &c.Retrieval.Embedding.Model)
+
+	if err := setInt("GUARDRAIL_DAILY_TOKEN_QUOTA", &c.Guardrail.DailyTokenQuota); err != nil {
+		return err
+	}
+
+	setString("REDIS_ADDR", &c.Redis.Addr)
+	setString("REDIS_PASSWORD", &c.Redis.Password)
+	if err := setInt("REDIS_DB", &c.Redis.DB); err != nil {
+		return err
+	}
+	setString("REVOCATION_BACKEND", &c.Revocation.Backend)
+
+	setString("MAIL_DRIVER", &c.Mail.Driver)
+	setString("MAIL_FROM", &c.Mail.From)
+	setString("SMTP_HOST", &c.Mail.SMTP.Host)
+	if err := setInt("SMTP_PORT", &c.Mail.SMTP.Port); err != nil {
+		return err
+	}
+	setString("SMTP_USERNAME", &c.Mail.SMTP.Username)
+	setString("SMTP_PASSWORD", &c.Mail.SMTP.Password)
+	setString("ACCOUNT_VERIFY_EMAIL_URL", &c.Account.VerifyEmailURL)
+	setString("ACCOUNT_RESET_PASSWORD_URL", &c.Account.ResetPasswordURL)
+	setString("ACCOUNT_TOKEN_SECRET", &c.Account.TokenSecret)
+
+	setString("MFA_ENCRYPTION_KEY", &c.MFA.EncryptionKey)
+	if v, ok := os.LookupEnv("MFA_REQUIRE_FOR_ADMIN"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("环境变量 MFA_REQUIRE_FOR_ADMIN 不是有效的布尔值: %v", err)
+		}
+		c.MFA.RequireForAdmin = b
+	}
+
+	if v, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		c.Server.TrustedProxies = nil
+		for _, proxy := range strings.Split(v, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				c.Server.TrustedProxies = append(c.Server.TrustedProxies, proxy)
+			}
+		}
+	}
+	if err := setInt("LOGIN_MAX_FAILURES", &c.LoginProtection.MaxFailures); err != nil {
+		return err
+	}
+	if err := setInt("LOGIN_IP_MAX_FAILURES", &c.LoginProtection.IPMaxFailures); err != nil {
+		return err
+	}
+	if err := setInt("RATE_LIMIT_REQUESTS_PER_MINUTE", &c.RateLimit.RequestsPerMinute); err != nil {
+		return err
+	}
+	if err := setInt("RATE_LIMIT_AUTH_REQUESTS_PER_MINUTE", &c.RateLimit.AuthRequestsPerMinute); err != nil {
+		return err
+	}
+
+	// 身份提供方的密钥按名称覆盖，例如 OIDC_GOOGLE_CLIENT_SECRET
+	for i := range c.OIDC.Providers {
+		p := &c.OIDC.Providers[i]
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(p.Name, "-", "_")) + "_"
+		setString(prefix+"CLIENT_ID", &p.ClientID)
+		setString(prefix+"CLIENT_SECRET", &p.ClientSecret)
+	}
+	if v, ok := os.LookupEnv("OIDC_MOCK_ENABLED"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("环境变量 OIDC_MOCK_ENABLED 不是有效的布尔值: %v", err)
+		}
+		c.OIDC.Mock.Enabled = b
+	}
+
+	setString("RBAC_WATCHER", &c.RBAC.Watcher)
+	if err := setDuration("RBAC_RELOAD_INTERVAL", &c.RBAC.ReloadInterval); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateKeys 校验非对称签名密钥的配置，未配置任何密钥时启动时会生成临时密钥
+func (j JWTConfig) validateKeys() []string {
+	if len(j.Keys) == 0 {
+		return nil
+	}
+
+	var problems []string
+	seen := make(map[string]bool, len(j.Keys))
+	signing := false
+	for i, k := range j.Keys {
+		if k.ID == "" {
+			problems = append(problems, fmt.Sprintf("jwt.keys[%d].kid 不能为空", i))
+			continue
+		}
+		if seen[k.ID] {
+			problems = append(problems, fmt.Sprintf("jwt.keys 中的 kid %s 重复", k.ID))
+		}
+		seen[k.ID] = true
+		if k.PrivateKeyFile == "" && k.PublicKeyFile == "" {
+			problems = append(problems, fmt.Sprintf("jwt.keys 中的 %s 必须配置 private_key_file 或 public_key_file", k.ID))
+		}
+		if k.ID == j.SigningKey {
+			if k.PrivateKeyFile == "" {
+				problems = append(problems, fmt.Sprintf("签名密钥 %s 必须配置 private_key_file", k.ID))
+			}
+			signing = true
+		}
+	}
+	if !signing {
+		problems = append(problems, "jwt.signing_key 必须是 jwt.keys 中的一个 kid")
+	}
+	return problems
+}
+
+// validate 校验第三方登录配置，名称只能包含小写字母、数字、- 和 _，用于拼接路由
+func (o OIDCConfig) validate() []string {
+	var problems []string
+	if o.StateExpire <= 0 {
+		problems = append(problems, "oidc.state_expire 必须大于0")
+	}
+	seen := make(map[string]bool, len(o.Providers))
+	for i, p := range o.Providers {
+		if p.Name == "" || strings.Trim(p.Name, "abcdefghijklmnopqrstuvwxyz0123456789-_") != "" {
+			problems = append(problems, fmt.Sprintf("oidc.providers[%d].name 只能包含小写字母、数字、- 和 _", i))
+			continue
+		}
+		if seen[p.Name] {
+			problems = append(problems, fmt.Sprintf("oidc.providers 中的 %s 重复", p.Name))
+		}
+		seen[p.Name] = true
+		if p.Issuer == "" {
+			problems = append(problems, fmt.Sprintf("oidc.providers 中 %s 的 issuer 不能为空", p.Name))
+		}
+		if p.ClientID == "" {
+			problems = append(problems, fmt.Sprintf("oidc.providers 中 %s 的 client_id 不能为空", p.Name))
+		}
+		if p.RedirectURL == "" {
+			problems = append(problems, fmt.Sprintf("oidc.providers 中 %s 的 redirect_url 不能为空", p.Name))
+		}
+	}
+	if o.Mock.Enabled {
+		if o.Mock.Issuer == "" {
+			problems = append(problems, "oidc.mock.issuer 不能为空")
+		}
+		if o.Mock.ClientID == "" {
+			problems = append(problems, "oidc.mock.client_id 不能为空")
+		}
+	}
+	return problems
+}
+
+// placeholderSecrets 示例配置和文档中出现过的占位值，密钥配置为这些值时校验失败
+var placeholderSecrets = map[string]bool{
+	"123456":                    true,
+	"xxx":                       true,
+	"sk-xxx":                    true,
+	"changeme":                  true,
+	"your-secret-key":           true,
+	"your-account-token-secret": true,
+	"your-mfa-encryption-key":   true,
+}
+
+// placeholderProblems 检查密钥是否仍是占位值
+func (c *Config) placeholderProblems() []string {
+	secrets := []struct {
+		name  string
+		value string
+	}{
+		{"database.password", c.Database.Password},
+		{"jwt.secret", c.JWT.Secret},
+		{"openai.api_key", c.OpenAI.APIKey},
+		{"mail.smtp.password", c.Mail.SMTP.Password},
+		{"account.token_secret", c.Account.TokenSecret},
+		{"mfa.encryption_key", c.MFA.EncryptionKey},
+	}
+	var problems []string
+	for _, s := range secrets {
+		if placeholderSecrets[strings.ToLower(strings.TrimSpace(s.value))] {
+			problems = append(problems, fmt.Sprintf("%s 不能使用示例中的占位值，请设置实际的密钥", s.name))
+		}
+	}
+	return problems
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		problems = append(problems, "server.port 必须在 1-65535 之间")
+	}
+	if c.Server.GRPCPort <= 0 || c.Server.GRPCPort > 65535 {
+		problems = append(problems, "server.grpc_port 必须在 1-65535 之间")
+	}
+	if c.Server.GRPCPort == c.Server.Port {
+		problems = append(problems, "server.grpc_port 不能与 server.port 相同")
+	}
+	if c.Server.GRPCServiceToken != "" && len(c.Server.GRPCServiceToken) < 32 {
+		problems = append(problems, "server.grpc_service_token 至少需要32个字符")
+	}
+	if c.Database.Host == "" {
+		problems = append(problems, "database.host 不能为空")
+	}
+	if c.Database.Port <= 0 || c.Database.Port > 65535 {
+		problems = append(problems, "database.port 必须在 1-65535 之间")
+	}
+	if c.Database.Name == "" {
+		problems = append(problems, "database.name 不能为空")
+	}
+	if c.Database.User == "" {
+		problems = append(problems, "database.user 不能为空")
+	}
+	switch c.JWT.Algorithm {
+	case JWTAlgorithmHS256:
+		if c.JWT.Secret == "" {
+			problems = append(problems, "jwt.secret 不能为空")
+		}
+	case JWTAlgorithmRS256, JWTAlgorithmEdDSA:
+		problems = append(problems, c.JWT.validateKeys()...)
+	default:
+		problems = append(problems, "jwt.algorithm 只能是 HS256、RS256 或 EdDSA")
+	}
+	if c.JWT.Expire <= 0 {
+		problems = append(problems, "jwt.expire 必须大于0")
+	}
+	if c.JWT.RenewBefore < 0 || c.JWT.RenewBefore >= c.JWT.Expire {
+		problems = append(problems, "jwt.renew_before 必须在 0 到 jwt.expire 之间")
+	}
+	if c.JWT.RefreshExpire <= c.JWT.Expire {
+		problems = append(problems, "jwt.refresh_expire 必须大于 jwt.expire")
+	}
+	if c.JWT.SessionMaxAge < c.JWT.RefreshExpire {
+		problems = append(problems, "jwt.session_max_age 不能小于 jwt.refresh_expire")
+	}
+	if c.JWT.Issuer == "" {
+		problems = append(problems, "jwt.issuer 不能为空")
+	}
+	if c.JWT.Audience == "" {
+		problems = append(problems, "jwt.audience 不能为空")
+	}
+	if c.JWT.Leeway < 0 || c.JWT.Leeway >= c.JWT.Expire {
+		problems = append(problems, "jwt.leeway 必须在 0 到 jwt.expire 之间")
+	}
+	if c.JWT.MFAChallengeExpire <= 0 {
+		problems = append(problems, "jwt.mfa_challenge_expire 必须大于0")
+	}
+	switch c.LLM.Provider {
+	case LLMProviderOpenAI:
+		if c.OpenAI.APIURL == "" {
+			problems = append(problems, "openai.api_url 不能为空")
+		}
+	case LLMProviderOllama:
+		if c.LLM.Ollama.APIURL == "" {
+			problems = append(problems, "llm.ollama.api_url 不能为空")
+		}
+	case LLMProviderFake:
+	default:
+		problems = append(problems, "llm.provider 只能是 openai、ollama 或 fake")
+	}
+	if c.LLM.Timeout <= 0 {
+		problems = append(problems, "llm.timeout 必须大于0")
+	}
+	if c.LLM.MaxRetries < 0 {
+		problems = append(problems, "llm.max_retries 不能小于0")
+	}
+	if c.LLM.RetryBackoff < 0 {
+		problems = append(problems, "llm.retry_backoff 不能小于0")
+	}
+	if c.LLM.HistoryTokenBudget < 0 {
+		problems = append(problems, "llm.history_token_budget 不能小于0")
+	}
+	switch c.Retrieval.Index {
+	case RetrievalIndexBM25:
+	case RetrievalIndexEmbedding:
+		switch c.Retrieval.Embedder {
+		case EmbedderHash:
+			if c.Retrieval.Embedding.Dimensions <= 0 {
+				problems = append(problems, "retrieval.embedding.dimensions 必须大于0")
+			}
+		case EmbedderOpenAI:
+			if c.Retrieval.Embedding.APIURL == "" {
+				problems = append(problems, "retrieval.embedding.api_url 不能为空")
+			}
+		default:
+			problems = append(problems, "retrieval.embedder 只能是 hash 或 openai")
+		}
+	default:
+		problems = append(problems, "retrieval.index 只能是 bm25 或 embedding")
+	}
+	if c.Retrieval.TopK <= 0 {
+		problems = append(problems, "retrieval.top_k 必须大于0")
+	}
+	if c.Retrieval.RefreshInterval < 0 {
+		problems = append(problems, "retrieval.refresh_interval 不能小于0")
+	}
+	if c.Guardrail.DailyTokenQuota < 0 {
+		problems = append(problems, "guardrail.daily_token_quota 不能小于0")
+	}
+	switch c.Revocation.Backend {
+	case RevocationBackendDB:
+	case RevocationBackendRedis:
+		if c.Redis.Addr == "" {
+			problems = append(problems, "redis.addr 不能为空")
+		}
+	default:
+		problems = append(problems, "revocation.backend 只能是 db 或 redis")
+	}
+	if c.Revocation.Cache {
+		if c.Revocation.CacheSize <= 0 {
+			problems = append(problems, "revocation.cache_size 必须大于0")
+		}
+		if c.Revocation.SyncInterval <= 0 {
+			problems = append(problems, "revocation.sync_interval 必须大于0")
+		}
+	}
+	if c.Revocation.SweepInterval <= 0 {
+		problems = append(problems, "revocation.sweep_interval 必须大于0")
+	}
+	switch c.Mail.Driver {
+	case MailDriverSMTP:
+		if c.Mail.SMTP.Host == "" {
+			problems = append(problems, "mail.smtp.host 不能为空")
+		}
+		if c.Mail.SMTP.Port <= 0 || c.Mail.SMTP.Port > 65535 {
+			problems = append(problems, "mail.smtp.port 必须在 1-65535 之间")
+		}
+	case MailDriverConsole:
+	case MailDriverFile:
+		if c.Mail.Dir == "" {
+			problems = append(problems, "mail.dir 不能为空")
+		}
+	default:
+		problems = append(problems, "mail.driver 只能是 smtp、console 或 file")
+	}
+	if c.Mail.From == "" {
+		problems = append(problems, "mail.from 不能为空")
+	}
+	if c.Account.VerifyEmailURL == "" {
+		problems = append(problems, "account.verify_email_url 不能为空")
+	}
+	if c.Account.ResetPasswordURL == "" {
+		problems = append(problems, "account.reset_password_url 不能为空")
+	}
+	if c.Account.TokenSecret == "" {
+		problems = append(problems, "account.token_secret 不能为空")
+	}
+	if c.Account.VerifyEmailExpire <= 0 {
+		problems = append(problems, "account.verify_email_expire 必须大于0")
+	}
+	if c.Account.PasswordResetExpire <= 0 {
+		problems = append(problems, "account.password_reset_expire 必须大于0")
+	}
+	if c.Account.ResendInterval < 0 {
+		problems = append(problems, "account.resend_interval 不能小于0")
+	}
+	if c.MFA.Issuer == "" {
+		problems = append(problems, "mfa.issuer 不能为空")
+	}
+	if c.MFA.EncryptionKey == "" {
+		problems = append(problems, "mfa.encryption_key 不能为空")
+	}
+	if c.LoginProtection.MaxFailures <= 0 {
+		problems = append(problems, "login_protection.max_failures 必须大于0")
+	}
+	if c.LoginProtection.IPMaxFailures <= 0 {
+		problems = append(problems, "login_protection.ip_max_failures 必须大于0")
+	}
+	if c.LoginProtection.FailureWindow <= 0 {
+		problems = append(problems, "login_protection.failure_window 必须大于0")
+	}
+	if c.LoginProtection.BaseLockout <= 0 {
+		problems = append(problems, "login_protection.base_lockout 必须大于0")
+	}
+	if c.LoginProtection.MaxLockout < c.LoginProtection.BaseLockout {
+		problems = append(problems, "login_protection.max_lockout 不能小于 login_protection.base_lockout")
+	}
+	if c.RateLimit.RequestsPerMinute <= 0 {
+		problems = append(problems, "rate_limit.requests_per_minute 必须大于0")
+	}
+	if c.RateLimit.AuthRequestsPerMinute <= 0 {
+		problems = append(problems, "rate_limit.auth_requests_per_minute 必须大于0")
+	}
+	problems = append(problems, c.OIDC.validate()...)
+	problems = append(problems, c.placeholderProblems()...)
+	switch c.RBAC.Watcher {
+	case RBACWatcherNone:
+	case RBACWatcherRedis:
+		if c.Redis.Addr == "" {
+			problems = append(problems, "redis.addr 不能为空")
+		}
+		if c.RBAC.Channel == "" {
+			problems = append(problems, "rbac.channel 不能为空")
+		}
+	default:
+		problems = append(problems, "rbac.watcher 只能是 none 或 redis")
+	}
+	if c.RBAC.ReloadInterval < 0 {
+		problems = append(problems, "rbac.reload_interval 不能小于0")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("配置校验失败: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -13,6 +13,9 @@ CREATE TABLE IF NOT EXISTS users (
     role VARCHAR(10) NOT NULL DEFAULT 'user',
     email VARCHAR(128),
     phone VARCHAR(20),
+    email_verified_at DATETIME(3) COMMENT '邮箱验证通过的时间，修改邮箱后清空',
+    token_version INT NOT NULL DEFAULT 0 COMMENT '递增后已签发的 access token 全部失效',
+    disabled_at DATETIME(3) COMMENT '被管理员禁用的时间，禁用期间不能登录',
     created_at DATETIME(3),
     updated_at DATETIME(3),
     deleted_at DATETIME(3),
@@ -22,17 +25,139 @@ CREATE TABLE IF NOT EXISTS users (
     INDEX idx_users_deleted_at (deleted_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
--- 创建token黑名单表
-CREATE TABLE IF NOT EXISTS token_blacklist (
+-- 已吊销的 access token，以 jti 为键，token 过期后由定时任务清除
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti VARCHAR(32) PRIMARY KEY,
+    expires_at DATETIME(3) NOT NULL,
+    created_at DATETIME(3),
+    INDEX idx_revoked_tokens_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- refresh token 表，只保存哈希
+CREATE TABLE IF NOT EXISTS refresh_tokens (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-    token VARCHAR(500) NOT NULL UNIQUE,
-    expired_at DATETIME(3) NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    family_id VARCHAR(32) NOT NULL COMMENT '同一次登录轮换出的 refresh token 属于同一个 family',
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at DATETIME(3) NOT NULL,
+    session_expires_at DATETIME(3) NOT NULL COMMENT '登录会话的最长有效期',
+    used_at DATETIME(3) COMMENT '已轮换的时间，再次使用视为盗用',
+    revoked_at DATETIME(3),
+    mfa TINYINT(1) NOT NULL DEFAULT 0 COMMENT '登录时是否通过了二次验证',
+    created_at DATETIME(3),
+    INDEX idx_refresh_tokens_user_id (user_id),
+    INDEX idx_refresh_tokens_family_id (family_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- TOTP 二次验证，enabled_at 为空表示已生成密钥但还没有确认绑定
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id BIGINT UNSIGNED PRIMARY KEY,
+    secret VARCHAR(255) NOT NULL COMMENT '使用 mfa.encryption_key 加密的 TOTP 密钥',
+    enabled_at DATETIME(3),
+    last_used_step BIGINT NOT NULL DEFAULT 0 COMMENT '最近一次通过验证的时间步，防止验证码重复使用',
+    failed_attempts INT NOT NULL DEFAULT 0,
+    locked_until DATETIME(3),
     created_at DATETIME(3),
     updated_at DATETIME(3),
-    deleted_at DATETIME(3),
-    INDEX idx_token_blacklist_token (token),
-    INDEX idx_token_blacklist_expired_at (expired_at),
-    INDEX idx_token_blacklist_deleted_at (deleted_at)
+    FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 二次验证恢复码，只保存哈希
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at DATETIME(3),
+    created_at DATETIME(3),
+    INDEX idx_mfa_recovery_codes_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 关联到用户的第三方账号（OpenID Connect）
+CREATE TABLE IF NOT EXISTS user_identities (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    provider VARCHAR(32) NOT NULL COMMENT '配置中身份提供方的 name',
+    subject VARCHAR(191) NOT NULL COMMENT 'id_token 中的 sub',
+    email VARCHAR(128) COMMENT '最近一次登录时身份提供方返回的邮箱',
+    last_login_at DATETIME(3),
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    UNIQUE INDEX idx_user_identities_provider_subject (provider, subject),
+    UNIQUE INDEX idx_user_identities_user_provider (user_id, provider),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 第三方登录跳转时保存的授权请求，回调时取出并删除
+CREATE TABLE IF NOT EXISTS oidc_states (
+    state_hash VARCHAR(64) NOT NULL PRIMARY KEY COMMENT 'state 的 SHA-256',
+    provider VARCHAR(32) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL COMMENT 'PKCE code_verifier',
+    user_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '关联第三方账号的用户，0 表示第三方登录',
+    expires_at DATETIME(3) NOT NULL,
+    created_at DATETIME(3),
+    INDEX idx_oidc_states_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 登录失败计数，按用户名和 IP 分别统计
+CREATE TABLE IF NOT EXISTS login_throttles (
+    throttle_key VARCHAR(191) NOT NULL PRIMARY KEY COMMENT 'user:用户名 | ip:地址',
+    failures INT NOT NULL DEFAULT 0 COMMENT '窗口内连续失败的次数',
+    last_failed_at DATETIME(3),
+    locked_until DATETIME(3) COMMENT '为空或早于当前时间表示未锁定',
+    updated_at DATETIME(3),
+    INDEX idx_login_throttles_locked_until (locked_until)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 安全事件表（登录锁定、解除锁定）
+CREATE TABLE IF NOT EXISTS security_events (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    type VARCHAR(32) NOT NULL COMMENT 'login_lockout | lockout_cleared',
+    username VARCHAR(191),
+    ip VARCHAR(64),
+    failures INT NOT NULL DEFAULT 0,
+    locked_until DATETIME(3),
+    operator_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '解除锁定的管理员ID',
+    detail VARCHAR(255),
+    created_at DATETIME(3),
+    INDEX idx_security_events_created_at (created_at),
+    INDEX idx_security_events_username (username),
+    INDEX idx_security_events_ip (ip)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 管理员操作的审计记录，与操作在同一个事务中写入
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    actor_id BIGINT UNSIGNED NOT NULL COMMENT '操作的管理员ID',
+    ip VARCHAR(64),
+    action VARCHAR(64) NOT NULL COMMENT 'user.disable | user.enable | user.logout | user.role_change | policy.add | policy.remove | role.link_add | role.link_remove | order.refund',
+    target_type VARCHAR(32) NOT NULL,
+    target_id VARCHAR(191) NOT NULL,
+    `before` TEXT COMMENT '操作前的状态（JSON）',
+    `after` TEXT COMMENT '操作后的状态（JSON）',
+    reason VARCHAR(255),
+    created_at DATETIME(3),
+    INDEX idx_audit_logs_created_at (created_at),
+    INDEX idx_audit_logs_actor_id (actor_id),
+    INDEX idx_audit_logs_action (action),
+    INDEX idx_audit_logs_target (target_type, target_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 邮箱验证和重置密码的一次性 token，只保存哈希
+CREATE TABLE IF NOT EXISTS account_tokens (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    purpose VARCHAR(20) NOT NULL COMMENT 'verify_email | reset_password',
+    email VARCHAR(128) NOT NULL COMMENT '发送的邮箱',
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at DATETIME(3) NOT NULL,
+    used_at DATETIME(3),
+    created_at DATETIME(3),
+    INDEX idx_account_tokens_user_id (user_id),
+    INDEX idx_account_tokens_expires_at (expires_at),
+    FOREIGN KEY (user_id) REFERENCES users(id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
 -- 创建商品分类表
@@ -67,6 +192,16 @@ CREATE TABLE IF NOT EXISTS products (
     FOREIGN KEY (category_id) REFERENCES categories(id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- 创建商品分类关联表
+CREATE TABLE IF NOT EXISTS product_categories (
+    product_id BIGINT UNSIGNED NOT NULL,
+    category_id BIGINT UNSIGNED NOT NULL,
+    PRIMARY KEY (product_id, category_id),
+    INDEX idx_product_categories_category (category_id),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (category_id) REFERENCES categories(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- 创建购物车表
 CREATE TABLE IF NOT EXISTS cart_items (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
@@ -121,6 +256,74 @@ CREATE TABLE IF NOT EXISTS system_logs (
     FOREIGN KEY (user_id) REFERENCES users(id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- 创建AI会话表
+CREATE TABLE IF NOT EXISTS conversations (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    title VARCHAR(100),
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    deleted_at DATETIME(3),
+    INDEX idx_conversations_user (user_id, updated_at),
+    INDEX idx_conversations_deleted_at (deleted_at),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建AI会话消息表
+CREATE TABLE IF NOT EXISTS messages (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    conversation_id BIGINT UNSIGNED NOT NULL,
+    role VARCHAR(20) NOT NULL COMMENT 'user 或 assistant',
+    content TEXT NOT NULL,
+    tokens INT NOT NULL DEFAULT 0 COMMENT '估算的token数，用于回放历史时控制预算',
+    created_at DATETIME(3),
+    INDEX idx_messages_conversation (conversation_id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建AI工具调用表（审计日志及待确认操作）
+CREATE TABLE IF NOT EXISTS ai_tool_calls (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    conversation_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '0 表示单次查询',
+    tool VARCHAR(50) NOT NULL,
+    arguments TEXT NOT NULL COMMENT '大模型给出的 JSON 参数',
+    status VARCHAR(20) NOT NULL COMMENT 'pending/executed/failed/rejected/expired',
+    result TEXT,
+    error VARCHAR(255),
+    expires_at DATETIME(3) COMMENT '待确认操作的过期时间',
+    executed_at DATETIME(3),
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    INDEX idx_ai_tool_calls_user_id (user_id),
+    INDEX idx_ai_tool_calls_status (status),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- AI审核记录表
+CREATE TABLE IF NOT EXISTS ai_moderation_events (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    source VARCHAR(20) NOT NULL COMMENT 'query/product/quota',
+    reason VARCHAR(100) NOT NULL COMMENT '拦截原因',
+    content TEXT COMMENT '被拦截的内容',
+    reviewed_at DATETIME(3),
+    reviewed_by BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '审核的管理员ID',
+    created_at DATETIME(3),
+    INDEX idx_ai_moderation_events_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- AI token 每日用量表
+CREATE TABLE IF NOT EXISTS ai_token_usage (
+    user_id BIGINT UNSIGNED NOT NULL,
+    day VARCHAR(10) NOT NULL COMMENT '日期，格式 2006-01-02',
+    tokens INT NOT NULL DEFAULT 0,
+    updated_at DATETIME(3),
+    PRIMARY KEY (user_id, day),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- 创建默认管理员账号
 INSERT INTO users (username, password, role, created_at, updated_at) 
 VALUES ('admin', '$2a$10$rV4Qp0lQHsYUqhd5ABqk6OyK4Yb8/oSE.f33Pba.XNhE3X8DYlA1O', 'admin', NOW(), NOW());
@@ -159,6 +362,19 @@ CREATE TABLE IF NOT EXISTS order_items (
     INDEX idx_product_id (product_id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='订单项表';
 
+-- 订单状态变化记录，与状态修改在同一个事务中写入
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    order_id BIGINT UNSIGNED NOT NULL COMMENT '订单ID',
+    from_status VARCHAR(20) NOT NULL COMMENT '变化前的状态，创建订单时为空',
+    to_status VARCHAR(20) NOT NULL COMMENT '变化后的状态',
+    actor_type VARCHAR(16) NOT NULL COMMENT 'user | admin | system',
+    actor_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '发起的用户ID，系统发起时为0',
+    reason VARCHAR(255) COMMENT '原因',
+    created_at DATETIME(3),
+    INDEX idx_order_status_history_order_id (order_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='订单状态变化记录';
+
 -- 支付记录表
 CREATE TABLE IF NOT EXISTS payments (
     id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
@@ -167,7 +383,7 @@ CREATE TABLE IF NOT EXISTS payments (
     user_id BIGINT UNSIGNED NOT NULL COMMENT '用户ID',
     amount DECIMAL(10,2) NOT NULL COMMENT '支付金额',
     payment_method VARCHAR(20) NOT NULL COMMENT '支付方式',
-    status VARCHAR(20) NOT NULL DEFAULT 'pending' COMMENT '支付状态',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' COMMENT '支付状态：pending、paid、cancelled、refunded、refund_pending（订单已取消，待退款）',
     paid_at DATETIME COMMENT '支付时间',
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
@@ -187,6 +403,9 @@ ALTER TABLE order_items
     ADD CONSTRAINT fk_order_items_order_id FOREIGN KEY (order_id) REFERENCES orders(id),
     ADD CONSTRAINT fk_order_items_product_id FOREIGN KEY (product_id) REFERENCES products(id);
 
+ALTER TABLE order_status_history
+    ADD CONSTRAINT fk_order_status_history_order_id FOREIGN KEY (order_id) REFERENCES orders(id);
+
 ALTER TABLE payments
     ADD CONSTRAINT fk_payments_order_id FOREIGN KEY (order_id) REFERENCES orders(id),
     ADD CONSTRAINT fk_payments_user_id FOREIGN KEY (user_id) REFERENCES users(id);
\ No newline at end of file
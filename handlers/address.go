@@ -1,21 +1,22 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 
+	"qaqmall/internal/service/address"
 	"qaqmall/models"
 )
 
 type AddressHandler struct {
-	db *gorm.DB
+	addresses *address.AddressService
 }
 
-func NewAddressHandler(db *gorm.DB) *AddressHandler {
-	return &AddressHandler{db: db}
+func NewAddressHandler(addresses *address.AddressService) *AddressHandler {
+	return &AddressHandler{addresses: addresses}
 }
 
 func (h *AddressHandler) ListAddresses(c *gin.Context) {
@@ -25,8 +26,8 @@ func (h *AddressHandler) ListAddresses(c *gin.Context) {
 		return
 	}
 
-	var addresses []models.Address
-	if err := h.db.Where("user_id = ?", userID).Find(&addresses).Error; err != nil {
+	addresses, err := h.addresses.List(c.Request.Context(), userID.(uint64))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取地址列表失败"})
 		return
 	}
@@ -34,6 +35,29 @@ func (h *AddressHandler) ListAddresses(c *gin.Context) {
 	c.JSON(http.StatusOK, addresses)
 }
 
+// GetAddress 获取地址详情
+func (h *AddressHandler) GetAddress(c *gin.Context) {
+	sub, ok := authzSubject(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	addressID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的地址ID"})
+		return
+	}
+
+	addr, err := h.addresses.Get(c.Request.Context(), sub, addressID)
+	if err != nil {
+		h.handleError(c, err, "获取地址失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, addr)
+}
+
 func (h *AddressHandler) CreateAddress(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -41,32 +65,24 @@ func (h *AddressHandler) CreateAddress(c *gin.Context) {
 		return
 	}
 
-	var address models.Address
-	if err := c.ShouldBindJSON(&address); err != nil {
+	var req models.Address
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
 		return
 	}
 
-	address.UserID = userID.(uint64)
-
-	// 如果是第一个地址，设为默认地址
-	var count int64
-	h.db.Model(&models.Address{}).Where("user_id = ?", userID).Count(&count)
-	if count == 0 {
-		address.IsDefault = true
-	}
-
-	if err := h.db.Create(&address).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建地址失败"})
+	addr, err := h.addresses.Create(c.Request.Context(), userID.(uint64), addressInput(&req))
+	if err != nil {
+		h.handleError(c, err, "创建地址失败")
 		return
 	}
 
-	c.JSON(http.StatusOK, address)
+	c.JSON(http.StatusOK, addr)
 }
 
 func (h *AddressHandler) UpdateAddress(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
+	sub, ok := authzSubject(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
 		return
 	}
@@ -77,31 +93,31 @@ func (h *AddressHandler) UpdateAddress(c *gin.Context) {
 		return
 	}
 
-	var address models.Address
-	if err := h.db.Where("id = ? AND user_id = ?", addressID, userID).First(&address).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "地址不存在"})
+	// 未传的字段保持原值
+	existing, err := h.addresses.Get(c.Request.Context(), sub, addressID)
+	if err != nil {
+		h.handleError(c, err, "更新地址失败")
 		return
 	}
 
-	if err := c.ShouldBindJSON(&address); err != nil {
+	if err := c.ShouldBindJSON(existing); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
 		return
 	}
 
-	address.ID = addressID
-	address.UserID = userID.(uint64)
-
-	if err := h.db.Save(&address).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新地址失败"})
+	addr, err := h.addresses.Update(c.Request.Context(), sub, addressID, addressInput(existing))
+	if err != nil {
+		h.handleError(c, err, "更新地址失败")
 		return
 	}
 
-	c.JSON(http.StatusOK, address)
+	c.JSON(http.StatusOK, addr)
 }
 
-func (h *AddressHandler) DeleteAddress(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
+// SetDefaultAddress 设置默认地址
+func (h *AddressHandler) SetDefaultAddress(c *gin.Context) {
+	sub, ok := authzSubject(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
 		return
 	}
@@ -112,15 +128,61 @@ func (h *AddressHandler) DeleteAddress(c *gin.Context) {
 		return
 	}
 
-	result := h.db.Where("id = ? AND user_id = ?", addressID, userID).Delete(&models.Address{})
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除地址失败"})
+	addr, err := h.addresses.SetDefault(c.Request.Context(), sub, addressID)
+	if err != nil {
+		h.handleError(c, err, "设置默认地址失败")
 		return
 	}
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "地址不存在"})
+
+	c.JSON(http.StatusOK, addr)
+}
+
+func (h *AddressHandler) DeleteAddress(c *gin.Context) {
+	sub, ok := authzSubject(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	addressID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的地址ID"})
+		return
+	}
+
+	if err := h.addresses.Delete(c.Request.Context(), sub, addressID); err != nil {
+		h.handleError(c, err, "删除地址失败")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "地址已删除"})
 }
+
+// handleError 将地址服务的错误转换为HTTP响应
+func (h *AddressHandler) handleError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, address.ErrAddressNotFound), errors.Is(err, address.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, address.ErrAddressForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, address.ErrInvalidAddress):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+func addressInput(a *models.Address) address.AddressInput {
+	return address.AddressInput{
+		Name:       a.Name,
+		Phone:      a.Phone,
+		Province:   a.Province,
+		City:       a.City,
+		District:   a.District,
+		Street:     a.Street,
+		Detail:     a.Detail,
+		PostalCode: a.PostalCode,
+		Tag:        a.Tag,
+		IsDefault:  a.IsDefault,
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/audit"
+	"qaqmall/internal/service/order"
+	"qaqmall/models"
+)
+
+// AdminOrderHandler 管理后台和客服查看订单、发货、退款
+type AdminOrderHandler struct {
+	orders *order.OrderService
+}
+
+func NewAdminOrderHandler(orders *order.OrderService) *AdminOrderHandler {
+	return &AdminOrderHandler{orders: orders}
+}
+
+// ListOrders 分页查询所有用户的订单，可按用户、状态和订单号过滤
+func (h *AdminOrderHandler) ListOrders(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	userID, _ := strconv.ParseUint(c.Query("user_id"), 10, 64)
+
+	orders, total, err := h.orders.AdminList(c.Request.Context(), order.AdminListQuery{
+		Pagination:  pagination.Pagination{Page: page, PageSize: pageSize},
+		UserID:      userID,
+		Status:      models.OrderStatus(c.Query("status")),
+		OrderNumber: c.Query("order_number"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": orders,
+	})
+}
+
+// GetOrder 查看任意用户的订单详情
+func (h *AdminOrderHandler) GetOrder(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	o, err := h.orders.AdminGet(c.Request.Context(), orderID)
+	if err != nil {
+		if errors.Is(err, order.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// Refund 对已支付或已发货的订单全额退款
+func (h *AdminOrderHandler) Refund(c *gin.Context) {
+	var req struct {
+		OrderID uint64 `json:"order_id" binding:"required"`
+		Reason  string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数", "details": err.Error()})
+		return
+	}
+
+	o, err := h.orders.Refund(c.Request.Context(), auditActor(c), req.OrderID, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, order.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, order.ErrOrderNotRefundable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "退款失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// ShipOrder 将已支付的订单标记为已发货
+func (h *AdminOrderHandler) ShipOrder(c *gin.Context) {
+	h.transition(c, h.orders.Ship, "发货失败")
+}
+
+// CompleteOrder 将已发货的订单标记为已完成
+func (h *AdminOrderHandler) CompleteOrder(c *gin.Context) {
+	h.transition(c, h.orders.Complete, "完成订单失败")
+}
+
+// GetOrderHistory 查看订单的状态变化记录
+func (h *AdminOrderHandler) GetOrderHistory(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	history, err := h.orders.History(c.Request.Context(), orderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单状态记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": len(history),
+		"items": history,
+	})
+}
+
+// transition 修改订单状态，请求体 {"reason": "..."} 可以省略
+func (h *AdminOrderHandler) transition(c *gin.Context, change func(context.Context, audit.Actor, uint64, string) (*models.Order, error), fallback string) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+	var req struct {
+		Reason string `json:"reason" binding:"max=255"`
+	}
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	o, err := change(c.Request.Context(), auditActor(c), orderID, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, order.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, order.ErrInvalidTransition):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
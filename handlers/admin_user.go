@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/audit"
+	"qaqmall/internal/service/user"
+)
+
+// AdminUserHandler 管理后台的用户管理，所有修改都会写入审计记录
+type AdminUserHandler struct {
+	users *user.UserService
+}
+
+func NewAdminUserHandler(users *user.UserService) *AdminUserHandler {
+	return &AdminUserHandler{users: users}
+}
+
+// ListUsers 分页查询用户，支持按用户名、邮箱、手机号搜索和按角色、状态过滤
+func (h *AdminUserHandler) ListUsers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+	users, total, err := h.users.List(c.Request.Context(), user.ListQuery{
+		Pagination: pagination.Pagination{Page: page, PageSize: pageSize},
+		Search:     c.Query("search"),
+		Role:       c.Query("role"),
+		Status:     c.Query("status"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": users,
+	})
+}
+
+// GetUser 查看用户详情
+func (h *AdminUserHandler) GetUser(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+
+	detail, err := h.users.AdminGet(c.Request.Context(), userID)
+	if err != nil {
+		h.error(c, err, "获取用户信息失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// DisableUser 禁用用户，用户随即在所有设备上退出登录
+func (h *AdminUserHandler) DisableUser(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	u, err := h.users.Disable(c.Request.Context(), auditActor(c), userID, req.Reason)
+	if err != nil {
+		h.error(c, err, "禁用用户失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+// EnableUser 解除禁用
+func (h *AdminUserHandler) EnableUser(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	u, err := h.users.Enable(c.Request.Context(), auditActor(c), userID, req.Reason)
+	if err != nil {
+		h.error(c, err, "启用用户失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+// LogoutUser 强制用户在所有设备上退出登录
+func (h *AdminUserHandler) LogoutUser(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	if err := h.users.ForceLogout(c.Request.Context(), auditActor(c), userID, req.Reason); err != nil {
+		h.error(c, err, "强制退出登录失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已使该用户在所有设备上退出登录"})
+}
+
+// ChangeRole 修改用户角色，用户需要重新登录才能使用新角色
+func (h *AdminUserHandler) ChangeRole(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Role   string `json:"role" binding:"required"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数", "details": err.Error()})
+		return
+	}
+
+	u, err := h.users.ChangeRole(c.Request.Context(), auditActor(c), userID, req.Role, req.Reason)
+	if err != nil {
+		h.error(c, err, "修改角色失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+func (h *AdminUserHandler) userID(c *gin.Context) (uint64, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func (h *AdminUserHandler) error(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, user.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, user.ErrCannotModifySelf), errors.Is(err, user.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// auditActor 当前登录的管理员，用于写入审计记录
+func auditActor(c *gin.Context) audit.Actor {
+	return audit.Actor{UserID: c.GetUint64("user_id"), IP: c.ClientIP()}
+}
+
+// bindOptionalJSON 解析可以省略的请求体，请求体为空时保留默认值
+func bindOptionalJSON(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindJSON(obj); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数", "details": err.Error()})
+		return false
+	}
+	return true
+}
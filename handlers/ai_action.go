@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/aitool"
+	"qaqmall/models"
+)
+
+// ListActions 获取AI助手发起的、等待当前用户确认的操作
+func (h *AIQueryHandler) ListActions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	actions, err := h.tools.ListPending(c.Request.Context(), userID.(uint64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取待确认操作失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, actions)
+}
+
+// ConfirmAction 确认并执行AI助手发起的操作，执行结果在返回记录的 status、result 和 error 中
+func (h *AIQueryHandler) ConfirmAction(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	actionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的操作ID"})
+		return
+	}
+
+	action, err := h.tools.Confirm(c.Request.Context(), userID.(uint64), actionID)
+	if err != nil {
+		h.handleActionError(c, err, "执行操作失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, action)
+}
+
+// RejectAction 拒绝AI助手发起的操作
+func (h *AIQueryHandler) RejectAction(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	actionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的操作ID"})
+		return
+	}
+
+	action, err := h.tools.Reject(c.Request.Context(), userID.(uint64), actionID)
+	if err != nil {
+		h.handleActionError(c, err, "拒绝操作失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, action)
+}
+
+// ListToolCalls 管理员查询AI工具调用的审计日志
+func (h *AIQueryHandler) ListToolCalls(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	userID, _ := strconv.ParseUint(c.Query("user_id"), 10, 64)
+
+	calls, total, err := h.tools.ListAudit(c.Request.Context(), aitool.AuditQuery{
+		Pagination: pagination.Pagination{Page: page, PageSize: pageSize},
+		UserID:     userID,
+		Tool:       c.Query("tool"),
+		Status:     models.AIToolCallStatus(c.Query("status")),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取工具调用记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": calls,
+	})
+}
+
+// handleActionError 将待确认操作的错误转换为HTTP响应
+func (h *AIQueryHandler) handleActionError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, aitool.ErrActionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, aitool.ErrActionNotPending), errors.Is(err, aitool.ErrActionExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
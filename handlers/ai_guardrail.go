@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/guardrail"
+)
+
+// GetUsage 获取当前用户当天的AI token 用量和额度
+func (h *AIQueryHandler) GetUsage(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	usage, err := h.guard.Usage(c.Request.Context(), userID.(uint64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取AI使用额度失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// ListModerationEvents 管理员查询被拦截的AI请求
+func (h *AIQueryHandler) ListModerationEvents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	userID, _ := strconv.ParseUint(c.Query("user_id"), 10, 64)
+	unreviewed, _ := strconv.ParseBool(c.Query("unreviewed"))
+
+	events, total, err := h.guard.ListEvents(c.Request.Context(), guardrail.EventQuery{
+		Pagination: pagination.Pagination{Page: page, PageSize: pageSize},
+		UserID:     userID,
+		Source:     c.Query("source"),
+		Unreviewed: unreviewed,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审核记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": events,
+	})
+}
+
+// ReviewModerationEvent 管理员将被拦截的AI请求标记为已审核
+func (h *AIQueryHandler) ReviewModerationEvent(c *gin.Context) {
+	reviewerID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	eventID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的记录ID"})
+		return
+	}
+
+	event, err := h.guard.Review(c.Request.Context(), eventID, reviewerID.(uint64))
+	if err != nil {
+		switch {
+		case errors.Is(err, guardrail.ErrEventNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, guardrail.ErrAlreadyReviewed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "审核失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/audit"
+)
+
+type AuditHandler struct {
+	audit *audit.AuditService
+}
+
+func NewAuditHandler(auditService *audit.AuditService) *AuditHandler {
+	return &AuditHandler{audit: auditService}
+}
+
+// ListLogs 管理员查询审计记录，可按操作人、操作和操作对象过滤
+func (h *AuditHandler) ListLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	actorID, _ := strconv.ParseUint(c.Query("actor_id"), 10, 64)
+
+	logs, total, err := h.audit.List(c.Request.Context(), audit.Query{
+		Pagination: pagination.Pagination{Page: page, PageSize: pageSize},
+		ActorID:    actorID,
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": logs,
+	})
+}
@@ -1,21 +1,21 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 
-	"qaqmall/models"
+	"qaqmall/internal/service/cart"
 )
 
 type CartHandler struct {
-	db *gorm.DB
+	carts *cart.CartService
 }
 
-func NewCartHandler(db *gorm.DB) *CartHandler {
-	return &CartHandler{db: db}
+func NewCartHandler(carts *cart.CartService) *CartHandler {
+	return &CartHandler{carts: carts}
 }
 
 func (h *CartHandler) ListCart(c *gin.Context) {
@@ -25,8 +25,8 @@ func (h *CartHandler) ListCart(c *gin.Context) {
 		return
 	}
 
-	var cartItems []models.CartItem
-	if err := h.db.Where("user_id = ?", userID).Find(&cartItems).Error; err != nil {
+	cartItems, err := h.carts.List(c.Request.Context(), userID.(uint64))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取购物车失败"})
 		return
 	}
@@ -36,6 +36,25 @@ func (h *CartHandler) ListCart(c *gin.Context) {
 	})
 }
 
+// CountCart 获取购物车商品总件数，用于页头角标
+func (h *CartHandler) CountCart(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	count, err := h.carts.Count(c.Request.Context(), userID.(uint64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取购物车商品数量失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count": count,
+	})
+}
+
 func (h *CartHandler) AddToCart(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -52,38 +71,9 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 		return
 	}
 
-	// 检查商品是否存在
-	var product models.Product
-	if err := h.db.First(&product, req.ProductID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "商品不存在"})
-		return
-	}
-
-	// 检查购物车中是否已存在该商品
-	var existingItem models.CartItem
-	if err := h.db.Where("user_id = ? AND product_id = ?", userID, req.ProductID).First(&existingItem).Error; err == nil {
-		// 如果存在，更新数量
-		existingItem.Quantity += req.Quantity
-		if err := h.db.Save(&existingItem).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新购物车失败"})
-			return
-		}
-		c.JSON(http.StatusOK, existingItem)
-		return
-	}
-
-	// 如果不存在，创建新记录
-	item := models.CartItem{
-		UserID:       userID.(uint64),
-		ProductID:    req.ProductID,
-		Quantity:     req.Quantity,
-		ProductName:  product.Name,
-		Price:        product.Price,
-		ProductImage: product.ImageURL,
-		Selected:     true,
-	}
-	if err := h.db.Create(&item).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加到购物车失败"})
+	item, err := h.carts.Add(c.Request.Context(), userID.(uint64), req.ProductID, req.Quantity)
+	if err != nil {
+		h.handleError(c, err, "添加到购物车失败")
 		return
 	}
 
@@ -112,17 +102,9 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 		return
 	}
 
-	var item models.CartItem
-	if err := h.db.Where("id = ? AND user_id = ?", itemID, userID).First(&item).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "购物车项不存在"})
-		return
-	}
-
-	item.Quantity = updateInfo.Quantity
-	item.Selected = updateInfo.Selected
-
-	if err := h.db.Save(&item).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新购物车失败"})
+	item, err := h.carts.Update(c.Request.Context(), userID.(uint64), itemID, updateInfo.Quantity, updateInfo.Selected)
+	if err != nil {
+		h.handleError(c, err, "更新购物车失败")
 		return
 	}
 
@@ -142,13 +124,8 @@ func (h *CartHandler) RemoveFromCart(c *gin.Context) {
 		return
 	}
 
-	result := h.db.Where("id = ? AND user_id = ?", itemID, userID).Delete(&models.CartItem{})
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除购物车项失败"})
-		return
-	}
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "购物车项不存在"})
+	if err := h.carts.Remove(c.Request.Context(), userID.(uint64), itemID); err != nil {
+		h.handleError(c, err, "删除购物车项失败")
 		return
 	}
 
@@ -162,11 +139,22 @@ func (h *CartHandler) EmptyCart(c *gin.Context) {
 		return
 	}
 
-	result := h.db.Where("user_id = ?", userID).Delete(&models.CartItem{})
-	if result.Error != nil {
+	if err := h.carts.Clear(c.Request.Context(), userID.(uint64)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "清空购物车失败"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "购物车已清空"})
 }
+
+// handleError 将购物车服务的错误转换为HTTP响应
+func (h *CartHandler) handleError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, cart.ErrProductNotFound), errors.Is(err, cart.ErrCartItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, cart.ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/llm"
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/conversation"
+	"qaqmall/internal/service/guardrail"
+)
+
+// CreateConversation 创建AI会话
+func (h *AIQueryHandler) CreateConversation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	var req struct {
+		Title string `json:"title"`
+	}
+	// 请求体可以为空
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+			return
+		}
+	}
+
+	conv, err := h.conversations.Create(c.Request.Context(), userID.(uint64), req.Title)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, conv)
+}
+
+// ListConversations 获取AI会话列表
+func (h *AIQueryHandler) ListConversations(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+	conversations, total, err := h.conversations.List(c.Request.Context(), userID.(uint64), conversation.ListQuery{
+		Pagination: pagination.Pagination{Page: page, PageSize: pageSize},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": conversations,
+	})
+}
+
+// GetConversation 获取AI会话及全部消息
+func (h *AIQueryHandler) GetConversation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的会话ID"})
+		return
+	}
+
+	conv, err := h.conversations.Get(c.Request.Context(), userID.(uint64), conversationID)
+	if err != nil {
+		h.handleConversationError(c, err, "获取会话失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, conv)
+}
+
+// ContinueConversation 在会话中继续提问，最近的历史消息会在 token 预算内回放给大模型
+func (h *AIQueryHandler) ContinueConversation(c *gin.Context) {
+	userID, conversationID, req, history, ok := h.prepareTurn(c)
+	if !ok {
+		return
+	}
+
+	allow := guardrail.Intent(req.Query)
+	messages := h.buildMessages(c.Request.Context(), userID, req.Query, history, allow)
+	resp, pending, err := h.chat(c.Request.Context(), userID, conversationID, messages, allow)
+	if err != nil {
+		log.Printf("调用AI服务失败 provider=%s: %v", h.llm.Name(), err)
+		status, message := chatError(err)
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	if err := h.conversations.AppendTurn(c.Request.Context(), userID, conversationID, req.Query, resp); err != nil {
+		h.handleConversationError(c, err, "保存会话失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversation_id": conversationID,
+		"answer":          resp.Content,
+		"usage":           resp.Usage,
+		"pending_actions": pending,
+	})
+}
+
+// ContinueConversationStream 流式继续会话，事件格式与 /ai/query/stream 相同，回答完整结束后才会保存
+func (h *AIQueryHandler) ContinueConversationStream(c *gin.Context) {
+	userID, conversationID, req, history, ok := h.prepareTurn(c)
+	if !ok {
+		return
+	}
+
+	allow := guardrail.Intent(req.Query)
+	resp, ok := h.stream(c, userID, h.buildMessages(c.Request.Context(), userID, req.Query, history, allow), allow)
+	if !ok {
+		return
+	}
+
+	if err := h.conversations.AppendTurn(c.Request.Context(), userID, conversationID, req.Query, resp); err != nil {
+		log.Printf("保存会话失败 conversation_id=%d: %v", conversationID, err)
+		c.SSEvent("error", gin.H{"error": "保存会话失败"})
+		c.Writer.Flush()
+		return
+	}
+
+	c.SSEvent("done", gin.H{
+		"conversation_id": conversationID,
+		"model":           resp.Model,
+		"usage":           resp.Usage,
+	})
+	c.Writer.Flush()
+}
+
+// DeleteConversation 删除AI会话及其消息
+func (h *AIQueryHandler) DeleteConversation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的会话ID"})
+		return
+	}
+
+	if err := h.conversations.Delete(c.Request.Context(), userID.(uint64), conversationID); err != nil {
+		h.handleConversationError(c, err, "删除会话失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "会话已删除"})
+}
+
+// prepareTurn 解析继续会话的请求、检查额度和问题内容并加载需要回放的历史消息，失败时已写入响应
+func (h *AIQueryHandler) prepareTurn(c *gin.Context) (uint64, uint64, aiQueryRequest, []llm.Message, bool) {
+	var req aiQueryRequest
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return 0, 0, req, nil, false
+	}
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的会话ID"})
+		return 0, 0, req, nil, false
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return 0, 0, req, nil, false
+	}
+
+	if !h.admit(c, userID.(uint64), req.Query) {
+		return 0, 0, req, nil, false
+	}
+
+	history, err := h.conversations.History(c.Request.Context(), userID.(uint64), conversationID)
+	if err != nil {
+		h.handleConversationError(c, err, "获取会话失败")
+		return 0, 0, req, nil, false
+	}
+
+	return userID.(uint64), conversationID, req, history, true
+}
+
+// handleConversationError 将会话服务的错误转换为HTTP响应
+func (h *AIQueryHandler) handleConversationError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, conversation.ErrConversationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/oidc"
+	"qaqmall/internal/service/identity"
+	"qaqmall/internal/service/user"
+)
+
+type IdentityHandler struct {
+	identities *identity.IdentityService
+}
+
+func NewIdentityHandler(identities *identity.IdentityService) *IdentityHandler {
+	return &IdentityHandler{identities: identities}
+}
+
+// ListProviders 列出可用的第三方登录方式
+func (h *IdentityHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": h.identities.Providers(),
+	})
+}
+
+// Login 跳转到身份提供方开始第三方登录，login_hint 会转发给身份提供方
+func (h *IdentityHandler) Login(c *gin.Context) {
+	authURL, err := h.identities.AuthorizationURL(c.Request.Context(), c.Param("provider"), 0, c.Query("login_hint"))
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback 身份提供方登录完成后的回调，第三方登录时响应与用户名密码登录相同
+func (h *IdentityHandler) Callback(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "第三方登录未完成",
+			"details": errCode + " " + c.Query("error_description"),
+		})
+		return
+	}
+
+	result, err := h.identities.Callback(c.Request.Context(), c.Param("provider"), c.Query("state"), c.Query("code"))
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+
+	if result.Linked {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "关联成功",
+			"data":    result.Identity,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, loginResponse(result.Login))
+}
+
+// ListIdentities 查询当前用户关联的第三方账号
+func (h *IdentityHandler) ListIdentities(c *gin.Context) {
+	identities, err := h.identities.List(c.Request.Context(), c.GetUint64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "获取第三方账号失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": identities,
+	})
+}
+
+// Link 为当前用户关联第三方账号，返回身份提供方的授权地址，由前端跳转，完成后回调到 Callback
+func (h *IdentityHandler) Link(c *gin.Context) {
+	authURL, err := h.identities.AuthorizationURL(c.Request.Context(), c.Param("provider"), c.GetUint64("user_id"), c.Query("login_hint"))
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"authorization_url": authURL,
+		},
+	})
+}
+
+// Unlink 解除当前用户与身份提供方的关联
+func (h *IdentityHandler) Unlink(c *gin.Context) {
+	if err := h.identities.Unlink(c.Request.Context(), c.GetUint64("user_id"), c.Param("provider")); err != nil {
+		h.error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已解除关联",
+	})
+}
+
+// error 将第三方登录的错误转换为响应
+func (h *IdentityHandler) error(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	message := "第三方登录失败"
+	switch {
+	case errors.Is(err, identity.ErrUnknownProvider), errors.Is(err, identity.ErrIdentityNotFound), errors.Is(err, user.ErrUserNotFound):
+		status, message = http.StatusNotFound, err.Error()
+	case errors.Is(err, identity.ErrInvalidState), errors.Is(err, identity.ErrLastLoginMethod):
+		status, message = http.StatusBadRequest, err.Error()
+	case errors.Is(err, identity.ErrSignupDisabled), errors.Is(err, user.ErrUserDisabled):
+		status, message = http.StatusForbidden, err.Error()
+	case errors.Is(err, identity.ErrEmailInUse), errors.Is(err, identity.ErrIdentityLinked), errors.Is(err, identity.ErrProviderLinked):
+		status, message = http.StatusConflict, err.Error()
+	case errors.Is(err, oidc.ErrDiscovery), errors.Is(err, oidc.ErrExchange), errors.Is(err, oidc.ErrInvalidIDToken):
+		status, message = http.StatusBadGateway, "身份提供方验证失败"
+	}
+	if status >= http.StatusInternalServerError {
+		log.Printf("第三方登录失败 provider=%s: %v", c.Param("provider"), err)
+	}
+
+	c.JSON(status, gin.H{
+		"code":  status,
+		"error": message,
+	})
+}
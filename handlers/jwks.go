@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/service/auth"
+)
+
+type KeyHandler struct {
+	tokens *auth.TokenService
+}
+
+func NewKeyHandler(tokens *auth.TokenService) *KeyHandler {
+	return &KeyHandler{tokens: tokens}
+}
+
+// JWKS 公开校验token使用的公钥，其他服务可以据此离线校验token
+func (h *KeyHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.tokens.Keys().JWKS())
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/service/mfa"
+)
+
+type MFAHandler struct {
+	mfa *mfa.MFAService
+}
+
+func NewMFAHandler(mfaService *mfa.MFAService) *MFAHandler {
+	return &MFAHandler{mfa: mfaService}
+}
+
+// GetStatus 查询当前用户的二次验证状态
+func (h *MFAHandler) GetStatus(c *gin.Context) {
+	status, err := h.mfa.Status(c.Request.Context(), c.GetUint64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "查询二次验证状态失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"enabled":                  status.Enabled,
+			"enabled_at":               status.EnabledAt,
+			"recovery_codes_remaining": status.RecoveryCodesRemaining,
+		},
+	})
+}
+
+// Enroll 生成 TOTP 密钥，返回的 otpauth_uri 由前端渲染为二维码
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	enrollment, err := h.mfa.Enroll(c.Request.Context(), c.GetUint64("user_id"))
+	if err != nil {
+		respondMFAError(c, err, "生成二次验证密钥失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "请使用验证器扫描二维码，并提交验证器上的验证码完成绑定",
+		"data": gin.H{
+			"secret":      enrollment.Secret,
+			"otpauth_uri": enrollment.URI,
+		},
+	})
+}
+
+// Activate 提交验证器上的验证码完成绑定，返回恢复码
+func (h *MFAHandler) Activate(c *gin.Context) {
+	code, ok := bindMFACode(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfa.Activate(c.Request.Context(), c.GetUint64("user_id"), code)
+	if err != nil {
+		respondMFAError(c, err, "开启二次验证失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "二次验证已开启，请妥善保存恢复码，重新登录后生效",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，之前的恢复码全部失效
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	code, ok := bindMFACode(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfa.RegenerateRecoveryCodes(c.Request.Context(), c.GetUint64("user_id"), code)
+	if err != nil {
+		respondMFAError(c, err, "生成恢复码失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "恢复码已重新生成",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// Disable 提交验证码或恢复码关闭二次验证
+func (h *MFAHandler) Disable(c *gin.Context) {
+	code, ok := bindMFACode(c)
+	if !ok {
+		return
+	}
+
+	if err := h.mfa.Disable(c.Request.Context(), c.GetUint64("user_id"), code); err != nil {
+		respondMFAError(c, err, "关闭二次验证失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "二次验证已关闭",
+	})
+}
+
+func bindMFACode(c *gin.Context) (string, bool) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return "", false
+	}
+	return req.Code, true
+}
+
+func respondMFAError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, mfa.ErrNotEnrolled), errors.Is(err, mfa.ErrAlreadyEnabled),
+		errors.Is(err, mfa.ErrNotEnabled), errors.Is(err, mfa.ErrInvalidCode):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":  400,
+			"error": err.Error(),
+		})
+	case errors.Is(err, mfa.ErrLocked):
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"code":  429,
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": message,
+		})
+	}
+}
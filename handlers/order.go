@@ -1,28 +1,32 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
-	"time"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"qaqmall/internal/authz"
+	"qaqmall/internal/service/order"
 	"qaqmall/models"
 )
 
 type OrderHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	orders *order.OrderService
+	authz  *authz.Authorizer
 }
 
-func NewOrderHandler(db *gorm.DB) *OrderHandler {
-	return &OrderHandler{db: db}
+func NewOrderHandler(db *gorm.DB, orders *order.OrderService, authorizer *authz.Authorizer) *OrderHandler {
+	return &OrderHandler{db: db, orders: orders, authz: authorizer}
 }
 
 // CreateOrder 创建订单
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
+	sub, ok := authzSubject(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
 		return
 	}
@@ -41,105 +45,14 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// 开始事务
-	tx := h.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// 验证地址
-	var address models.Address
-	if err := tx.First(&address, req.AddressID).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的收货地址"})
-		return
-	}
-
-	if address.UserID != userID.(uint64) {
-		tx.Rollback()
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权使用该地址"})
-		return
-	}
-
-	// 生成订单号
-	orderNumber := fmt.Sprintf("%s%d", time.Now().Format("20060102150405"), userID)
-
-	// 创建订单
-	order := models.Order{
-		OrderNumber: orderNumber,
-		UserID:      userID.(uint64),
-		Status:      models.OrderStatusPending,
-		AddressID:   req.AddressID,
-		Remark:      req.Remark,
-		ExpiredAt:   time.Now().Add(30 * time.Minute), // 30分钟后过期
-	}
-
-	if err := tx.Create(&order).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败"})
-		return
-	}
-
-	// 处理订单项
-	var totalAmount float64
+	in := order.CreateInput{AddressID: req.AddressID, Remark: req.Remark}
 	for _, item := range req.Items {
-		var product models.Product
-		if err := tx.First(&product, item.ProductID).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{"error": "商品不存在"})
-			return
-		}
-
-		if !product.IsOnSale {
-			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("商品 %s 已下架", product.Name)})
-			return
-		}
-
-		if product.Stock < item.Quantity {
-			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("商品 %s 库存不足", product.Name)})
-			return
-		}
-
-		// 创建订单项
-		orderItem := models.OrderItem{
-			OrderID:      order.ID,
-			ProductID:    product.ID,
-			ProductName:  product.Name,
-			ProductImage: product.ImageURL,
-			Price:        product.Price,
-			Quantity:     item.Quantity,
-		}
-
-		if err := tx.Create(&orderItem).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单项失败"})
-			return
-		}
-
-		// 扣减库存
-		if err := tx.Model(&product).Update("stock", product.Stock-item.Quantity).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新库存失败"})
-			return
-		}
-
-		totalAmount += product.Price * float64(item.Quantity)
+		in.Items = append(in.Items, order.Item{ProductID: item.ProductID, Quantity: item.Quantity})
 	}
 
-	// 更新订单总金额
-	if err := tx.Model(&order).Update("total_amount", totalAmount).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单金额失败"})
-		return
-	}
-
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败"})
+	created, err := h.orders.Create(c.Request.Context(), sub, in)
+	if err != nil {
+		h.handleError(c, err, "创建订单失败")
 		return
 	}
 
@@ -148,31 +61,32 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		"code":    200,
 		"message": "创建订单成功",
 		"data": gin.H{
-			"order_id":     order.ID,
-			"order_number": order.OrderNumber,
-			"total_amount": totalAmount,
-			"expired_at":   order.ExpiredAt,
+			"order_id":     created.ID,
+			"order_number": created.OrderNumber,
+			"total_amount": created.TotalAmount,
+			"expired_at":   created.ExpiredAt,
 		},
 	})
 }
 
 // GetOrder 获取订单详情
 func (h *OrderHandler) GetOrder(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
+	sub, ok := authzSubject(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
 		return
 	}
 
-	orderID := c.Param("id")
-	var order models.Order
-	if err := h.db.Preload("Items").Preload("Items.Product").Preload("Address").First(&order, orderID).Error; err != nil {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
 		return
 	}
 
-	if order.UserID != userID.(uint64) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该订单"})
+	var order models.Order
+	query := h.db.Preload("Items").Preload("Items.Product").Preload("Address")
+	if err := h.authz.Load(query, sub, authz.ActRead, &order, orderID); err != nil {
+		authzError(c, err, "订单不存在", "无权查看该订单")
 		return
 	}
 
@@ -200,21 +114,21 @@ func (h *OrderHandler) GetOrders(c *gin.Context) {
 
 // UpdateOrder 修改订单信息
 func (h *OrderHandler) UpdateOrder(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
+	sub, ok := authzSubject(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
 		return
 	}
 
-	orderID := c.Param("id")
-	var order models.Order
-	if err := h.db.First(&order, orderID).Error; err != nil {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
 		return
 	}
 
-	if order.UserID != userID.(uint64) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权修改该订单"})
+	var order models.Order
+	if err := h.authz.Load(h.db, sub, authz.ActUpdate, &order, orderID); err != nil {
+		authzError(c, err, "订单不存在", "无权修改该订单")
 		return
 	}
 
@@ -236,13 +150,12 @@ func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 	// 如果修改了地址，验证新地址
 	if req.AddressID > 0 {
 		var address models.Address
-		if err := h.db.First(&address, req.AddressID).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的收货地址"})
-			return
-		}
-
-		if address.UserID != userID.(uint64) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "无权使用该地址"})
+		if err := h.authz.Load(h.db, sub, authz.ActUse, &address, req.AddressID); err != nil {
+			if errors.Is(err, authz.ErrNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的收货地址"})
+				return
+			}
+			authzError(c, err, "", "无权使用该地址")
 			return
 		}
 
@@ -251,7 +164,8 @@ func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 
 	order.Remark = req.Remark
 
-	if err := h.db.Save(&order).Error; err != nil {
+	// 只修改地址和备注，订单状态只能通过状态机修改
+	if err := h.db.Model(&order).Select("address_id", "remark", "updated_at").Updates(&order).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单失败"})
 		return
 	}
@@ -265,52 +179,24 @@ func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 
 // CancelOrder 取消订单
 func (h *OrderHandler) CancelOrder(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
+	sub, ok := authzSubject(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
 		return
 	}
 
-	orderID := c.Param("id")
-	var order models.Order
-	if err := h.db.Preload("Items").First(&order, orderID).Error; err != nil {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
 		return
 	}
 
-	if order.UserID != userID.(uint64) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权取消该订单"})
-		return
-	}
-
-	if order.Status != models.OrderStatusPending {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "只能取消待支付的订单"})
-		return
-	}
-
-	// 开始事务
-	tx := h.db.Begin()
-
-	// 更新订单状态
-	if err := tx.Model(&order).Update("status", models.OrderStatusCancelled).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消订单失败"})
-		return
-	}
-
-	// 恢复库存
-	for _, item := range order.Items {
-		if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
-			UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复库存失败"})
+	if _, err := h.orders.Cancel(c.Request.Context(), sub, orderID); err != nil {
+		if errors.Is(err, order.ErrOrderForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权取消该订单"})
 			return
 		}
-	}
-
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消订单失败"})
+		h.handleError(c, err, "取消订单失败")
 		return
 	}
 
@@ -319,3 +205,44 @@ func (h *OrderHandler) CancelOrder(c *gin.Context) {
 		"message": "取消订单成功",
 	})
 }
+
+// handleError 将订单服务的错误转换为HTTP响应
+func (h *OrderHandler) handleError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, order.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, order.ErrOrderForbidden), errors.Is(err, order.ErrAddressForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, order.ErrOrderNotCancellable),
+		errors.Is(err, order.ErrInvalidAddress),
+		errors.Is(err, order.ErrProductNotFound),
+		errors.Is(err, order.ErrProductOffSale),
+		errors.Is(err, order.ErrInsufficientStock),
+		errors.Is(err, order.ErrEmptyItems),
+		errors.Is(err, order.ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// authzSubject 当前登录的用户，用于资源级别的权限检查
+func authzSubject(c *gin.Context) (authz.Subject, bool) {
+	userID := c.GetUint64("user_id")
+	if userID == 0 {
+		return authz.Subject{}, false
+	}
+	return authz.Subject{ID: userID, Role: c.GetString("role")}, true
+}
+
+// authzError 将 authz.Load 的错误转换为HTTP响应，notFound、forbidden 为对应的提示
+func authzError(c *gin.Context, err error, notFound, forbidden string) {
+	switch {
+	case errors.Is(err, authz.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case errors.Is(err, authz.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": forbidden})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "权限检查失败"})
+	}
+}
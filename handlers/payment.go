@@ -1,28 +1,36 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"qaqmall/internal/authz"
+	"qaqmall/internal/service/order"
 	"qaqmall/models"
 )
 
 type PaymentHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	authz  *authz.Authorizer
+	orders *order.OrderService
 }
 
-func NewPaymentHandler(db *gorm.DB) *PaymentHandler {
-	return &PaymentHandler{db: db}
+func NewPaymentHandler(db *gorm.DB, authorizer *authz.Authorizer, orders *order.OrderService) *PaymentHandler {
+	return &PaymentHandler{db: db, authz: authorizer, orders: orders}
 }
 
 // CreatePayment 创建支付
 func (h *PaymentHandler) CreatePayment(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
+	sub, ok := authzSubject(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
 		return
 	}
@@ -42,16 +50,9 @@ func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 
 	// 查找订单
 	var order models.Order
-	if err := tx.First(&order, req.OrderID).Error; err != nil {
+	if err := h.authz.Load(tx, sub, authz.ActPay, &order, req.OrderID); err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
-		return
-	}
-
-	// 验证订单所有者
-	if order.UserID != userID.(uint64) {
-		tx.Rollback()
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权支付该订单"})
+		authzError(c, err, "订单不存在", "无权支付该订单")
 		return
 	}
 
@@ -70,13 +71,13 @@ func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 	}
 
 	// 生成支付单号
-	paymentNumber := fmt.Sprintf("PAY%s%d", time.Now().Format("20060102150405"), userID)
+	paymentNumber := fmt.Sprintf("PAY%s%d", time.Now().Format("20060102150405"), order.UserID)
 
 	// 创建支付记录
 	payment := models.Payment{
 		PaymentNumber: paymentNumber,
 		OrderID:       order.ID,
-		UserID:        userID.(uint64),
+		UserID:        order.UserID,
 		Amount:        order.TotalAmount,
 		PaymentMethod: req.PaymentMethod,
 		Status:        models.PaymentStatusPending,
@@ -138,10 +139,33 @@ func (h *PaymentHandler) PaymentCallback(c *gin.Context) {
 		return
 	}
 
+	// 锁定订单，避免与用户取消、超时取消并发修改
+	var paidOrder models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&paidOrder, payment.OrderID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单状态失败"})
+		return
+	}
+
+	// 更新订单状态，订单已被取消（例如超时）时不能再支付
+	status := models.PaymentStatusPaid
+	message := "支付成功"
+	err := h.orders.ChangeStatus(tx, &paidOrder, models.OrderStatusPaid, order.SystemActor, "支付成功："+payment.PaymentNumber)
+	if errors.Is(err, order.ErrInvalidTransition) {
+		// 钱已经收到，保存支付记录并标记为待退款，返回成功避免支付渠道重复回调
+		status = models.PaymentStatusRefundPending
+		message = "订单已不是待支付状态，支付待退款"
+		log.Printf("订单 %s 的状态为 %s，支付 %s 待退款", paidOrder.OrderNumber, paidOrder.Status, payment.PaymentNumber)
+	} else if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单状态失败"})
+		return
+	}
+
 	// 更新支付状态
 	paidAt := time.Now()
 	updates := map[string]interface{}{
-		"status":  models.PaymentStatusPaid,
+		"status":  status,
 		"paid_at": &paidAt,
 	}
 
@@ -151,14 +175,6 @@ func (h *PaymentHandler) PaymentCallback(c *gin.Context) {
 		return
 	}
 
-	// 更新订单状态
-	if err := tx.Model(&models.Order{}).Where("id = ?", payment.OrderID).
-		Update("status", models.OrderStatusPaid).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单状态失败"})
-		return
-	}
-
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理支付回调失败"})
@@ -167,27 +183,27 @@ func (h *PaymentHandler) PaymentCallback(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
-		"message": "支付成功",
+		"message": message,
 	})
 }
 
 // GetPayment 获取支付详情
 func (h *PaymentHandler) GetPayment(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
+	sub, ok := authzSubject(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
 		return
 	}
 
-	paymentID := c.Param("id")
-	var payment models.Payment
-	if err := h.db.First(&payment, paymentID).Error; err != nil {
+	paymentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "支付记录不存在"})
 		return
 	}
 
-	if payment.UserID != userID.(uint64) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该支付记录"})
+	var payment models.Payment
+	if err := h.authz.Load(h.db, sub, authz.ActRead, &payment, paymentID); err != nil {
+		authzError(c, err, "支付记录不存在", "无权查看该支付记录")
 		return
 	}
 
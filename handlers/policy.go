@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/authz"
+	"qaqmall/internal/service/policy"
+)
+
+// PolicyHandler 在运行时管理权限策略和角色继承
+type PolicyHandler struct {
+	policies *policy.PolicyService
+}
+
+func NewPolicyHandler(policies *policy.PolicyService) *PolicyHandler {
+	return &PolicyHandler{policies: policies}
+}
+
+// ListPolicies 查询权限策略，可按角色过滤
+func (h *PolicyHandler) ListPolicies(c *gin.Context) {
+	policies, err := h.policies.ListPolicies(c.Query("role"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取权限策略失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": len(policies),
+		"items": policies,
+	})
+}
+
+// AddPolicy 添加权限策略
+func (h *PolicyHandler) AddPolicy(c *gin.Context) {
+	var req struct {
+		policy.Policy
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数", "details": err.Error()})
+		return
+	}
+
+	if err := h.policies.AddPolicy(c.Request.Context(), auditActor(c), req.Policy, req.Reason); err != nil {
+		h.error(c, err, "添加权限策略失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, req.Policy)
+}
+
+// RemovePolicy 删除权限策略，通过查询参数 role、object、action 指定
+func (h *PolicyHandler) RemovePolicy(c *gin.Context) {
+	p := policy.Policy{
+		Role:   c.Query("role"),
+		Object: c.Query("object"),
+		Action: c.Query("action"),
+	}
+	if err := h.policies.RemovePolicy(c.Request.Context(), auditActor(c), p, c.Query("reason")); err != nil {
+		h.error(c, err, "删除权限策略失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已删除权限策略"})
+}
+
+// ListResourcePolicies 查询资源级别的策略，可按角色过滤
+func (h *PolicyHandler) ListResourcePolicies(c *gin.Context) {
+	policies, err := h.policies.ListResourcePolicies(c.Query("role"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取资源策略失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": len(policies),
+		"items": policies,
+	})
+}
+
+// AddResourcePolicy 添加资源级别的策略
+func (h *PolicyHandler) AddResourcePolicy(c *gin.Context) {
+	var req struct {
+		policy.ResourcePolicy
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数", "details": err.Error()})
+		return
+	}
+
+	if err := h.policies.AddResourcePolicy(c.Request.Context(), auditActor(c), req.ResourcePolicy, req.Reason); err != nil {
+		h.error(c, err, "添加资源策略失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, req.ResourcePolicy)
+}
+
+// RemoveResourcePolicy 删除资源级别的策略，通过查询参数 role、type、action、condition 指定
+func (h *PolicyHandler) RemoveResourcePolicy(c *gin.Context) {
+	p := policy.ResourcePolicy{
+		Role:      c.Query("role"),
+		Type:      c.Query("type"),
+		Action:    c.Query("action"),
+		Condition: c.Query("condition"),
+	}
+	if err := h.policies.RemoveResourcePolicy(c.Request.Context(), auditActor(c), p, c.Query("reason")); err != nil {
+		h.error(c, err, "删除资源策略失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已删除资源策略"})
+}
+
+// CheckResource 检查用户能否对资源执行操作，只检查不执行
+func (h *PolicyHandler) CheckResource(c *gin.Context) {
+	var req struct {
+		Role   string `json:"role" binding:"required"`
+		UserID uint64 `json:"user_id"`
+		Type   string `json:"type" binding:"required"`
+		Owner  uint64 `json:"owner"`
+		Status string `json:"status"`
+		Action string `json:"action" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数", "details": err.Error()})
+		return
+	}
+
+	allowed, err := h.policies.CheckResource(req.Role, req.UserID, authz.Attributes{
+		Type:   req.Type,
+		Owner:  req.Owner,
+		Status: req.Status,
+	}, req.Action)
+	if err != nil {
+		h.error(c, err, "权限检查失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"allowed": allowed})
+}
+
+// ListRoles 列出所有角色及其继承的角色和权限
+func (h *PolicyHandler) ListRoles(c *gin.Context) {
+	roles, err := h.policies.Roles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取角色列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": len(roles),
+		"items": roles,
+	})
+}
+
+// ListRoleLinks 查询角色继承规则
+func (h *PolicyHandler) ListRoleLinks(c *gin.Context) {
+	links, err := h.policies.ListRoleLinks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取角色继承失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": len(links),
+		"items": links,
+	})
+}
+
+// AddRoleLink 使角色继承另一个角色的所有权限
+func (h *PolicyHandler) AddRoleLink(c *gin.Context) {
+	var req struct {
+		policy.RoleLink
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数", "details": err.Error()})
+		return
+	}
+
+	if err := h.policies.AddRoleLink(c.Request.Context(), auditActor(c), req.RoleLink, req.Reason); err != nil {
+		h.error(c, err, "添加角色继承失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, req.RoleLink)
+}
+
+// RemoveRoleLink 删除角色继承，通过查询参数 role、parent 指定
+func (h *PolicyHandler) RemoveRoleLink(c *gin.Context) {
+	l := policy.RoleLink{
+		Role:   c.Query("role"),
+		Parent: c.Query("parent"),
+	}
+	if err := h.policies.RemoveRoleLink(c.Request.Context(), auditActor(c), l, c.Query("reason")); err != nil {
+		h.error(c, err, "删除角色继承失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已删除角色继承"})
+}
+
+// Check 检查角色能否对路径执行操作，只检查不执行
+func (h *PolicyHandler) Check(c *gin.Context) {
+	var req struct {
+		Role   string `json:"role" binding:"required"`
+		Object string `json:"object" binding:"required"`
+		Action string `json:"action" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数", "details": err.Error()})
+		return
+	}
+
+	result, err := h.policies.Check(req.Role, req.Object, req.Action)
+	if err != nil {
+		h.error(c, err, "权限检查失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *PolicyHandler) error(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, policy.ErrInvalidRole),
+		errors.Is(err, policy.ErrInvalidObject),
+		errors.Is(err, policy.ErrInvalidAction),
+		errors.Is(err, policy.ErrProtectedPolicy),
+		errors.Is(err, policy.ErrRoleCycle),
+		errors.Is(err, policy.ErrInvalidType),
+		errors.Is(err, policy.ErrInvalidCondition):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, policy.ErrPolicyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, policy.ErrPolicyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -1,107 +1,176 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 
-	"qaqmall/models"
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/product"
 )
 
 // ProductHandler 商品处理器
 type ProductHandler struct {
-	db *gorm.DB
+	products *product.ProductService
 }
 
 // NewProductHandler 创建商品处理器
-func NewProductHandler(db *gorm.DB) *ProductHandler {
-	return &ProductHandler{db: db}
+func NewProductHandler(products *product.ProductService) *ProductHandler {
+	return &ProductHandler{products: products}
 }
 
-// ListProducts 获取商品列表
-func (h *ProductHandler) ListProducts(c *gin.Context) {
-	var products []models.Product
-	query := h.db.Model(&models.Product{})
+// productRequest 创建、修改商品的请求参数
+type productRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Price       float64  `json:"price"`
+	Stock       int      `json:"stock"`
+	ImageURL    string   `json:"image_url"`
+	IsOnSale    *bool    `json:"is_on_sale"`
+	Categories  []uint64 `json:"categories"` // 商品分类ID列表
+}
+
+func (r productRequest) input() product.ProductInput {
+	isOnSale := true
+	if r.IsOnSale != nil {
+		isOnSale = *r.IsOnSale
+	}
+	return product.ProductInput{
+		Name:        r.Name,
+		Description: r.Description,
+		Price:       r.Price,
+		Stock:       r.Stock,
+		ImageURL:    r.ImageURL,
+		IsOnSale:    isOnSale,
+		CategoryIDs: r.Categories,
+	}
+}
 
-	// 处理分页
+// ListProducts 获取商品列表，支持关键词搜索、价格区间、分类过滤和排序
+func (h *ProductHandler) ListProducts(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
-	offset := (page - 1) * pageSize
+	minPrice, _ := strconv.ParseFloat(c.Query("min_price"), 64)
+	maxPrice, _ := strconv.ParseFloat(c.Query("max_price"), 64)
+	categoryID, _ := strconv.ParseUint(c.Query("category_id"), 10, 64)
+
+	products, total, err := h.products.List(c.Request.Context(), product.Query{
+		Pagination: pagination.Pagination{Page: page, PageSize: pageSize},
+		Keyword:    c.Query("keyword"),
+		MinPrice:   minPrice,
+		MaxPrice:   maxPrice,
+		CategoryID: categoryID,
+		OnlyOnSale: c.Query("only_on_sale") == "true",
+		SortBy:     c.Query("sort_by"),
+		Desc:       c.Query("desc") == "true",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取商品列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": products,
+	})
+}
 
-	// 获取总数
-	var total int64
-	if err := query.Count(&total).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取商品总数失败"})
+// GetProduct 获取商品详情
+func (h *ProductHandler) GetProduct(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "无效的商品ID"})
 		return
 	}
 
-	// 获取商品列表
-	if err := query.Offset(offset).Limit(pageSize).Find(&products).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取商品列表失败"})
+	p, err := h.products.Get(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err, "获取商品失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+// ListCategories 获取商品分类列表
+func (h *ProductHandler) ListCategories(c *gin.Context) {
+	categories, err := h.products.ListCategories(c.Request.Context(), c.Query("only_active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分类列表失败"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"total": total,
-		"items": products,
+		"items": categories,
 	})
 }
 
 // CreateProduct 创建商品
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
-	var product models.Product
-	if err := c.ShouldBindJSON(&product); err != nil {
+	var req productRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "无效的请求数据"})
 		return
 	}
 
-	if err := h.db.Create(&product).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "创建商品失败"})
+	p, err := h.products.Create(c.Request.Context(), req.input())
+	if err != nil {
+		h.handleError(c, err, "创建商品失败")
 		return
 	}
 
-	c.JSON(http.StatusCreated, product)
+	c.JSON(http.StatusCreated, p)
 }
 
 // UpdateProduct 更新商品信息
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
-	id := c.Param("id")
-	var product models.Product
-
-	if err := h.db.First(&product, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "商品不存在"})
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "无效的商品ID"})
 		return
 	}
 
-	if err := c.ShouldBindJSON(&product); err != nil {
+	var req productRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "无效的请求数据"})
 		return
 	}
 
-	if err := h.db.Save(&product).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "更新商品失败"})
+	p, err := h.products.Update(c.Request.Context(), id, req.input())
+	if err != nil {
+		h.handleError(c, err, "更新商品失败")
 		return
 	}
 
-	c.JSON(http.StatusOK, product)
+	c.JSON(http.StatusOK, p)
 }
 
 // DeleteProduct 删除商品
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
-	id := c.Param("id")
-	var product models.Product
-
-	if err := h.db.First(&product, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "商品不存在"})
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "无效的商品ID"})
 		return
 	}
 
-	if err := h.db.Delete(&product).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "删除商品失败"})
+	if err := h.products.Delete(c.Request.Context(), id); err != nil {
+		h.handleError(c, err, "删除商品失败")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "商品已删除"})
 }
+
+// handleError 将商品服务的错误转换为HTTP响应
+func (h *ProductHandler) handleError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, product.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, product.ErrCategoryNotFound), errors.Is(err, product.ErrInvalidProduct):
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": fallback})
+	}
+}
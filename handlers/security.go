@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/security"
+)
+
+type SecurityHandler struct {
+	security *security.SecurityService
+}
+
+func NewSecurityHandler(securityService *security.SecurityService) *SecurityHandler {
+	return &SecurityHandler{security: securityService}
+}
+
+// ListEvents 管理员查询登录锁定、解除锁定等安全事件
+func (h *SecurityHandler) ListEvents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+	events, total, err := h.security.ListEvents(c.Request.Context(), security.EventQuery{
+		Pagination: pagination.Pagination{Page: page, PageSize: pageSize},
+		Type:       c.Query("type"),
+		Username:   c.Query("username"),
+		IP:         c.Query("ip"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取安全事件失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": events,
+	})
+}
+
+// ListLockouts 管理员查询当前被锁定的用户名和 IP
+func (h *SecurityHandler) ListLockouts(c *gin.Context) {
+	lockouts, err := h.security.ListLockouts(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取锁定列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": len(lockouts),
+		"items": lockouts,
+	})
+}
+
+// ClearLockout 管理员解除用户名和（或）IP 的登录锁定
+func (h *SecurityHandler) ClearLockout(c *gin.Context) {
+	operatorID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	err := h.security.ClearLockout(c.Request.Context(), c.Query("username"), c.Query("ip"), operatorID.(uint64))
+	if err != nil {
+		switch {
+		case errors.Is(err, security.ErrEmptyLockoutTarget):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, security.ErrLockoutNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "解除锁定失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已解除锁定"})
+}
@@ -1,29 +1,36 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 
-	"qaqmall/models"
+	"qaqmall/internal/service/auth"
+	"qaqmall/internal/service/mfa"
+	"qaqmall/internal/service/security"
+	"qaqmall/internal/service/user"
 )
 
 type UserHandler struct {
-	db *gorm.DB
+	users  *user.UserService
+	tokens *auth.TokenService
 }
 
-func NewUserHandler(db *gorm.DB) *UserHandler {
-	return &UserHandler{db: db}
+func NewUserHandler(users *user.UserService, tokens *auth.TokenService) *UserHandler {
+	return &UserHandler{users: users, tokens: tokens}
 }
 
 func (h *UserHandler) Register(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Email    string `json:"email"`
+		Phone    string `json:"phone"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
 			"error":   "无效的请求参数",
@@ -32,42 +39,20 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// 验证必要字段
-	if user.Username == "" || user.Password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":  400,
-			"error": "用户名和密码不能为空",
-		})
-		return
-	}
-
-	// 检查用户名是否已存在
-	var existingUser models.User
-	if err := h.db.Where("username = ?", user.Username).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":  400,
-			"error": "用户名已存在",
-		})
-		return
-	}
-
-	// 加密密码
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	u, err := h.users.Register(c.Request.Context(), user.RegisterInput{
+		Username: req.Username,
+		Password: req.Password,
+		Email:    req.Email,
+		Phone:    req.Phone,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"error":   "密码加密失败",
-			"details": err.Error(),
-		})
-		return
-	}
-	user.Password = string(hashedPassword)
-
-	// 设置默认角色
-	user.Role = "user"
-
-	// 创建用户
-	if err := h.db.Create(&user).Error; err != nil {
+		if errors.Is(err, user.ErrEmptyCredentials) || errors.Is(err, user.ErrUserExists) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":  400,
+				"error": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
 			"error":   "创建用户失败",
@@ -80,9 +65,9 @@ func (h *UserHandler) Register(c *gin.Context) {
 		"code":    200,
 		"message": "注册成功",
 		"data": gin.H{
-			"user_id":  user.ID,
-			"username": user.Username,
-			"role":     user.Role,
+			"user_id":  u.ID,
+			"username": u.Username,
+			"role":     u.Role,
 		},
 	})
 }
@@ -102,43 +87,154 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := h.db.Where("username = ? AND deleted_at IS NULL", loginInfo.Username).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	result, err := h.users.Login(c.Request.Context(), loginInfo.Username, loginInfo.Password, c.ClientIP())
+	if err != nil {
+		var locked *security.LockedError
+		switch {
+		case errors.As(err, &locked):
+			retryAfter := security.RetryAfterSeconds(locked.RetryAfter)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"code":        429,
+				"error":       security.ErrLocked.Error(),
+				"retry_after": retryAfter,
+			})
+		case errors.Is(err, user.ErrInvalidCredentials):
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"code":  401,
-				"error": "用户不存在或已被删除",
+				"error": err.Error(),
 			})
-		} else {
+		case errors.Is(err, user.ErrUserDisabled):
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":  403,
+				"error": err.Error(),
+			})
+		default:
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"code":    500,
-				"error":   "数据库查询错误",
+				"error":   "登录失败",
 				"details": err.Error(),
 			})
 		}
 		return
 	}
 
-	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginInfo.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"code":  401,
-			"error": "密码错误",
+	c.JSON(http.StatusOK, loginResponse(result))
+}
+
+// LoginMFA 登录的第二步，提交二次验证码或恢复码换取token
+func (h *UserHandler) LoginMFA(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
 		})
 		return
 	}
 
-	// 生成JWT令牌
-	token := generateToken(user.ID, user.Username, user.Role)
+	result, err := h.users.CompleteMFALogin(c.Request.Context(), req.MFAToken, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidMFAChallenge), errors.Is(err, mfa.ErrInvalidCode), errors.Is(err, mfa.ErrNotEnabled):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":  401,
+				"error": err.Error(),
+			})
+		case errors.Is(err, mfa.ErrLocked):
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"code":  429,
+				"error": err.Error(),
+			})
+		case errors.Is(err, user.ErrUserDisabled):
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":  403,
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":  500,
+				"error": "登录失败",
+			})
+		}
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, loginResponse(result))
+}
+
+// loginResponse 登录成功的响应，开启了二次验证时返回二次验证 token
+func loginResponse(result *user.LoginResult) gin.H {
+	if result.Challenge != nil {
+		return gin.H{
+			"code":    200,
+			"message": "请输入二次验证码",
+			"data": gin.H{
+				"mfa_required":   true,
+				"mfa_token":      result.Challenge.Token,
+				"mfa_expires_at": result.Challenge.ExpiresAt,
+				"user_id":        result.User.ID,
+				"username":       result.User.Username,
+			},
+		}
+	}
+	return gin.H{
 		"code":    200,
 		"message": "登录成功",
 		"data": gin.H{
-			"token":    token,
-			"user_id":  user.ID,
-			"username": user.Username,
-			"role":     user.Role,
+			"token":              result.Tokens.AccessToken,
+			"expires_at":         result.Tokens.ExpiresAt,
+			"refresh_token":      result.Tokens.RefreshToken,
+			"refresh_expires_at": result.Tokens.RefreshExpiresAt,
+			"user_id":            result.User.ID,
+			"username":           result.User.Username,
+			"role":               result.User.Role,
+		},
+	}
+}
+
+// RefreshToken 使用 refresh token 换取新的 access token 和 refresh token
+func (h *UserHandler) RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	pair, err := h.tokens.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":  401,
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "刷新token失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "刷新成功",
+		"data": gin.H{
+			"token":              pair.AccessToken,
+			"expires_at":         pair.ExpiresAt,
+			"refresh_token":      pair.RefreshToken,
+			"refresh_expires_at": pair.RefreshExpiresAt,
 		},
 	})
 }
@@ -150,18 +246,19 @@ func (h *UserHandler) GetUserInfo(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	u, err := h.users.Get(c.Request.Context(), userID.(uint64))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":       user.ID,
-		"username": user.Username,
-		"role":     user.Role,
-		"email":    user.Email,
-		"phone":    user.Phone,
+		"id":             u.ID,
+		"username":       u.Username,
+		"role":           u.Role,
+		"email":          u.Email,
+		"email_verified": u.EmailVerifiedAt != nil,
+		"phone":          u.Phone,
 	})
 }
 
@@ -182,16 +279,12 @@ func (h *UserHandler) UpdateUserInfo(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
-		return
-	}
-
-	user.Email = updateInfo.Email
-	user.Phone = updateInfo.Phone
-
-	if err := h.db.Save(&user).Error; err != nil {
+	u, err := h.users.Update(c.Request.Context(), userID.(uint64), updateInfo.Email, updateInfo.Phone)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户信息失败"})
 		return
 	}
@@ -199,11 +292,12 @@ func (h *UserHandler) UpdateUserInfo(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "更新成功",
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"role":     user.Role,
-			"email":    user.Email,
-			"phone":    user.Phone,
+			"id":             u.ID,
+			"username":       u.Username,
+			"role":           u.Role,
+			"email":          u.Email,
+			"email_verified": u.EmailVerifiedAt != nil,
+			"phone":          u.Phone,
 		},
 	})
 }
@@ -218,18 +312,15 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	// 先查找用户确保存在
-	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"code":  404,
-			"error": "用户不存在",
-		})
-		return
-	}
-
-	// 使用软删除
-	if err := h.db.Delete(&user).Error; err != nil {
+	// 删除用户并将当前token加入黑名单
+	if err := h.users.Delete(c.Request.Context(), userID.(uint64), c.GetString("token")); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":  404,
+				"error": "用户不存在",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":  500,
 			"error": "删除用户失败",
@@ -237,106 +328,208 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	// 获取当前token并加入黑名单
-	authHeader := c.GetHeader("Authorization")
-	if authHeader != "" {
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) == 2 && parts[0] == "Bearer" {
-			token, err := jwt.Parse(parts[1], func(token *jwt.Token) (interface{}, error) {
-				return []byte("your-secret-key"), nil
-			})
-			if err == nil {
-				if claims, ok := token.Claims.(jwt.MapClaims); ok {
-					exp := time.Unix(int64(claims["exp"].(float64)), 0)
-					blacklistedToken := models.TokenBlacklist{
-						Token:     parts[1],
-						ExpiredAt: exp,
-					}
-					h.db.Create(&blacklistedToken)
-				}
-			}
-		}
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "用户已删除",
 	})
 }
 
+// Logout 吊销当前 access token，请求体中带有 refresh_token 时同时结束该登录会话
 func (h *UserHandler) Logout(c *gin.Context) {
-	// 从请求头中获取token
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供token"})
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	// 请求体是可选的
+	_ = c.ShouldBindJSON(&req)
+
+	if err := h.revokeCurrentToken(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败"})
 		return
 	}
 
-	parts := strings.SplitN(authHeader, " ", 2)
-	if !(len(parts) == 2 && parts[0] == "Bearer") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "token格式错误"})
+	if req.RefreshToken != "" {
+		err := h.tokens.RevokeRefreshToken(c.Request.Context(), c.GetUint64("user_id"), req.RefreshToken)
+		if err != nil && !errors.Is(err, auth.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "登出成功",
+	})
+}
+
+// LogoutAll 在所有设备上退出登录，已签发的 access token 和 refresh token 全部失效
+func (h *UserHandler) LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
 		return
 	}
 
-	tokenString := parts[1]
+	if err := h.tokens.LogoutAll(c.Request.Context(), userID.(uint64)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败"})
+		return
+	}
 
-	// 解析token以获取过期时间
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte("your-secret-key"), nil
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已在所有设备上退出登录",
 	})
+}
 
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的token"})
+// RequestEmailVerification 向当前用户的邮箱发送验证邮件
+func (h *UserHandler) RequestEmailVerification(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
 		return
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的token claims"})
+	if err := h.users.RequestEmailVerification(c.Request.Context(), userID.(uint64)); err != nil {
+		switch {
+		case errors.Is(err, user.ErrEmailNotSet), errors.Is(err, user.ErrEmailVerified):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":  400,
+				"error": err.Error(),
+			})
+		case errors.Is(err, user.ErrTooFrequent):
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"code":  429,
+				"error": err.Error(),
+			})
+		case errors.Is(err, user.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":  404,
+				"error": "用户不存在",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":  500,
+				"error": "发送验证邮件失败",
+			})
+		}
 		return
 	}
 
-	// 获取token的过期时间
-	exp := time.Unix(int64(claims["exp"].(float64)), 0)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "验证邮件已发送",
+	})
+}
 
-	// 将token加入黑名单
-	blacklistedToken := models.TokenBlacklist{
-		Token:     tokenString,
-		ExpiredAt: exp,
+// VerifyEmail 使用验证邮件中的 token 验证邮箱
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
 	}
 
-	if err := h.db.Create(&blacklistedToken).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败"})
+	u, err := h.users.VerifyEmail(c.Request.Context(), req.Token)
+	if err != nil {
+		if errors.Is(err, user.ErrInvalidAccountToken) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":  400,
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "验证邮箱失败",
+		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
-		"message": "登出成功",
+		"message": "邮箱验证成功",
+		"data": gin.H{
+			"user_id": u.ID,
+			"email":   u.Email,
+		},
 	})
 }
 
-func generateToken(userID uint64, username string, role string) string {
-	// 创建JWT声明
-	now := time.Now().Add(time.Duration(time.Now().UnixNano()%1000) * time.Millisecond) // 添加随机毫秒数以确保每次生成的token都不同
-	claims := jwt.MapClaims{
-		"user_id":  userID,
-		"username": username,
-		"role":     role,
-		"iat":      now.Unix(),
-		"exp":      now.Add(time.Hour * 24).Unix(),
-		"jti":      time.Now().UnixNano(), // 添加唯一标识符
+// ForgotPassword 发送重置密码邮件，无论邮箱是否存在都返回成功
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
 	}
 
-	// 创建token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if err := h.users.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "发送重置密码邮件失败",
+		})
+		return
+	}
 
-	// 使用密钥签名token
-	secretKey := []byte("your-secret-key")
-	tokenString, err := token.SignedString(secretKey)
-	if err != nil {
-		return ""
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "如果该邮箱已绑定并验证，重置密码邮件将很快送达",
+	})
+}
+
+// ResetPassword 使用重置密码邮件中的 token 设置新密码，所有已登录的会话随即失效
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
 	}
 
-	return tokenString
+	if err := h.users.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		if errors.Is(err, user.ErrInvalidAccountToken) || errors.Is(err, user.ErrEmptyPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":  400,
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "重置密码失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "密码已重置，请重新登录",
+	})
+}
+
+// revokeCurrentToken 吊销 Auth 中间件校验过的当前token
+func (h *UserHandler) revokeCurrentToken(c *gin.Context) error {
+	jti := c.GetString("token_id")
+	expiresAt, ok := c.Get("token_expires_at")
+	if jti == "" || !ok {
+		return nil
+	}
+	return h.tokens.Revoke(c.Request.Context(), jti, expiresAt.(time.Time))
 }
@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"qaqmall/config"
+)
+
+const (
+	// fakeModel 假模型在响应中返回的模型名
+	fakeModel = "fake"
+	// fakeChunkSize 流式输出时每段的字符数
+	fakeChunkSize = 4
+)
+
+// fakeToolPrefix 用户消息中以该前缀开头的行会被假模型当作工具调用，格式为 "/tool 工具名 {JSON参数}"
+const fakeToolPrefix = "/tool "
+
+// FakeProvider 进程内的假模型，不访问网络，回答是确定的，用于测试和离线环境
+// reply 不为空时总是返回 reply，否则复述最后一条用户消息
+// 请求带有工具时，最后一条用户消息中的 "/tool" 指令会转换为工具调用，收到工具结果后复述结果
+type FakeProvider struct {
+	reply string
+}
+
+func NewFakeProvider(reply string) *FakeProvider {
+	return &FakeProvider{reply: reply}
+}
+
+func (p *FakeProvider) Name() string {
+	return config.LLMProviderFake
+}
+
+func (p *FakeProvider) Chat(ctx context.Context, req Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if call, ok := fakeToolCall(req); ok {
+		return &Response{
+			ToolCalls: []ToolCall{call},
+			Model:     fakeModel,
+			Usage:     EstimateUsage(req.Messages, call.Arguments),
+		}, nil
+	}
+
+	content := p.answer(req)
+	return &Response{
+		Content: content,
+		Model:   fakeModel,
+		Usage:   EstimateUsage(req.Messages, content),
+	}, nil
+}
+
+// ChatStream 每次输出回答中的 fakeChunkSize 个字符
+func (p *FakeProvider) ChatStream(ctx context.Context, req Request, onDelta func(delta string) error) (*Response, error) {
+	content := p.answer(req)
+	runes := []rune(content)
+	for start := 0; start < len(runes); start += fakeChunkSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end := min(start+fakeChunkSize, len(runes))
+		if err := onDelta(string(runes[start:end])); err != nil {
+			return nil, err
+		}
+	}
+	return &Response{
+		Content: content,
+		Model:   fakeModel,
+		Usage:   EstimateUsage(req.Messages, content),
+	}, nil
+}
+
+func (p *FakeProvider) answer(req Request) string {
+	if p.reply != "" {
+		return p.reply
+	}
+	if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == RoleTool {
+		return fmt.Sprintf("（离线模式）工具返回：%s", req.Messages[n-1].Content)
+	}
+	return fmt.Sprintf("（离线模式）已收到您的问题：%s", lastUserMessage(req.Messages))
+}
+
+func lastUserMessage(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == RoleUser {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+// fakeToolCall 在最后一条消息是用户消息时解析其中的 "/tool" 指令
+func fakeToolCall(req Request) (ToolCall, bool) {
+	n := len(req.Messages)
+	if len(req.Tools) == 0 || n == 0 || req.Messages[n-1].Role != RoleUser {
+		return ToolCall{}, false
+	}
+
+	for _, line := range strings.Split(req.Messages[n-1].Content, "\n") {
+		idx := strings.Index(line, fakeToolPrefix)
+		if idx < 0 {
+			continue
+		}
+		name, args, _ := strings.Cut(strings.TrimSpace(line[idx+len(fakeToolPrefix):]), " ")
+		for _, tool := range req.Tools {
+			if tool.Name == name {
+				if args = strings.TrimSpace(args); args == "" {
+					args = "{}"
+				}
+				return ToolCall{ID: "call_fake_" + name, Name: name, Arguments: args}, true
+			}
+		}
+	}
+	return ToolCall{}, false
+}
@@ -0,0 +1,239 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"unicode"
+
+	"qaqmall/config"
+)
+
+var (
+	ErrEmptyResponse = errors.New("AI响应为空")
+	ErrTimeout       = errors.New("AI服务响应超时")
+)
+
+// 消息角色
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message 对话消息
+// 大模型请求调用工具时 assistant 消息带 ToolCalls，工具的执行结果以 tool 消息返回，ToolCallID 对应调用的 ID
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Tool 可供大模型调用的工具，Parameters 为 JSON Schema
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+}
+
+// ToolCall 大模型发起的一次工具调用，Arguments 为 JSON 字符串
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Request 对话补全请求，Temperature 为0时使用后端配置的默认值
+// Tools 只在 Chat 中生效，流式接口不支持工具调用
+type Request struct {
+	Messages    []Message
+	Tools       []Tool
+	Temperature float64
+	MaxTokens   int
+}
+
+// Usage token 用量，后端未返回用量时按 EstimateTokens 估算
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Add 累加用量
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// Response 对话补全结果，ToolCalls 不为空时 Content 可能为空
+type Response struct {
+	Content   string
+	ToolCalls []ToolCall
+	Model     string
+	Usage     Usage
+}
+
+// LLMProvider 大模型后端
+type LLMProvider interface {
+	// Name 后端名称，用于日志
+	Name() string
+	// Chat 对话补全，单次调用的超时由后端自己控制，重试由 New 返回的包装处理
+	Chat(ctx context.Context, req Request) (*Response, error)
+	// ChatStream 流式对话补全，每收到一段增量内容调用一次 onDelta，onDelta 返回错误时中止
+	// 结束后返回完整内容和用量
+	ChatStream(ctx context.Context, req Request, onDelta func(delta string) error) (*Response, error)
+}
+
+// StatusError 后端返回的非200响应
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s 返回状态码 %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// retryable 限流和服务端错误可以重试
+func (e *StatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// New 根据配置创建大模型后端，网络后端会带上超时、重试和用量统计
+func New(cfg *config.Config) (LLMProvider, error) {
+	var provider LLMProvider
+	switch cfg.LLM.Provider {
+	case config.LLMProviderOpenAI:
+		provider = NewOpenAIProvider(cfg.OpenAI, cfg.LLM.Timeout)
+	case config.LLMProviderOllama:
+		provider = NewOllamaProvider(cfg.LLM.Ollama, cfg.LLM.Timeout)
+	case config.LLMProviderFake:
+		return NewFakeProvider(cfg.LLM.FakeReply), nil
+	default:
+		return nil, fmt.Errorf("不支持的大模型后端: %s", cfg.LLM.Provider)
+	}
+	return WithRetry(provider, cfg.LLM.MaxRetries, cfg.LLM.RetryBackoff), nil
+}
+
+// retryProvider 对可重试的错误按指数退避重试
+type retryProvider struct {
+	LLMProvider
+	maxRetries int
+	backoff    time.Duration
+}
+
+// WithRetry 包装后端，网络错误、限流和服务端错误最多重试 maxRetries 次，每次等待时间翻倍
+func WithRetry(provider LLMProvider, maxRetries int, backoff time.Duration) LLMProvider {
+	if maxRetries <= 0 {
+		return provider
+	}
+	return &retryProvider{LLMProvider: provider, maxRetries: maxRetries, backoff: backoff}
+}
+
+func (p *retryProvider) Chat(ctx context.Context, req Request) (*Response, error) {
+	wait := p.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := p.LLMProvider.Chat(ctx, req)
+		if err == nil || attempt >= p.maxRetries || !shouldRetry(ctx, err) {
+			return resp, err
+		}
+
+		log.Printf("调用 %s 失败，%v 后第 %d 次重试: %v", p.Name(), wait, attempt+1, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// ChatStream 只在还没有输出任何内容时重试，已经输出的内容无法撤回
+func (p *retryProvider) ChatStream(ctx context.Context, req Request, onDelta func(delta string) error) (*Response, error) {
+	var sent bool
+	relay := func(delta string) error {
+		sent = true
+		return onDelta(delta)
+	}
+
+	wait := p.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := p.LLMProvider.ChatStream(ctx, req, relay)
+		if err == nil || sent || attempt >= p.maxRetries || !shouldRetry(ctx, err) {
+			return resp, err
+		}
+
+		log.Printf("调用 %s 失败，%v 后第 %d 次重试: %v", p.Name(), wait, attempt+1, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func shouldRetry(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.retryable()
+	}
+	// 空响应重试也没有意义，其余按网络错误处理
+	return !errors.Is(err, ErrEmptyResponse)
+}
+
+// EstimateTokens 粗略估算文本的 token 数：每个汉字算1个，其余字符每4个算1个
+func EstimateTokens(s string) int {
+	var han, other int
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			han++
+		} else if !unicode.IsSpace(r) {
+			other++
+		}
+	}
+	return han + (other+3)/4
+}
+
+// EstimateUsage 按请求和回答估算用量，用于服务端没有返回用量或请求中途失败的情况
+func EstimateUsage(messages []Message, content string) Usage {
+	var prompt int
+	for _, m := range messages {
+		prompt += EstimateTokens(m.Content)
+	}
+	completion := EstimateTokens(content)
+	return Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+}
+
+// newStreamClient 流式请求的响应时间不固定，timeout 只限制等待响应头的时间
+func newStreamClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{Transport: transport}
+}
+
+// wrapTimeout 将 http.Client 超时转换为 ErrTimeout，调用方取消时保留 context 的错误
+func wrapTimeout(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var netErr interface{ Timeout() bool }
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qaqmall/config"
+)
+
+var testRequest = Request{Messages: []Message{{Role: RoleUser, Content: "你好"}}}
+
+// newTestServer 依次用 handlers 处理请求，请求数超过 handlers 时重复使用最后一个，返回服务和请求计数
+func newTestServer(t *testing.T, handlers ...http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(calls.Add(1)) - 1
+		handlers[min(i, len(handlers)-1)](w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func newTestOpenAI(url string, timeout time.Duration) *OpenAIProvider {
+	return NewOpenAIProvider(config.OpenAIConfig{APIKey: "test-key", APIURL: url, Model: "gpt-test", Temperature: 0.3}, timeout)
+}
+
+func statusHandler(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+func openAIReply(content string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"model":"gpt-test","choices":[{"message":{"role":"assistant","content":%q}}]}`, content)
+	}
+}
+
+// openAIStream 以 SSE 逐段返回 deltas
+func openAIStream(deltas ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, d := range deltas {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", d)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+}
+
+// slowHandler 直到客户端断开或者 1 秒后才响应
+func slowHandler(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(time.Second):
+	}
+}
+
+func TestRetryChat(t *testing.T) {
+	tests := []struct {
+		name      string
+		handlers  []http.HandlerFunc
+		wantCalls int32
+		wantCode  int
+	}{
+		{name: "rate limited then ok", handlers: []http.HandlerFunc{statusHandler(http.StatusTooManyRequests), openAIReply("好的")}, wantCalls: 2},
+		{name: "server errors then ok", handlers: []http.HandlerFunc{statusHandler(http.StatusBadGateway), statusHandler(http.StatusServiceUnavailable), openAIReply("好的")}, wantCalls: 3},
+		{name: "gives up after max retries", handlers: []http.HandlerFunc{statusHandler(http.StatusInternalServerError)}, wantCalls: 3, wantCode: http.StatusInternalServerError},
+		// 客户端错误重试也不会成功
+		{name: "client error not retried", handlers: []http.HandlerFunc{statusHandler(http.StatusUnauthorized)}, wantCalls: 1, wantCode: http.StatusUnauthorized},
+		{name: "bad request not retried", handlers: []http.HandlerFunc{statusHandler(http.StatusBadRequest), openAIReply("好的")}, wantCalls: 1, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := newTestServer(t, tt.handlers...)
+			p := WithRetry(newTestOpenAI(srv.URL, time.Second), 2, time.Millisecond)
+
+			resp, err := p.Chat(context.Background(), testRequest)
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Fatalf("calls = %d, want %d", got, tt.wantCalls)
+			}
+			if tt.wantCode == 0 {
+				if err != nil || resp.Content != "好的" {
+					t.Fatalf("resp = %+v, err = %v", resp, err)
+				}
+				return
+			}
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantCode {
+				t.Fatalf("err = %v, want status %d", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRetryEmptyResponse(t *testing.T) {
+	srv, calls := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"model":"gpt-test","choices":[]}`)
+	})
+	p := WithRetry(newTestOpenAI(srv.URL, time.Second), 2, time.Millisecond)
+	if _, err := p.Chat(context.Background(), testRequest); !errors.Is(err, ErrEmptyResponse) {
+		t.Fatalf("err = %v, want ErrEmptyResponse", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("calls = %d, want 1", calls.Load())
+	}
+}
+
+func TestRetryChatStream(t *testing.T) {
+	t.Run("retries before first delta", func(t *testing.T) {
+		srv, calls := newTestServer(t, statusHandler(http.StatusServiceUnavailable), openAIStream("你", "好"))
+		p := WithRetry(newTestOpenAI(srv.URL, time.Second), 2, time.Millisecond)
+
+		var deltas []string
+		resp, err := p.ChatStream(context.Background(), testRequest, func(d string) error {
+			deltas = append(deltas, d)
+			return nil
+		})
+		if err != nil || resp.Content != "你好" {
+			t.Fatalf("resp = %+v, err = %v", resp, err)
+		}
+		if calls.Load() != 2 || len(deltas) != 2 {
+			t.Fatalf("calls = %d, deltas = %q", calls.Load(), deltas)
+		}
+	})
+
+	t.Run("no retry after first delta", func(t *testing.T) {
+		// 输出一段内容后响应出错，已经输出的内容无法撤回，不能重试
+		srv, calls := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"你\"}}]}\n\n")
+			fmt.Fprint(w, "data: {broken\n\n")
+		}, openAIStream("你", "好"))
+		p := WithRetry(newTestOpenAI(srv.URL, time.Second), 2, time.Millisecond)
+
+		var deltas []string
+		_, err := p.ChatStream(context.Background(), testRequest, func(d string) error {
+			deltas = append(deltas, d)
+			return nil
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if calls.Load() != 1 || len(deltas) != 1 {
+			t.Fatalf("calls = %d, deltas = %q", calls.Load(), deltas)
+		}
+	})
+
+	t.Run("onDelta error not retried", func(t *testing.T) {
+		srv, calls := newTestServer(t, openAIStream("你", "好"))
+		p := WithRetry(newTestOpenAI(srv.URL, time.Second), 2, time.Millisecond)
+
+		stop := errors.New("client gone")
+		_, err := p.ChatStream(context.Background(), testRequest, func(string) error { return stop })
+		if !errors.Is(err, stop) || calls.Load() != 1 {
+			t.Fatalf("err = %v, calls = %d", err, calls.Load())
+		}
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	srv, _ := newTestServer(t, slowHandler)
+	providers := []LLMProvider{
+		newTestOpenAI(srv.URL, 50*time.Millisecond),
+		NewOllamaProvider(config.OllamaConfig{APIURL: srv.URL, Model: "llama-test"}, 50*time.Millisecond),
+	}
+	for _, p := range providers {
+		t.Run(p.Name(), func(t *testing.T) {
+			if _, err := p.Chat(context.Background(), testRequest); !errors.Is(err, ErrTimeout) {
+				t.Fatalf("Chat: err = %v, want ErrTimeout", err)
+			}
+			// 流式请求的超时只限制等待响应头的时间
+			if _, err := p.ChatStream(context.Background(), testRequest, func(string) error { return nil }); !errors.Is(err, ErrTimeout) {
+				t.Fatalf("ChatStream: err = %v, want ErrTimeout", err)
+			}
+
+			// 调用方取消时返回 context 的错误，不当作超时
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err := WithRetry(p, 2, time.Millisecond).Chat(ctx, testRequest)
+			if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrTimeout) {
+				t.Fatalf("cancelled: err = %v, want context.DeadlineExceeded", err)
+			}
+		})
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"你好世界", 4},
+		{"hello", 2},
+		{"hi 你好", 3},
+		{"  \n", 0},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
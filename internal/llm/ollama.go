@@ -0,0 +1,218 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"qaqmall/config"
+)
+
+// OllamaProvider Ollama 兼容的 /api/chat 接口
+type OllamaProvider struct {
+	cfg          config.OllamaConfig
+	client       *http.Client
+	streamClient *http.Client
+}
+
+func NewOllamaProvider(cfg config.OllamaConfig, timeout time.Duration) *OllamaProvider {
+	return &OllamaProvider{
+		cfg:          cfg,
+		client:       &http.Client{Timeout: timeout},
+		streamClient: newStreamClient(timeout),
+	}
+}
+
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []functionTool  `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Options  ollamaOptions   `json:"options"`
+}
+
+// ollamaMessage Ollama 的工具调用没有 ID，参数是 JSON 对象而不是字符串
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Done            bool          `json:"done"`
+	Error           string        `json:"error"`
+}
+
+func (p *OllamaProvider) Name() string {
+	return config.LLMProviderOllama
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, req Request) (*Response, error) {
+	httpReq, err := p.newRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	httpResp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, wrapTimeout(ctx, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, readStatusError(p.Name(), httpResp)
+	}
+
+	var out ollamaResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&out); err != nil {
+		return nil, wrapTimeout(ctx, err)
+	}
+	content := strings.TrimSpace(out.Message.Content)
+	var calls []ToolCall
+	for i, call := range out.Message.ToolCalls {
+		calls = append(calls, ToolCall{
+			ID:        fmt.Sprintf("call_%d", i),
+			Name:      call.Function.Name,
+			Arguments: string(call.Function.Arguments),
+		})
+	}
+	if content == "" && len(calls) == 0 {
+		return nil, ErrEmptyResponse
+	}
+
+	return &Response{Content: content, ToolCalls: calls, Model: out.Model, Usage: out.usage(req.Messages, content)}, nil
+}
+
+// ChatStream 流式接口每行一个 JSON 对象，最后一行 done 为 true 并带有用量
+func (p *OllamaProvider) ChatStream(ctx context.Context, req Request, onDelta func(delta string) error) (*Response, error) {
+	httpReq, err := p.newRequest(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	httpResp, err := p.streamClient.Do(httpReq)
+	if err != nil {
+		return nil, wrapTimeout(ctx, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, readStatusError(p.Name(), httpResp)
+	}
+
+	var content strings.Builder
+	var last ollamaResponse
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, err
+		}
+		if chunk.Error != "" {
+			return nil, &StatusError{Provider: p.Name(), StatusCode: http.StatusInternalServerError, Body: chunk.Error}
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			if err := onDelta(chunk.Message.Content); err != nil {
+				return nil, err
+			}
+		}
+		last = chunk
+		if chunk.Done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, wrapTimeout(ctx, err)
+	}
+
+	text := strings.TrimSpace(content.String())
+	if text == "" {
+		return nil, ErrEmptyResponse
+	}
+	return &Response{Content: text, Model: last.Model, Usage: last.usage(req.Messages, text)}, nil
+}
+
+func (p *OllamaProvider) newRequest(ctx context.Context, req Request, stream bool) (*http.Request, error) {
+	temperature := req.Temperature
+	if temperature == 0 {
+		temperature = p.cfg.Temperature
+	}
+	payload := ollamaRequest{
+		Model:    p.cfg.Model,
+		Messages: toOllamaMessages(req.Messages),
+		Stream:   stream,
+		Options:  ollamaOptions{Temperature: temperature, NumPredict: req.MaxTokens},
+	}
+	if !stream {
+		payload.Tools = toFunctionTools(req.Tools)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.APIURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	return httpReq, nil
+}
+
+func toOllamaMessages(messages []Message) []ollamaMessage {
+	out := make([]ollamaMessage, 0, len(messages))
+	for _, m := range messages {
+		msg := ollamaMessage{Role: m.Role, Content: m.Content}
+		for _, call := range m.ToolCalls {
+			var tc ollamaToolCall
+			tc.Function.Name = call.Name
+			tc.Function.Arguments = json.RawMessage(call.Arguments)
+			if !json.Valid(tc.Function.Arguments) {
+				tc.Function.Arguments = json.RawMessage("{}")
+			}
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// usage 使用 Ollama 返回的计数，没有返回时按字数估算
+func (r *ollamaResponse) usage(messages []Message, content string) Usage {
+	if r.PromptEvalCount == 0 && r.EvalCount == 0 {
+		return EstimateUsage(messages, content)
+	}
+	return Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"qaqmall/config"
+)
+
+func newTestOllama(url string) *OllamaProvider {
+	return NewOllamaProvider(config.OllamaConfig{APIURL: url, Model: "llama-test", Temperature: 0.2}, time.Second)
+}
+
+func TestOllamaChat(t *testing.T) {
+	var got ollamaRequest
+	srv, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, `{"model":"llama-test","message":{"role":"assistant","content":"",
+			"tool_calls":[{"function":{"name":"get_order","arguments":{"order_id":3}}},{"function":{"name":"list_orders","arguments":{}}}]},
+			"prompt_eval_count":20,"eval_count":6,"done":true}`)
+	})
+
+	resp, err := newTestOllama(srv.URL).Chat(context.Background(), Request{
+		Messages:  testRequest.Messages,
+		Tools:     []Tool{{Name: "get_order"}, {Name: "list_orders"}},
+		MaxTokens: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Stream || got.Options.Temperature != 0.2 || got.Options.NumPredict != 100 || len(got.Tools) != 2 {
+		t.Fatalf("request = %+v", got)
+	}
+	// Ollama 的工具调用没有 ID，按顺序生成；参数对象转换为 JSON 字符串
+	want := []ToolCall{
+		{ID: "call_0", Name: "get_order", Arguments: `{"order_id":3}`},
+		{ID: "call_1", Name: "list_orders", Arguments: `{}`},
+	}
+	if !reflect.DeepEqual(resp.ToolCalls, want) {
+		t.Fatalf("tool calls = %+v", resp.ToolCalls)
+	}
+	if resp.Usage != (Usage{PromptTokens: 20, CompletionTokens: 6, TotalTokens: 26}) {
+		t.Fatalf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestOllamaChatStream(t *testing.T) {
+	srv, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"model":"llama-test","message":{"role":"assistant","content":"有"},"done":false}`)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, `{"model":"llama-test","message":{"role":"assistant","content":"货"},"done":false}`)
+		fmt.Fprintln(w, `{"model":"llama-test","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":9,"eval_count":2}`)
+	})
+
+	var deltas []string
+	resp, err := newTestOllama(srv.URL).ChatStream(context.Background(), testRequest, func(d string) error {
+		deltas = append(deltas, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deltas, []string{"有", "货"}) || resp.Content != "有货" || resp.Model != "llama-test" {
+		t.Fatalf("deltas = %q, resp = %+v", deltas, resp)
+	}
+	if resp.Usage != (Usage{PromptTokens: 9, CompletionTokens: 2, TotalTokens: 11}) {
+		t.Fatalf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestOllamaStreamError(t *testing.T) {
+	streamError := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"error":"model is loading"}`)
+	}
+	// 流中返回的错误按服务端错误处理
+	srv, _ := newTestServer(t, streamError)
+	_, err := newTestOllama(srv.URL).ChatStream(context.Background(), testRequest, func(string) error { return nil })
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError || statusErr.Body != "model is loading" {
+		t.Fatalf("err = %v", err)
+	}
+
+	// 还没有输出内容时可以重试
+	srv, calls := newTestServer(t, streamError, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"model":"llama-test","message":{"content":"好的"},"done":true}`)
+	})
+	resp, err := WithRetry(newTestOllama(srv.URL), 2, time.Millisecond).ChatStream(context.Background(), testRequest, func(string) error { return nil })
+	if err != nil || resp.Content != "好的" || calls.Load() != 2 {
+		t.Fatalf("resp = %+v, err = %v, calls = %d", resp, err, calls.Load())
+	}
+}
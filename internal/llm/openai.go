@@ -0,0 +1,274 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"qaqmall/config"
+)
+
+// maxErrorBody 错误响应体最多保留的字节数
+const maxErrorBody = 512
+
+// OpenAIProvider OpenAI 兼容的 /v1/chat/completions 接口
+type OpenAIProvider struct {
+	cfg          config.OpenAIConfig
+	client       *http.Client
+	streamClient *http.Client
+}
+
+func NewOpenAIProvider(cfg config.OpenAIConfig, timeout time.Duration) *OpenAIProvider {
+	return &OpenAIProvider{
+		cfg:          cfg,
+		client:       &http.Client{Timeout: timeout},
+		streamClient: newStreamClient(timeout),
+	}
+}
+
+type openAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Tools       []functionTool  `json:"tools,omitempty"`
+	Temperature float64         `json:"temperature"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// functionTool 工具定义，OpenAI 和 Ollama 使用相同的格式
+type functionTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description"`
+		Parameters  map[string]interface{} `json:"parameters"`
+	} `json:"function"`
+}
+
+type openAIResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// openAIChunk 流式响应中的一个 data 事件
+type openAIChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta openAIMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+func (p *OpenAIProvider) Name() string {
+	return config.LLMProviderOpenAI
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, req Request) (*Response, error) {
+	httpReq, err := p.newRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	httpResp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, wrapTimeout(ctx, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, readStatusError(p.Name(), httpResp)
+	}
+
+	var out openAIResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&out); err != nil {
+		return nil, wrapTimeout(ctx, err)
+	}
+	if len(out.Choices) == 0 {
+		return nil, ErrEmptyResponse
+	}
+
+	message := out.Choices[0].Message
+	resp := &Response{
+		Content: strings.TrimSpace(message.Content),
+		Model:   out.Model,
+	}
+	for _, call := range message.ToolCalls {
+		resp.ToolCalls = append(resp.ToolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	if resp.Content == "" && len(resp.ToolCalls) == 0 {
+		return nil, ErrEmptyResponse
+	}
+	if out.Usage != nil {
+		resp.Usage = *out.Usage
+	} else {
+		resp.Usage = EstimateUsage(req.Messages, resp.Content)
+	}
+	return resp, nil
+}
+
+// ChatStream 使用 SSE 流式接口，请求用量随最后一个事件返回，后端不支持时按字数估算
+func (p *OpenAIProvider) ChatStream(ctx context.Context, req Request, onDelta func(delta string) error) (*Response, error) {
+	httpReq, err := p.newRequest(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	httpResp, err := p.streamClient.Do(httpReq)
+	if err != nil {
+		return nil, wrapTimeout(ctx, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, readStatusError(p.Name(), httpResp)
+	}
+
+	var content strings.Builder
+	resp := &Response{}
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, err
+		}
+		if chunk.Model != "" {
+			resp.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			resp.Usage = *chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, wrapTimeout(ctx, err)
+	}
+
+	resp.Content = strings.TrimSpace(content.String())
+	if resp.Content == "" {
+		return nil, ErrEmptyResponse
+	}
+	if resp.Usage.TotalTokens == 0 {
+		resp.Usage = EstimateUsage(req.Messages, resp.Content)
+	}
+	return resp, nil
+}
+
+func (p *OpenAIProvider) newRequest(ctx context.Context, req Request, stream bool) (*http.Request, error) {
+	temperature := req.Temperature
+	if temperature == 0 {
+		temperature = p.cfg.Temperature
+	}
+	payload := openAIRequest{
+		Model:       p.cfg.Model,
+		Messages:    toOpenAIMessages(req.Messages),
+		Temperature: temperature,
+		MaxTokens:   req.MaxTokens,
+		Stream:      stream,
+	}
+	if stream {
+		payload.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	} else {
+		payload.Tools = toFunctionTools(req.Tools)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.APIURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.cfg.APIKey)
+	return httpReq, nil
+}
+
+func toOpenAIMessages(messages []Message) []openAIMessage {
+	out := make([]openAIMessage, 0, len(messages))
+	for _, m := range messages {
+		msg := openAIMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, call := range m.ToolCalls {
+			tc := openAIToolCall{ID: call.ID, Type: "function"}
+			tc.Function.Name = call.Name
+			tc.Function.Arguments = call.Arguments
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+func toFunctionTools(tools []Tool) []functionTool {
+	var out []functionTool
+	for _, tool := range tools {
+		ft := functionTool{Type: "function"}
+		ft.Function.Name = tool.Name
+		ft.Function.Description = tool.Description
+		ft.Function.Parameters = tool.Parameters
+		out = append(out, ft)
+	}
+	return out
+}
+
+func readStatusError(provider string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return &StatusError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
@@ -0,0 +1,101 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOpenAIChat(t *testing.T) {
+	var got openAIRequest
+	srv, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, `{"model":"gpt-test","choices":[{"message":{"role":"assistant","content":"",
+			"tool_calls":[{"id":"call_1","type":"function","function":{"name":"search_products","arguments":"{\"keyword\":\"耳机\"}"}}]}}],
+			"usage":{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17}}`)
+	})
+	p := newTestOpenAI(srv.URL, time.Second)
+
+	resp, err := p.Chat(context.Background(), Request{
+		Messages: testRequest.Messages,
+		Tools:    []Tool{{Name: "search_products", Description: "搜索商品", Parameters: map[string]interface{}{"type": "object"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未指定 Temperature 时使用配置的默认值，非流式请求带上工具
+	if got.Model != "gpt-test" || got.Temperature != 0.3 || got.Stream || len(got.Tools) != 1 || got.Tools[0].Function.Name != "search_products" {
+		t.Fatalf("request = %+v", got)
+	}
+	want := []ToolCall{{ID: "call_1", Name: "search_products", Arguments: `{"keyword":"耳机"}`}}
+	if !reflect.DeepEqual(resp.ToolCalls, want) || resp.Model != "gpt-test" {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if resp.Usage != (Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}) {
+		t.Fatalf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestOpenAIChatStreamSSE(t *testing.T) {
+	var got openAIRequest
+	srv, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		// 注释行、空行、event 行和没有空格的 data 都要能处理，[DONE] 之后的内容忽略
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "event: message\n")
+		fmt.Fprint(w, "data: {\"model\":\"gpt-test\",\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"推荐\"}}]}\n\n")
+		fmt.Fprint(w, "data:{\"choices\":[{\"delta\":{\"content\":\"这款耳机\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":8,\"completion_tokens\":3,\"total_tokens\":11}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"多余\"}}]}\n\n")
+	})
+	p := newTestOpenAI(srv.URL, time.Second)
+
+	var deltas []string
+	resp, err := p.ChatStream(context.Background(), Request{Messages: testRequest.Messages, Temperature: 0.9}, func(d string) error {
+		deltas = append(deltas, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Stream || got.StreamOptions == nil || !got.StreamOptions.IncludeUsage || got.Temperature != 0.9 {
+		t.Fatalf("request = %+v", got)
+	}
+	if !reflect.DeepEqual(deltas, []string{"推荐", "这款耳机"}) {
+		t.Fatalf("deltas = %q", deltas)
+	}
+	if resp.Content != "推荐这款耳机" || resp.Model != "gpt-test" {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if resp.Usage != (Usage{PromptTokens: 8, CompletionTokens: 3, TotalTokens: 11}) {
+		t.Fatalf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestOpenAIChatStreamEstimatesUsage(t *testing.T) {
+	srv, _ := newTestServer(t, openAIStream("你好", "世界"))
+	p := newTestOpenAI(srv.URL, time.Second)
+
+	resp, err := p.ChatStream(context.Background(), testRequest, func(string) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 后端没有返回用量时按字数估算
+	if want := EstimateUsage(testRequest.Messages, "你好世界"); resp.Usage != want {
+		t.Fatalf("usage = %+v, want %+v", resp.Usage, want)
+	}
+}
@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConsoleMailer 把邮件打印到标准输出，用于本地开发
+type ConsoleMailer struct {
+	from string
+	mu   sync.Mutex
+	out  io.Writer
+}
+
+func NewConsoleMailer(from string) *ConsoleMailer {
+	return &ConsoleMailer{from: from, out: os.Stdout}
+}
+
+func (m *ConsoleMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.out, "==== 邮件 ====\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n==============\n",
+		m.from, msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// FileMailer 把每封邮件写成 dir 下的一个 .eml 文件，可以用邮件客户端打开，用于本地开发和测试
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	// 文件名按时间排序，收件人中的特殊字符替换为下划线
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), sanitizeFileName(msg.To))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, format(m.from, msg), 0o644); err != nil {
+		return err
+	}
+	log.Printf("邮件已写入 %s", path)
+	return nil
+}
+
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,169 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// supportedAlgorithms 接受的 id_token 签名算法，不接受 none 和 HS256
+var supportedAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+// jwksRefreshInterval 遇到未知 kid 时重新获取公钥的最短间隔，避免伪造的 kid 不断触发请求
+const jwksRefreshInterval = time.Minute
+
+// jwk JSON Web Key 中用到的字段
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type publicKey struct {
+	alg string
+	key interface{}
+}
+
+// keySet 缓存的身份提供方签名公钥
+type keySet struct {
+	keys      map[string]publicKey
+	fetchedAt time.Time
+}
+
+// verificationKey 按 id_token 头部的 kid 选择公钥，找不到时重新获取一次（身份提供方可能已轮换密钥）
+// token 声明的算法必须与公钥一致，防止算法混淆
+func (p *Provider) verificationKey(ctx context.Context, meta *metadata, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys.lookup(kid)
+	if !ok && (p.keys == nil || time.Since(p.keys.fetchedAt) > jwksRefreshInterval) {
+		keys, err := p.fetchKeys(ctx, meta.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+		p.keys = keys
+		key, ok = p.keys.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("未知的密钥 kid=%q", kid)
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.key, nil
+}
+
+// lookup 按 kid 查找公钥；token 没有 kid 且只有一个公钥时使用该公钥
+func (s *keySet) lookup(kid string) (publicKey, bool) {
+	if s == nil {
+		return publicKey{}, false
+	}
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (*keySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("%w: 获取公钥失败: %v", ErrInvalidIDToken, err)
+	}
+
+	keys := &keySet{keys: make(map[string]publicKey, len(set.Keys)), fetchedAt: time.Now()}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// 跳过不支持的密钥类型，其余密钥仍可使用
+			continue
+		}
+		keys.keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// publicKey 解析 RSA、P-256 和 Ed25519 公钥
+func (k jwk) publicKey() (publicKey, error) {
+	var key publicKey
+	switch {
+	case k.Kty == "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return key, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return key, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return key, errors.New("RSA 公钥的 e 无效")
+		}
+		key = publicKey{alg: "RS256", key: &rsa.PublicKey{N: n, E: int(e.Int64())}}
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return key, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return key, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return key, errors.New("EC 公钥不在曲线上")
+		}
+		key = publicKey{alg: "ES256", key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return key, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return key, errors.New("Ed25519 公钥长度无效")
+		}
+		key = publicKey{alg: "EdDSA", key: ed25519.PublicKey(x)}
+	default:
+		return key, fmt.Errorf("不支持的密钥类型 %s %s", k.Kty, k.Crv)
+	}
+
+	if k.Alg != "" && k.Alg != key.alg {
+		return key, fmt.Errorf("不支持的算法 %s", k.Alg)
+	}
+	return key, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("空的整数")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
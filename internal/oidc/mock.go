@@ -0,0 +1,281 @@
+package oidc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"qaqmall/config"
+)
+
+const (
+	// mockCodeExpire 测试身份提供方授权码的有效期
+	mockCodeExpire = time.Minute
+	// mockIDTokenExpire 测试身份提供方签发的 id_token 的有效期
+	mockIDTokenExpire = 5 * time.Minute
+	// mockDefaultSubject 授权请求没有 login_hint 时使用的用户
+	mockDefaultSubject = "mock-user"
+)
+
+// MockProvider 进程内的测试身份提供方，实现 OIDC 授权码 + PKCE 流程的服务端，用于本地开发和离线测试
+// 授权时不显示登录页，直接以 login_hint 指定的用户（默认为 mock-user）同意授权；
+// login_hint 为邮箱时 sub 和 email 都使用该邮箱，否则 email 为 <login_hint>@example.com。
+// 附加参数 email_verified=false 时签发的 id_token 中邮箱未验证
+// 签名密钥在创建时随机生成，重启后失效
+type MockProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	kid          string
+	key          ed25519.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]mockGrant
+}
+
+// mockGrant 授权码对应的授权请求
+type mockGrant struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	subject       string
+	email         string
+	emailVerified bool
+	expiresAt     time.Time
+}
+
+func NewMockProvider(cfg config.OIDCMockConfig) (*MockProvider, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := RandomString(6)
+	if err != nil {
+		return nil, err
+	}
+	return &MockProvider{
+		issuer:       strings.TrimSuffix(cfg.Issuer, "/"),
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		kid:          "mock-" + kid,
+		key:          key,
+		grants:       make(map[string]mockGrant),
+	}, nil
+}
+
+// ServeHTTP 按路径的结尾分发请求，挂载时需要去掉 issuer 的路径前缀
+func (m *MockProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path := r.URL.Path; {
+	case strings.HasSuffix(path, "/.well-known/openid-configuration"):
+		m.discovery(w)
+	case strings.HasSuffix(path, "/authorize"):
+		m.authorize(w, r)
+	case strings.HasSuffix(path, "/token"):
+		m.token(w, r)
+	case strings.HasSuffix(path, "/jwks"):
+		m.jwks(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *MockProvider) discovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                m.issuer,
+		"authorization_endpoint":                m.issuer + "/authorize",
+		"token_endpoint":                        m.issuer + "/token",
+		"jwks_uri":                              m.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"EdDSA"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
+
+func (m *MockProvider) jwks(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []jwk{{
+			Kty: "OKP",
+			Kid: m.kid,
+			Use: "sig",
+			Alg: "EdDSA",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(m.key.Public().(ed25519.PublicKey)),
+		}},
+	})
+}
+
+// authorize 授权端点，校验请求后直接带着授权码重定向回 redirect_uri
+func (m *MockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	target, err := url.Parse(redirectURI)
+	if q.Get("client_id") != m.clientID || redirectURI == "" || err != nil || !target.IsAbs() {
+		// client_id 或 redirect_uri 无效时不能重定向（RFC 6749 4.1.2.1）
+		http.Error(w, "invalid client_id or redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	redirect := func(params url.Values) {
+		params.Set("state", q.Get("state"))
+		query := target.Query()
+		for k, v := range params {
+			query[k] = v
+		}
+		target.RawQuery = query.Encode()
+		http.Redirect(w, r, target.String(), http.StatusFound)
+	}
+
+	switch {
+	case q.Get("response_type") != "code":
+		redirect(url.Values{"error": {"unsupported_response_type"}})
+		return
+	case !strings.Contains(" "+q.Get("scope")+" ", " openid "):
+		redirect(url.Values{"error": {"invalid_scope"}, "error_description": {"scope must include openid"}})
+		return
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		redirect(url.Values{"error": {"invalid_request"}, "error_description": {"PKCE with S256 is required"}})
+		return
+	}
+
+	subject := q.Get("login_hint")
+	if subject == "" {
+		subject = mockDefaultSubject
+	}
+	email := subject
+	if !strings.Contains(email, "@") {
+		email += "@example.com"
+	}
+
+	code, err := RandomString(24)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	m.mu.Lock()
+	now := time.Now()
+	for c, g := range m.grants {
+		if now.After(g.expiresAt) {
+			delete(m.grants, c)
+		}
+	}
+	m.grants[code] = mockGrant{
+		redirectURI:   redirectURI,
+		codeChallenge: q.Get("code_challenge"),
+		nonce:         q.Get("nonce"),
+		subject:       subject,
+		email:         email,
+		emailVerified: q.Get("email_verified") != "false",
+		expiresAt:     now.Add(mockCodeExpire),
+	}
+	m.mu.Unlock()
+
+	redirect(url.Values{"code": {code}})
+}
+
+// token 令牌端点，授权码只能使用一次，code_verifier 必须与授权请求的 code_challenge 对应
+func (m *MockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		tokenError(w, http.StatusMethodNotAllowed, "invalid_request", "POST required")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != m.clientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(m.clientSecret)) != 1 {
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	m.mu.Lock()
+	grant, ok := m.grants[code]
+	delete(m.grants, code)
+	m.mu.Unlock()
+
+	switch {
+	case !ok || time.Now().After(grant.expiresAt):
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "code is invalid or expired")
+		return
+	case r.PostForm.Get("redirect_uri") != grant.redirectURI:
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri mismatch")
+		return
+	case CodeChallenge(r.PostForm.Get("code_verifier")) != grant.codeChallenge:
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "code_verifier mismatch")
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, idTokenClaims{
+		Nonce:             grant.nonce,
+		Email:             grant.email,
+		EmailVerified:     flexBool(grant.emailVerified),
+		Name:              grant.subject,
+		PreferredUsername: strings.SplitN(grant.subject, "@", 2)[0],
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			Subject:   grant.subject,
+			Audience:  jwt.ClaimStrings{m.clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mockIDTokenExpire)),
+		},
+	})
+	idToken.Header["kid"] = m.kid
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	accessToken, err := RandomString(24)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(mockIDTokenExpire / time.Second),
+		"id_token":     signed,
+	})
+}
+
+func tokenError(w http.ResponseWriter, status int, code, description string) {
+	body := map[string]string{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,188 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"qaqmall/config"
+)
+
+const (
+	testClientID     = "qaqmall"
+	testClientSecret = "mock-secret"
+	testRedirectURL  = "http://localhost:8888/oauth/mock/callback"
+)
+
+// newMockServer 在 httptest 服务上运行 MockProvider，issuer 为服务的地址
+func newMockServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var mock *MockProvider
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	var err error
+	mock, err = NewMockProvider(config.OIDCMockConfig{Issuer: srv.URL, ClientID: testClientID, ClientSecret: testClientSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func newTestProvider(issuer string) *Provider {
+	return NewProvider(config.OIDCProviderConfig{
+		Name:         "mock",
+		Issuer:       issuer,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	})
+}
+
+// authorize 请求授权地址，不跟随重定向，返回重定向到 redirect_uri 的参数
+func authorize(t *testing.T, authURL string, extra url.Values) url.Values {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	for k, v := range extra {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned HTTP %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != testRedirectURL {
+		t.Fatalf("redirected to %s, want %s", got, testRedirectURL)
+	}
+	return location.Query()
+}
+
+// startFlow 生成 state、nonce 和 code_verifier 并完成授权，返回授权码
+func startFlow(t *testing.T, p *Provider, loginHint string, extra url.Values) (code, verifier, nonce string) {
+	t.Helper()
+	state, _ := RandomString(32)
+	nonce, _ = RandomString(32)
+	verifier, _ = RandomString(48)
+
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, CodeChallenge(verifier), loginHint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := authorize(t, authURL, extra)
+	if params.Get("state") != state {
+		t.Fatalf("state = %q, want %q", params.Get("state"), state)
+	}
+	if params.Get("error") != "" {
+		t.Fatalf("authorize error: %s %s", params.Get("error"), params.Get("error_description"))
+	}
+	return params.Get("code"), verifier, nonce
+}
+
+func TestMockProviderFlow(t *testing.T) {
+	srv := newMockServer(t)
+	p := newTestProvider(srv.URL)
+	ctx := context.Background()
+
+	code, verifier, nonce := startFlow(t, p, "alice@example.com", nil)
+	ident, err := p.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ident.Subject != "alice@example.com" || ident.Email != "alice@example.com" || !ident.EmailVerified {
+		t.Fatalf("unexpected identity: %+v", ident)
+	}
+	if ident.PreferredUsername != "alice" {
+		t.Fatalf("preferred_username = %q, want alice", ident.PreferredUsername)
+	}
+
+	// 授权码只能使用一次
+	if _, err := p.Exchange(ctx, code, verifier, nonce); !errors.Is(err, ErrExchange) {
+		t.Fatalf("reused code: err = %v, want ErrExchange", err)
+	}
+
+	code, verifier, nonce = startFlow(t, p, "", url.Values{"email_verified": {"false"}})
+	ident, err = p.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ident.Subject != mockDefaultSubject || ident.Email != "mock-user@example.com" || ident.EmailVerified {
+		t.Fatalf("unexpected identity: %+v", ident)
+	}
+}
+
+func TestMockProviderPKCE(t *testing.T) {
+	srv := newMockServer(t)
+	p := newTestProvider(srv.URL)
+
+	code, _, nonce := startFlow(t, p, "bob", nil)
+	other, _ := RandomString(48)
+	if _, err := p.Exchange(context.Background(), code, other, nonce); !errors.Is(err, ErrExchange) {
+		t.Fatalf("wrong code_verifier: err = %v, want ErrExchange", err)
+	}
+
+	// 没有 code_challenge 的授权请求被拒绝
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce", CodeChallenge("verifier"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := authorize(t, authURL, url.Values{"code_challenge": {""}})
+	if params.Get("error") != "invalid_request" || params.Get("code") != "" {
+		t.Fatalf("missing code_challenge: %v", params)
+	}
+}
+
+func TestMockProviderNonce(t *testing.T) {
+	srv := newMockServer(t)
+	p := newTestProvider(srv.URL)
+
+	code, verifier, _ := startFlow(t, p, "carol", nil)
+	if _, err := p.Exchange(context.Background(), code, verifier, "another-nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("wrong nonce: err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestMockProviderClientAuth(t *testing.T) {
+	srv := newMockServer(t)
+	p := NewProvider(config.OIDCProviderConfig{
+		Name:         "mock",
+		Issuer:       srv.URL,
+		ClientID:     testClientID,
+		ClientSecret: "wrong-secret",
+		RedirectURL:  testRedirectURL,
+	})
+
+	code, verifier, nonce := startFlow(t, p, "dave", nil)
+	if _, err := p.Exchange(context.Background(), code, verifier, nonce); !errors.Is(err, ErrExchange) {
+		t.Fatalf("wrong client_secret: err = %v, want ErrExchange", err)
+	}
+}
+
+func TestProviderIssuerMismatch(t *testing.T) {
+	srv := newMockServer(t)
+	p := newTestProvider(srv.URL + "/other")
+
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge", ""); !errors.Is(err, ErrDiscovery) {
+		t.Fatalf("err = %v, want ErrDiscovery", err)
+	}
+}
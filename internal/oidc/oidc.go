@@ -0,0 +1,302 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"qaqmall/config"
+)
+
+var (
+	ErrDiscovery      = errors.New("获取身份提供方配置失败")
+	ErrExchange       = errors.New("换取身份提供方token失败")
+	ErrInvalidIDToken = errors.New("身份提供方返回的id_token无效")
+)
+
+const (
+	// httpTimeout 访问身份提供方的超时时间
+	httpTimeout = 10 * time.Second
+	// maxResponseBody 身份提供方响应体的最大字节数
+	maxResponseBody = 1 << 20
+	// clockSkew 校验 id_token 有效期时允许的时钟偏差
+	clockSkew = time.Minute
+)
+
+// Identity 从 id_token 中取出的第三方用户信息
+// Subject 在同一身份提供方内唯一且不会改变，用于关联本地用户；邮箱只有 EmailVerified 为 true 时可信
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// metadata /.well-known/openid-configuration 中用到的字段
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// idTokenClaims id_token 的载荷，iss、aud、exp、iat 由 RegisteredClaims 校验
+type idTokenClaims struct {
+	Nonce             string   `json:"nonce"`
+	AuthorizedParty   string   `json:"azp"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	jwt.RegisteredClaims
+}
+
+// flexBool 部分身份提供方把 email_verified 写成字符串 "true"
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = flexBool(v)
+	case string:
+		*b = flexBool(v == "true")
+	}
+	return nil
+}
+
+// Provider 一个 OIDC 身份提供方，实现授权码 + PKCE 流程的客户端（relying party）
+// 端点地址和签名公钥在第一次使用时从 issuer 获取并缓存，获取失败时下次使用再重试
+type Provider struct {
+	cfg    config.OIDCProviderConfig
+	client *http.Client
+
+	mu   sync.Mutex
+	meta *metadata
+	keys *keySet
+}
+
+func NewProvider(cfg config.OIDCProviderConfig) *Provider {
+	return &Provider{cfg: cfg, client: &http.Client{Timeout: httpTimeout}}
+}
+
+// Name 身份提供方的名称
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// DisplayName 展示给用户的名称，未配置时使用 Name
+func (p *Provider) DisplayName() string {
+	if p.cfg.DisplayName != "" {
+		return p.cfg.DisplayName
+	}
+	return p.cfg.Name
+}
+
+// AllowSignup 没有关联账号的第三方用户登录时是否自动注册
+func (p *Provider) AllowSignup() bool {
+	return p.cfg.AllowSignup
+}
+
+// AuthCodeURL 返回跳转到身份提供方的授权地址，loginHint 不为空时提示身份提供方预填账号
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge, loginHint string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.scopes(), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	if loginHint != "" {
+		params.Set("login_hint", loginHint)
+	}
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange 使用回调中的授权码和 PKCE code_verifier 换取 id_token，校验签名、签发方、受众、有效期和 nonce 后返回用户信息
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// client_secret_basic，客户端 ID 和密钥需要先做 URL 编码（RFC 6749 2.3.1）
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBody)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%w: HTTP %d", ErrExchange, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("%w: HTTP %d %s %s", ErrExchange, resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("%w: 响应中没有 id_token", ErrExchange)
+	}
+
+	return p.verifyIDToken(ctx, meta, body.IDToken, nonce)
+}
+
+// verifyIDToken 校验 id_token（OpenID Connect Core 3.1.3.7）
+func (p *Provider) verifyIDToken(ctx context.Context, meta *metadata, raw, nonce string) (*Identity, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(supportedAlgorithms),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithLeeway(clockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+
+	var claims idTokenClaims
+	keyfunc := func(token *jwt.Token) (interface{}, error) {
+		return p.verificationKey(ctx, meta, token)
+	}
+	if _, err := parser.ParseWithClaims(raw, &claims, keyfunc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: 缺少 sub", ErrInvalidIDToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce 不一致", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: azp 不一致", ErrInvalidIDToken)
+	}
+
+	return &Identity{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     bool(claims.EmailVerified),
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// scopes 请求的权限，始终包含 openid
+func (p *Provider) scopes() []string {
+	if len(p.cfg.Scopes) == 0 {
+		return []string{"openid", "email", "profile"}
+	}
+	for _, s := range p.cfg.Scopes {
+		if s == "openid" {
+			return p.cfg.Scopes
+		}
+	}
+	return append([]string{"openid"}, p.cfg.Scopes...)
+}
+
+// metadata 获取并缓存身份提供方的配置，返回的 issuer 必须与配置一致
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var meta metadata
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &meta); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("%w: issuer 为 %q，与配置的 %q 不一致", ErrDiscovery, meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: 缺少 authorization_endpoint、token_endpoint 或 jwks_uri", ErrDiscovery)
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s 返回 HTTP %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBody)).Decode(v)
+}
+
+// RandomString 生成 n 字节随机数的 base64url 编码，用于 state、nonce 和 code_verifier
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge 按 S256 方法由 code_verifier 计算 code_challenge（RFC 7636）
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,39 @@
+// Package pagination 列表查询共用的分页参数
+package pagination
+
+const (
+	// DefaultPageSize 未指定时每页的条数
+	DefaultPageSize = 10
+	// MaxPageSize 每页最多的条数
+	MaxPageSize = 100
+)
+
+// Pagination 分页参数，嵌入到各个列表查询参数中
+type Pagination struct {
+	Page     int
+	PageSize int
+}
+
+// Normalize 修正分页参数，页码从1开始，每页默认10条，最多100条
+func (p Pagination) Normalize() Pagination {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.PageSize < 1 {
+		p.PageSize = DefaultPageSize
+	}
+	if p.PageSize > MaxPageSize {
+		p.PageSize = MaxPageSize
+	}
+	return p
+}
+
+// Offset 当前页第一条记录的偏移量，需要先调用 Normalize
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// TotalPages 按每页条数计算总页数，需要先调用 Normalize
+func (p Pagination) TotalPages(total int64) int64 {
+	return (total + int64(p.PageSize) - 1) / int64(p.PageSize)
+}
@@ -0,0 +1,31 @@
+package pagination
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want Pagination
+	}{
+		{Pagination{}, Pagination{Page: 1, PageSize: DefaultPageSize}},
+		{Pagination{Page: -1, PageSize: -5}, Pagination{Page: 1, PageSize: DefaultPageSize}},
+		{Pagination{Page: 3, PageSize: 20}, Pagination{Page: 3, PageSize: 20}},
+		{Pagination{Page: 2, PageSize: MaxPageSize + 1}, Pagination{Page: 2, PageSize: MaxPageSize}},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Normalize(); got != tt.want {
+			t.Errorf("%+v.Normalize() = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestOffsetAndTotalPages(t *testing.T) {
+	p := Pagination{Page: 3, PageSize: 10}
+	if got := p.Offset(); got != 20 {
+		t.Fatalf("Offset() = %d, want 20", got)
+	}
+	for total, want := range map[int64]int64{0: 0, 1: 1, 10: 1, 11: 2, 100: 10} {
+		if got := p.TotalPages(total); got != want {
+			t.Errorf("TotalPages(%d) = %d, want %d", total, got, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package policywatch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"qaqmall/config"
+)
+
+// RedisWatcher 通过 Redis 的发布订阅通知其他实例授权策略已修改，实现 Casbin 的 persist.Watcher
+// 消息内容为发送方的实例ID，收到自己发出的消息时忽略
+type RedisWatcher struct {
+	client  *redis.Client
+	pubsub  *redis.PubSub
+	channel string
+	id      string
+
+	mu       sync.RWMutex
+	callback func(string)
+}
+
+// NewRedisWatcher 订阅 channel，订阅失败时返回错误
+func NewRedisWatcher(cfg config.RedisConfig, channel string) (*RedisWatcher, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pubsub := client.Subscribe(ctx, channel)
+	// 等待订阅确认，Redis 不可用时启动失败而不是静默地收不到通知
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		client.Close()
+		return nil, err
+	}
+
+	w := &RedisWatcher{client: client, pubsub: pubsub, channel: channel, id: hex.EncodeToString(id)}
+	go w.run()
+	return w, nil
+}
+
+// run 接收其他实例的通知，连接断开后 go-redis 会自动重连并重新订阅
+func (w *RedisWatcher) run() {
+	for msg := range w.pubsub.Channel() {
+		if msg.Payload == w.id {
+			continue
+		}
+		w.mu.RLock()
+		callback := w.callback
+		w.mu.RUnlock()
+		if callback != nil {
+			callback(msg.Payload)
+		}
+	}
+}
+
+func (w *RedisWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update 通知其他实例重新加载策略
+func (w *RedisWatcher) Update() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return w.client.Publish(ctx, w.channel, w.id).Err()
+}
+
+func (w *RedisWatcher) Close() {
+	if err := w.pubsub.Close(); err != nil {
+		log.Printf("关闭授权策略订阅失败: %v", err)
+	}
+	w.client.Close()
+}
@@ -0,0 +1,114 @@
+package retrieval
+
+import (
+	"context"
+	"math"
+	"sync"
+)
+
+// BM25 参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// BM25Index 进程内的 BM25 倒排索引，不依赖外部服务
+type BM25Index struct {
+	mu       sync.RWMutex
+	docs     map[uint64]map[string]int // 文档ID -> 词频
+	lengths  map[uint64]int
+	postings map[string]map[uint64]bool // 词 -> 包含该词的文档
+	totalLen int
+}
+
+func NewBM25Index() *BM25Index {
+	return &BM25Index{
+		docs:     make(map[uint64]map[string]int),
+		lengths:  make(map[uint64]int),
+		postings: make(map[string]map[uint64]bool),
+	}
+}
+
+func (x *BM25Index) Upsert(ctx context.Context, docs ...Document) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, doc := range docs {
+		x.remove(doc.ID)
+
+		tokens := Tokenize(doc.Text)
+		tf := make(map[string]int, len(tokens))
+		for _, t := range tokens {
+			tf[t]++
+		}
+		for t := range tf {
+			if x.postings[t] == nil {
+				x.postings[t] = make(map[uint64]bool)
+			}
+			x.postings[t][doc.ID] = true
+		}
+		x.docs[doc.ID] = tf
+		x.lengths[doc.ID] = len(tokens)
+		x.totalLen += len(tokens)
+	}
+	return nil
+}
+
+func (x *BM25Index) Remove(ids ...uint64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, id := range ids {
+		x.remove(id)
+	}
+}
+
+// Search 查询词重复出现时按出现次数累计得分
+func (x *BM25Index) Search(ctx context.Context, query string, k int) ([]Hit, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	n := len(x.docs)
+	if n == 0 || k <= 0 {
+		return nil, nil
+	}
+	avgLen := float64(x.totalLen) / float64(n)
+
+	scores := make(map[uint64]float64)
+	for _, t := range Tokenize(query) {
+		posting := x.postings[t]
+		if len(posting) == 0 {
+			continue
+		}
+		df := float64(len(posting))
+		idf := math.Log(1 + (float64(n)-df+0.5)/(df+0.5))
+		for id := range posting {
+			tf := float64(x.docs[id][t])
+			norm := tf + bm25K1*(1-bm25B+bm25B*float64(x.lengths[id])/avgLen)
+			scores[id] += idf * tf * (bm25K1 + 1) / norm
+		}
+	}
+	return topK(scores, k), nil
+}
+
+func (x *BM25Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.docs)
+}
+
+func (x *BM25Index) remove(id uint64) {
+	tf, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	for t := range tf {
+		delete(x.postings[t], id)
+		if len(x.postings[t]) == 0 {
+			delete(x.postings, t)
+		}
+	}
+	x.totalLen -= x.lengths[id]
+	delete(x.docs, id)
+	delete(x.lengths, id)
+}
@@ -0,0 +1,134 @@
+package retrieval
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"  ，。 ", nil},
+		{"iPhone 15 Pro", []string{"iphone", "15", "pro"}},
+		{"蓝牙耳机", []string{"蓝", "蓝牙", "牙", "牙耳", "耳", "耳机", "机"}},
+		{"USB-C充电器", []string{"usb", "c", "充", "充电", "电", "电器", "器"}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// smallCorpus 用于检验排序的小语料
+var smallCorpus = []Document{
+	{ID: 1, Text: "无线蓝牙耳机 降噪 长续航"},
+	{ID: 2, Text: "有线耳机 入耳式"},
+	{ID: 3, Text: "键盘 青轴 RGB背光 全尺寸 热插拔"},
+	{ID: 4, Text: "蓝牙音箱 便携 防水"},
+	{ID: 5, Text: "游戏鼠标 RGB 无线"},
+}
+
+func hitIDs(hits []Hit) []uint64 {
+	ids := make([]uint64, 0, len(hits))
+	for _, h := range hits {
+		ids = append(ids, h.ID)
+	}
+	return ids
+}
+
+func TestBM25Ranking(t *testing.T) {
+	ctx := context.Background()
+	x := NewBM25Index()
+	if err := x.Upsert(ctx, smallCorpus...); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		k     int
+		want  []uint64
+	}{
+		// 同时命中蓝牙和耳机的文档排在只命中其中一个的前面
+		{"蓝牙耳机", 10, []uint64{1, 2, 4}},
+		{"键盘", 10, []uint64{3}},
+		// 英文不区分大小写，词频相同时较短的文档在前
+		{"RGB", 10, []uint64{5, 3}},
+		{"无线", 1, []uint64{5}},
+		{"显示器", 10, []uint64{}},
+	}
+	for _, tt := range tests {
+		hits, err := x.Search(ctx, tt.query, tt.k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hitIDs(hits); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q, %d) = %v, want %v", tt.query, tt.k, got, tt.want)
+		}
+		for i := 1; i < len(hits); i++ {
+			if hits[i].Score > hits[i-1].Score {
+				t.Errorf("Search(%q): hits not sorted by score: %+v", tt.query, hits)
+			}
+		}
+	}
+}
+
+func TestBM25UpsertAndRemove(t *testing.T) {
+	ctx := context.Background()
+	x := NewBM25Index()
+	if err := x.Upsert(ctx, smallCorpus...); err != nil {
+		t.Fatal(err)
+	}
+
+	// 覆盖已有文档后旧内容不再命中
+	if err := x.Upsert(ctx, Document{ID: 3, Text: "显示器 27寸"}); err != nil {
+		t.Fatal(err)
+	}
+	if hits, _ := x.Search(ctx, "键盘", 10); len(hits) != 0 {
+		t.Fatalf("stale content still indexed: %+v", hits)
+	}
+	if hits, _ := x.Search(ctx, "显示器", 10); !reflect.DeepEqual(hitIDs(hits), []uint64{3}) {
+		t.Fatalf("updated content not indexed: %+v", hits)
+	}
+
+	x.Remove(1, 100)
+	if x.Len() != len(smallCorpus)-1 {
+		t.Fatalf("Len() = %d, want %d", x.Len(), len(smallCorpus)-1)
+	}
+	if hits, _ := x.Search(ctx, "蓝牙耳机", 10); !reflect.DeepEqual(hitIDs(hits), []uint64{2, 4}) {
+		t.Fatalf("removed document returned: %+v", hits)
+	}
+}
+
+func TestSearchEmpty(t *testing.T) {
+	ctx := context.Background()
+	indexes := map[string]Index{
+		"bm25":      NewBM25Index(),
+		"embedding": NewEmbeddingIndex(NewHashEmbedder(64)),
+	}
+	for name, x := range indexes {
+		t.Run(name, func(t *testing.T) {
+			// 空索引
+			if hits, err := x.Search(ctx, "耳机", 10); err != nil || len(hits) != 0 {
+				t.Fatalf("empty corpus: hits = %+v, err = %v", hits, err)
+			}
+
+			if err := x.Upsert(ctx, smallCorpus...); err != nil {
+				t.Fatal(err)
+			}
+			// 空查询、只有标点的查询和 k 不大于0时没有结果
+			for _, query := range []string{"", "  ，？"} {
+				if hits, err := x.Search(ctx, query, 10); err != nil || len(hits) != 0 {
+					t.Fatalf("query %q: hits = %+v, err = %v", query, hits, err)
+				}
+			}
+			if hits, err := x.Search(ctx, "耳机", 0); err != nil || len(hits) != 0 {
+				t.Fatalf("k = 0: hits = %+v, err = %v", hits, err)
+			}
+		})
+	}
+}
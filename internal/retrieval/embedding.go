@@ -0,0 +1,230 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Embedder 文本向量化后端，返回的向量与 texts 一一对应
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbeddingIndex 进程内的向量索引，按余弦相似度暴力检索，适合商品数量不大的场景
+type EmbeddingIndex struct {
+	embedder Embedder
+	mu       sync.RWMutex
+	vectors  map[uint64][]float32
+}
+
+func NewEmbeddingIndex(embedder Embedder) *EmbeddingIndex {
+	return &EmbeddingIndex{embedder: embedder, vectors: make(map[uint64][]float32)}
+}
+
+// Upsert 先批量向量化再写入，向量化失败时索引保持不变
+func (x *EmbeddingIndex) Upsert(ctx context.Context, docs ...Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.Text
+	}
+	vectors, err := x.embedder.Embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	if len(vectors) != len(docs) {
+		return fmt.Errorf("向量数量 %d 与文档数量 %d 不一致", len(vectors), len(docs))
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for i, doc := range docs {
+		x.vectors[doc.ID] = normalize(vectors[i])
+	}
+	return nil
+}
+
+func (x *EmbeddingIndex) Remove(ids ...uint64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, id := range ids {
+		delete(x.vectors, id)
+	}
+}
+
+// Search 只返回相似度大于0的文档
+func (x *EmbeddingIndex) Search(ctx context.Context, query string, k int) ([]Hit, error) {
+	if k <= 0 || x.Len() == 0 {
+		return nil, nil
+	}
+
+	vectors, err := x.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, errors.New("查询向量化失败")
+	}
+	q := normalize(vectors[0])
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	scores := make(map[uint64]float64)
+	for id, v := range x.vectors {
+		if score := dot(q, v); score > 0 {
+			scores[id] = score
+		}
+	}
+	return topK(scores, k), nil
+}
+
+func (x *EmbeddingIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.vectors)
+}
+
+// HashEmbedder 基于特征哈希的本地向量化，把分词结果散列到固定维度，不依赖外部服务
+// 只能表达字面上的重合，语义检索需要使用 OpenAIEmbedder 等真正的向量模型
+type HashEmbedder struct {
+	dimensions int
+}
+
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	return &HashEmbedder{dimensions: dimensions}
+}
+
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, e.dimensions)
+		for _, t := range Tokenize(text) {
+			h := fnv.New32a()
+			h.Write([]byte(t))
+			sum := h.Sum32()
+			// 最高位决定符号，减少哈希冲突带来的偏差
+			if sum&(1<<31) != 0 {
+				v[sum%uint32(e.dimensions)] -= 1
+			} else {
+				v[sum%uint32(e.dimensions)] += 1
+			}
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+// OpenAIEmbedder OpenAI 兼容的 /v1/embeddings 接口
+type OpenAIEmbedder struct {
+	apiURL string
+	apiKey string
+	model  string
+	client *http.Client
+}
+
+func NewOpenAIEmbedder(apiURL, apiKey, model string, timeout time.Duration) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		apiURL: apiURL,
+		apiKey: apiKey,
+		model:  model,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(embeddingRequest{Model: e.model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.apiURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.apiKey)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("向量化接口返回 %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var out embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("向量化接口返回了无效的序号 %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("向量化接口缺少第 %d 条文本的结果", i)
+		}
+	}
+	return vectors, nil
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
+
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
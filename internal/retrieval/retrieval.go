@@ -0,0 +1,233 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/models"
+)
+
+// rebuildBatchSize 重建索引时每批加载和向量化的商品数
+const rebuildBatchSize = 200
+
+// Document 待索引的文档
+type Document struct {
+	ID   uint64
+	Text string
+}
+
+// Hit 检索结果，Score 越大越相关，不同索引的分数不可比较
+type Hit struct {
+	ID    uint64
+	Score float64
+}
+
+// Index 检索索引后端，需要并发安全
+type Index interface {
+	// Upsert 写入或覆盖文档
+	Upsert(ctx context.Context, docs ...Document) error
+	// Remove 删除文档，不存在的ID忽略
+	Remove(ids ...uint64)
+	// Search 返回与查询最相关的至多 k 个文档，按分数从高到低排序
+	Search(ctx context.Context, query string, k int) ([]Hit, error)
+	// Len 已索引的文档数
+	Len() int
+}
+
+// NewIndex 根据配置创建索引
+func NewIndex(cfg *config.Config) (Index, error) {
+	rc := cfg.Retrieval
+	switch rc.Index {
+	case config.RetrievalIndexBM25:
+		return NewBM25Index(), nil
+	case config.RetrievalIndexEmbedding:
+		switch rc.Embedder {
+		case config.EmbedderHash:
+			return NewEmbeddingIndex(NewHashEmbedder(rc.Embedding.Dimensions)), nil
+		case config.EmbedderOpenAI:
+			return NewEmbeddingIndex(NewOpenAIEmbedder(rc.Embedding.APIURL, cfg.OpenAI.APIKey, rc.Embedding.Model, cfg.LLM.Timeout)), nil
+		default:
+			return nil, fmt.Errorf("不支持的向量化后端: %s", rc.Embedder)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的检索索引: %s", rc.Index)
+	}
+}
+
+// ProductRetriever 在售商品的检索，索引商品名称、分类和描述
+// 商品服务在创建、修改、删除商品后调用 ProductSaved、ProductDeleted 同步索引；
+// 其他实例对商品的修改由 Run 定期重建时同步，只有内容变化的商品会重新写入索引
+type ProductRetriever struct {
+	db    *gorm.DB
+	index Index
+
+	mu      sync.Mutex
+	indexed map[uint64]uint64 // 商品ID -> 已索引文本的哈希
+}
+
+func NewProductRetriever(db *gorm.DB, index Index) *ProductRetriever {
+	return &ProductRetriever{db: db, index: index, indexed: make(map[uint64]uint64)}
+}
+
+// Search 返回与查询最相关的至多 k 个在售商品，预加载 Categories
+func (r *ProductRetriever) Search(ctx context.Context, query string, k int) ([]models.Product, error) {
+	hits, err := r.index.Search(ctx, query, k)
+	if err != nil || len(hits) == 0 {
+		return nil, err
+	}
+
+	ids := make([]uint64, len(hits))
+	rank := make(map[uint64]int, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+		rank[hit.ID] = i
+	}
+
+	var products []models.Product
+	if err := r.db.WithContext(ctx).Preload("Categories").
+		Where("id IN ? AND is_on_sale = ?", ids, true).
+		Find(&products).Error; err != nil {
+		return nil, err
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return rank[products[i].ID] < rank[products[j].ID]
+	})
+	return products, nil
+}
+
+// ProductSaved 商品创建或修改后同步索引，下架的商品从索引中移除
+// 商品需要预加载 Categories，同步失败只记录日志，由下一次重建修复
+func (r *ProductRetriever) ProductSaved(ctx context.Context, product *models.Product) {
+	if !product.IsOnSale {
+		r.ProductDeleted(ctx, product.ID)
+		return
+	}
+
+	doc := productDocument(product)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.index.Upsert(ctx, doc); err != nil {
+		log.Printf("更新商品索引失败 product_id=%d: %v", product.ID, err)
+		return
+	}
+	r.indexed[product.ID] = hashText(doc.Text)
+}
+
+// ProductDeleted 商品删除后从索引中移除
+func (r *ProductRetriever) ProductDeleted(ctx context.Context, id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.index.Remove(id)
+	delete(r.indexed, id)
+}
+
+// Rebuild 与数据库中的在售商品对齐：写入新增和内容变化的商品，移除已下架或删除的商品
+func (r *ProductRetriever) Rebuild(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[uint64]bool, len(r.indexed))
+	var products []models.Product
+	result := r.db.WithContext(ctx).Preload("Categories").
+		Where("is_on_sale = ?", true).
+		FindInBatches(&products, rebuildBatchSize, func(tx *gorm.DB, batch int) error {
+			var docs []Document
+			hashes := make(map[uint64]uint64)
+			for i := range products {
+				seen[products[i].ID] = true
+				doc := productDocument(&products[i])
+				hash := hashText(doc.Text)
+				if r.indexed[doc.ID] != hash {
+					docs = append(docs, doc)
+					hashes[doc.ID] = hash
+				}
+			}
+			if err := r.index.Upsert(ctx, docs...); err != nil {
+				return err
+			}
+			for id, hash := range hashes {
+				r.indexed[id] = hash
+			}
+			return nil
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	var stale []uint64
+	for id := range r.indexed {
+		if !seen[id] {
+			stale = append(stale, id)
+			delete(r.indexed, id)
+		}
+	}
+	r.index.Remove(stale...)
+	return nil
+}
+
+// Run 每隔 interval 重建一次索引，直到 ctx 取消；interval 不大于0时只在调用时重建一次
+func (r *ProductRetriever) Run(ctx context.Context, interval time.Duration) {
+	if err := r.Rebuild(ctx); err != nil {
+		log.Printf("重建商品索引失败: %v", err)
+	}
+	log.Printf("商品索引已加载 products=%d", r.index.Len())
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Rebuild(ctx); err != nil {
+				log.Printf("重建商品索引失败: %v", err)
+			}
+		}
+	}
+}
+
+// productDocument 商品的索引文本，名称重复一次以提高名称命中的权重
+func productDocument(p *models.Product) Document {
+	parts := []string{p.Name, p.Name}
+	for _, c := range p.Categories {
+		parts = append(parts, c.Name)
+	}
+	parts = append(parts, p.Description)
+	return Document{ID: p.ID, Text: strings.Join(parts, "\n")}
+}
+
+func hashText(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// topK 按分数从高到低取前 k 个，分数相同时ID小的在前
+func topK(scores map[uint64]float64, k int) []Hit {
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
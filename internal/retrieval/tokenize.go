@@ -0,0 +1,47 @@
+package retrieval
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize 简单分词：英文和数字按连续字符切分并转小写，汉字切分为单字和相邻双字
+// 返回的词保留重复，便于统计词频
+func Tokenize(s string) []string {
+	var tokens []string
+	var word []rune
+	var han []rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushHan := func() {
+		for i, r := range han {
+			tokens = append(tokens, string(r))
+			if i+1 < len(han) {
+				tokens = append(tokens, string(han[i:i+2]))
+			}
+		}
+		han = han[:0]
+	}
+
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return tokens
+}
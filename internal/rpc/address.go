@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "qaqmall/api/address/v1"
+	"qaqmall/internal/authz"
+	"qaqmall/internal/service/address"
+	"qaqmall/models"
+)
+
+// AddressServer gRPC 收货地址服务
+type AddressServer struct {
+	pb.UnimplementedAddressServiceServer
+	addresses *address.AddressService
+}
+
+func NewAddressServer(addresses *address.AddressService) *AddressServer {
+	return &AddressServer{addresses: addresses}
+}
+
+func (s *AddressServer) CreateAddress(ctx context.Context, req *pb.CreateAddressRequest) (*pb.CreateAddressResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodPost); err != nil {
+		return nil, err
+	}
+
+	addr, err := s.addresses.Create(ctx, req.UserId, address.AddressInput{
+		Name:       req.Name,
+		Phone:      req.Phone,
+		Province:   req.Province,
+		City:       req.City,
+		District:   req.District,
+		Street:     req.Street,
+		Detail:     req.Detail,
+		PostalCode: req.PostalCode,
+		Tag:        req.Tag,
+		IsDefault:  req.IsDefault,
+	})
+	if err != nil {
+		return nil, addressStatus(err)
+	}
+	return &pb.CreateAddressResponse{Address: toAddress(addr)}, nil
+}
+
+func (s *AddressServer) ListAddresses(ctx context.Context, req *pb.ListAddressesRequest) (*pb.ListAddressesResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodGet); err != nil {
+		return nil, err
+	}
+
+	addresses, err := s.addresses.List(ctx, req.UserId)
+	if err != nil {
+		return nil, addressStatus(err)
+	}
+
+	resp := &pb.ListAddressesResponse{Total: int32(len(addresses))}
+	for i := range addresses {
+		resp.Addresses = append(resp.Addresses, toAddress(&addresses[i]))
+	}
+	return resp, nil
+}
+
+func (s *AddressServer) GetAddress(ctx context.Context, req *pb.GetAddressRequest) (*pb.GetAddressResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodGet); err != nil {
+		return nil, err
+	}
+
+	addr, err := s.addresses.Get(ctx, userSubject(req.UserId), req.AddressId)
+	if err != nil {
+		return nil, addressStatus(err)
+	}
+	return &pb.GetAddressResponse{Address: toAddress(addr)}, nil
+}
+
+func (s *AddressServer) UpdateAddress(ctx context.Context, req *pb.UpdateAddressRequest) (*pb.UpdateAddressResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodPut); err != nil {
+		return nil, err
+	}
+
+	addr, err := s.addresses.Update(ctx, userSubject(req.UserId), req.AddressId, address.AddressInput{
+		Name:       req.Name,
+		Phone:      req.Phone,
+		Province:   req.Province,
+		City:       req.City,
+		District:   req.District,
+		Street:     req.Street,
+		Detail:     req.Detail,
+		PostalCode: req.PostalCode,
+		Tag:        req.Tag,
+		IsDefault:  req.IsDefault,
+	})
+	if err != nil {
+		return nil, addressStatus(err)
+	}
+	return &pb.UpdateAddressResponse{Address: toAddress(addr)}, nil
+}
+
+func (s *AddressServer) SetDefaultAddress(ctx context.Context, req *pb.SetDefaultAddressRequest) (*pb.SetDefaultAddressResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodPost); err != nil {
+		return nil, err
+	}
+
+	addr, err := s.addresses.SetDefault(ctx, userSubject(req.UserId), req.AddressId)
+	if err != nil {
+		return nil, addressStatus(err)
+	}
+	return &pb.SetDefaultAddressResponse{Address: toAddress(addr)}, nil
+}
+
+func (s *AddressServer) DeleteAddress(ctx context.Context, req *pb.DeleteAddressRequest) (*pb.DeleteAddressResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodDelete); err != nil {
+		return nil, err
+	}
+
+	if err := s.addresses.Delete(ctx, userSubject(req.UserId), req.AddressId); err != nil {
+		return nil, addressStatus(err)
+	}
+	return &pb.DeleteAddressResponse{
+		Success: true,
+		Message: "地址已删除",
+	}, nil
+}
+
+// userSubject 以请求中的用户身份访问地址，调用方已经通过 authorizeUser 检查
+func userSubject(userID uint64) authz.Subject {
+	return authz.Subject{ID: userID, Role: models.RoleUser}
+}
+
+func toAddress(a *models.Address) *pb.Address {
+	return &pb.Address{
+		Id:         a.ID,
+		UserId:     a.UserID,
+		Name:       a.Name,
+		Phone:      a.Phone,
+		Province:   a.Province,
+		City:       a.City,
+		District:   a.District,
+		Street:     a.Street,
+		Detail:     a.Detail,
+		PostalCode: a.PostalCode,
+		Tag:        a.Tag,
+		IsDefault:  a.IsDefault,
+	}
+}
+
+// addressStatus 将地址服务的错误转换为 gRPC 状态码
+func addressStatus(err error) error {
+	switch {
+	case errors.Is(err, address.ErrAddressNotFound), errors.Is(err, address.ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, address.ErrAddressForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, address.ErrInvalidAddress):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, "服务内部错误")
+	}
+}
@@ -0,0 +1,127 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "qaqmall/api/ai_query/v1"
+	"qaqmall/internal/pagination"
+	aiquery "qaqmall/internal/service/ai_query"
+	"qaqmall/models"
+)
+
+// AIQueryServer gRPC 智能商品查询服务
+type AIQueryServer struct {
+	pb.UnimplementedAIQueryServiceServer
+	queries *aiquery.AIQueryService
+}
+
+func NewAIQueryServer(queries *aiquery.AIQueryService) *AIQueryServer {
+	return &AIQueryServer{queries: queries}
+}
+
+func (s *AIQueryServer) QueryProducts(ctx context.Context, req *pb.QueryProductsRequest) (*pb.QueryProductsResponse, error) {
+	q := aiquery.Query{
+		Query:      req.Query,
+		Pagination: pagination.Pagination{Page: int(req.Page), PageSize: int(req.PageSize)}.Normalize(),
+		SortBy:     req.SortBy,
+		Ascending:  req.Ascending,
+		Filters:    req.Filters,
+	}
+
+	result, err := s.queries.QueryProducts(ctx, q)
+	if err != nil {
+		return nil, aiQueryStatus(err)
+	}
+
+	return &pb.QueryProductsResponse{
+		Products:    toScoredProducts(result.Products),
+		Total:       int32(result.Total),
+		TotalPages:  int32(q.TotalPages(result.Total)),
+		Suggestions: result.Suggestions,
+	}, nil
+}
+
+func (s *AIQueryServer) GetRecommendations(ctx context.Context, req *pb.GetRecommendationsRequest) (*pb.GetRecommendationsResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodGet); err != nil {
+		return nil, err
+	}
+
+	products, id, err := s.queries.GetRecommendations(ctx, req.UserId, int(req.Limit), req.Context)
+	if err != nil {
+		return nil, aiQueryStatus(err)
+	}
+	return &pb.GetRecommendationsResponse{
+		Products:         toScoredProducts(products),
+		RecommendationId: id,
+	}, nil
+}
+
+func (s *AIQueryServer) GetSimilarProducts(ctx context.Context, req *pb.GetSimilarProductsRequest) (*pb.GetSimilarProductsResponse, error) {
+	products, err := s.queries.GetSimilarProducts(ctx, req.ProductId, int(req.Limit), req.Aspects)
+	if err != nil {
+		return nil, aiQueryStatus(err)
+	}
+	return &pb.GetSimilarProductsResponse{Products: toScoredProducts(products)}, nil
+}
+
+func (s *AIQueryServer) ClassifyProducts(ctx context.Context, req *pb.ClassifyProductsRequest) (*pb.ClassifyProductsResponse, error) {
+	classifications, err := s.queries.ClassifyProducts(ctx, req.ProductIds, req.ClassificationType)
+	if err != nil {
+		return nil, aiQueryStatus(err)
+	}
+
+	resp := &pb.ClassifyProductsResponse{}
+	for _, c := range classifications {
+		group := &pb.Classification{Category: c.Category, Description: c.Description}
+		for i := range c.Products {
+			group.Products = append(group.Products, toAIProduct(&c.Products[i], 0))
+		}
+		resp.Classifications = append(resp.Classifications, group)
+	}
+	return resp, nil
+}
+
+func toAIProduct(p *models.Product, score float64) *pb.Product {
+	product := &pb.Product{
+		Id:              p.ID,
+		Name:            p.Name,
+		Description:     p.Description,
+		Price:           p.Price,
+		Stock:           int32(p.Stock),
+		ImageUrl:        p.ImageURL,
+		IsOnSale:        p.IsOnSale,
+		SimilarityScore: score,
+	}
+	for _, c := range p.Categories {
+		product.Categories = append(product.Categories, c.Name)
+	}
+	return product
+}
+
+func toScoredProducts(products []aiquery.ScoredProduct) []*pb.Product {
+	result := make([]*pb.Product, 0, len(products))
+	for i := range products {
+		result = append(result, toAIProduct(&products[i].Product, products[i].Score))
+	}
+	return result
+}
+
+// aiQueryStatus 将智能查询服务的错误转换为 gRPC 状态码
+func aiQueryStatus(err error) error {
+	switch {
+	case errors.Is(err, aiquery.ErrProductNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, aiquery.ErrInvalidFilter),
+		errors.Is(err, aiquery.ErrUnsupportedAspect),
+		errors.Is(err, aiquery.ErrUnsupportedClassification),
+		errors.Is(err, aiquery.ErrEmptyProductIDs):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, "服务内部错误")
+	}
+}
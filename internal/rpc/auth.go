@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "qaqmall/api/auth/v1"
+	"qaqmall/internal/service/auth"
+	"qaqmall/internal/service/user"
+	"qaqmall/models"
+)
+
+// AuthServer gRPC 身份令牌服务，与 HTTP 接口共用 auth.TokenService
+type AuthServer struct {
+	pb.UnimplementedAuthServiceServer
+	tokens *auth.TokenService
+	users  *user.UserService
+}
+
+func NewAuthServer(tokens *auth.TokenService, users *user.UserService) *AuthServer {
+	return &AuthServer{tokens: tokens, users: users}
+}
+
+// GenerateToken 为用户签发token，仅限携带了内部服务凭证的调用
+// 签发的角色不能高于用户实际角色；被禁用或开启了二次验证的用户不能通过该接口签发
+func (s *AuthServer) GenerateToken(ctx context.Context, req *pb.GenerateTokenRequest) (*pb.GenerateTokenResponse, error) {
+	if err := requireInternal(ctx); err != nil {
+		return nil, err
+	}
+
+	u, err := s.users.Get(ctx, req.UserId)
+	if err != nil {
+		return nil, userStatus(err)
+	}
+
+	role := roleName(req.Role)
+	if role == models.RoleAdmin && u.Role != models.RoleAdmin {
+		return nil, status.Error(codes.PermissionDenied, "不能签发高于用户实际角色的token")
+	}
+
+	issued := *u
+	issued.Role = role
+	token, expiresAt, err := s.users.AccessToken(ctx, &issued)
+	if err != nil {
+		if errors.Is(err, user.ErrMFARequired) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, userStatus(err)
+	}
+
+	return &pb.GenerateTokenResponse{
+		Token:     token,
+		ExpiresAt: expiresAt.Unix(),
+	}, nil
+}
+
+// VerifyToken 校验token，无效token返回 IsValid=false 而不是错误
+func (s *AuthServer) VerifyToken(ctx context.Context, req *pb.VerifyTokenRequest) (*pb.VerifyTokenResponse, error) {
+	claims, err := s.tokens.Verify(ctx, req.Token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) {
+			return &pb.VerifyTokenResponse{IsValid: false}, nil
+		}
+		return nil, status.Error(codes.Internal, "token校验失败")
+	}
+
+	return &pb.VerifyTokenResponse{
+		IsValid:      true,
+		UserId:       claims.UserID,
+		Role:         roleValue(claims.Role),
+		Username:     claims.Username,
+		ExpiresAt:    claims.ExpiresAt.Unix(),
+		NeedsRenewal: s.tokens.NeedsRenewal(claims),
+	}, nil
+}
+
+// RenewToken 续期token，不能超过登录会话的最长有效期 jwt.session_max_age
+func (s *AuthServer) RenewToken(ctx context.Context, req *pb.RenewTokenRequest) (*pb.RenewTokenResponse, error) {
+	token, expiresAt, err := s.tokens.Renew(ctx, req.OldToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) || errors.Is(err, auth.ErrSessionExpired) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "续期token失败")
+	}
+
+	return &pb.RenewTokenResponse{
+		NewToken:  token,
+		ExpiresAt: expiresAt.Unix(),
+	}, nil
+}
+
+func roleName(role pb.Role) string {
+	if role == pb.Role_ROLE_ADMIN {
+		return models.RoleAdmin
+	}
+	return models.RoleUser
+}
+
+func roleValue(role string) pb.Role {
+	if role == models.RoleAdmin {
+		return pb.Role_ROLE_ADMIN
+	}
+	return pb.Role_ROLE_USER
+}
@@ -0,0 +1,135 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "qaqmall/api/cart/v1"
+	"qaqmall/internal/service/cart"
+	"qaqmall/models"
+)
+
+// CartServer gRPC 购物车服务
+type CartServer struct {
+	pb.UnimplementedCartServiceServer
+	carts *cart.CartService
+}
+
+func NewCartServer(carts *cart.CartService) *CartServer {
+	return &CartServer{carts: carts}
+}
+
+func (s *CartServer) AddToCart(ctx context.Context, req *pb.AddToCartRequest) (*pb.AddToCartResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodPost); err != nil {
+		return nil, err
+	}
+
+	item, err := s.carts.Add(ctx, req.UserId, req.ProductId, int(req.Quantity))
+	if err != nil {
+		return nil, cartStatus(err)
+	}
+	return &pb.AddToCartResponse{Item: toCartItem(item)}, nil
+}
+
+func (s *CartServer) GetCart(ctx context.Context, req *pb.GetCartRequest) (*pb.GetCartResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodGet); err != nil {
+		return nil, err
+	}
+
+	c, err := s.carts.Get(ctx, req.UserId)
+	if err != nil {
+		return nil, cartStatus(err)
+	}
+
+	resp := &pb.GetCartResponse{
+		TotalPrice:       c.TotalPrice,
+		TotalQuantity:    int32(c.TotalQuantity),
+		SelectedQuantity: int32(c.SelectedQuantity),
+		SelectedPrice:    c.SelectedPrice,
+	}
+	for i := range c.Items {
+		resp.Items = append(resp.Items, toCartItem(&c.Items[i]))
+	}
+	return resp, nil
+}
+
+func (s *CartServer) UpdateCartItem(ctx context.Context, req *pb.UpdateCartItemRequest) (*pb.UpdateCartItemResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodPut); err != nil {
+		return nil, err
+	}
+
+	item, err := s.carts.Update(ctx, req.UserId, req.CartItemId, int(req.Quantity), req.Selected)
+	if err != nil {
+		return nil, cartStatus(err)
+	}
+	return &pb.UpdateCartItemResponse{Item: toCartItem(item)}, nil
+}
+
+func (s *CartServer) GetCartItemCount(ctx context.Context, req *pb.GetCartItemCountRequest) (*pb.GetCartItemCountResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodGet); err != nil {
+		return nil, err
+	}
+
+	count, err := s.carts.Count(ctx, req.UserId)
+	if err != nil {
+		return nil, cartStatus(err)
+	}
+	return &pb.GetCartItemCountResponse{Count: int32(count)}, nil
+}
+
+func (s *CartServer) RemoveFromCart(ctx context.Context, req *pb.RemoveFromCartRequest) (*pb.RemoveFromCartResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodDelete); err != nil {
+		return nil, err
+	}
+
+	if err := s.carts.Remove(ctx, req.UserId, req.CartItemId); err != nil {
+		return nil, cartStatus(err)
+	}
+	return &pb.RemoveFromCartResponse{
+		Success: true,
+		Message: "购物车项已删除",
+	}, nil
+}
+
+func (s *CartServer) ClearCart(ctx context.Context, req *pb.ClearCartRequest) (*pb.ClearCartResponse, error) {
+	if err := authorizeUser(ctx, req.UserId, http.MethodDelete); err != nil {
+		return nil, err
+	}
+
+	if err := s.carts.Clear(ctx, req.UserId); err != nil {
+		return nil, cartStatus(err)
+	}
+	return &pb.ClearCartResponse{
+		Success: true,
+		Message: "购物车已清空",
+	}, nil
+}
+
+func toCartItem(item *models.CartItem) *pb.CartItem {
+	return &pb.CartItem{
+		Id:           item.ID,
+		UserId:       item.UserID,
+		ProductId:    item.ProductID,
+		ProductName:  item.ProductName,
+		ProductImage: item.ProductImage,
+		Price:        item.Price,
+		Quantity:     int32(item.Quantity),
+		Selected:     item.Selected,
+	}
+}
+
+// cartStatus 将购物车服务的错误转换为 gRPC 状态码
+func cartStatus(err error) error {
+	switch {
+	case errors.Is(err, cart.ErrProductNotFound), errors.Is(err, cart.ErrCartItemNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, cart.ErrInvalidQuantity):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, "服务内部错误")
+	}
+}
@@ -0,0 +1,155 @@
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"qaqmall/internal/service/auth"
+)
+
+type claimsKey struct{}
+type tokenKey struct{}
+type serviceKey struct{}
+type policyKey struct{}
+
+// Enforcer 按用户在授权策略中的角色检查权限，由 middleware.CasbinPolicies 实现
+type Enforcer interface {
+	EnforceUser(userID uint64, obj, act string) (bool, error)
+}
+
+// policy 管理员操作的权限检查，由 AuthInterceptor 放入 context
+type policy struct {
+	enforcer Enforcer
+	adminMFA bool
+}
+
+// serviceTokenHeader 内部服务调用时携带凭证的 metadata
+const serviceTokenHeader = "x-service-token"
+
+// AuthInterceptor 解析 metadata 中的 authorization: Bearer {token} 和内部服务凭证 x-service-token
+// serviceToken 为 server.grpc_service_token，为空时不接受内部调用；凭证不正确或携带了无效token时拒绝
+// 两者都没有携带的调用只能访问不需要认证的接口（注册、登录、商品查询等），需要认证的接口由各方法检查
+// 管理员的操作按用户在授权策略中的角色检查，与 HTTP 的 /admin 接口使用同样的路径和方法；
+// adminMFA 为 mfa.require_for_admin，为 true 时这些操作只接受登录时通过了二次验证的 token
+func AuthInterceptor(tokens *auth.TokenService, serviceToken string, enforcer Enforcer, adminMFA bool) grpc.UnaryServerInterceptor {
+	p := &policy{enforcer: enforcer, adminMFA: adminMFA}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = context.WithValue(ctx, policyKey{}, p)
+		md, ok := metadata.FromIncomingContext(ctx)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		if values := md.Get(serviceTokenHeader); len(values) > 0 {
+			if serviceToken == "" || subtle.ConstantTimeCompare([]byte(values[0]), []byte(serviceToken)) != 1 {
+				return nil, status.Error(codes.Unauthenticated, "无效的服务凭证")
+			}
+			ctx = context.WithValue(ctx, serviceKey{}, true)
+		}
+
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return handler(ctx, req)
+		}
+
+		parts := strings.SplitN(values[0], " ", 2)
+		if !(len(parts) == 2 && parts[0] == "Bearer") {
+			return nil, status.Error(codes.Unauthenticated, "认证格式错误")
+		}
+
+		claims, err := tokens.Verify(ctx, parts[1])
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "无效的token")
+		}
+
+		ctx = context.WithValue(ctx, claimsKey{}, claims)
+		ctx = context.WithValue(ctx, tokenKey{}, parts[1])
+		return handler(ctx, req)
+	}
+}
+
+// claimsFromContext 获取 AuthInterceptor 解析出的用户信息
+func claimsFromContext(ctx context.Context) (*auth.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*auth.Claims)
+	return claims, ok
+}
+
+// isInternal 调用方是否携带了正确的内部服务凭证
+func isInternal(ctx context.Context) bool {
+	internal, _ := ctx.Value(serviceKey{}).(bool)
+	return internal
+}
+
+// requireInternal 要求调用方携带内部服务凭证
+func requireInternal(ctx context.Context) error {
+	if !isInternal(ctx) {
+		return status.Error(codes.Unauthenticated, "仅限内部服务调用")
+	}
+	return nil
+}
+
+// tokenFromContext 获取调用方携带的token
+func tokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(tokenKey{}).(string)
+	return token
+}
+
+// requirePermission 要求调用方携带token，且用户的角色对 HTTP 接口中对应的路径 obj 和方法 act 有权限
+func requirePermission(ctx context.Context, obj, act string) error {
+	claims, ok := claimsFromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "未提供认证信息")
+	}
+	return checkPermission(ctx, claims, obj, act, "没有权限访问该资源")
+}
+
+// checkPermission 通过授权策略检查权限，denied 为没有权限时返回的信息
+// 开启 mfa.require_for_admin 时还要求 token 在登录时通过了二次验证，与 HTTP 的 /admin 接口一致
+func checkPermission(ctx context.Context, claims *auth.Claims, obj, act, denied string) error {
+	p, _ := ctx.Value(policyKey{}).(*policy)
+	if p == nil {
+		return status.Error(codes.PermissionDenied, denied)
+	}
+	ok, err := p.enforcer.EnforceUser(claims.UserID, obj, act)
+	if err != nil {
+		return status.Error(codes.Internal, "权限检查失败")
+	}
+	if !ok {
+		return status.Error(codes.PermissionDenied, denied)
+	}
+	if p.adminMFA && !claims.MFA {
+		return status.Error(codes.PermissionDenied, "该操作需要开启二次验证，并在登录时完成验证")
+	}
+	return nil
+}
+
+// authorizeUser 携带了token时只能操作自己的数据，act 为 HTTP 方法；操作其他用户的数据需要对 /admin/users/{id} 有权限
+// 携带了内部服务凭证时不限制，两者都没有时拒绝
+func authorizeUser(ctx context.Context, userID uint64, act string) error {
+	claims, ok := claimsFromContext(ctx)
+	if !ok {
+		if isInternal(ctx) {
+			return nil
+		}
+		return status.Error(codes.Unauthenticated, "未提供认证信息")
+	}
+	if claims.UserID == userID {
+		return nil
+	}
+	return checkPermission(ctx, claims, "/admin/users/"+strconv.FormatUint(userID, 10), act, "无权操作其他用户的数据")
+}
+
+// authorizeUserToken 要求调用方携带用户token，只能操作自己的数据，有权限的管理员除外；内部服务凭证不能代替
+func authorizeUserToken(ctx context.Context, userID uint64, act string) error {
+	if _, ok := claimsFromContext(ctx); !ok {
+		return status.Error(codes.Unauthenticated, "未提供认证信息")
+	}
+	return authorizeUser(ctx, userID, act)
+}
@@ -0,0 +1,87 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"qaqmall/internal/service/auth"
+)
+
+// fakeEnforcer 按用户ID返回角色，operator 只能查看订单，admin 可以访问 /admin 下的所有接口
+type fakeEnforcer map[uint64]string
+
+func (e fakeEnforcer) EnforceUser(userID uint64, obj, act string) (bool, error) {
+	switch e[userID] {
+	case "admin":
+		return true, nil
+	case "operator":
+		return obj == "/admin/orders" && act == http.MethodGet, nil
+	}
+	return false, nil
+}
+
+func withClaims(enforcer Enforcer, adminMFA bool, claims *auth.Claims) context.Context {
+	ctx := context.WithValue(context.Background(), policyKey{}, &policy{enforcer: enforcer, adminMFA: adminMFA})
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func TestRequirePermission(t *testing.T) {
+	enforcer := fakeEnforcer{1: "admin", 2: "operator"}
+	tests := []struct {
+		name     string
+		adminMFA bool
+		claims   *auth.Claims
+		obj, act string
+		want     codes.Code
+	}{
+		{name: "admin", claims: &auth.Claims{UserID: 1}, obj: "/admin/users", act: http.MethodGet, want: codes.OK},
+		// 权限取决于授权策略中用户的角色，不看 token 中的角色
+		{name: "stale admin role", claims: &auth.Claims{UserID: 3, Role: "admin"}, obj: "/admin/users", act: http.MethodGet, want: codes.PermissionDenied},
+		{name: "operator allowed", claims: &auth.Claims{UserID: 2, Role: "user"}, obj: "/admin/orders", act: http.MethodGet, want: codes.OK},
+		{name: "operator denied", claims: &auth.Claims{UserID: 2}, obj: "/admin/users", act: http.MethodGet, want: codes.PermissionDenied},
+		{name: "mfa required", adminMFA: true, claims: &auth.Claims{UserID: 1}, obj: "/admin/users", act: http.MethodGet, want: codes.PermissionDenied},
+		{name: "mfa passed", adminMFA: true, claims: &auth.Claims{UserID: 1, MFA: true}, obj: "/admin/users", act: http.MethodGet, want: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := requirePermission(withClaims(enforcer, tt.adminMFA, tt.claims), tt.obj, tt.act)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("code = %v, want %v (err = %v)", got, tt.want, err)
+			}
+		})
+	}
+
+	if err := requirePermission(context.Background(), "/admin/users", http.MethodGet); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("no token: err = %v, want Unauthenticated", err)
+	}
+}
+
+func TestAuthorizeUser(t *testing.T) {
+	enforcer := fakeEnforcer{1: "admin"}
+
+	// 操作自己的数据不需要权限和二次验证
+	if err := authorizeUser(withClaims(enforcer, true, &auth.Claims{UserID: 5}), 5, http.MethodPut); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorizeUser(withClaims(enforcer, true, &auth.Claims{UserID: 5, Role: "admin"}), 6, http.MethodGet); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("other user: err = %v, want PermissionDenied", err)
+	}
+	if err := authorizeUser(withClaims(enforcer, true, &auth.Claims{UserID: 1}), 6, http.MethodGet); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("admin without mfa: err = %v, want PermissionDenied", err)
+	}
+	if err := authorizeUser(withClaims(enforcer, true, &auth.Claims{UserID: 1, MFA: true}), 6, http.MethodGet); err != nil {
+		t.Fatal(err)
+	}
+
+	internal := context.WithValue(context.Background(), serviceKey{}, true)
+	if err := authorizeUser(internal, 6, http.MethodGet); err != nil {
+		t.Fatalf("internal call: %v", err)
+	}
+	if err := authorizeUserToken(internal, 6, http.MethodGet); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("internal call without token: err = %v, want Unauthenticated", err)
+	}
+}
@@ -0,0 +1,188 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "qaqmall/api/product/v1"
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/product"
+	"qaqmall/models"
+)
+
+// ProductServer gRPC 商品服务
+type ProductServer struct {
+	pb.UnimplementedProductServiceServer
+	products *product.ProductService
+}
+
+func NewProductServer(products *product.ProductService) *ProductServer {
+	return &ProductServer{products: products}
+}
+
+func (s *ProductServer) ListCategories(ctx context.Context, req *pb.ListCategoriesRequest) (*pb.ListCategoriesResponse, error) {
+	categories, err := s.products.ListCategories(ctx, req.OnlyActive)
+	if err != nil {
+		return nil, productStatus(err)
+	}
+
+	resp := &pb.ListCategoriesResponse{}
+	for _, category := range categories {
+		resp.Categories = append(resp.Categories, toCategory(category))
+	}
+	return resp, nil
+}
+
+func (s *ProductServer) CreateProduct(ctx context.Context, req *pb.CreateProductRequest) (*pb.CreateProductResponse, error) {
+	if err := requirePermission(ctx, "/admin/products", http.MethodPost); err != nil {
+		return nil, err
+	}
+
+	p, err := s.products.Create(ctx, product.ProductInput{
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       req.Price,
+		Stock:       int(req.Stock),
+		ImageURL:    req.ImageUrl,
+		IsOnSale:    req.IsOnSale,
+		CategoryIDs: append([]uint64{req.CategoryId}, req.CategoryIds...),
+	})
+	if err != nil {
+		return nil, productStatus(err)
+	}
+
+	return &pb.CreateProductResponse{Product: toProduct(p)}, nil
+}
+
+func (s *ProductServer) GetProduct(ctx context.Context, req *pb.GetProductRequest) (*pb.GetProductResponse, error) {
+	p, err := s.products.Get(ctx, req.Id)
+	if err != nil {
+		return nil, productStatus(err)
+	}
+	return &pb.GetProductResponse{Product: toProduct(p)}, nil
+}
+
+func (s *ProductServer) UpdateProduct(ctx context.Context, req *pb.UpdateProductRequest) (*pb.UpdateProductResponse, error) {
+	if err := requirePermission(ctx, productPath(req.Id), http.MethodPut); err != nil {
+		return nil, err
+	}
+
+	p, err := s.products.Update(ctx, req.Id, product.ProductInput{
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       req.Price,
+		Stock:       int(req.Stock),
+		ImageURL:    req.ImageUrl,
+		IsOnSale:    req.IsOnSale,
+		CategoryIDs: append([]uint64{req.CategoryId}, req.CategoryIds...),
+	})
+	if err != nil {
+		return nil, productStatus(err)
+	}
+
+	return &pb.UpdateProductResponse{Product: toProduct(p)}, nil
+}
+
+func (s *ProductServer) ListProducts(ctx context.Context, req *pb.ListProductsRequest) (*pb.ListProductsResponse, error) {
+	products, total, err := s.products.List(ctx, product.Query{
+		Pagination: pagination.Pagination{Page: int(req.Page), PageSize: int(req.PageSize)},
+		CategoryID: req.CategoryId,
+		OnlyOnSale: req.OnlyOnSale,
+		SortBy:     req.SortBy,
+		Desc:       req.Desc,
+	})
+	if err != nil {
+		return nil, productStatus(err)
+	}
+
+	return &pb.ListProductsResponse{Products: toProducts(products), Total: total}, nil
+}
+
+func (s *ProductServer) SearchProducts(ctx context.Context, req *pb.SearchProductsRequest) (*pb.SearchProductsResponse, error) {
+	products, total, err := s.products.List(ctx, product.Query{
+		Pagination: pagination.Pagination{Page: int(req.Page), PageSize: int(req.PageSize)},
+		Keyword:    req.Keyword,
+		MinPrice:   req.MinPrice,
+		MaxPrice:   req.MaxPrice,
+		CategoryID: req.CategoryId,
+		OnlyOnSale: req.OnlyOnSale,
+		SortBy:     req.SortBy,
+		Desc:       req.Desc,
+	})
+	if err != nil {
+		return nil, productStatus(err)
+	}
+
+	return &pb.SearchProductsResponse{Products: toProducts(products), Total: total}, nil
+}
+
+func (s *ProductServer) DeleteProduct(ctx context.Context, req *pb.DeleteProductRequest) (*pb.DeleteProductResponse, error) {
+	if err := requirePermission(ctx, productPath(req.Id), http.MethodDelete); err != nil {
+		return nil, err
+	}
+
+	if err := s.products.Delete(ctx, req.Id); err != nil {
+		return nil, productStatus(err)
+	}
+
+	return &pb.DeleteProductResponse{
+		Success: true,
+		Message: "商品已删除",
+	}, nil
+}
+
+func toCategory(c models.Category) *pb.Category {
+	return &pb.Category{
+		Id:          c.ID,
+		Name:        c.Name,
+		Description: c.Description,
+	}
+}
+
+func toProduct(p *models.Product) *pb.Product {
+	result := &pb.Product{
+		Id:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		Stock:       int32(p.Stock),
+		ImageUrl:    p.ImageURL,
+		IsOnSale:    p.IsOnSale,
+		CreatedAt:   p.CreatedAt.Unix(),
+		UpdatedAt:   p.UpdatedAt.Unix(),
+	}
+	for _, category := range p.Categories {
+		result.Categories = append(result.Categories, toCategory(category))
+	}
+	return result
+}
+
+func toProducts(products []models.Product) []*pb.Product {
+	result := make([]*pb.Product, 0, len(products))
+	for i := range products {
+		result = append(result, toProduct(&products[i]))
+	}
+	return result
+}
+
+// productStatus 将商品服务的错误转换为 gRPC 状态码
+func productStatus(err error) error {
+	switch {
+	case errors.Is(err, product.ErrProductNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, product.ErrCategoryNotFound), errors.Is(err, product.ErrInvalidProduct):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, "服务内部错误")
+	}
+}
+
+// productPath 商品在 HTTP 管理接口中的路径，用于权限检查
+func productPath(id uint64) string {
+	return "/admin/products/" + strconv.FormatUint(id, 10)
+}
@@ -0,0 +1,187 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	pb "qaqmall/api/user/v1"
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/security"
+	"qaqmall/internal/service/user"
+	"qaqmall/models"
+)
+
+// UserServer gRPC 用户服务
+type UserServer struct {
+	pb.UnimplementedUserServiceServer
+	users *user.UserService
+}
+
+func NewUserServer(users *user.UserService) *UserServer {
+	return &UserServer{users: users}
+}
+
+func (s *UserServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	u, err := s.users.Register(ctx, user.RegisterInput{
+		Username: req.Username,
+		Password: req.Password,
+		Email:    req.Email,
+		Phone:    req.Phone,
+	})
+	if err != nil {
+		return nil, userStatus(err)
+	}
+
+	return &pb.RegisterResponse{
+		UserId:   u.ID,
+		Username: u.Username,
+		Role:     u.Role,
+	}, nil
+}
+
+func (s *UserServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	u, err := s.users.Authenticate(ctx, req.Username, req.Password, peerIP(ctx))
+	if err != nil {
+		return nil, userStatus(err)
+	}
+
+	token, expiresAt, err := s.users.AccessToken(ctx, u)
+	if err != nil {
+		if errors.Is(err, user.ErrMFARequired) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "生成token失败")
+	}
+
+	return &pb.LoginResponse{
+		UserId:    u.ID,
+		Username:  u.Username,
+		Role:      u.Role,
+		Token:     token,
+		ExpiresAt: expiresAt.Unix(),
+	}, nil
+}
+
+// GetUserInfo 需要携带token，只能查询自己，有 GET /admin/users/{id} 权限的管理员可以查询任意用户
+func (s *UserServer) GetUserInfo(ctx context.Context, req *pb.GetUserInfoRequest) (*pb.UserInfo, error) {
+	if err := authorizeUserToken(ctx, req.UserId, http.MethodGet); err != nil {
+		return nil, err
+	}
+
+	u, err := s.users.Get(ctx, req.UserId)
+	if err != nil {
+		return nil, userStatus(err)
+	}
+	return toUserInfo(u), nil
+}
+
+// UpdateUser 需要携带token，只能修改自己，有 PUT /admin/users/{id} 权限的管理员可以修改任意用户
+func (s *UserServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.UpdateUserResponse, error) {
+	if err := authorizeUserToken(ctx, req.UserId, http.MethodPut); err != nil {
+		return nil, err
+	}
+
+	u, err := s.users.Update(ctx, req.UserId, req.Email, req.Phone)
+	if err != nil {
+		return nil, userStatus(err)
+	}
+
+	return &pb.UpdateUserResponse{
+		Success: true,
+		Message: "更新成功",
+		User:    toUserInfo(u),
+	}, nil
+}
+
+// ListUsers 需要有 GET /admin/users 的权限
+func (s *UserServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	if err := requirePermission(ctx, "/admin/users", http.MethodGet); err != nil {
+		return nil, err
+	}
+
+	query := user.ListQuery{
+		Pagination: pagination.Pagination{Page: int(req.Page), PageSize: int(req.PageSize)}.Normalize(),
+		Search:     req.Search,
+		Role:       req.Role,
+	}
+	users, total, err := s.users.List(ctx, query)
+	if err != nil {
+		return nil, userStatus(err)
+	}
+
+	resp := &pb.ListUsersResponse{
+		Total:      total,
+		TotalPages: int32(query.TotalPages(total)),
+	}
+	for i := range users {
+		resp.Users = append(resp.Users, toUserInfo(&users[i]))
+	}
+	return resp, nil
+}
+
+// DeleteUser 需要携带token，只能删除自己，有 DELETE /admin/users/{id} 权限的管理员可以删除任意用户
+// 操作人以token中的身份为准，请求中的 operator_id、operator_role 不再使用
+func (s *UserServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
+	if err := authorizeUserToken(ctx, req.UserId, http.MethodDelete); err != nil {
+		return nil, err
+	}
+
+	if err := s.users.Delete(ctx, req.UserId, tokenFromContext(ctx)); err != nil {
+		return nil, userStatus(err)
+	}
+
+	return &pb.DeleteUserResponse{
+		Success: true,
+		Message: "用户已删除",
+	}, nil
+}
+
+func toUserInfo(u *models.User) *pb.UserInfo {
+	return &pb.UserInfo{
+		UserId:    u.ID,
+		Username:  u.Username,
+		Role:      u.Role,
+		Email:     u.Email,
+		Phone:     u.Phone,
+		CreatedAt: u.CreatedAt.Unix(),
+	}
+}
+
+// userStatus 将用户服务的错误转换为 gRPC 状态码
+func userStatus(err error) error {
+	switch {
+	case errors.Is(err, user.ErrEmptyCredentials):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, user.ErrUserExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, user.ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, user.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, security.ErrLocked):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, user.ErrUserDisabled):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Error(codes.Internal, "服务内部错误")
+	}
+}
+
+// peerIP 返回 gRPC 客户端的 IP，用于按 IP 统计登录失败
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
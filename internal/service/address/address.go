@@ -0,0 +1,263 @@
+package address
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"qaqmall/internal/authz"
+	"qaqmall/models"
+)
+
+var (
+	ErrAddressNotFound  = errors.New("地址不存在")
+	ErrAddressForbidden = errors.New("无权操作该地址")
+	ErrInvalidAddress   = errors.New("收货人、电话和详细地址不能为空")
+	ErrUserNotFound     = errors.New("用户不存在")
+)
+
+// AddressInput 创建、修改地址的参数
+type AddressInput struct {
+	Name       string
+	Phone      string
+	Province   string
+	City       string
+	District   string
+	Street     string
+	Detail     string
+	PostalCode string
+	Tag        string
+	IsDefault  bool
+}
+
+// AddressService 收货地址业务逻辑，HTTP 和 gRPC 共用
+// 所有修改默认地址的操作都在事务中先锁定地址所属用户的记录，保证每个有地址的用户有且只有一个默认地址
+// 按 ID 访问地址时由 authz 按授权策略检查权限
+type AddressService struct {
+	db    *gorm.DB
+	authz *authz.Authorizer
+}
+
+func NewAddressService(db *gorm.DB, authorizer *authz.Authorizer) *AddressService {
+	return &AddressService{db: db, authz: authorizer}
+}
+
+// List 获取用户的地址列表，默认地址排在最前面
+func (s *AddressService) List(ctx context.Context, userID uint64) ([]models.Address, error) {
+	var addresses []models.Address
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).
+		Order("is_default DESC, id").
+		Find(&addresses).Error; err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+// Get 获取地址详情
+func (s *AddressService) Get(ctx context.Context, sub authz.Subject, addressID uint64) (*models.Address, error) {
+	var address models.Address
+	if err := s.authz.Load(s.db.WithContext(ctx), sub, authz.ActRead, &address, addressID); err != nil {
+		return nil, addressError(err)
+	}
+	return &address, nil
+}
+
+// Default 获取用户的默认地址，没有地址时返回 ErrAddressNotFound
+func (s *AddressService) Default(ctx context.Context, userID uint64) (*models.Address, error) {
+	var address models.Address
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND is_default = ?", userID, true).
+		First(&address).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAddressNotFound
+		}
+		return nil, err
+	}
+	return &address, nil
+}
+
+// Create 创建地址，第一个地址自动成为默认地址
+func (s *AddressService) Create(ctx context.Context, userID uint64, in AddressInput) (*models.Address, error) {
+	if err := validate(in); err != nil {
+		return nil, err
+	}
+
+	address := models.Address{UserID: userID}
+	apply(&address, in)
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.Address{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			address.IsDefault = true
+		}
+
+		if address.IsDefault {
+			if err := clearDefault(tx, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&address).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// Update 修改地址，默认地址不能直接取消默认，只能把其他地址设为默认
+func (s *AddressService) Update(ctx context.Context, sub authz.Subject, addressID uint64, in AddressInput) (*models.Address, error) {
+	if err := validate(in); err != nil {
+		return nil, err
+	}
+
+	var address *models.Address
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		address, err = s.lockAddress(tx, sub, authz.ActUpdate, addressID)
+		if err != nil {
+			return err
+		}
+
+		wasDefault := address.IsDefault
+		apply(address, in)
+		address.IsDefault = wasDefault || in.IsDefault
+
+		if address.IsDefault && !wasDefault {
+			if err := clearDefault(tx, address.UserID); err != nil {
+				return err
+			}
+		}
+		return tx.Save(address).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+// SetDefault 将地址设为默认地址，原默认地址取消默认
+func (s *AddressService) SetDefault(ctx context.Context, sub authz.Subject, addressID uint64) (*models.Address, error) {
+	var address *models.Address
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		address, err = s.lockAddress(tx, sub, authz.ActUpdate, addressID)
+		if err != nil {
+			return err
+		}
+
+		if err := clearDefault(tx, address.UserID); err != nil {
+			return err
+		}
+		address.IsDefault = true
+		return tx.Model(address).Update("is_default", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+// Delete 删除地址，删除的是默认地址时将最早创建的其他地址设为默认
+func (s *AddressService) Delete(ctx context.Context, sub authz.Subject, addressID uint64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		address, err := s.lockAddress(tx, sub, authz.ActDelete, addressID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(address).Error; err != nil {
+			return err
+		}
+
+		if !address.IsDefault {
+			return nil
+		}
+
+		var next models.Address
+		err = tx.Where("user_id = ?", address.UserID).Order("id").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&next).Update("is_default", true).Error
+	})
+}
+
+// lockUser 锁定用户记录，串行化同一用户的默认地址变更
+func lockUser(tx *gorm.DB, userID uint64) error {
+	var user models.User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		Where("id = ? AND deleted_at IS NULL", userID).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// clearDefault 取消用户所有地址的默认状态
+func clearDefault(tx *gorm.DB, userID uint64) error {
+	return tx.Model(&models.Address{}).
+		Where("user_id = ? AND is_default = ?", userID, true).
+		Update("is_default", false).Error
+}
+
+// lockAddress 检查 sub 能否对地址执行 act，并锁定地址所属用户的记录
+// 锁定后重新读取地址，避免读到锁定前被并发修改的状态
+func (s *AddressService) lockAddress(tx *gorm.DB, sub authz.Subject, act string, addressID uint64) (*models.Address, error) {
+	var address models.Address
+	if err := s.authz.Load(tx, sub, act, &address, addressID); err != nil {
+		return nil, addressError(err)
+	}
+	if err := lockUser(tx, address.UserID); err != nil {
+		return nil, err
+	}
+	if err := tx.First(&address, addressID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAddressNotFound
+		}
+		return nil, err
+	}
+	return &address, nil
+}
+
+// addressError 将权限检查的错误转换为地址的错误
+func addressError(err error) error {
+	switch {
+	case errors.Is(err, authz.ErrNotFound):
+		return ErrAddressNotFound
+	case errors.Is(err, authz.ErrForbidden):
+		return ErrAddressForbidden
+	default:
+		return err
+	}
+}
+
+func validate(in AddressInput) error {
+	if in.Name == "" || in.Phone == "" || in.Detail == "" {
+		return ErrInvalidAddress
+	}
+	return nil
+}
+
+func apply(address *models.Address, in AddressInput) {
+	address.Name = in.Name
+	address.Phone = in.Phone
+	address.Province = in.Province
+	address.City = in.City
+	address.District = in.District
+	address.Street = in.Street
+	address.Detail = in.Detail
+	address.PostalCode = in.PostalCode
+	address.Tag = in.Tag
+	address.IsDefault = in.IsDefault
+}
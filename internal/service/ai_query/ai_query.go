@@ -1 +1,557 @@
- 
\ No newline at end of file
+package aiquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/models"
+)
+
+var (
+	ErrProductNotFound           = errors.New("商品不存在")
+	ErrInvalidFilter             = errors.New("无效的过滤条件")
+	ErrUnsupportedAspect         = errors.New("不支持的相似度维度")
+	ErrUnsupportedClassification = errors.New("不支持的分类方式")
+	ErrEmptyProductIDs           = errors.New("商品ID不能为空")
+)
+
+const (
+	// maxCandidates 单次参与打分的最大商品数
+	maxCandidates = 1000
+	// maxSuggestions 搜索建议的最大条数
+	maxSuggestions = 5
+	// maxSeeds 推荐时参考的历史商品数
+	maxSeeds = 20
+)
+
+// 推荐场景
+const (
+	ContextHomepage = "homepage"
+	ContextCart     = "cart"
+)
+
+// 分类方式
+const (
+	ClassifyByPriceRange = "price_range"
+	ClassifyByCategory   = "category"
+	ClassifyByStock      = "stock"
+)
+
+// priceRanges 按价格分类时的区间，左闭右开
+var priceRanges = []struct {
+	min, max    float64
+	name, about string
+}{
+	{0, 100, "100元以下", "经济实惠"},
+	{100, 500, "100-500元", "中等价位"},
+	{500, 2000, "500-2000元", "中高端"},
+	{2000, 0, "2000元以上", "高端商品"},
+}
+
+// Query 智能搜索参数
+type Query struct {
+	Query string
+	pagination.Pagination
+	SortBy    string
+	Ascending bool
+	// Filters 格式为 key:value，支持 category、in_stock、on_sale、min_price、max_price
+	Filters []string
+}
+
+// ScoredProduct 带相关度的商品
+type ScoredProduct struct {
+	Product models.Product
+	Score   float64
+}
+
+// QueryResult 智能搜索结果
+type QueryResult struct {
+	Products    []ScoredProduct
+	Total       int64
+	Suggestions []string
+}
+
+// Classification 一组分类结果
+type Classification struct {
+	Category    string
+	Description string
+	Products    []models.Product
+}
+
+// filters 解析后的过滤条件
+type filters struct {
+	category string
+	inStock  bool
+	onSale   *bool
+	minPrice float64
+	maxPrice float64
+}
+
+// AIQueryService 智能商品查询，打分由 Model 完成
+type AIQueryService struct {
+	db    *gorm.DB
+	model Model
+}
+
+func NewAIQueryService(db *gorm.DB, model Model) *AIQueryService {
+	return &AIQueryService{db: db, model: model}
+}
+
+// QueryProducts 按查询词搜索商品，查询词为空时只按过滤条件筛选
+// 默认按相关度从高到低排序，其他排序字段支持 price、stock、name、created_at
+func (s *AIQueryService) QueryProducts(ctx context.Context, q Query) (*QueryResult, error) {
+	q.Pagination = q.Pagination.Normalize()
+	f, err := parseFilters(q.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.Product{}).Where("products.deleted_at IS NULL")
+	if f.onSale == nil || *f.onSale {
+		query = query.Where("products.is_on_sale = ?", true)
+	} else {
+		query = query.Where("products.is_on_sale = ?", false)
+	}
+	if f.inStock {
+		query = query.Where("products.stock > 0")
+	}
+	if f.minPrice > 0 {
+		query = query.Where("products.price >= ?", f.minPrice)
+	}
+	if f.maxPrice > 0 {
+		query = query.Where("products.price <= ?", f.maxPrice)
+	}
+	if f.category != "" {
+		query = query.Where(`EXISTS (SELECT 1 FROM product_categories pc
+			JOIN categories c ON c.id = pc.category_id
+			WHERE pc.product_id = products.id AND c.name = ?)`, f.category)
+	}
+
+	var products []models.Product
+	if err := query.Preload("Categories").Order("products.id").Limit(maxCandidates).Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	scores, err := s.model.Relevance(ctx, q.Query, products)
+	if err != nil {
+		return nil, err
+	}
+
+	keyword := strings.TrimSpace(q.Query)
+	var matches []ScoredProduct
+	for i, p := range products {
+		if keyword != "" && scores[i] <= 0 {
+			continue
+		}
+		matches = append(matches, ScoredProduct{Product: p, Score: scores[i]})
+	}
+
+	sortByScore(matches)
+	suggestions, err := s.suggest(ctx, keyword, matches)
+	if err != nil {
+		return nil, err
+	}
+	sortScored(matches, q.SortBy, q.Ascending)
+
+	result := &QueryResult{Total: int64(len(matches)), Suggestions: suggestions}
+	start := q.Offset()
+	if start < len(matches) {
+		end := min(start+q.PageSize, len(matches))
+		result.Products = matches[start:end]
+	}
+	return result, nil
+}
+
+// GetRecommendations 推荐商品
+// 以用户历史订单中的商品为种子（context 为 cart 时加上购物车商品），按与种子的最大相似度和销量综合打分；
+// 没有种子时按销量推荐。已购买或已在购物车中的商品不会被推荐
+func (s *AIQueryService) GetRecommendations(ctx context.Context, userID uint64, limit int, scene string) ([]ScoredProduct, string, error) {
+	limit = normalizeLimit(limit)
+	db := s.db.WithContext(ctx)
+
+	var seedIDs []uint64
+	if err := db.Model(&models.OrderItem{}).
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.user_id = ? AND orders.status <> ?", userID, models.OrderStatusCancelled).
+		Group("order_items.product_id").
+		Order("MAX(orders.created_at) DESC").
+		Limit(maxSeeds).
+		Pluck("order_items.product_id", &seedIDs).Error; err != nil {
+		return nil, "", err
+	}
+	if scene == ContextCart {
+		var cartIDs []uint64
+		if err := db.Model(&models.CartItem{}).Where("user_id = ?", userID).
+			Pluck("product_id", &cartIDs).Error; err != nil {
+			return nil, "", err
+		}
+		seedIDs = append(seedIDs, cartIDs...)
+	}
+
+	var seeds []models.Product
+	if len(seedIDs) > 0 {
+		if err := db.Preload("Categories").Where("id IN ?", seedIDs).Find(&seeds).Error; err != nil {
+			return nil, "", err
+		}
+	}
+
+	query := db.Preload("Categories").
+		Where("is_on_sale = ? AND stock > 0", true).
+		Order("id").
+		Limit(maxCandidates)
+	if len(seedIDs) > 0 {
+		query = query.Where("id NOT IN ?", seedIDs)
+	}
+	var candidates []models.Product
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil, "", err
+	}
+
+	popularity, err := s.popularity(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	scored := make([]ScoredProduct, len(candidates))
+	for i, p := range candidates {
+		scored[i] = ScoredProduct{Product: p, Score: popularity[p.ID]}
+	}
+
+	if len(seeds) > 0 {
+		best := make([]float64, len(candidates))
+		for _, seed := range seeds {
+			sims, err := s.model.Similarity(ctx, seed, candidates, nil)
+			if err != nil {
+				return nil, "", err
+			}
+			for i, sim := range sims {
+				best[i] = max(best[i], sim)
+			}
+		}
+		for i := range scored {
+			scored[i].Score = 0.7*best[i] + 0.3*scored[i].Score
+		}
+	}
+
+	sortByScore(scored)
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+
+	recommendationID := fmt.Sprintf("rec-%d-%d", userID, time.Now().UnixNano())
+	return scored, recommendationID, nil
+}
+
+// GetSimilarProducts 按指定维度查找与目标商品相似的在售商品，aspects 为空时使用全部维度
+func (s *AIQueryService) GetSimilarProducts(ctx context.Context, productID uint64, limit int, aspects []string) ([]ScoredProduct, error) {
+	limit = normalizeLimit(limit)
+	for _, aspect := range aspects {
+		if !validAspect(aspect) {
+			return nil, ErrUnsupportedAspect
+		}
+	}
+
+	db := s.db.WithContext(ctx)
+	var target models.Product
+	if err := db.Preload("Categories").First(&target, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	var candidates []models.Product
+	if err := db.Preload("Categories").
+		Where("id <> ? AND is_on_sale = ?", productID, true).
+		Order("id").
+		Limit(maxCandidates).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	scores, err := s.model.Similarity(ctx, target, candidates, aspects)
+	if err != nil {
+		return nil, err
+	}
+
+	var similar []ScoredProduct
+	for i, p := range candidates {
+		if scores[i] > 0 {
+			similar = append(similar, ScoredProduct{Product: p, Score: scores[i]})
+		}
+	}
+	sortByScore(similar)
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+	return similar, nil
+}
+
+// ClassifyProducts 对指定商品分组，支持按价格区间、商品分类和库存状态分组，空分组不返回
+func (s *AIQueryService) ClassifyProducts(ctx context.Context, productIDs []uint64, classificationType string) ([]Classification, error) {
+	if len(productIDs) == 0 {
+		return nil, ErrEmptyProductIDs
+	}
+
+	var classify func([]models.Product) []Classification
+	switch classificationType {
+	case ClassifyByPriceRange:
+		classify = classifyByPrice
+	case ClassifyByCategory:
+		classify = classifyByCategory
+	case ClassifyByStock:
+		classify = classifyByStock
+	default:
+		return nil, ErrUnsupportedClassification
+	}
+
+	var products []models.Product
+	if err := s.db.WithContext(ctx).Preload("Categories").
+		Where("id IN ?", productIDs).
+		Order("id").
+		Find(&products).Error; err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		return nil, ErrProductNotFound
+	}
+
+	return classify(products), nil
+}
+
+// suggest 搜索建议：优先取相关度最高的商品所属分类，不足时补充名称与查询词有重合的分类
+func (s *AIQueryService) suggest(ctx context.Context, keyword string, matches []ScoredProduct) ([]string, error) {
+	if keyword == "" {
+		return nil, nil
+	}
+
+	var suggestions []string
+	seen := map[string]bool{keyword: true}
+	add := func(name string) {
+		if len(suggestions) < maxSuggestions && !seen[name] {
+			seen[name] = true
+			suggestions = append(suggestions, name)
+		}
+	}
+
+	for _, m := range matches {
+		for _, c := range m.Product.Categories {
+			add(c.Name)
+		}
+	}
+	if len(suggestions) >= maxSuggestions {
+		return suggestions, nil
+	}
+
+	var categories []models.Category
+	if err := s.db.WithContext(ctx).Where("deleted_at IS NULL").Order("id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	terms := tokenSet(keyword)
+	for _, c := range categories {
+		if jaccard(terms, tokenSet(c.Name)) > 0 {
+			add(c.Name)
+		}
+	}
+	return suggestions, nil
+}
+
+// popularity 已支付订单中各商品的销量，归一化到 [0, 1]
+func (s *AIQueryService) popularity(ctx context.Context) (map[uint64]float64, error) {
+	var rows []struct {
+		ProductID uint64
+		Sold      int64
+	}
+	if err := s.db.WithContext(ctx).Model(&models.OrderItem{}).
+		Select("order_items.product_id, SUM(order_items.quantity) AS sold").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.status IN ?", []models.OrderStatus{
+			models.OrderStatusPaid, models.OrderStatusShipped, models.OrderStatusCompleted,
+		}).
+		Group("order_items.product_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var top int64
+	for _, r := range rows {
+		top = max(top, r.Sold)
+	}
+	popularity := make(map[uint64]float64, len(rows))
+	for _, r := range rows {
+		if top > 0 {
+			popularity[r.ProductID] = float64(r.Sold) / float64(top)
+		}
+	}
+	return popularity, nil
+}
+
+func parseFilters(raw []string) (filters, error) {
+	var f filters
+	for _, item := range raw {
+		key, value, ok := strings.Cut(item, ":")
+		if !ok {
+			return f, ErrInvalidFilter
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		var err error
+		switch key {
+		case "category":
+			f.category = value
+		case "in_stock":
+			f.inStock, err = strconv.ParseBool(value)
+		case "on_sale":
+			var onSale bool
+			onSale, err = strconv.ParseBool(value)
+			f.onSale = &onSale
+		case "min_price":
+			f.minPrice, err = strconv.ParseFloat(value, 64)
+		case "max_price":
+			f.maxPrice, err = strconv.ParseFloat(value, 64)
+		default:
+			return f, ErrInvalidFilter
+		}
+		if err != nil {
+			return f, ErrInvalidFilter
+		}
+	}
+	return f, nil
+}
+
+// sortByScore 按分数从高到低排序，分数相同时按商品ID排序，保证结果稳定
+func sortByScore(products []ScoredProduct) {
+	sort.SliceStable(products, func(i, j int) bool {
+		if products[i].Score != products[j].Score {
+			return products[i].Score > products[j].Score
+		}
+		return products[i].Product.ID < products[j].Product.ID
+	})
+}
+
+// sortScored 按指定字段排序，未知字段按相关度排序
+func sortScored(products []ScoredProduct, sortBy string, ascending bool) {
+	var less func(a, b *models.Product) bool
+	switch sortBy {
+	case "price":
+		less = func(a, b *models.Product) bool { return a.Price < b.Price }
+	case "stock":
+		less = func(a, b *models.Product) bool { return a.Stock < b.Stock }
+	case "name":
+		less = func(a, b *models.Product) bool { return a.Name < b.Name }
+	case "created_at":
+		less = func(a, b *models.Product) bool { return a.CreatedAt.Before(b.CreatedAt) }
+	default:
+		sortByScore(products)
+		return
+	}
+
+	sort.SliceStable(products, func(i, j int) bool {
+		a, b := &products[i].Product, &products[j].Product
+		if ascending {
+			return less(a, b)
+		}
+		return less(b, a)
+	})
+}
+
+func normalizeLimit(limit int) int {
+	if limit < 1 {
+		return 10
+	}
+	if limit > 50 {
+		return 50
+	}
+	return limit
+}
+
+func validAspect(aspect string) bool {
+	for _, a := range allAspects {
+		if a == aspect {
+			return true
+		}
+	}
+	return false
+}
+
+func classifyByPrice(products []models.Product) []Classification {
+	var result []Classification
+	for _, r := range priceRanges {
+		group := Classification{Category: r.name, Description: r.about}
+		for _, p := range products {
+			if p.Price >= r.min && (r.max == 0 || p.Price < r.max) {
+				group.Products = append(group.Products, p)
+			}
+		}
+		if len(group.Products) > 0 {
+			result = append(result, group)
+		}
+	}
+	return result
+}
+
+// classifyByCategory 属于多个分类的商品会出现在每个分类中，没有分类的商品归入"未分类"
+func classifyByCategory(products []models.Product) []Classification {
+	var result []Classification
+	index := make(map[uint64]int)
+	var uncategorized []models.Product
+
+	for _, p := range products {
+		if len(p.Categories) == 0 {
+			uncategorized = append(uncategorized, p)
+			continue
+		}
+		for _, c := range p.Categories {
+			i, ok := index[c.ID]
+			if !ok {
+				i = len(result)
+				index[c.ID] = i
+				result = append(result, Classification{Category: c.Name, Description: c.Description})
+			}
+			result[i].Products = append(result[i].Products, p)
+		}
+	}
+
+	if len(uncategorized) > 0 {
+		result = append(result, Classification{
+			Category:    "未分类",
+			Description: "没有关联分类的商品",
+			Products:    uncategorized,
+		})
+	}
+	return result
+}
+
+func classifyByStock(products []models.Product) []Classification {
+	groups := []Classification{
+		{Category: "缺货", Description: "库存为0"},
+		{Category: "库存紧张", Description: "库存少于10件"},
+		{Category: "库存充足", Description: "库存10件及以上"},
+	}
+	for _, p := range products {
+		switch {
+		case p.Stock <= 0:
+			groups[0].Products = append(groups[0].Products, p)
+		case p.Stock < 10:
+			groups[1].Products = append(groups[1].Products, p)
+		default:
+			groups[2].Products = append(groups[2].Products, p)
+		}
+	}
+
+	var result []Classification
+	for _, g := range groups {
+		if len(g.Products) > 0 {
+			result = append(result, g)
+		}
+	}
+	return result
+}
@@ -0,0 +1,251 @@
+package aiquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/testutil"
+	"qaqmall/models"
+)
+
+// newTestService 使用内存 SQLite，写入 testProducts 中的商品，以及一个下架商品5
+func newTestService(t *testing.T) (*AIQueryService, *gorm.DB) {
+	t.Helper()
+	db := testutil.NewSQLite(t, &models.Category{}, &models.Product{}, &models.Order{}, &models.OrderItem{}, &models.CartItem{})
+	for _, p := range testProducts() {
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	offSale := models.Product{ID: 5, Name: "Phone Case", Description: "phone case", Price: 99, Stock: 30, Categories: []models.Category{{ID: 3}}}
+	if err := db.Create(&offSale).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&offSale).Update("is_on_sale", false).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return NewAIQueryService(db, NewLocalModel()), db
+}
+
+func createOrder(t *testing.T, db *gorm.DB, userID uint64, status models.OrderStatus, productID uint64, quantity int) {
+	t.Helper()
+	order := models.Order{
+		OrderNumber: fmt.Sprintf("T%d-%d-%d", userID, productID, time.Now().UnixNano()),
+		UserID:      userID,
+		Status:      status,
+		ExpiredAt:   time.Now().Add(time.Hour),
+		Items:       []models.OrderItem{{ProductID: productID, ProductName: "p", Quantity: quantity}},
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func productIDs(products []ScoredProduct) []uint64 {
+	ids := make([]uint64, len(products))
+	for i, p := range products {
+		ids[i] = p.Product.ID
+	}
+	return ids
+}
+
+func classificationIDs(groups []Classification) map[string][]uint64 {
+	result := make(map[string][]uint64, len(groups))
+	for _, g := range groups {
+		for _, p := range g.Products {
+			result[g.Category] = append(result[g.Category], p.ID)
+		}
+	}
+	return result
+}
+
+func assertIDs(t *testing.T, got, want []uint64) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("ids = %v, want %v", got, want)
+	}
+}
+
+func TestQueryProducts(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	result, err := s.QueryProducts(ctx, Query{Query: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 下架的商品5不参与搜索，没有命中的商品3不返回
+	assertIDs(t, productIDs(result.Products), []uint64{2, 4, 1})
+	if result.Total != 3 {
+		t.Fatalf("total = %d, want 3", result.Total)
+	}
+	if fmt.Sprint(result.Suggestions) != fmt.Sprint([]string{"手机", "配件"}) {
+		t.Fatalf("suggestions = %v", result.Suggestions)
+	}
+
+	result, err = s.QueryProducts(ctx, Query{Query: "phone", SortBy: "price", Ascending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, productIDs(result.Products), []uint64{4, 2, 1})
+
+	result, err = s.QueryProducts(ctx, Query{Query: "phone", Filters: []string{"category:手机"}, Pagination: pagination.Pagination{Page: 2, PageSize: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, productIDs(result.Products), []uint64{1})
+	if result.Total != 2 {
+		t.Fatalf("total = %d, want 2", result.Total)
+	}
+
+	result, err = s.QueryProducts(ctx, Query{Filters: []string{"on_sale:false"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, productIDs(result.Products), []uint64{5})
+
+	if _, err := s.QueryProducts(ctx, Query{Filters: []string{"color:red"}}); !errors.Is(err, ErrInvalidFilter) {
+		t.Fatalf("err = %v, want ErrInvalidFilter", err)
+	}
+}
+
+func TestGetRecommendations(t *testing.T) {
+	s, db := newTestService(t)
+	ctx := context.Background()
+
+	// 用户1买过商品1；用户2买了3件商品4，商品4销量最高
+	createOrder(t, db, 1, models.OrderStatusCompleted, 1, 1)
+	createOrder(t, db, 2, models.OrderStatusPaid, 4, 3)
+	// 取消的订单不计入种子和销量
+	createOrder(t, db, 1, models.OrderStatusCancelled, 2, 10)
+
+	// 没有历史订单时按销量推荐，缺货的商品3和下架的商品5不推荐
+	products, _, err := s.GetRecommendations(ctx, 3, 10, ContextHomepage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, productIDs(products), []uint64{4, 1, 2})
+
+	// 与买过的商品1同类的商品2排在销量更高的商品4前面，商品1本身不推荐
+	products, _, err = s.GetRecommendations(ctx, 1, 10, ContextHomepage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, productIDs(products), []uint64{2, 4})
+
+	// 购物车中的商品同样作为种子且不推荐
+	if err := db.Create(&models.CartItem{UserID: 1, ProductID: 4, Quantity: 1, ProductName: "p"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	products, _, err = s.GetRecommendations(ctx, 1, 10, ContextCart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, productIDs(products), []uint64{2})
+
+	products, _, err = s.GetRecommendations(ctx, 3, 1, ContextHomepage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, productIDs(products), []uint64{4})
+}
+
+func TestGetSimilarProducts(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	products, err := s.GetSimilarProducts(ctx, 1, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同类的商品2最相似，下架的商品5不返回
+	assertIDs(t, productIDs(products), []uint64{2, 3, 4})
+	for i := 1; i < len(products); i++ {
+		if products[i].Score > products[i-1].Score {
+			t.Fatalf("scores not descending: %v", products)
+		}
+	}
+
+	// 只按名称比较时没有共同词的商品不返回
+	products, err = s.GetSimilarProducts(ctx, 1, 10, []string{AspectName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, productIDs(products), []uint64{3})
+
+	products, err = s.GetSimilarProducts(ctx, 1, 2, []string{AspectPrice})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, productIDs(products), []uint64{2, 3})
+
+	if _, err := s.GetSimilarProducts(ctx, 1, 10, []string{"color"}); !errors.Is(err, ErrUnsupportedAspect) {
+		t.Fatalf("err = %v, want ErrUnsupportedAspect", err)
+	}
+	if _, err := s.GetSimilarProducts(ctx, 100, 10, nil); !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("err = %v, want ErrProductNotFound", err)
+	}
+}
+
+func TestClassifyProducts(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+	ids := []uint64{5, 4, 3, 2, 1}
+
+	groups, err := s.ClassifyProducts(ctx, ids, ClassifyByPriceRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 空的 100-500元 分组不返回，分组按区间排序，组内按商品ID排序
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups, want 3", len(groups))
+	}
+	byPrice := classificationIDs(groups)
+	assertIDs(t, byPrice["100元以下"], []uint64{4, 5})
+	assertIDs(t, byPrice["500-2000元"], []uint64{3})
+	assertIDs(t, byPrice["2000元以上"], []uint64{1, 2})
+	if groups[0].Category != "100元以下" || groups[2].Category != "2000元以上" {
+		t.Fatalf("unexpected group order: %s, %s", groups[0].Category, groups[2].Category)
+	}
+
+	groups, err = s.ClassifyProducts(ctx, ids, ClassifyByCategory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.Category)
+	}
+	if fmt.Sprint(names) != fmt.Sprint([]string{"手机", "耳机", "配件"}) {
+		t.Fatalf("categories = %v", names)
+	}
+	byCategory := classificationIDs(groups)
+	assertIDs(t, byCategory["手机"], []uint64{1, 2})
+	assertIDs(t, byCategory["配件"], []uint64{4, 5})
+
+	groups, err = s.ClassifyProducts(ctx, ids, ClassifyByStock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byStock := classificationIDs(groups)
+	assertIDs(t, byStock["缺货"], []uint64{3})
+	assertIDs(t, byStock["库存紧张"], []uint64{2})
+	assertIDs(t, byStock["库存充足"], []uint64{1, 4, 5})
+
+	if _, err := s.ClassifyProducts(ctx, ids, "brand"); !errors.Is(err, ErrUnsupportedClassification) {
+		t.Fatalf("err = %v, want ErrUnsupportedClassification", err)
+	}
+	if _, err := s.ClassifyProducts(ctx, nil, ClassifyByStock); !errors.Is(err, ErrEmptyProductIDs) {
+		t.Fatalf("err = %v, want ErrEmptyProductIDs", err)
+	}
+	if _, err := s.ClassifyProducts(ctx, []uint64{100}, ClassifyByStock); !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("err = %v, want ErrProductNotFound", err)
+	}
+}
@@ -0,0 +1,164 @@
+package aiquery
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"qaqmall/internal/retrieval"
+	"qaqmall/models"
+)
+
+// 相似度比较维度
+const (
+	AspectPrice       = "price"
+	AspectCategory    = "category"
+	AspectName        = "name"
+	AspectDescription = "description"
+)
+
+// allAspects 未指定比较维度时使用全部维度
+var allAspects = []string{AspectPrice, AspectCategory, AspectName, AspectDescription}
+
+// Model 相关度模型后端，可以替换为基于向量或大模型的实现
+// 商品需要预加载 Categories
+type Model interface {
+	// Relevance 计算查询与每个商品的相关度，返回值与 products 一一对应，取值 [0, 1]
+	Relevance(ctx context.Context, query string, products []models.Product) ([]float64, error)
+	// Similarity 计算目标商品与每个候选商品在指定维度上的相似度，返回值与 candidates 一一对应，取值 [0, 1]
+	Similarity(ctx context.Context, target models.Product, candidates []models.Product, aspects []string) ([]float64, error)
+}
+
+// LocalModel 本地确定性模型，基于分词重合度计算，不依赖外部服务，相同输入总是得到相同结果
+type LocalModel struct{}
+
+func NewLocalModel() *LocalModel {
+	return &LocalModel{}
+}
+
+// 相关度中商品名称、分类名称和描述的权重
+const (
+	nameWeight        = 3.0
+	categoryWeight    = 2.0
+	descriptionWeight = 1.0
+)
+
+// Relevance 按查询词在商品名称、分类、描述中的覆盖率打分，名称包含完整查询时额外加分
+func (m *LocalModel) Relevance(ctx context.Context, query string, products []models.Product) ([]float64, error) {
+	scores := make([]float64, len(products))
+	query = strings.ToLower(strings.TrimSpace(query))
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return scores, nil
+	}
+
+	for i, p := range products {
+		name := tokenSet(p.Name)
+		description := tokenSet(p.Description)
+		categories := make(map[string]bool)
+		for _, c := range p.Categories {
+			for t := range tokenSet(c.Name) {
+				categories[t] = true
+			}
+		}
+
+		var hit float64
+		for _, t := range terms {
+			switch {
+			case name[t]:
+				hit += nameWeight
+			case categories[t]:
+				hit += categoryWeight
+			case description[t]:
+				hit += descriptionWeight
+			}
+		}
+
+		score := 0.8 * hit / (nameWeight * float64(len(terms)))
+		if strings.Contains(strings.ToLower(p.Name), query) {
+			score += 0.2
+		}
+		scores[i] = math.Min(score, 1)
+	}
+	return scores, nil
+}
+
+// Similarity 各维度相似度的平均值
+// 价格按相对差值计算，分类按分类ID的 Jaccard 系数，名称和描述按分词的 Jaccard 系数
+func (m *LocalModel) Similarity(ctx context.Context, target models.Product, candidates []models.Product, aspects []string) ([]float64, error) {
+	if len(aspects) == 0 {
+		aspects = allAspects
+	}
+
+	scores := make([]float64, len(candidates))
+	for i, c := range candidates {
+		var total float64
+		for _, aspect := range aspects {
+			switch aspect {
+			case AspectPrice:
+				total += priceSimilarity(target.Price, c.Price)
+			case AspectCategory:
+				total += jaccard(categoryIDs(target), categoryIDs(c))
+			case AspectName:
+				total += jaccard(tokenSet(target.Name), tokenSet(c.Name))
+			case AspectDescription:
+				total += jaccard(tokenSet(target.Description), tokenSet(c.Description))
+			default:
+				return nil, ErrUnsupportedAspect
+			}
+		}
+		scores[i] = total / float64(len(aspects))
+	}
+	return scores, nil
+}
+
+func priceSimilarity(a, b float64) float64 {
+	high := math.Max(a, b)
+	if high <= 0 {
+		return 1
+	}
+	return 1 - math.Abs(a-b)/high
+}
+
+func categoryIDs(p models.Product) map[uint64]bool {
+	ids := make(map[uint64]bool, len(p.Categories))
+	for _, c := range p.Categories {
+		ids[c.ID] = true
+	}
+	return ids
+}
+
+func jaccard[K comparable](a, b map[K]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	var inter int
+	for k := range a {
+		if b[k] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+func tokenSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, t := range tokenize(s) {
+		set[t] = true
+	}
+	return set
+}
+
+// tokenize 分词并去重，保持首次出现的顺序
+func tokenize(s string) []string {
+	tokens := retrieval.Tokenize(s)
+	seen := make(map[string]bool, len(tokens))
+	unique := tokens[:0]
+	for _, t := range tokens {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
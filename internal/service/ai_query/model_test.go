@@ -0,0 +1,119 @@
+package aiquery
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"qaqmall/models"
+)
+
+func testProducts() []models.Product {
+	phone := models.Category{ID: 1, Name: "手机"}
+	audio := models.Category{ID: 2, Name: "耳机"}
+	accessory := models.Category{ID: 3, Name: "配件"}
+	return []models.Product{
+		{ID: 1, Name: "Apple iPhone 15", Description: "旗舰 手机", Price: 5999, Stock: 50, Categories: []models.Category{phone}},
+		{ID: 2, Name: "Xiaomi Phone 14", Description: "性价比 手机", Price: 2999, Stock: 5, Categories: []models.Category{phone}},
+		{ID: 3, Name: "Apple AirPods Pro", Description: "无线 耳机", Price: 1899, Stock: 0, Categories: []models.Category{audio}},
+		{ID: 4, Name: "USB-C Cable", Description: "charging cable for phone", Price: 49, Stock: 200, Categories: []models.Category{accessory}},
+	}
+}
+
+func assertScores(t *testing.T, got, want []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d scores, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Fatalf("score[%d] = %v, want %v (all: %v)", i, got[i], want[i], got)
+		}
+	}
+}
+
+func TestLocalModelRelevance(t *testing.T) {
+	m := NewLocalModel()
+	products := testProducts()
+
+	scores, err := m.Relevance(context.Background(), "Apple iPhone", products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 商品1名称命中两个词且包含完整查询，商品3名称命中 apple
+	assertScores(t, scores, []float64{1, 0, 0.4, 0})
+
+	scores, err = m.Relevance(context.Background(), "phone", products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 名称命中 > 描述命中 > 名称只以子串包含查询
+	assertScores(t, scores, []float64{0.2, 1, 0, 0.8 / 3})
+
+	scores, err = m.Relevance(context.Background(), "  ", products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertScores(t, scores, []float64{0, 0, 0, 0})
+}
+
+func TestLocalModelSimilarity(t *testing.T) {
+	m := NewLocalModel()
+	products := testProducts()
+	target, candidates := products[0], products[1:]
+
+	scores, err := m.Similarity(context.Background(), target, candidates, []string{AspectCategory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertScores(t, scores, []float64{1, 0, 0})
+
+	scores, err = m.Similarity(context.Background(), target, candidates, []string{AspectName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// {apple, iphone, 15} 与 {apple, airpods, pro} 重合一个词
+	assertScores(t, scores, []float64{0, 0.2, 0})
+
+	scores, err = m.Similarity(context.Background(), target, candidates, []string{AspectPrice})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertScores(t, scores, []float64{2999.0 / 5999, 1899.0 / 5999, 49.0 / 5999})
+
+	if _, err := m.Similarity(context.Background(), target, candidates, []string{"color"}); !errors.Is(err, ErrUnsupportedAspect) {
+		t.Fatalf("err = %v, want ErrUnsupportedAspect", err)
+	}
+}
+
+func TestLocalModelDeterministic(t *testing.T) {
+	m := NewLocalModel()
+	products := testProducts()
+
+	first, err := m.Relevance(context.Background(), "apple 手机 phone", products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstSim, err := m.Similarity(context.Background(), products[0], products, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		scores, err := m.Relevance(context.Background(), "apple 手机 phone", products)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertScores(t, scores, first)
+
+		sims, err := m.Similarity(context.Background(), products[0], products, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertScores(t, sims, firstSim)
+	}
+	// 与自身的所有维度完全相同
+	if firstSim[0] != 1 {
+		t.Fatalf("self similarity = %v, want 1", firstSim[0])
+	}
+}
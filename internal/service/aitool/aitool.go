@@ -0,0 +1,264 @@
+package aitool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/llm"
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/address"
+	"qaqmall/internal/service/cart"
+	"qaqmall/internal/service/order"
+	"qaqmall/internal/service/product"
+	"qaqmall/models"
+)
+
+var (
+	ErrActionNotFound   = errors.New("待确认的操作不存在")
+	ErrActionNotPending = errors.New("该操作已处理")
+	ErrActionExpired    = errors.New("该操作已过期，请重新发起")
+	ErrUnknownTool      = errors.New("未知的工具")
+	ErrInvalidArguments = errors.New("工具参数无效")
+)
+
+// confirmTTL 待确认操作的有效期
+const confirmTTL = 10 * time.Minute
+
+// maxErrorLength 审计日志中错误信息的最大长度
+const maxErrorLength = 255
+
+// AuditQuery 工具调用审计日志的查询参数，UserID 为0、Tool 和 Status 为空时不过滤
+type AuditQuery struct {
+	pagination.Pagination
+	UserID uint64
+	Tool   string
+	Status models.AIToolCallStatus
+}
+
+// ToolService AI助手可以调用的工具
+// 每次调用都记录在 ai_tool_calls 中；有副作用的工具不会直接执行，而是记录为待确认的操作，
+// 由用户调用 Confirm 后才真正执行，超过 confirmTTL 未确认的操作失效
+type ToolService struct {
+	db        *gorm.DB
+	products  *product.ProductService
+	carts     *cart.CartService
+	orders    *order.OrderService
+	addresses *address.AddressService
+}
+
+func NewToolService(db *gorm.DB, products *product.ProductService, carts *cart.CartService, orders *order.OrderService, addresses *address.AddressService) *ToolService {
+	return &ToolService{db: db, products: products, carts: carts, orders: orders, addresses: addresses}
+}
+
+// Tools 返回提供给大模型的工具定义
+func (s *ToolService) Tools() []llm.Tool {
+	defs := make([]llm.Tool, 0, len(tools))
+	for _, t := range tools {
+		defs = append(defs, t.def)
+	}
+	return defs
+}
+
+// Invoke 处理大模型发起的工具调用，返回交给大模型的工具结果（JSON）和审计记录
+// 只读工具直接执行；有副作用的工具只记录为待确认操作，结果中告知大模型需要用户确认
+func (s *ToolService) Invoke(ctx context.Context, userID, conversationID uint64, call llm.ToolCall) (string, *models.AIToolCall) {
+	record := &models.AIToolCall{
+		UserID:         userID,
+		ConversationID: conversationID,
+		Tool:           call.Name,
+		Arguments:      call.Arguments,
+	}
+
+	t, args, err := parse(call.Name, call.Arguments)
+	switch {
+	case err != nil:
+		record.Status = models.AIToolCallFailed
+		record.Error = truncate(err.Error())
+	case t.confirm:
+		expiresAt := time.Now().Add(confirmTTL)
+		record.Status = models.AIToolCallPending
+		record.ExpiresAt = &expiresAt
+	default:
+		s.run(ctx, t, userID, args, record)
+	}
+
+	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+		log.Printf("记录AI工具调用失败 user_id=%d tool=%s: %v", userID, call.Name, err)
+	}
+	return toolContent(record), record
+}
+
+// ListPending 获取用户未过期的待确认操作
+func (s *ToolService) ListPending(ctx context.Context, userID uint64) ([]models.AIToolCall, error) {
+	var calls []models.AIToolCall
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ? AND status = ? AND expires_at > ?", userID, models.AIToolCallPending, time.Now()).
+		Order("id").
+		Find(&calls).Error; err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// Confirm 确认并执行待确认的操作，执行失败时记录错误并返回记录，不返回 error
+func (s *ToolService) Confirm(ctx context.Context, userID, id uint64) (*models.AIToolCall, error) {
+	record, err := s.claim(ctx, userID, id, models.AIToolCallExecuted)
+	if err != nil {
+		return nil, err
+	}
+
+	t, args, err := parse(record.Tool, record.Arguments)
+	if err != nil {
+		record.Status = models.AIToolCallFailed
+		record.Error = truncate(err.Error())
+	} else {
+		s.run(ctx, t, userID, args, record)
+	}
+
+	if err := s.db.WithContext(ctx).Model(record).Updates(map[string]interface{}{
+		"status":      record.Status,
+		"result":      record.Result,
+		"error":       record.Error,
+		"executed_at": record.ExecutedAt,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Reject 拒绝待确认的操作
+func (s *ToolService) Reject(ctx context.Context, userID, id uint64) (*models.AIToolCall, error) {
+	return s.claim(ctx, userID, id, models.AIToolCallRejected)
+}
+
+// ListAudit 分页查询工具调用的审计日志，最新的在前
+func (s *ToolService) ListAudit(ctx context.Context, q AuditQuery) ([]models.AIToolCall, int64, error) {
+	q.Pagination = q.Pagination.Normalize()
+	query := s.db.WithContext(ctx).Model(&models.AIToolCall{})
+	if q.UserID > 0 {
+		query = query.Where("user_id = ?", q.UserID)
+	}
+	if q.Tool != "" {
+		query = query.Where("tool = ?", q.Tool)
+	}
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var calls []models.AIToolCall
+	if err := query.Order("id DESC").
+		Offset(q.Offset()).
+		Limit(q.PageSize).
+		Find(&calls).Error; err != nil {
+		return nil, 0, err
+	}
+	return calls, total, nil
+}
+
+// claim 将待确认的操作改为 status，用条件更新保证同一个操作只会被处理一次
+// 已过期的操作标记为 expired 并返回 ErrActionExpired
+func (s *ToolService) claim(ctx context.Context, userID, id uint64, status models.AIToolCallStatus) (*models.AIToolCall, error) {
+	db := s.db.WithContext(ctx)
+
+	var record models.AIToolCall
+	if err := db.Where("id = ? AND user_id = ?", id, userID).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrActionNotFound
+		}
+		return nil, err
+	}
+	if record.Status != models.AIToolCallPending {
+		return nil, ErrActionNotPending
+	}
+
+	if record.ExpiresAt != nil && time.Now().After(*record.ExpiresAt) {
+		status = models.AIToolCallExpired
+	}
+	result := db.Model(&models.AIToolCall{}).
+		Where("id = ? AND status = ?", id, models.AIToolCallPending).
+		Update("status", status)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrActionNotPending
+	}
+	if status == models.AIToolCallExpired {
+		return nil, ErrActionExpired
+	}
+
+	record.Status = status
+	return &record, nil
+}
+
+// run 执行工具并把结果写入 record
+func (s *ToolService) run(ctx context.Context, t *tool, userID uint64, args interface{}, record *models.AIToolCall) {
+	now := time.Now()
+	record.ExecutedAt = &now
+
+	result, err := t.run(ctx, s, userID, args)
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(result); err == nil {
+			record.Status = models.AIToolCallExecuted
+			record.Result = string(data)
+			return
+		}
+	}
+	record.Status = models.AIToolCallFailed
+	record.Error = truncate(err.Error())
+}
+
+// parse 查找工具并解析参数
+func parse(name, arguments string) (*tool, interface{}, error) {
+	for i := range tools {
+		if tools[i].def.Name != name {
+			continue
+		}
+		args := tools[i].newArgs()
+		if arguments != "" {
+			if err := json.Unmarshal([]byte(arguments), args); err != nil {
+				return nil, nil, ErrInvalidArguments
+			}
+		}
+		return &tools[i], args, nil
+	}
+	return nil, nil, ErrUnknownTool
+}
+
+// toolContent 生成交给大模型的工具结果
+func toolContent(record *models.AIToolCall) string {
+	var content interface{}
+	switch record.Status {
+	case models.AIToolCallExecuted:
+		return record.Result
+	case models.AIToolCallPending:
+		content = map[string]interface{}{
+			"status":    "pending_confirmation",
+			"action_id": record.ID,
+			"message":   "该操作需要用户确认后才会执行，请告诉用户操作内容并提示其确认",
+		}
+	default:
+		content = map[string]interface{}{"status": "error", "error": record.Error}
+	}
+	data, _ := json.Marshal(content)
+	return string(data)
+}
+
+func truncate(s string) string {
+	runes := []rune(s)
+	if len(runes) <= maxErrorLength {
+		return s
+	}
+	return string(runes[:maxErrorLength])
+}
@@ -0,0 +1,306 @@
+package aitool
+
+import (
+	"context"
+
+	"qaqmall/internal/authz"
+	"qaqmall/internal/llm"
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/cart"
+	"qaqmall/internal/service/order"
+	"qaqmall/internal/service/product"
+	"qaqmall/models"
+)
+
+// 工具名称
+const (
+	ToolSearchProducts     = "search_products"
+	ToolAddToCart          = "add_to_cart"
+	ToolUpdateCartQuantity = "update_cart_quantity"
+	ToolListOrders         = "list_orders"
+	ToolCreateOrder        = "create_order"
+	ToolCancelOrder        = "cancel_order"
+)
+
+// maxListSize 查询类工具最多返回的记录数
+const maxListSize = 20
+
+// tool 工具的定义和实现
+// newArgs 返回参数结构体的指针，run 收到的 args 就是解析后的该指针
+type tool struct {
+	def     llm.Tool
+	confirm bool // 有副作用，需要用户确认后才执行
+	newArgs func() interface{}
+	run     func(ctx context.Context, s *ToolService, userID uint64, args interface{}) (interface{}, error)
+}
+
+type searchProductsArgs struct {
+	Keyword  string  `json:"keyword"`
+	MinPrice float64 `json:"min_price"`
+	MaxPrice float64 `json:"max_price"`
+	Limit    int     `json:"limit"`
+}
+
+type cartQuantityArgs struct {
+	ProductID uint64 `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+type listOrdersArgs struct {
+	Status string `json:"status"`
+	Limit  int    `json:"limit"`
+}
+
+type createOrderArgs struct {
+	Items  []cartQuantityArgs `json:"items"`
+	Remark string             `json:"remark"`
+}
+
+type cancelOrderArgs struct {
+	OrderID uint64 `json:"order_id"`
+}
+
+var tools = []tool{
+	{
+		def: llm.Tool{
+			Name:        ToolSearchProducts,
+			Description: "按关键词和价格区间搜索在售商品",
+			Parameters: object(map[string]interface{}{
+				"keyword":   prop("string", "商品名称或描述中的关键词"),
+				"min_price": prop("number", "最低价格（元）"),
+				"max_price": prop("number", "最高价格（元）"),
+				"limit":     prop("integer", "返回的商品数量，最多20个"),
+			}),
+		},
+		newArgs: func() interface{} { return &searchProductsArgs{} },
+		run:     searchProducts,
+	},
+	{
+		def: llm.Tool{
+			Name:        ToolAddToCart,
+			Description: "把商品加入购物车，已在购物车中时累加数量，需要用户确认",
+			Parameters: object(map[string]interface{}{
+				"product_id": prop("integer", "商品ID"),
+				"quantity":   prop("integer", "加入的数量"),
+			}, "product_id", "quantity"),
+		},
+		confirm: true,
+		newArgs: func() interface{} { return &cartQuantityArgs{} },
+		run:     addToCart,
+	},
+	{
+		def: llm.Tool{
+			Name:        ToolUpdateCartQuantity,
+			Description: "修改购物车中某个商品的数量，需要用户确认",
+			Parameters: object(map[string]interface{}{
+				"product_id": prop("integer", "商品ID"),
+				"quantity":   prop("integer", "修改后的数量"),
+			}, "product_id", "quantity"),
+		},
+		confirm: true,
+		newArgs: func() interface{} { return &cartQuantityArgs{} },
+		run:     updateCartQuantity,
+	},
+	{
+		def: llm.Tool{
+			Name:        ToolListOrders,
+			Description: "查询用户最近的订单",
+			Parameters: object(map[string]interface{}{
+				"status": prop("string", "订单状态：pending、paid、shipped、completed、cancelled、refunded，为空时查询全部"),
+				"limit":  prop("integer", "返回的订单数量，最多20个"),
+			}),
+		},
+		newArgs: func() interface{} { return &listOrdersArgs{} },
+		run:     listOrders,
+	},
+	{
+		def: llm.Tool{
+			Name:        ToolCreateOrder,
+			Description: "使用默认收货地址下单，items 为空时购买购物车中已选中的商品，需要用户确认",
+			Parameters: object(map[string]interface{}{
+				"items": map[string]interface{}{
+					"type":        "array",
+					"description": "要购买的商品",
+					"items": object(map[string]interface{}{
+						"product_id": prop("integer", "商品ID"),
+						"quantity":   prop("integer", "购买数量"),
+					}, "product_id", "quantity"),
+				},
+				"remark": prop("string", "订单备注"),
+			}),
+		},
+		confirm: true,
+		newArgs: func() interface{} { return &createOrderArgs{} },
+		run:     createOrder,
+	},
+	{
+		def: llm.Tool{
+			Name:        ToolCancelOrder,
+			Description: "取消待支付的订单，需要用户确认",
+			Parameters: object(map[string]interface{}{
+				"order_id": prop("integer", "订单ID"),
+			}, "order_id"),
+		},
+		confirm: true,
+		newArgs: func() interface{} { return &cancelOrderArgs{} },
+		run:     cancelOrder,
+	},
+}
+
+func searchProducts(ctx context.Context, s *ToolService, _ uint64, args interface{}) (interface{}, error) {
+	a := args.(*searchProductsArgs)
+	products, _, err := s.products.List(ctx, product.Query{
+		Pagination: pagination.Pagination{PageSize: listSize(a.Limit)},
+		Keyword:    a.Keyword,
+		MinPrice:   a.MinPrice,
+		MaxPrice:   a.MaxPrice,
+		OnlyOnSale: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(products))
+	for _, p := range products {
+		result = append(result, map[string]interface{}{
+			"product_id": p.ID,
+			"name":       p.Name,
+			"price":      p.Price,
+			"stock":      p.Stock,
+		})
+	}
+	return result, nil
+}
+
+func addToCart(ctx context.Context, s *ToolService, userID uint64, args interface{}) (interface{}, error) {
+	a := args.(*cartQuantityArgs)
+	item, err := s.carts.Add(ctx, userID, a.ProductID, a.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	return cartItemResult(item), nil
+}
+
+func updateCartQuantity(ctx context.Context, s *ToolService, userID uint64, args interface{}) (interface{}, error) {
+	a := args.(*cartQuantityArgs)
+	items, err := s.carts.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.ProductID != a.ProductID {
+			continue
+		}
+		updated, err := s.carts.Update(ctx, userID, item.ID, a.Quantity, item.Selected)
+		if err != nil {
+			return nil, err
+		}
+		return cartItemResult(updated), nil
+	}
+	return nil, cart.ErrCartItemNotFound
+}
+
+func listOrders(ctx context.Context, s *ToolService, userID uint64, args interface{}) (interface{}, error) {
+	a := args.(*listOrdersArgs)
+	orders, err := s.orders.List(ctx, userID, models.OrderStatus(a.Status), listSize(a.Limit))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(orders))
+	for _, o := range orders {
+		result = append(result, orderResult(&o))
+	}
+	return result, nil
+}
+
+func createOrder(ctx context.Context, s *ToolService, userID uint64, args interface{}) (interface{}, error) {
+	a := args.(*createOrderArgs)
+	addr, err := s.addresses.Default(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var created *models.Order
+	if len(a.Items) == 0 {
+		created, err = s.orders.CreateFromCart(ctx, toolSubject(userID), addr.ID, a.Remark)
+	} else {
+		in := order.CreateInput{AddressID: addr.ID, Remark: a.Remark}
+		for _, item := range a.Items {
+			in.Items = append(in.Items, order.Item{ProductID: item.ProductID, Quantity: item.Quantity})
+		}
+		created, err = s.orders.Create(ctx, toolSubject(userID), in)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return orderResult(created), nil
+}
+
+func cancelOrder(ctx context.Context, s *ToolService, userID uint64, args interface{}) (interface{}, error) {
+	a := args.(*cancelOrderArgs)
+	if a.OrderID == 0 {
+		return nil, ErrInvalidArguments
+	}
+	cancelled, err := s.orders.Cancel(ctx, toolSubject(userID), a.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	return orderResult(cancelled), nil
+}
+
+// toolSubject AI助手始终以普通用户的身份操作，只能访问用户自己的订单和地址
+func toolSubject(userID uint64) authz.Subject {
+	return authz.Subject{ID: userID, Role: models.RoleUser}
+}
+
+func cartItemResult(item *models.CartItem) map[string]interface{} {
+	return map[string]interface{}{
+		"product_id": item.ProductID,
+		"name":       item.ProductName,
+		"price":      item.Price,
+		"quantity":   item.Quantity,
+	}
+}
+
+func orderResult(o *models.Order) map[string]interface{} {
+	items := make([]map[string]interface{}, 0, len(o.Items))
+	for _, item := range o.Items {
+		items = append(items, map[string]interface{}{
+			"product_id": item.ProductID,
+			"name":       item.ProductName,
+			"price":      item.Price,
+			"quantity":   item.Quantity,
+		})
+	}
+	return map[string]interface{}{
+		"order_id":     o.ID,
+		"order_number": o.OrderNumber,
+		"status":       o.Status,
+		"total_amount": o.TotalAmount,
+		"items":        items,
+	}
+}
+
+func listSize(limit int) int {
+	if limit <= 0 || limit > maxListSize {
+		return maxListSize
+	}
+	return limit
+}
+
+// object 生成 JSON Schema 的 object 类型
+func object(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func prop(typ, description string) map[string]interface{} {
+	return map[string]interface{}{"type": typ, "description": description}
+}
@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/models"
+)
+
+// Actor 执行操作的管理员
+type Actor struct {
+	UserID uint64
+	IP     string
+}
+
+// Entry 一条审计记录，Before、After 为操作前后的状态，序列化为 JSON 保存，为 nil 时不保存
+type Entry struct {
+	Actor      Actor
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     interface{}
+	After      interface{}
+	Reason     string
+}
+
+// Record 在调用方的事务中写入审计记录，写入失败时操作一起回滚，保证每次修改都有记录
+func Record(tx *gorm.DB, e Entry) error {
+	before, err := marshal(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshal(e.After)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.AuditLog{
+		ActorID:    e.Actor.UserID,
+		IP:         e.Actor.IP,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		Before:     before,
+		After:      after,
+		Reason:     e.Reason,
+	}).Error
+}
+
+func marshal(v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Query 审计记录的查询参数，为空的条件不过滤
+type Query struct {
+	pagination.Pagination
+	ActorID    uint64
+	Action     string
+	TargetType string
+	TargetID   string
+}
+
+// AuditService 查询管理员操作的审计记录
+type AuditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// List 分页查询审计记录，按时间倒序
+func (s *AuditService) List(ctx context.Context, q Query) ([]models.AuditLog, int64, error) {
+	q.Pagination = q.Pagination.Normalize()
+	query := s.db.WithContext(ctx).Model(&models.AuditLog{})
+	if q.ActorID > 0 {
+		query = query.Where("actor_id = ?", q.ActorID)
+	}
+	if q.Action != "" {
+		query = query.Where("action = ?", q.Action)
+	}
+	if q.TargetType != "" {
+		query = query.Where("target_type = ?", q.TargetType)
+	}
+	if q.TargetID != "" {
+		query = query.Where("target_id = ?", q.TargetID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []models.AuditLog
+	if err := query.Order("id DESC").
+		Offset(q.Offset()).
+		Limit(q.PageSize).
+		Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
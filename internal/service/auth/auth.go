@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/models"
+)
+
+var (
+	ErrInvalidToken        = errors.New("无效的token")
+	ErrTokenRevoked        = errors.New("token已失效")
+	ErrInvalidRefreshToken = errors.New("无效的refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token已被使用，该登录会话已失效")
+	ErrSessionExpired      = errors.New("登录已超过最长有效期，请重新登录")
+)
+
+// Claims token中携带的用户信息
+type Claims struct {
+	// ID token 的唯一标识（jti）
+	ID       string
+	UserID   uint64
+	Username string
+	Role     string
+	// TokenVersion 签发时用户的 token 版本，与用户当前版本不一致的token视为已吊销
+	TokenVersion int
+	// MFA 登录时是否通过了二次验证
+	MFA       bool
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// SessionExpiresAt 所在登录会话的最长有效期，续期不能超过；旧版本签发的token没有该字段，为零值
+	SessionExpiresAt time.Time
+}
+
+// 认证方式（amr），通过了二次验证的token带有 otp
+const (
+	amrPassword = "pwd"
+	amrOTP      = "otp"
+)
+
+// tokenClaims access token 的载荷，iss、aud、exp、iat、jti 由 RegisteredClaims 校验
+type tokenClaims struct {
+	UserID   uint64 `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Version  int    `json:"ver"`
+	// AMR 登录时使用的认证方式（RFC 8176）
+	AMR []string `json:"amr,omitempty"`
+	// SessionExpiresAt 登录会话的最长有效期
+	SessionExpiresAt *jwt.NumericDate `json:"sxp,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenService 负责token的签发、校验、续期和吊销，HTTP 和 gRPC 共用
+// access token 为短期的 JWT；refresh token 为保存在服务端的随机串，每次刷新都会轮换，见 refresh.go
+type TokenService struct {
+	db          *gorm.DB
+	cfg         config.JWTConfig
+	keys        *Keyring
+	revocations RevocationStore
+	// versions 开启 revocation.cache 时缓存用户的 token 版本，否则为 nil
+	versions *CachedRevocationStore
+	parser   *jwt.Parser
+}
+
+func NewTokenService(db *gorm.DB, cfg config.JWTConfig, keys *Keyring, revocations RevocationStore) *TokenService {
+	versions, _ := revocations.(*CachedRevocationStore)
+	return &TokenService{
+		db:          db,
+		cfg:         cfg,
+		keys:        keys,
+		revocations: revocations,
+		versions:    versions,
+		parser: jwt.NewParser(
+			jwt.WithIssuer(cfg.Issuer),
+			jwt.WithAudience(cfg.Audience),
+			jwt.WithLeeway(cfg.Leeway),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+		),
+	}
+}
+
+// Generate 签发token，version 为用户当前的 token 版本，mfa 表示登录时是否通过了二次验证
+// sessionExpiresAt 为所在登录会话的最长有效期，token 的有效期不超过它；为零值时开始一个新的会话，最长持续 session_max_age
+func (s *TokenService) Generate(userID uint64, username string, role string, version int, mfa bool, sessionExpiresAt time.Time) (string, time.Time, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// JWT 中的时间精确到秒
+	now := time.Unix(time.Now().Unix(), 0)
+	if sessionExpiresAt.IsZero() {
+		sessionExpiresAt = now.Add(s.cfg.SessionMaxAge)
+	}
+	sessionExpiresAt = time.Unix(sessionExpiresAt.Unix(), 0)
+	expiresAt := now.Add(s.cfg.Expire)
+	if expiresAt.After(sessionExpiresAt) {
+		expiresAt = sessionExpiresAt
+	}
+	amr := []string{amrPassword}
+	if mfa {
+		amr = append(amr, amrOTP)
+	}
+	claims := tokenClaims{
+		UserID:           userID,
+		Username:         username,
+		Role:             role,
+		Version:          version,
+		AMR:              amr,
+		SessionExpiresAt: jwt.NewNumericDate(sessionExpiresAt),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.cfg.Issuer,
+			Subject:   strconv.FormatUint(userID, 10),
+			Audience:  jwt.ClaimStrings{s.cfg.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	tokenString, err := s.keys.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+// Parse 校验token的签名、签发方、受众和有效期并解析出用户信息，不检查是否已被吊销
+// 有效期允许 jwt.leeway 的时钟偏差；字段类型不符或缺少必需字段的token视为无效
+func (s *TokenService) Parse(tokenString string) (*Claims, error) {
+	var claims tokenClaims
+	if _, err := s.parser.ParseWithClaims(tokenString, &claims, s.keys.Keyfunc); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.UserID == 0 || claims.Role == "" || claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	result := &Claims{
+		ID:           claims.ID,
+		UserID:       claims.UserID,
+		Username:     claims.Username,
+		Role:         claims.Role,
+		TokenVersion: claims.Version,
+		ExpiresAt:    claims.ExpiresAt.Time,
+	}
+	for _, method := range claims.AMR {
+		if method == amrOTP {
+			result.MFA = true
+		}
+	}
+	if claims.IssuedAt != nil {
+		result.IssuedAt = claims.IssuedAt.Time
+	}
+	if claims.SessionExpiresAt != nil {
+		result.SessionExpiresAt = claims.SessionExpiresAt.Time
+	}
+	return result, nil
+}
+
+// Keys 返回签发token使用的密钥，用于发布 JWKS
+func (s *TokenService) Keys() *Keyring {
+	return s.keys
+}
+
+// Verify 校验token并检查是否已被吊销，包括吊销记录和用户的 token 版本
+func (s *TokenService) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := s.Parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.revocations.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	version, err := s.tokenVersion(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if version != claims.TokenVersion {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// NeedsRenewal 剩余有效期不足 renew_before 时需要续期
+func (s *TokenService) NeedsRenewal(claims *Claims) bool {
+	return time.Until(claims.ExpiresAt) < s.cfg.RenewBefore
+}
+
+// Renew 使用未过期的旧token换取新token，旧token随即吊销
+// 新token属于同一个登录会话，有效期不超过会话的最长有效期；会话已到期或旧token没有会话信息时返回 ErrSessionExpired
+func (s *TokenService) Renew(ctx context.Context, oldToken string) (string, time.Time, error) {
+	claims, err := s.Verify(ctx, oldToken)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if claims.SessionExpiresAt.IsZero() || !time.Now().Before(claims.SessionExpiresAt) {
+		return "", time.Time{}, ErrSessionExpired
+	}
+
+	// 用户被删除后不能再续期
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ? AND deleted_at IS NULL", claims.UserID).First(&user).Error; err != nil {
+		return "", time.Time{}, ErrInvalidToken
+	}
+
+	tokenString, expiresAt, err := s.Generate(claims.UserID, user.Username, claims.Role, user.TokenVersion, claims.MFA, claims.SessionExpiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if err := s.Revoke(ctx, claims.ID, claims.ExpiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+// Revoke 吊销 jti 对应的 access token 直到其过期
+// 校验时允许 jwt.leeway 的时钟偏差，过期后的这段时间内token仍然能通过校验，吊销记录需要多保留这么久
+func (s *TokenService) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	return s.revocations.Revoke(ctx, jti, expiresAt.Add(s.cfg.Leeway))
+}
+
+// PurgeExpired 清除已过期的吊销记录和 refresh token，返回清除的条数
+func (s *TokenService) PurgeExpired(ctx context.Context) (revocations int64, refreshTokens int64, err error) {
+	revocations, err = s.revocations.Purge(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	result := s.db.WithContext(ctx).
+		Where("expires_at <= ?", time.Now()).
+		Delete(&models.RefreshToken{})
+	return revocations, result.RowsAffected, result.Error
+}
+
+// LogoutAll 使用户在所有设备上退出登录：递增 token 版本使已签发的 access token 全部失效，并吊销所有 refresh token
+func (s *TokenService) LogoutAll(ctx context.Context, userID uint64) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return RevokeSessions(tx, userID)
+	})
+	if err != nil {
+		return err
+	}
+	s.SessionsRevoked(userID)
+	return nil
+}
+
+// SessionsRevoked 清除本实例缓存的用户 token 版本，使 RevokeSessions 的修改立即生效
+// 调用 RevokeSessions 或删除用户的事务提交后调用；其他实例最迟在一个同步周期后生效
+func (s *TokenService) SessionsRevoked(userID uint64) {
+	if s.versions != nil {
+		s.versions.invalidateTokenVersion(userID)
+	}
+}
+
+// RevokeSessions 在调用方的事务中使用户所有的登录会话失效，用于修改、重置密码等需要与会话吊销一起提交的操作
+// 事务提交后需要调用 TokenService.SessionsRevoked
+func RevokeSessions(tx *gorm.DB, userID uint64) error {
+	result := tx.Model(&models.User{}).Where("id = ?", userID).
+		Update("token_version", gorm.Expr("token_version + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidToken
+	}
+	return tx.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// tokenVersion 获取用户当前的 token 版本，用户不存在或已删除时返回 ErrTokenRevoked
+// 开启 revocation.cache 时先查缓存
+func (s *TokenService) tokenVersion(ctx context.Context, userID uint64) (int, error) {
+	var epoch uint64
+	if s.versions != nil {
+		var version int
+		var ok bool
+		if version, ok, epoch = s.versions.tokenVersion(userID); ok {
+			return version, nil
+		}
+	}
+
+	var user models.User
+	err := s.db.WithContext(ctx).Select("id", "token_version").
+		Where("id = ? AND deleted_at IS NULL", userID).
+		First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrTokenRevoked
+		}
+		return 0, err
+	}
+	if s.versions != nil {
+		s.versions.putTokenVersion(userID, user.TokenVersion, epoch)
+	}
+	return user.TokenVersion, nil
+}
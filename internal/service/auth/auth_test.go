@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/testutil"
+	"qaqmall/models"
+)
+
+// newTestTokenService 使用内存 SQLite 和数据库中的吊销记录，返回 token 版本为 0 的用户
+func newTestTokenService(t *testing.T) (*TokenService, *gorm.DB, *models.User) {
+	t.Helper()
+	db := testutil.NewSQLite(t, &models.User{}, &models.RevokedToken{}, &models.RefreshToken{})
+	u := &models.User{Username: "alice", Password: "hash", Role: models.RoleUser}
+	if err := db.Create(u).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.JWT.Secret = "auth-test-secret"
+	keys, err := NewKeyring(cfg.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTokenService(db, cfg.JWT, keys, NewDBRevocationStore(db)), db, u
+}
+
+// signToken 签发指定过期时间和会话最长有效期的token，用于构造已过期但仍在 leeway 内、或者会话已到期的token
+// sessionExpiresAt 为零值时不带会话信息，与旧版本签发的token一样
+func signToken(t *testing.T, s *TokenService, u *models.User, expiresAt, sessionExpiresAt time.Time) string {
+	t.Helper()
+	jti, err := randomHex(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sxp *jwt.NumericDate
+	if !sessionExpiresAt.IsZero() {
+		sxp = jwt.NewNumericDate(sessionExpiresAt)
+	}
+	token, err := s.keys.Sign(tokenClaims{
+		UserID:           u.ID,
+		Username:         u.Username,
+		Role:             u.Role,
+		Version:          u.TokenVersion,
+		SessionExpiresAt: sxp,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.cfg.Issuer,
+			Subject:   strconv.FormatUint(u.ID, 10),
+			Audience:  jwt.ClaimStrings{s.cfg.Audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRevokeWithinLeeway(t *testing.T) {
+	s, db, u := newTestTokenService(t)
+	ctx := context.Background()
+
+	// 已过期但仍在 leeway 内的token能通过校验
+	expiresAt := time.Unix(time.Now().Add(-s.cfg.Leeway/2).Unix(), 0)
+	token := signToken(t, s, u, expiresAt, time.Time{})
+	claims, err := s.Verify(ctx, token)
+	if err != nil {
+		t.Fatalf("token inside leeway: %v", err)
+	}
+
+	// 吊销记录保留到 exp + leeway，在这段时间内token仍然被拒绝
+	if err := s.Revoke(ctx, claims.ID, claims.ExpiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Verify(ctx, token); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("revoked token inside leeway: err = %v, want ErrTokenRevoked", err)
+	}
+
+	var record models.RevokedToken
+	if err := db.Where("jti = ?", claims.ID).First(&record).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := expiresAt.Add(s.cfg.Leeway); !record.ExpiresAt.Equal(want) {
+		t.Fatalf("expires_at = %v, want %v", record.ExpiresAt, want)
+	}
+
+	// 超出 leeway 的token由解析拒绝，不再依赖吊销记录
+	expired := signToken(t, s, u, time.Now().Add(-2*s.cfg.Leeway), time.Time{})
+	if _, err := s.Verify(ctx, expired); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("token past leeway: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRenewSessionMaxAge(t *testing.T) {
+	s, _, u := newTestTokenService(t)
+	ctx := context.Background()
+
+	// 续期得到的token属于同一个会话，有效期不超过会话的最长有效期
+	sessionExpiresAt := time.Unix(time.Now().Add(s.cfg.Expire/2).Unix(), 0)
+	token, expiresAt, err := s.Generate(u.ID, u.Username, u.Role, u.TokenVersion, false, sessionExpiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiresAt.Equal(sessionExpiresAt) {
+		t.Fatalf("expires_at = %v, want session expiry %v", expiresAt, sessionExpiresAt)
+	}
+	renewed, renewedExpiresAt, err := s.Renew(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.Verify(ctx, renewed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.SessionExpiresAt.Equal(sessionExpiresAt) || renewedExpiresAt.After(sessionExpiresAt) {
+		t.Fatalf("renewed token: session expires at %v, expires at %v", claims.SessionExpiresAt, renewedExpiresAt)
+	}
+	if _, err := s.Verify(ctx, token); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("old token: err = %v, want ErrTokenRevoked", err)
+	}
+
+	// 没有指定会话时开始一个新的会话
+	_, expiresAt, err = s.Generate(u.ID, u.Username, u.Role, u.TokenVersion, false, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Now().Add(s.cfg.Expire); expiresAt.Before(want.Add(-time.Second)) || expiresAt.After(want) {
+		t.Fatalf("expires_at = %v, want about %v", expiresAt, want)
+	}
+
+	// 会话已到期的token不能续期，即使token本身还在有效期内
+	expired := signToken(t, s, u, time.Now().Add(time.Hour), time.Now().Add(-time.Minute))
+	if _, _, err := s.Renew(ctx, expired); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("session expired: err = %v, want ErrSessionExpired", err)
+	}
+	// 没有会话信息的旧token同样不能续期
+	legacy := signToken(t, s, u, time.Now().Add(time.Hour), time.Time{})
+	if _, _, err := s.Renew(ctx, legacy); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("legacy token: err = %v, want ErrSessionExpired", err)
+	}
+}
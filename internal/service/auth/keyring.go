@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"qaqmall/config"
+)
+
+// Key 签名或校验token使用的密钥
+// HS256 的密钥没有 kid，签发的token也不带 kid；非对称密钥只配置公钥时只用于校验
+type Key struct {
+	ID        string
+	Algorithm string
+	sign      interface{}
+	verify    interface{}
+}
+
+// JWK JSON Web Key，只包含公钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS /.well-known/jwks.json 的响应
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Keyring 签名密钥和所有可用于校验的密钥
+// 轮换密钥时把新密钥设为签名密钥，旧密钥只保留公钥，直到用它签发的token全部过期
+type Keyring struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeyring 按配置加载密钥
+// 非对称算法没有配置密钥时生成一个临时密钥，进程重启后之前签发的token全部失效，只适合本地开发
+func NewKeyring(cfg config.JWTConfig) (*Keyring, error) {
+	if cfg.Algorithm == config.JWTAlgorithmHS256 {
+		key := &Key{Algorithm: jwt.SigningMethodHS256.Alg(), sign: []byte(cfg.Secret), verify: []byte(cfg.Secret)}
+		return &Keyring{signing: key, keys: map[string]*Key{"": key}}, nil
+	}
+
+	if len(cfg.Keys) == 0 {
+		key, err := generateKey(cfg.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("未配置 jwt.keys，使用临时生成的 %s 密钥 kid=%s，重启后已签发的token将失效", key.Algorithm, key.ID)
+		return &Keyring{signing: key, keys: map[string]*Key{key.ID: key}}, nil
+	}
+
+	ring := &Keyring{keys: make(map[string]*Key, len(cfg.Keys))}
+	for _, kc := range cfg.Keys {
+		key, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("加载密钥 %s 失败: %v", kc.ID, err)
+		}
+		ring.keys[key.ID] = key
+		if key.ID == cfg.SigningKey {
+			ring.signing = key
+		}
+	}
+
+	if ring.signing == nil || ring.signing.sign == nil {
+		return nil, fmt.Errorf("签名密钥 %s 没有配置私钥", cfg.SigningKey)
+	}
+	if ring.signing.Algorithm != cfg.Algorithm {
+		return nil, fmt.Errorf("签名密钥 %s 的算法为 %s，与 jwt.algorithm 不一致", cfg.SigningKey, ring.signing.Algorithm)
+	}
+	return ring, nil
+}
+
+// Sign 使用签名密钥签发token，非对称密钥在头部写入 kid
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(k.signing.Algorithm), claims)
+	if k.signing.ID != "" {
+		token.Header["kid"] = k.signing.ID
+	}
+	return token.SignedString(k.signing.sign)
+}
+
+// Keyfunc 按 kid 选择校验密钥，token 声明的算法必须与密钥一致，防止算法混淆
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("未知的密钥 kid=%q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.verify, nil
+}
+
+// JWKS 返回所有非对称校验密钥的公钥，HS256 密钥不公开
+func (k *Keyring) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		switch pub := key.verify.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Algorithm,
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Algorithm,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// loadKey 从 PEM 文件加载密钥，配置了私钥时公钥由私钥导出
+func loadKey(kc config.JWTKeyConfig) (*Key, error) {
+	if kc.PrivateKeyFile != "" {
+		block, err := readPEM(kc.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var priv interface{}
+		if block.Type == "RSA PRIVATE KEY" {
+			priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		} else {
+			priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("不支持的私钥类型")
+		}
+		key, err := newKey(kc.ID, signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		key.sign = priv
+		return key, nil
+	}
+
+	block, err := readPEM(kc.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return newKey(kc.ID, pub)
+}
+
+// newKey 根据公钥类型确定算法，只支持 RSA 和 Ed25519
+func newKey(id string, pub crypto.PublicKey) (*Key, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return &Key{ID: id, Algorithm: jwt.SigningMethodRS256.Alg(), verify: pub}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Algorithm: jwt.SigningMethodEdDSA.Alg(), verify: pub}, nil
+	default:
+		return nil, fmt.Errorf("不支持的公钥类型 %T", pub)
+	}
+}
+
+func generateKey(algorithm string) (*Key, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	id = "ephemeral-" + id
+
+	if algorithm == config.JWTAlgorithmEdDSA {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{ID: id, Algorithm: jwt.SigningMethodEdDSA.Alg(), sign: priv, verify: pub}, nil
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ID: id, Algorithm: jwt.SigningMethodRS256.Alg(), sign: priv, verify: &priv.PublicKey}, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s 不是有效的 PEM 文件", path)
+	}
+	return block, nil
+}
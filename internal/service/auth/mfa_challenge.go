@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"qaqmall/models"
+)
+
+var ErrInvalidMFAChallenge = errors.New("二次验证已超时，请重新登录")
+
+// mfaAudienceSuffix 二次验证 token 的 aud 为 jwt.audience 加上该后缀，不能当作 access token 使用
+const mfaAudienceSuffix = ":mfa"
+
+// MFAChallenge 密码校验通过、等待输入二次验证码时签发的短期token
+type MFAChallenge struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+type mfaChallengeClaims struct {
+	UserID  uint64 `json:"user_id"`
+	Version int    `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+// IssueMFAChallenge 为通过了密码校验的用户签发二次验证 token，有效期为 jwt.mfa_challenge_expire
+func (s *TokenService) IssueMFAChallenge(user *models.User) (*MFAChallenge, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Unix(time.Now().Unix(), 0)
+	expiresAt := now.Add(s.cfg.MFAChallengeExpire)
+	token, err := s.keys.Sign(mfaChallengeClaims{
+		UserID:  user.ID,
+		Version: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.cfg.Issuer,
+			Subject:   strconv.FormatUint(user.ID, 10),
+			Audience:  jwt.ClaimStrings{s.cfg.Audience + mfaAudienceSuffix},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MFAChallenge{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// ParseMFAChallenge 校验二次验证 token，返回用户ID
+// 签发后用户修改了密码或退出了所有设备的，token 随即失效
+func (s *TokenService) ParseMFAChallenge(ctx context.Context, token string) (uint64, error) {
+	parser := jwt.NewParser(
+		jwt.WithIssuer(s.cfg.Issuer),
+		jwt.WithAudience(s.cfg.Audience+mfaAudienceSuffix),
+		jwt.WithLeeway(s.cfg.Leeway),
+		jwt.WithExpirationRequired(),
+	)
+
+	var claims mfaChallengeClaims
+	if _, err := parser.ParseWithClaims(token, &claims, s.keys.Keyfunc); err != nil || claims.UserID == 0 {
+		return 0, ErrInvalidMFAChallenge
+	}
+
+	version, err := s.tokenVersion(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrTokenRevoked) {
+			return 0, ErrInvalidMFAChallenge
+		}
+		return 0, err
+	}
+	if version != claims.Version {
+		return 0, ErrInvalidMFAChallenge
+	}
+	return claims.UserID, nil
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/models"
+)
+
+// TokenPair 登录或刷新后签发的一组token
+type TokenPair struct {
+	AccessToken      string
+	ExpiresAt        time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// IssuePair 为用户签发 access token 和 refresh token，开始一个新的登录会话
+// 同一次登录轮换出的 refresh token 属于同一个 family，会话最长持续 session_max_age；mfa 表示登录时是否通过了二次验证
+func (s *TokenService) IssuePair(ctx context.Context, user *models.User, mfa bool) (*TokenPair, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	parent := models.RefreshToken{
+		UserID:           user.ID,
+		FamilyID:         familyID,
+		SessionExpiresAt: now.Add(s.cfg.SessionMaxAge),
+		MFA:              mfa,
+	}
+
+	var pair *TokenPair
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		pair, err = s.rotate(tx, user, &parent)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Refresh 使用 refresh token 换取新的一组token，旧的 refresh token 随即失效
+// 已经使用过的 refresh token 再次出现说明可能已被盗用，此时吊销整个 family 并返回 ErrRefreshTokenReused
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	var (
+		pair   *TokenPair
+		reused *models.RefreshToken
+	)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Where("token_hash = ?", hashToken(refreshToken)).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// 条件更新保证并发刷新时只有一个请求能使用该 refresh token
+		result := tx.Model(&current).Where("used_at IS NULL").Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = &current
+			return revokeFamily(tx, current.FamilyID)
+		}
+
+		var user models.User
+		if err := tx.Where("id = ? AND deleted_at IS NULL", current.UserID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		var err error
+		pair, err = s.rotate(tx, &user, &current)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused != nil {
+		log.Printf("检测到refresh token被重复使用 user_id=%d family_id=%s，已吊销该登录会话", reused.UserID, reused.FamilyID)
+		return nil, ErrRefreshTokenReused
+	}
+	return pair, nil
+}
+
+// RevokeRefreshToken 吊销 refresh token 所在的登录会话，只能吊销 userID 自己的会话
+func (s *TokenService) RevokeRefreshToken(ctx context.Context, userID uint64, refreshToken string) error {
+	var current models.RefreshToken
+	err := s.db.WithContext(ctx).
+		Where("token_hash = ? AND user_id = ?", hashToken(refreshToken), userID).
+		First(&current).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return revokeFamily(s.db.WithContext(ctx), current.FamilyID)
+}
+
+// rotate 签发新的 access token，并在 parent 所在的 family 中生成新的 refresh token
+// refresh token 的有效期每次轮换时顺延 refresh_expire，但不超过会话的最长时间
+func (s *TokenService) rotate(tx *gorm.DB, user *models.User, parent *models.RefreshToken) (*TokenPair, error) {
+	accessToken, expiresAt, err := s.Generate(user.ID, user.Username, user.Role, user.TokenVersion, parent.MFA, parent.SessionExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshExpiresAt := time.Now().Add(s.cfg.RefreshExpire)
+	if refreshExpiresAt.After(parent.SessionExpiresAt) {
+		refreshExpiresAt = parent.SessionExpiresAt
+	}
+
+	next := models.RefreshToken{
+		UserID:           user.ID,
+		FamilyID:         parent.FamilyID,
+		TokenHash:        hashToken(raw),
+		ExpiresAt:        refreshExpiresAt,
+		SessionExpiresAt: parent.SessionExpiresAt,
+		MFA:              parent.MFA,
+	}
+	if err := tx.Create(&next).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     raw,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// revokeFamily 吊销同一个登录会话中的所有 refresh token
+func revokeFamily(tx *gorm.DB, familyID string) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// newRefreshToken 生成随机的 refresh token，数据库中只保存其哈希
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
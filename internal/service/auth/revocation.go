@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"qaqmall/config"
+	"qaqmall/models"
+)
+
+// Revocation 一条吊销记录，token 过期后记录即可清除
+type Revocation struct {
+	JTI       string
+	ExpiresAt time.Time
+}
+
+// RevocationStore 已吊销的 access token，以 jti 为键
+type RevocationStore interface {
+	// Revoke 吊销 jti 对应的token直到 expiresAt
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsRevoked 检查 jti 是否已被吊销
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// Active 返回所有未过期的吊销记录，用于重建缓存
+	Active(ctx context.Context) ([]Revocation, error)
+	// Purge 清除已过期的记录，返回清除的条数
+	Purge(ctx context.Context) (int64, error)
+}
+
+// NewRevocationBackend 按配置创建吊销记录的存储后端
+func NewRevocationBackend(cfg *config.Config, db *gorm.DB) (RevocationStore, error) {
+	switch cfg.Revocation.Backend {
+	case config.RevocationBackendDB:
+		return NewDBRevocationStore(db), nil
+	case config.RevocationBackendRedis:
+		return NewRedisRevocationStore(cfg.Redis, cfg.Revocation.KeyPrefix), nil
+	default:
+		return nil, fmt.Errorf("不支持的吊销记录存储: %s", cfg.Revocation.Backend)
+	}
+}
+
+// DBRevocationStore 保存在 revoked_tokens 表中的吊销记录
+type DBRevocationStore struct {
+	db *gorm.DB
+}
+
+func NewDBRevocationStore(db *gorm.DB) *DBRevocationStore {
+	return &DBRevocationStore{db: db}
+}
+
+func (s *DBRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+func (s *DBRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.RevokedToken{}).
+		Where("jti = ? AND expires_at > ?", jti, time.Now()).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *DBRevocationStore) Active(ctx context.Context) ([]Revocation, error) {
+	var rows []models.RevokedToken
+	if err := s.db.WithContext(ctx).
+		Where("expires_at > ?", time.Now()).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	revocations := make([]Revocation, 0, len(rows))
+	for _, row := range rows {
+		revocations = append(revocations, Revocation{JTI: row.JTI, ExpiresAt: row.ExpiresAt})
+	}
+	return revocations, nil
+}
+
+func (s *DBRevocationStore) Purge(ctx context.Context) (int64, error) {
+	result := s.db.WithContext(ctx).
+		Where("expires_at <= ?", time.Now()).
+		Delete(&models.RevokedToken{})
+	return result.RowsAffected, result.Error
+}
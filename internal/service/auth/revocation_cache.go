@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// bloomFalsePositiveRate 布隆过滤器的目标误判率
+	bloomFalsePositiveRate = 0.01
+	// revokedCacheTTL 已吊销结果的缓存时间，不短于 access token 的有效期即可
+	revokedCacheTTL = 24 * time.Hour
+)
+
+// CachedRevocationStore 在吊销记录后端前加一层进程内缓存
+// 先查 LRU 缓存中已吊销的 jti；未命中时由包含所有已吊销 jti 的布隆过滤器判断，判定不存在时直接放行，
+// 判定可能存在时再查后端，只缓存已吊销的结果：误判的 jti 每次都查后端，之后被其他实例吊销时立即生效
+// 布隆过滤器由 Run 定期从后端重建，其他实例吊销的token最迟在一个同步周期后生效；本实例吊销的token立即生效
+// 同时缓存 TokenService 读取的用户 token 版本，失效方式相同：每次同步时清空，本实例吊销会话后立即清除
+type CachedRevocationStore struct {
+	backend RevocationStore
+
+	mu     sync.Mutex
+	bloom  *bloomFilter
+	lru    *lruCache[bool]
+	synced bool
+	// versionTTL token 版本的缓存时间，与同步周期一致
+	versionTTL time.Duration
+
+	// versions 用户ID到 token 版本的缓存
+	versions *lruCache[int]
+	// epoch 每次清除 token 版本缓存时递增，清除前读取的版本不再放入缓存
+	epoch uint64
+}
+
+func NewCachedRevocationStore(backend RevocationStore, size int) *CachedRevocationStore {
+	return &CachedRevocationStore{backend: backend, lru: newLRUCache[bool](size), versions: newLRUCache[int](size)}
+}
+
+func (s *CachedRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := s.backend.Revoke(ctx, jti, expiresAt); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bloom != nil {
+		s.bloom.add(jti)
+	}
+	s.lru.put(jti, true, expiresAt)
+	return nil
+}
+
+func (s *CachedRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	if revoked, ok := s.lru.get(jti); ok {
+		s.mu.Unlock()
+		return revoked, nil
+	}
+	if s.synced && !s.bloom.mayContain(jti) {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.mu.Unlock()
+
+	revoked, err := s.backend.IsRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	// jti 不会重复使用，已吊销的结果不会改变；未吊销的结果随时可能被其他实例吊销，不缓存
+	if revoked {
+		s.mu.Lock()
+		s.lru.put(jti, true, time.Now().Add(revokedCacheTTL))
+		s.mu.Unlock()
+	}
+	return revoked, nil
+}
+
+func (s *CachedRevocationStore) Active(ctx context.Context) ([]Revocation, error) {
+	return s.backend.Active(ctx)
+}
+
+func (s *CachedRevocationStore) Purge(ctx context.Context) (int64, error) {
+	return s.backend.Purge(ctx)
+}
+
+// Sync 从后端加载所有未过期的吊销记录，重建布隆过滤器
+func (s *CachedRevocationStore) Sync(ctx context.Context) error {
+	revocations, err := s.backend.Active(ctx)
+	if err != nil {
+		return err
+	}
+
+	bloom := newBloomFilter(len(revocations))
+	for _, r := range revocations {
+		bloom.add(r.JTI)
+	}
+
+	s.mu.Lock()
+	// 加载期间本实例新吊销的记录可能不在 revocations 中
+	for _, jti := range revokedKeys(s.lru) {
+		bloom.add(jti)
+	}
+	s.bloom = bloom
+	s.synced = true
+	// 其他实例可能修改了 token 版本
+	s.versions = newLRUCache[int](s.versions.size)
+	s.epoch++
+	s.mu.Unlock()
+	return nil
+}
+
+// tokenVersion 缓存的 token 版本；未命中时返回当前的 epoch，从数据库读取后传给 putTokenVersion
+func (s *CachedRevocationStore) tokenVersion(userID uint64) (version int, ok bool, epoch uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	version, ok = s.versions.get(strconv.FormatUint(userID, 10))
+	return version, ok, s.epoch
+}
+
+// putTokenVersion 缓存从数据库读取的 token 版本，只缓存一个同步周期
+// 读取之后缓存被清除过（epoch 已变化）时不缓存，避免放入会话吊销之前的版本
+func (s *CachedRevocationStore) putTokenVersion(userID uint64, version int, epoch uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.versionTTL <= 0 || epoch != s.epoch {
+		return
+	}
+	s.versions.put(strconv.FormatUint(userID, 10), version, time.Now().Add(s.versionTTL))
+}
+
+// invalidateTokenVersion 用户的会话被吊销后清除缓存的 token 版本
+func (s *CachedRevocationStore) invalidateTokenVersion(userID uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions.remove(strconv.FormatUint(userID, 10))
+	s.epoch++
+}
+
+// Run 立即同步一次，之后每隔 interval 同步，直到 ctx 结束；同步失败时继续直接查询后端
+func (s *CachedRevocationStore) Run(ctx context.Context, interval time.Duration) {
+	s.mu.Lock()
+	s.versionTTL = interval
+	s.mu.Unlock()
+
+	if err := s.Sync(ctx); err != nil {
+		log.Printf("加载token吊销记录失败: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sync(ctx); err != nil {
+				log.Printf("同步token吊销记录失败: %v", err)
+				s.mu.Lock()
+				s.synced = false
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// bloomFilter 布隆过滤器，使用双重哈希生成 k 个位置
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// newBloomFilter 按预计元素数创建布隆过滤器，预留一倍容量给同步周期之间新增的吊销记录
+func newBloomFilter(n int) *bloomFilter {
+	capacity := float64(n * 2)
+	if capacity < 1024 {
+		capacity = 1024
+	}
+	m := uint64(math.Ceil(-capacity * math.Log(bloomFalsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / capacity * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+func (b *bloomFilter) add(key string) {
+	h1, h2 := bloomHash(key)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *bloomFilter) mayContain(key string) bool {
+	h1, h2 := bloomHash(key)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func bloomHash(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h = fnv.New64()
+	h.Write([]byte(key))
+	// h2 为奇数，保证 k 个位置互不相同
+	return h1, h.Sum64() | 1
+}
+
+// lruCache 固定容量的 LRU 缓存，条目带有过期时间
+type lruCache[V any] struct {
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+	until time.Time
+}
+
+func newLRUCache[V any](size int) *lruCache[V] {
+	return &lruCache[V]{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lruCache[V]) get(key string) (V, bool) {
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := elem.Value.(*lruEntry[V])
+	if time.Now().After(entry.until) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *lruCache[V]) put(key string, value V, until time.Time) {
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry[V])
+		entry.value = value
+		entry.until = until
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value, until: until})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[V]).key)
+	}
+}
+
+func (c *lruCache[V]) remove(key string) {
+	if elem, ok := c.items[key]; ok {
+		c.order.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// revokedKeys 返回缓存中未过期的已吊销记录
+func revokedKeys(c *lruCache[bool]) []string {
+	now := time.Now()
+	var keys []string
+	for key, elem := range c.items {
+		entry := elem.Value.(*lruEntry[bool])
+		if entry.value && now.Before(entry.until) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
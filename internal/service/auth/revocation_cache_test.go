@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// memoryRevocationStore 内存中的吊销记录后端，queries 统计 IsRevoked 的调用次数
+type memoryRevocationStore struct {
+	records map[string]time.Time
+	queries int
+}
+
+func newMemoryRevocationStore() *memoryRevocationStore {
+	return &memoryRevocationStore{records: make(map[string]time.Time)}
+}
+
+func (s *memoryRevocationStore) Revoke(_ context.Context, jti string, expiresAt time.Time) error {
+	s.records[jti] = expiresAt
+	return nil
+}
+
+func (s *memoryRevocationStore) IsRevoked(_ context.Context, jti string) (bool, error) {
+	s.queries++
+	expiresAt, ok := s.records[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (s *memoryRevocationStore) Active(context.Context) ([]Revocation, error) {
+	var revocations []Revocation
+	for jti, expiresAt := range s.records {
+		if time.Now().Before(expiresAt) {
+			revocations = append(revocations, Revocation{JTI: jti, ExpiresAt: expiresAt})
+		}
+	}
+	return revocations, nil
+}
+
+func (s *memoryRevocationStore) Purge(context.Context) (int64, error) {
+	return 0, nil
+}
+
+func TestBloomFilterNoFalseNegatives(t *testing.T) {
+	const n = 10000
+	b := newBloomFilter(n)
+	for i := 0; i < n; i++ {
+		b.add(fmt.Sprintf("jti-%d", i))
+	}
+	for i := 0; i < n; i++ {
+		if !b.mayContain(fmt.Sprintf("jti-%d", i)) {
+			t.Fatalf("jti-%d: false negative", i)
+		}
+	}
+
+	// 误判率接近 bloomFalsePositiveRate，预留了一倍容量，实际应该更低
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if b.mayContain(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 2*bloomFalsePositiveRate {
+		t.Fatalf("false positive rate = %v", rate)
+	}
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := newLRUCache[int](3)
+	until := time.Now().Add(time.Hour)
+	c.put("a", 1, until)
+	c.put("b", 2, until)
+	c.put("c", 3, until)
+
+	// 访问 a 后 b 成为最久未使用的条目
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Fatalf("get a = %v, %v", v, ok)
+	}
+	c.put("d", 4, until)
+	if _, ok := c.get("b"); ok {
+		t.Fatal("b not evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := c.get(key); !ok {
+			t.Fatalf("%s evicted", key)
+		}
+	}
+
+	// 更新已有的条目不增加数量，并移到最前
+	c.put("a", 10, until)
+	c.put("e", 5, until)
+	if _, ok := c.get("c"); ok {
+		t.Fatal("c not evicted")
+	}
+	if v, _ := c.get("a"); v != 10 {
+		t.Fatalf("a = %d, want 10", v)
+	}
+
+	// 过期的条目视为不存在
+	c.put("f", 6, time.Now().Add(-time.Second))
+	if _, ok := c.get("f"); ok {
+		t.Fatal("expired entry returned")
+	}
+}
+
+func TestCachedRevocationStoreSync(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryRevocationStore()
+	expiresAt := time.Now().Add(time.Hour)
+	backend.records["before-sync"] = expiresAt
+	s := NewCachedRevocationStore(backend, 100)
+
+	// 同步之前直接查询后端
+	if revoked, _ := s.IsRevoked(ctx, "before-sync"); !revoked {
+		t.Fatal("before-sync not revoked")
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 过滤器判定不存在时不查询后端
+	queries := backend.queries
+	if revoked, _ := s.IsRevoked(ctx, "unknown"); revoked {
+		t.Fatal("unknown revoked")
+	}
+	if backend.queries != queries {
+		t.Fatal("backend queried for a jti not in the bloom filter")
+	}
+
+	// 本实例吊销的token立即生效，并且不会因为同步时后端还没有返回而丢失
+	if err := s.Revoke(ctx, "local", expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	delete(backend.records, "local")
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := s.IsRevoked(ctx, "local"); !revoked {
+		t.Fatal("local revocation lost after sync")
+	}
+
+	// 其他实例吊销的token在下一次同步后生效
+	backend.records["remote"] = expiresAt
+	if revoked, _ := s.IsRevoked(ctx, "remote"); revoked {
+		t.Fatal("remote revoked before sync")
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := s.IsRevoked(ctx, "remote"); !revoked {
+		t.Fatal("remote not revoked after sync")
+	}
+}
+
+func TestCachedRevocationStoreNoNegativeCache(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryRevocationStore()
+	s := NewCachedRevocationStore(backend, 100)
+	// 与 Run 一样设置同步周期
+	s.versionTTL = time.Hour
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟布隆过滤器的误判：未吊销的 jti 判定为可能存在时查询后端，结果不缓存
+	s.bloom.add("false-positive")
+	for i := 0; i < 2; i++ {
+		if revoked, _ := s.IsRevoked(ctx, "false-positive"); revoked {
+			t.Fatal("false-positive revoked")
+		}
+	}
+	if backend.queries != 2 {
+		t.Fatalf("backend queries = %d, want 2", backend.queries)
+	}
+
+	// 之后被其他实例吊销时立即生效，已吊销的结果缓存后不再查询后端
+	backend.records["false-positive"] = time.Now().Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if revoked, _ := s.IsRevoked(ctx, "false-positive"); !revoked {
+			t.Fatal("revocation by another instance not visible")
+		}
+	}
+	if backend.queries != 3 {
+		t.Fatalf("backend queries = %d, want 3", backend.queries)
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"qaqmall/config"
+)
+
+// RedisRevocationStore 保存在 Redis（或兼容 Redis 协议的服务）中的吊销记录
+// 每条记录是一个带过期时间的键，值为token的过期时间戳，过期的键由 Redis 自动删除
+type RedisRevocationStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisRevocationStore(cfg config.RedisConfig, prefix string) *RedisRevocationStore {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	return &RedisRevocationStore{client: client, prefix: prefix}
+}
+
+func (s *RedisRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, s.prefix+jti, expiresAt.Unix(), ttl).Err()
+}
+
+func (s *RedisRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.prefix+jti).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *RedisRevocationStore) Active(ctx context.Context) ([]Revocation, error) {
+	var revocations []Revocation
+	iter := s.client.Scan(ctx, 0, s.prefix+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		value, err := s.client.Get(ctx, key).Result()
+		if err == redis.Nil {
+			// 扫描期间已过期
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		exp, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		revocations = append(revocations, Revocation{
+			JTI:       strings.TrimPrefix(key, s.prefix),
+			ExpiresAt: time.Unix(exp, 0),
+		})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return revocations, nil
+}
+
+// Purge Redis 自动删除过期的键，无需清理
+func (s *RedisRevocationStore) Purge(ctx context.Context) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,163 @@
+package cart
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"qaqmall/models"
+)
+
+var (
+	ErrProductNotFound  = errors.New("商品不存在")
+	ErrCartItemNotFound = errors.New("购物车项不存在")
+	ErrInvalidQuantity  = errors.New("商品数量必须大于0")
+)
+
+// Cart 购物车内容及汇总信息
+type Cart struct {
+	Items            []models.CartItem
+	TotalPrice       float64
+	TotalQuantity    int
+	SelectedQuantity int
+	SelectedPrice    float64
+}
+
+// CartService 购物车业务逻辑，HTTP 和 gRPC 共用
+type CartService struct {
+	db *gorm.DB
+}
+
+func NewCartService(db *gorm.DB) *CartService {
+	return &CartService{db: db}
+}
+
+// List 获取用户购物车中的商品
+func (s *CartService) List(ctx context.Context, userID uint64) ([]models.CartItem, error) {
+	var items []models.CartItem
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Get 获取购物车内容并汇总总价、总数量和已选商品
+func (s *CartService) Get(ctx context.Context, userID uint64) (*Cart, error) {
+	items, err := s.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cart := &Cart{Items: items}
+	for _, item := range items {
+		amount := item.Price * float64(item.Quantity)
+		cart.TotalQuantity += item.Quantity
+		cart.TotalPrice += amount
+		if item.Selected {
+			cart.SelectedQuantity += item.Quantity
+			cart.SelectedPrice += amount
+		}
+	}
+	return cart, nil
+}
+
+// Count 购物车商品总件数
+func (s *CartService) Count(ctx context.Context, userID uint64) (int, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.CartItem{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&count).Error; err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// Add 添加商品到购物车，已存在时累加数量
+func (s *CartService) Add(ctx context.Context, userID, productID uint64, quantity int) (*models.CartItem, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	db := s.db.WithContext(ctx)
+
+	// 检查商品是否存在
+	var product models.Product
+	if err := db.First(&product, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	// 检查购物车中是否已存在该商品
+	var existingItem models.CartItem
+	err := db.Where("user_id = ? AND product_id = ?", userID, productID).First(&existingItem).Error
+	if err == nil {
+		existingItem.Quantity += quantity
+		if err := db.Save(&existingItem).Error; err != nil {
+			return nil, err
+		}
+		return &existingItem, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	item := models.CartItem{
+		UserID:       userID,
+		ProductID:    productID,
+		Quantity:     quantity,
+		ProductName:  product.Name,
+		Price:        product.Price,
+		ProductImage: product.ImageURL,
+		Selected:     true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Update 修改购物车项的数量和选中状态
+func (s *CartService) Update(ctx context.Context, userID, itemID uint64, quantity int, selected bool) (*models.CartItem, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	db := s.db.WithContext(ctx)
+
+	var item models.CartItem
+	if err := db.Where("id = ? AND user_id = ?", itemID, userID).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCartItemNotFound
+		}
+		return nil, err
+	}
+
+	item.Quantity = quantity
+	item.Selected = selected
+
+	if err := db.Save(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Remove 删除购物车项
+func (s *CartService) Remove(ctx context.Context, userID, itemID uint64) error {
+	result := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", itemID, userID).Delete(&models.CartItem{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCartItemNotFound
+	}
+	return nil
+}
+
+// Clear 清空购物车
+func (s *CartService) Clear(ctx context.Context, userID uint64) error {
+	return s.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.CartItem{}).Error
+}
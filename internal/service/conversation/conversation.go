@@ -0,0 +1,174 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/llm"
+	"qaqmall/internal/pagination"
+	"qaqmall/models"
+)
+
+var ErrConversationNotFound = errors.New("会话不存在")
+
+// maxTitleLength 自动生成的会话标题最大字数
+const maxTitleLength = 30
+
+// ListQuery 会话列表查询参数
+type ListQuery struct {
+	pagination.Pagination
+}
+
+// ConversationService AI助手多轮会话的存储
+// 继续会话时按 historyBudget 回放最近的历史消息，超出预算的更早消息不再发给大模型
+type ConversationService struct {
+	db            *gorm.DB
+	historyBudget int
+}
+
+func NewConversationService(db *gorm.DB, historyBudget int) *ConversationService {
+	return &ConversationService{db: db, historyBudget: historyBudget}
+}
+
+// Create 创建会话，title 为空时使用第一个问题作为标题
+func (s *ConversationService) Create(ctx context.Context, userID uint64, title string) (*models.Conversation, error) {
+	conv := models.Conversation{UserID: userID, Title: truncate(title, maxTitleLength)}
+	if err := s.db.WithContext(ctx).Create(&conv).Error; err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// List 分页获取用户的会话，最近活跃的在前
+func (s *ConversationService) List(ctx context.Context, userID uint64, q ListQuery) ([]models.Conversation, int64, error) {
+	q.Pagination = q.Pagination.Normalize()
+	query := s.db.WithContext(ctx).Model(&models.Conversation{}).Where("user_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var conversations []models.Conversation
+	if err := query.Order("updated_at DESC, id DESC").
+		Offset(q.Offset()).
+		Limit(q.PageSize).
+		Find(&conversations).Error; err != nil {
+		return nil, 0, err
+	}
+	return conversations, total, nil
+}
+
+// Get 获取会话及全部消息
+func (s *ConversationService) Get(ctx context.Context, userID, id uint64) (*models.Conversation, error) {
+	var conv models.Conversation
+	err := s.db.WithContext(ctx).
+		Preload("Messages", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("id = ? AND user_id = ?", id, userID).
+		First(&conv).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// History 按时间顺序返回需要回放的历史消息，从最新的消息往前取，总 token 数不超过预算
+func (s *ConversationService) History(ctx context.Context, userID, id uint64) ([]llm.Message, error) {
+	db := s.db.WithContext(ctx)
+	if err := findConversation(db, userID, id); err != nil {
+		return nil, err
+	}
+
+	var messages []models.Message
+	if err := db.Where("conversation_id = ?", id).Order("id DESC").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	var used int
+	var history []llm.Message
+	for _, m := range messages {
+		if used+m.Tokens > s.historyBudget {
+			break
+		}
+		used += m.Tokens
+		history = append(history, llm.Message{Role: m.Role, Content: m.Content})
+	}
+
+	// 回放时必须从用户的问题开始
+	for len(history) > 0 && history[len(history)-1].Role != llm.RoleUser {
+		history = history[:len(history)-1]
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return history, nil
+}
+
+// AppendTurn 保存一轮问答，会话还没有标题时用问题作为标题
+func (s *ConversationService) AppendTurn(ctx context.Context, userID, id uint64, question string, resp *llm.Response) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var conv models.Conversation
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&conv).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrConversationNotFound
+			}
+			return err
+		}
+
+		answerTokens := resp.Usage.CompletionTokens
+		if answerTokens == 0 {
+			answerTokens = llm.EstimateTokens(resp.Content)
+		}
+		messages := []models.Message{
+			{ConversationID: id, Role: llm.RoleUser, Content: question, Tokens: llm.EstimateTokens(question)},
+			{ConversationID: id, Role: llm.RoleAssistant, Content: resp.Content, Tokens: answerTokens},
+		}
+		if err := tx.Create(&messages).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"updated_at": time.Now()}
+		if conv.Title == "" {
+			updates["title"] = truncate(question, maxTitleLength)
+		}
+		return tx.Model(&conv).Updates(updates).Error
+	})
+}
+
+// Delete 删除会话及其消息
+func (s *ConversationService) Delete(ctx context.Context, userID, id uint64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := findConversation(tx, userID, id); err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", id).Delete(&models.Message{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Conversation{}, id).Error
+	})
+}
+
+func findConversation(db *gorm.DB, userID, id uint64) error {
+	var count int64
+	if err := db.Model(&models.Conversation{}).Where("id = ? AND user_id = ?", id, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrConversationNotFound
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,166 @@
+package guardrail
+
+import (
+	"regexp"
+	"strings"
+)
+
+// injectionPattern 提示词注入的特征及其原因
+type injectionPattern struct {
+	re     *regexp.Regexp
+	reason string
+}
+
+var injectionPatterns = []injectionPattern{
+	{
+		re:     regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override|bypass)\b.{0,30}\b(previous|above|prior|earlier|all|system|your)\b.{0,20}\b(instructions?|prompts?|rules?|directions?)\b`),
+		reason: "要求忽略之前的指令",
+	},
+	{
+		re:     regexp.MustCompile(`(忽略|无视|忘记|忘掉|不要理会|跳过|绕过).{0,12}(指令|指示|提示词|规则|设定|限制)`),
+		reason: "要求忽略之前的指令",
+	},
+	{
+		re:     regexp.MustCompile(`(?i)(system\s*prompt|系统提示词|系统指令|初始指令|(reveal|print|show|repeat|输出|显示|告诉我|复述).{0,10}(your|你的).{0,10}(instructions?|prompt|提示词|指令))`),
+		reason: "试图获取或修改系统提示词",
+	},
+	{
+		re:     regexp.MustCompile(`(?i)(\b(you are now|act as|pretend (to be|you are)|roleplay as)\b|你现在是|从现在开始你是|假装你是|你现在扮演)`),
+		reason: "要求扮演其他角色",
+	},
+	{
+		re:     regexp.MustCompile(`(?i)\b(jailbreak|developer mode|dan mode|do anything now)\b|越狱模式|开发者模式`),
+		reason: "越狱提示",
+	},
+	{
+		re:     regexp.MustCompile(`(?im)(<\|?/?(system|assistant|im_start|im_end)\|?>|\[/?INST\]|^\s*#{2,}\s*(system|instruction))`),
+		reason: "伪造对话标记",
+	},
+}
+
+// DetectInjection 检测文本中的提示词注入特征，命中时返回原因
+func DetectInjection(text string) (string, bool) {
+	for _, p := range injectionPatterns {
+		if p.re.MatchString(text) {
+			return p.reason, true
+		}
+	}
+	return "", false
+}
+
+// Allow 用户明确询问的个人信息，对应的信息不做脱敏
+type Allow struct {
+	Phone   bool
+	Email   bool
+	Address bool
+}
+
+var (
+	phoneKeywords   = []string{"电话", "手机号", "联系方式", "号码", "phone"}
+	emailKeywords   = []string{"邮箱", "邮件", "email", "e-mail"}
+	addressKeywords = []string{"地址", "收货", "寄到", "送到", "配送到", "address"}
+)
+
+// Intent 根据问题中的关键词判断用户是否在询问自己的电话、邮箱或地址
+func Intent(query string) Allow {
+	q := strings.ToLower(query)
+	return Allow{
+		Phone:   containsAny(q, phoneKeywords),
+		Email:   containsAny(q, emailKeywords),
+		Address: containsAny(q, addressKeywords),
+	}
+}
+
+// 个人信息的替换文本
+const (
+	phoneMask   = "[电话已隐藏]"
+	emailMask   = "[邮箱已隐藏]"
+	addressMask = "[地址已隐藏]"
+	idCardMask  = "[证件号已隐藏]"
+)
+
+var (
+	phonePattern = regexp.MustCompile(`(\+?86[- ]?)?\b1[3-9]\d{9}\b|\b0\d{2,3}-\d{7,8}\b`)
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// idCardPattern 18位居民身份证号，末位可以是校验码 X
+	idCardPattern = regexp.MustCompile(`\b[1-9]\d{5}(19|20)\d{2}(0[1-9]|1[0-2])(0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`)
+	// addressPatterns 街道门牌和楼栋房号
+	addressPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`[\p{Han}\d]{0,12}(路|街|大道|巷|弄|胡同)\d+号(院)?([\p{Han}\d-]{0,12}?\d+(栋|幢|号楼|单元|室|层))*`),
+		regexp.MustCompile(`\d+(栋|幢|号楼)(\d+单元)?(\d+室)?`),
+	}
+)
+
+// Redact 隐藏文本中的电话、邮箱和地址详情，allow 中的信息保留；身份证号总是隐藏
+func Redact(text string, allow Allow) string {
+	text = idCardPattern.ReplaceAllString(text, idCardMask)
+	if !allow.Email {
+		text = emailPattern.ReplaceAllString(text, emailMask)
+	}
+	if !allow.Phone {
+		text = phonePattern.ReplaceAllString(text, phoneMask)
+	}
+	if !allow.Address {
+		for _, re := range addressPatterns {
+			text = re.ReplaceAllString(text, addressMask)
+		}
+	}
+	return text
+}
+
+// maxPendingRunes 流式脱敏时最多缓存的字数，超过后即使没有遇到断句也输出
+const maxPendingRunes = 200
+
+// StreamRedactor 对流式输出脱敏
+// 电话、邮箱和地址中不会出现中文标点和换行，因此缓存到断句处再脱敏输出，避免个人信息被拆分在两段中漏掉
+type StreamRedactor struct {
+	allow   Allow
+	pending []rune
+	emit    func(string) error
+}
+
+func NewStreamRedactor(allow Allow, emit func(string) error) *StreamRedactor {
+	return &StreamRedactor{allow: allow, emit: emit}
+}
+
+// Write 写入一段输出，遇到断句时输出断句前的内容
+func (r *StreamRedactor) Write(delta string) error {
+	r.pending = append(r.pending, []rune(delta)...)
+
+	cut := -1
+	for i := len(r.pending) - 1; i >= 0; i-- {
+		if strings.ContainsRune("，。！？；：、\n", r.pending[i]) {
+			cut = i + 1
+			break
+		}
+	}
+	if cut < 0 && len(r.pending) > maxPendingRunes {
+		cut = len(r.pending)
+	}
+	if cut < 0 {
+		return nil
+	}
+
+	out := string(r.pending[:cut])
+	r.pending = append(r.pending[:0], r.pending[cut:]...)
+	return r.emit(Redact(out, r.allow))
+}
+
+// Flush 输出剩余的内容
+func (r *StreamRedactor) Flush() error {
+	if len(r.pending) == 0 {
+		return nil
+	}
+	out := string(r.pending)
+	r.pending = r.pending[:0]
+	return r.emit(Redact(out, r.allow))
+}
+
+func containsAny(s string, keywords []string) bool {
+	for _, k := range keywords {
+		if strings.Contains(s, k) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package guardrail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/models"
+)
+
+var (
+	ErrBlocked         = errors.New("问题包含不允许的内容")
+	ErrQuotaExceeded   = errors.New("今日AI使用额度已用完")
+	ErrEventNotFound   = errors.New("审核记录不存在")
+	ErrAlreadyReviewed = errors.New("该记录已审核")
+)
+
+// maxContentLength 审核记录中保存的内容最大字数
+const maxContentLength = 1000
+
+// BlockedError 被拦截的输入及原因，errors.Is(err, ErrBlocked) 为 true
+type BlockedError struct {
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%s：%s", ErrBlocked.Error(), e.Reason)
+}
+
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrBlocked
+}
+
+// EventQuery 审核记录的查询参数，UserID 为0、Source 为空时不过滤
+type EventQuery struct {
+	pagination.Pagination
+	UserID     uint64
+	Source     string
+	Unreviewed bool
+}
+
+// Usage 用户当天的 token 用量，Quota 为0表示不限制
+type Usage struct {
+	Day   string `json:"day"`
+	Used  int    `json:"used"`
+	Quota int    `json:"quota"`
+}
+
+// GuardrailService AI助手的安全防护
+// 拦截含有提示词注入特征的问题，过滤放入上下文的不可信内容，并按天限制每个用户的 token 用量；
+// 所有拦截都记录在 ai_moderation_events 中供管理员审核
+type GuardrailService struct {
+	db         *gorm.DB
+	dailyQuota int
+}
+
+func NewGuardrailService(db *gorm.DB, dailyQuota int) *GuardrailService {
+	return &GuardrailService{db: db, dailyQuota: dailyQuota}
+}
+
+// CheckInput 检查用户的问题，命中注入特征时记录并返回 *BlockedError
+func (s *GuardrailService) CheckInput(ctx context.Context, userID uint64, text string) error {
+	reason, found := DetectInjection(text)
+	if !found {
+		return nil
+	}
+	s.record(ctx, userID, models.ModerationSourceQuery, reason, text)
+	return &BlockedError{Reason: reason}
+}
+
+// CleanContext 过滤放入上下文的不可信内容（例如管理员填写的商品描述），label 用于在审核记录中标明内容的出处
+// 命中注入特征时记录并返回 false，调用方应丢弃该内容；否则返回按 allow 隐藏个人信息后的文本
+func (s *GuardrailService) CleanContext(ctx context.Context, userID uint64, source, label, text string, allow Allow) (string, bool) {
+	if reason, found := DetectInjection(text); found {
+		s.record(ctx, userID, source, reason, label+"\n"+text)
+		return "", false
+	}
+	return Redact(text, allow), true
+}
+
+// CheckQuota 检查用户当天的 token 用量，超出额度时记录并返回 ErrQuotaExceeded
+func (s *GuardrailService) CheckQuota(ctx context.Context, userID uint64) error {
+	usage, err := s.Usage(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if usage.Quota > 0 && usage.Used >= usage.Quota {
+		s.record(ctx, userID, models.ModerationSourceQuota, ErrQuotaExceeded.Error(),
+			fmt.Sprintf("used=%d quota=%d", usage.Used, usage.Quota))
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Usage 获取用户当天的 token 用量
+func (s *GuardrailService) Usage(ctx context.Context, userID uint64) (*Usage, error) {
+	usage := &Usage{Day: today(), Quota: s.dailyQuota}
+	var record models.AITokenUsage
+	err := s.db.WithContext(ctx).Where("user_id = ? AND day = ?", userID, usage.Day).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	usage.Used = record.Tokens
+	return usage, nil
+}
+
+// RecordUsage 累计用户当天的 token 用量，失败只记录日志
+func (s *GuardrailService) RecordUsage(ctx context.Context, userID uint64, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"tokens": gorm.Expr("tokens + ?", tokens), "updated_at": time.Now()}),
+	}).Create(&models.AITokenUsage{UserID: userID, Day: today(), Tokens: tokens}).Error
+	if err != nil {
+		log.Printf("记录AI token用量失败 user_id=%d tokens=%d: %v", userID, tokens, err)
+	}
+}
+
+// ListEvents 分页查询审核记录，最新的在前
+func (s *GuardrailService) ListEvents(ctx context.Context, q EventQuery) ([]models.AIModerationEvent, int64, error) {
+	q.Pagination = q.Pagination.Normalize()
+	query := s.db.WithContext(ctx).Model(&models.AIModerationEvent{})
+	if q.UserID > 0 {
+		query = query.Where("user_id = ?", q.UserID)
+	}
+	if q.Source != "" {
+		query = query.Where("source = ?", q.Source)
+	}
+	if q.Unreviewed {
+		query = query.Where("reviewed_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []models.AIModerationEvent
+	if err := query.Order("id DESC").
+		Offset(q.Offset()).
+		Limit(q.PageSize).
+		Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// Review 将审核记录标记为已审核
+func (s *GuardrailService) Review(ctx context.Context, id, reviewerID uint64) (*models.AIModerationEvent, error) {
+	db := s.db.WithContext(ctx)
+
+	var event models.AIModerationEvent
+	if err := db.First(&event, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEventNotFound
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	result := db.Model(&event).Where("reviewed_at IS NULL").
+		Updates(map[string]interface{}{"reviewed_at": now, "reviewed_by": reviewerID})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAlreadyReviewed
+	}
+
+	event.ReviewedAt = &now
+	event.ReviewedBy = reviewerID
+	return &event, nil
+}
+
+// record 记录被拦截的内容，失败只记录日志
+func (s *GuardrailService) record(ctx context.Context, userID uint64, source, reason, content string) {
+	if runes := []rune(content); len(runes) > maxContentLength {
+		content = string(runes[:maxContentLength])
+	}
+	event := models.AIModerationEvent{UserID: userID, Source: source, Reason: reason, Content: content}
+	if err := s.db.WithContext(ctx).Create(&event).Error; err != nil {
+		log.Printf("记录AI审核事件失败 user_id=%d source=%s: %v", userID, source, err)
+		return
+	}
+	log.Printf("AI请求已拦截 user_id=%d source=%s reason=%s", userID, source, reason)
+}
+
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
@@ -0,0 +1,355 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/oidc"
+	"qaqmall/internal/service/user"
+	"qaqmall/models"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("不支持的登录方式")
+	ErrInvalidState     = errors.New("登录请求无效或已过期，请重新登录")
+	ErrSignupDisabled   = errors.New("该第三方账号未关联用户，请先使用用户名密码登录后关联")
+	ErrEmailInUse       = errors.New("该邮箱已被其他用户使用，请先使用该用户登录后关联第三方账号")
+	ErrIdentityLinked   = errors.New("该第三方账号已关联其他用户")
+	ErrProviderLinked   = errors.New("已关联该平台的其他账号，请先解除关联")
+	ErrIdentityNotFound = errors.New("未关联该平台的账号")
+	ErrLastLoginMethod  = errors.New("这是该用户唯一的登录方式，请先设置密码再解除关联")
+)
+
+// ProviderInfo 可用的第三方登录方式
+type ProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// CallbackResult 第三方登录回调的结果
+// 第三方登录时 Login 不为空，与用户名密码登录的结果相同；关联第三方账号时 Linked 为 true
+type CallbackResult struct {
+	Login    *user.LoginResult
+	Identity *models.UserIdentity
+	Linked   bool
+}
+
+// IdentityService 第三方登录（OpenID Connect 授权码 + PKCE）及第三方账号的关联
+// 第三方账号按身份提供方和 sub 关联本地用户；没有关联的账号在身份提供方允许时自动注册，
+// 但不会按邮箱自动关联已有用户，避免他人在身份提供方注册同一邮箱接管账号
+type IdentityService struct {
+	db          *gorm.DB
+	users       *user.UserService
+	providers   map[string]*oidc.Provider
+	order       []string
+	stateExpire time.Duration
+}
+
+func NewIdentityService(db *gorm.DB, users *user.UserService, cfg config.OIDCConfig) *IdentityService {
+	s := &IdentityService{
+		db:          db,
+		users:       users,
+		providers:   make(map[string]*oidc.Provider, len(cfg.Providers)),
+		stateExpire: cfg.StateExpire,
+	}
+	for _, pc := range cfg.Providers {
+		s.providers[pc.Name] = oidc.NewProvider(pc)
+		s.order = append(s.order, pc.Name)
+	}
+	return s
+}
+
+// Providers 返回配置的身份提供方，顺序与配置一致
+func (s *IdentityService) Providers() []ProviderInfo {
+	infos := make([]ProviderInfo, 0, len(s.order))
+	for _, name := range s.order {
+		p := s.providers[name]
+		infos = append(infos, ProviderInfo{Name: p.Name(), DisplayName: p.DisplayName()})
+	}
+	return infos
+}
+
+// AuthorizationURL 开始第三方登录（userID 为0）或为已登录用户关联第三方账号，返回跳转到身份提供方的地址
+// state、nonce 和 PKCE code_verifier 保存在服务端，回调时校验
+func (s *IdentityService) AuthorizationURL(ctx context.Context, provider string, userID uint64, loginHint string) (string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.RandomString(48)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier), loginHint)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.db.WithContext(ctx).Create(&models.OIDCState{
+		StateHash:    hashState(state),
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       userID,
+		ExpiresAt:    time.Now().Add(s.stateExpire),
+	}).Error; err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// Callback 处理身份提供方的回调：校验 state，使用授权码换取并校验 id_token，然后登录或关联第三方账号
+func (s *IdentityService) Callback(ctx context.Context, provider, state, code string) (*CallbackResult, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	if state == "" || code == "" {
+		return nil, ErrInvalidState
+	}
+
+	record, err := s.claimState(ctx, provider, state)
+	if err != nil {
+		return nil, err
+	}
+
+	ident, err := p.Exchange(ctx, code, record.CodeVerifier, record.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.UserID != 0 {
+		linked, err := s.link(ctx, record.UserID, provider, ident)
+		if err != nil {
+			return nil, err
+		}
+		return &CallbackResult{Identity: linked, Linked: true}, nil
+	}
+	return s.login(ctx, p, ident)
+}
+
+// List 返回用户关联的第三方账号
+func (s *IdentityService) List(ctx context.Context, userID uint64) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// Unlink 解除用户与身份提供方的关联；没有设置密码的用户不能解除最后一个关联
+func (s *IdentityService) Unlink(ctx context.Context, userID uint64, provider string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var u models.User
+		if err := tx.Where("id = ? AND deleted_at IS NULL", userID).First(&u).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return user.ErrUserNotFound
+			}
+			return err
+		}
+
+		var identities []models.UserIdentity
+		if err := tx.Where("user_id = ?", userID).Find(&identities).Error; err != nil {
+			return err
+		}
+		var target *models.UserIdentity
+		for i := range identities {
+			if identities[i].Provider == provider {
+				target = &identities[i]
+			}
+		}
+		if target == nil {
+			return ErrIdentityNotFound
+		}
+		if u.Password == "" && len(identities) == 1 {
+			return ErrLastLoginMethod
+		}
+		return tx.Delete(target).Error
+	})
+}
+
+// PurgeExpiredStates 清除过期未使用的授权请求，返回清除的条数
+func (s *IdentityService) PurgeExpiredStates(ctx context.Context) (int64, error) {
+	result := s.db.WithContext(ctx).
+		Where("expires_at <= ?", time.Now()).
+		Delete(&models.OIDCState{})
+	return result.RowsAffected, result.Error
+}
+
+// claimState 取出并删除 state 对应的授权请求，条件删除保证并发的回调只有一个能使用
+func (s *IdentityService) claimState(ctx context.Context, provider, state string) (*models.OIDCState, error) {
+	var record models.OIDCState
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		hash := hashState(state)
+		if err := tx.Where("state_hash = ? AND provider = ?", hash, provider).First(&record).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidState
+			}
+			return err
+		}
+		result := tx.Where("state_hash = ? AND expires_at > ?", hash, time.Now()).Delete(&models.OIDCState{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidState
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// login 使用第三方账号登录，没有关联用户时按身份提供方的配置自动注册
+func (s *IdentityService) login(ctx context.Context, p *oidc.Provider, ident *oidc.Identity) (*CallbackResult, error) {
+	var (
+		u      models.User
+		linked models.UserIdentity
+	)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Where("provider = ? AND subject = ?", p.Name(), ident.Subject).First(&linked).Error
+		switch {
+		case err == nil:
+			err = tx.Where("id = ? AND deleted_at IS NULL", linked.UserID).First(&u).Error
+			if err == nil {
+				linked.Email = ident.Email
+				linked.LastLoginAt = &now
+				return tx.Model(&linked).Updates(map[string]interface{}{"email": ident.Email, "last_login_at": now}).Error
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			// 关联的用户已被删除，按新用户处理
+			if err := tx.Delete(&linked).Error; err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		if !p.AllowSignup() {
+			return ErrSignupDisabled
+		}
+		if ident.EmailVerified && ident.Email != "" {
+			var count int64
+			if err := tx.Model(&models.User{}).
+				Where("email = ? AND deleted_at IS NULL", ident.Email).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrEmailInUse
+			}
+		}
+
+		created, err := user.CreateExternalUser(tx, user.ExternalUserInput{
+			Username:      usernameHint(ident),
+			Email:         ident.Email,
+			EmailVerified: ident.EmailVerified,
+		})
+		if err != nil {
+			return err
+		}
+		u = *created
+		linked = models.UserIdentity{
+			UserID:      u.ID,
+			Provider:    p.Name(),
+			Subject:     ident.Subject,
+			Email:       ident.Email,
+			LastLoginAt: &now,
+		}
+		return tx.Create(&linked).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.users.StartSession(ctx, &u)
+	if err != nil {
+		return nil, err
+	}
+	return &CallbackResult{Login: result, Identity: &linked}, nil
+}
+
+// link 为已登录用户关联第三方账号，重复关联同一个账号时直接返回
+func (s *IdentityService) link(ctx context.Context, userID uint64, provider string, ident *oidc.Identity) (*models.UserIdentity, error) {
+	var linked models.UserIdentity
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var u models.User
+		if err := tx.Where("id = ? AND deleted_at IS NULL", userID).First(&u).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return user.ErrUserNotFound
+			}
+			return err
+		}
+
+		err := tx.Where("provider = ? AND subject = ?", provider, ident.Subject).First(&linked).Error
+		switch {
+		case err == nil && linked.UserID == userID:
+			linked.Email = ident.Email
+			return tx.Model(&linked).Update("email", ident.Email).Error
+		case err == nil:
+			return ErrIdentityLinked
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.UserIdentity{}).
+			Where("user_id = ? AND provider = ?", userID, provider).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrProviderLinked
+		}
+
+		linked = models.UserIdentity{
+			UserID:   userID,
+			Provider: provider,
+			Subject:  ident.Subject,
+			Email:    ident.Email,
+		}
+		return tx.Create(&linked).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &linked, nil
+}
+
+// usernameHint 自动注册时期望的用户名，依次使用 preferred_username、邮箱的用户名部分和 name
+func usernameHint(ident *oidc.Identity) string {
+	if ident.PreferredUsername != "" {
+		return ident.PreferredUsername
+	}
+	if local, _, ok := strings.Cut(ident.Email, "@"); ok && local != "" {
+		return local
+	}
+	return ident.Name
+}
+
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,249 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/oidc"
+	"qaqmall/internal/service/auth"
+	"qaqmall/internal/service/mfa"
+	"qaqmall/internal/service/user"
+	"qaqmall/internal/testutil"
+	"qaqmall/models"
+)
+
+const testRedirectURL = "http://localhost:8888/oauth/mock/callback"
+
+// newTestService 使用内存 SQLite 和运行在 httptest 服务上的 MockProvider
+func newTestService(t *testing.T, allowSignup bool) (*IdentityService, *gorm.DB) {
+	t.Helper()
+	db := testutil.NewSQLite(t, &models.User{}, &models.UserIdentity{}, &models.OIDCState{}, &models.RefreshToken{}, &models.UserMFA{})
+
+	var mock *oidc.MockProvider
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	var err error
+	mock, err = oidc.NewMockProvider(config.OIDCMockConfig{Issuer: srv.URL, ClientID: "qaqmall", ClientSecret: "mock-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.JWT.Secret = "identity-test-secret"
+	cfg.OIDC.Providers = []config.OIDCProviderConfig{{
+		Name:         "mock",
+		Issuer:       srv.URL,
+		ClientID:     "qaqmall",
+		ClientSecret: "mock-secret",
+		RedirectURL:  testRedirectURL,
+		AllowSignup:  allowSignup,
+	}}
+	keys, err := auth.NewKeyring(cfg.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := auth.NewTokenService(db, cfg.JWT, keys, auth.NewDBRevocationStore(db))
+	users := user.NewUserService(db, tokens, mfa.NewMFAService(db, cfg.MFA), nil, nil, cfg.Account, nil)
+	return NewIdentityService(db, users, cfg.OIDC), db
+}
+
+// authorize 开始登录或关联，请求身份提供方的授权地址（不跟随重定向），返回回调中的 state 和 code
+func authorize(t *testing.T, s *IdentityService, userID uint64, loginHint string) (state, code string) {
+	t.Helper()
+	authURL, err := s.AuthorizationURL(context.Background(), "mock", userID, loginHint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, param := range []string{"state", "nonce", "code_challenge"} {
+		if u, _ := url.Parse(authURL); u.Query().Get(param) == "" {
+			t.Fatalf("authorization url has no %s: %s", param, authURL)
+		}
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := location.Query()
+	if q.Get("code") == "" {
+		t.Fatalf("callback has no code: %s", location)
+	}
+	return q.Get("state"), q.Get("code")
+}
+
+func TestCallbackLogin(t *testing.T) {
+	s, db := newTestService(t, true)
+	ctx := context.Background()
+
+	// 第一次登录时自动注册，邮箱已验证
+	state, code := authorize(t, s, 0, "alice@example.com")
+	result, err := s.Callback(ctx, "mock", state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Login == nil || result.Login.Tokens == nil || result.Linked {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	created := result.Login.User
+	if created.Username != "alice" || created.Email != "alice@example.com" || created.EmailVerifiedAt == nil {
+		t.Fatalf("unexpected user: %+v", created)
+	}
+
+	// state 只能使用一次
+	if _, err := s.Callback(ctx, "mock", state, code); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("reused state: err = %v, want ErrInvalidState", err)
+	}
+
+	// 再次登录时使用已关联的用户
+	state, code = authorize(t, s, 0, "alice@example.com")
+	result, err = s.Callback(ctx, "mock", state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Login.User.ID != created.ID {
+		t.Fatalf("logged in as user %d, want %d", result.Login.User.ID, created.ID)
+	}
+	if result.Identity.LastLoginAt == nil {
+		t.Fatal("last_login_at not updated")
+	}
+
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("users = %d, want 1", count)
+	}
+}
+
+func TestCallbackEmailInUse(t *testing.T) {
+	s, db := newTestService(t, true)
+	ctx := context.Background()
+
+	now := time.Now()
+	existing := models.User{Username: "alice", Password: "hash", Email: "alice@example.com", EmailVerifiedAt: &now, Role: "user"}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 不按邮箱自动关联已有用户
+	state, code := authorize(t, s, 0, "alice@example.com")
+	if _, err := s.Callback(ctx, "mock", state, code); !errors.Is(err, ErrEmailInUse) {
+		t.Fatalf("err = %v, want ErrEmailInUse", err)
+	}
+	var identities int64
+	db.Model(&models.UserIdentity{}).Count(&identities)
+	if identities != 0 {
+		t.Fatalf("identities = %d, want 0", identities)
+	}
+
+	// 登录后关联同一个第三方账号，之后可以用它登录
+	state, code = authorize(t, s, existing.ID, "alice@example.com")
+	result, err := s.Callback(ctx, "mock", state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Linked || result.Login != nil || result.Identity.UserID != existing.ID {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	state, code = authorize(t, s, 0, "alice@example.com")
+	result, err = s.Callback(ctx, "mock", state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Login.User.ID != existing.ID {
+		t.Fatalf("logged in as user %d, want %d", result.Login.User.ID, existing.ID)
+	}
+}
+
+func TestCallbackLink(t *testing.T) {
+	s, db := newTestService(t, true)
+	ctx := context.Background()
+
+	bob := models.User{Username: "bob", Password: "hash", Role: "user"}
+	carol := models.User{Username: "carol", Password: "hash", Role: "user"}
+	for _, u := range []*models.User{&bob, &carol} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state, code := authorize(t, s, bob.ID, "bob-mock")
+	result, err := s.Callback(ctx, "mock", state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Linked || result.Identity.Subject != "bob-mock" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	// 同一用户重复关联同一个账号时直接返回
+	state, code = authorize(t, s, bob.ID, "bob-mock")
+	if _, err := s.Callback(ctx, "mock", state, code); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一平台的其他账号
+	state, code = authorize(t, s, bob.ID, "bob-other")
+	if _, err := s.Callback(ctx, "mock", state, code); !errors.Is(err, ErrProviderLinked) {
+		t.Fatalf("err = %v, want ErrProviderLinked", err)
+	}
+
+	// 已关联其他用户的账号
+	state, code = authorize(t, s, carol.ID, "bob-mock")
+	if _, err := s.Callback(ctx, "mock", state, code); !errors.Is(err, ErrIdentityLinked) {
+		t.Fatalf("err = %v, want ErrIdentityLinked", err)
+	}
+
+	identities, err := s.List(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 {
+		t.Fatalf("identities = %d, want 1", len(identities))
+	}
+
+	// 设置了密码的用户可以解除唯一的关联
+	if err := s.Unlink(ctx, bob.ID, "mock"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCallbackSignupDisabled(t *testing.T) {
+	s, _ := newTestService(t, false)
+
+	state, code := authorize(t, s, 0, "dave")
+	if _, err := s.Callback(context.Background(), "mock", state, code); !errors.Is(err, ErrSignupDisabled) {
+		t.Fatalf("err = %v, want ErrSignupDisabled", err)
+	}
+}
+
+func TestCallbackInvalidState(t *testing.T) {
+	s, _ := newTestService(t, true)
+	ctx := context.Background()
+
+	_, code := authorize(t, s, 0, "erin")
+	if _, err := s.Callback(ctx, "mock", "forged-state", code); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("err = %v, want ErrInvalidState", err)
+	}
+	if _, err := s.Callback(ctx, "unknown", "state", code); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("err = %v, want ErrUnknownProvider", err)
+	}
+}
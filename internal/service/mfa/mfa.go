@@ -0,0 +1,354 @@
+package mfa
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/models"
+)
+
+var (
+	ErrNotEnrolled    = errors.New("请先生成二次验证密钥")
+	ErrAlreadyEnabled = errors.New("已开启二次验证")
+	ErrNotEnabled     = errors.New("未开启二次验证")
+	ErrInvalidCode    = errors.New("验证码错误")
+	ErrLocked         = errors.New("验证码错误次数过多，请稍后再试")
+)
+
+const (
+	// recoveryCodeCount 每次生成的恢复码个数
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet 恢复码字符集，去掉了容易混淆的 0、1、i、l、o
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	// maxFailedAttempts 连续验证失败达到该次数后锁定 lockDuration
+	maxFailedAttempts = 5
+	lockDuration      = 15 * time.Minute
+)
+
+// Enrollment 生成的 TOTP 密钥，Secret 供手动输入，URI 渲染为二维码供扫码绑定
+type Enrollment struct {
+	Secret string
+	URI    string
+}
+
+// Status 用户的二次验证状态
+type Status struct {
+	Enabled                bool
+	EnabledAt              *time.Time
+	RecoveryCodesRemaining int64
+}
+
+// MFAService TOTP（RFC 6238）二次验证：绑定验证器、校验验证码、恢复码和关闭
+// 绑定分两步：Enroll 生成密钥，Activate 用验证器上的验证码确认后才生效
+type MFAService struct {
+	db  *gorm.DB
+	cfg config.MFAConfig
+	// key 加密 TOTP 密钥使用的 AES-256 密钥，由 mfa.encryption_key 派生
+	key []byte
+}
+
+func NewMFAService(db *gorm.DB, cfg config.MFAConfig) *MFAService {
+	key := sha256.Sum256([]byte(cfg.EncryptionKey))
+	return &MFAService{db: db, cfg: cfg, key: key[:]}
+}
+
+// Enabled 用户是否已开启二次验证
+func (s *MFAService) Enabled(ctx context.Context, userID uint64) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.UserMFA{}).
+		Where("user_id = ? AND enabled_at IS NOT NULL", userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Status 返回用户的二次验证状态和剩余的恢复码个数
+func (s *MFAService) Status(ctx context.Context, userID uint64) (*Status, error) {
+	record, err := s.get(ctx, userID)
+	if errors.Is(err, ErrNotEnrolled) {
+		return &Status{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Enabled: record.EnabledAt != nil, EnabledAt: record.EnabledAt}
+	if status.Enabled {
+		if err := s.db.WithContext(ctx).Model(&models.MFARecoveryCode{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Count(&status.RecoveryCodesRemaining).Error; err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Enroll 为用户生成新的 TOTP 密钥，之前生成但未确认的密钥随即作废；已开启二次验证时返回 ErrAlreadyEnabled
+func (s *MFAService) Enroll(ctx context.Context, userID uint64) (*Enrollment, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ? AND deleted_at IS NULL", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	record, err := s.get(ctx, userID)
+	if err != nil && !errors.Is(err, ErrNotEnrolled) {
+		return nil, err
+	}
+	if record != nil && record.EnabledAt != nil {
+		return nil, ErrAlreadyEnabled
+	}
+
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	encrypted, err := s.encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserMFA{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserMFA{UserID: userID, Secret: encrypted}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Enrollment{
+		Secret: base32NoPadding.EncodeToString(secret),
+		URI:    provisioningURI(s.cfg.Issuer, user.Username, secret),
+	}, nil
+}
+
+// Activate 使用验证器上的验证码确认绑定，返回恢复码；恢复码只在此时返回一次
+func (s *MFAService) Activate(ctx context.Context, userID uint64, code string) ([]string, error) {
+	record, err := s.get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if record.EnabledAt != nil {
+		return nil, ErrAlreadyEnabled
+	}
+	if err := s.check(ctx, record, code, false); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserMFA{}).Where("user_id = ?", userID).
+			Update("enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify 校验验证码或恢复码，用于登录时的二次验证；恢复码使用后失效
+func (s *MFAService) Verify(ctx context.Context, userID uint64, code string) error {
+	record, err := s.enabled(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.check(ctx, record, code, true)
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码，之前的恢复码全部失效
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID uint64, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable 校验验证码或恢复码后关闭二次验证，删除密钥和恢复码
+func (s *MFAService) Disable(ctx context.Context, userID uint64, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.UserMFA{}).Error
+	})
+}
+
+// check 校验验证码，allowRecovery 为 true 时也接受恢复码
+// 连续失败 maxFailedAttempts 次后锁定 lockDuration，期间所有验证码都会被拒绝
+func (s *MFAService) check(ctx context.Context, record *models.UserMFA, code string, allowRecovery bool) error {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+	if record.LockedUntil != nil && now.Before(*record.LockedUntil) {
+		return ErrLocked
+	}
+
+	secret, err := s.decrypt(record.Secret)
+	if err != nil {
+		return err
+	}
+
+	if step, ok := validateTOTP(secret, code, now, record.LastUsedStep); ok {
+		// 条件更新保证同一个验证码在并发请求中只能使用一次
+		result := db.Model(&models.UserMFA{}).
+			Where("user_id = ? AND last_used_step < ?", record.UserID, step).
+			Updates(map[string]interface{}{"last_used_step": step, "failed_attempts": 0, "locked_until": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+	}
+
+	if allowRecovery {
+		result := db.Model(&models.MFARecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", record.UserID, hashRecoveryCode(code)).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return db.Model(&models.UserMFA{}).Where("user_id = ?", record.UserID).
+				Updates(map[string]interface{}{"failed_attempts": 0, "locked_until": nil}).Error
+		}
+	}
+
+	updates := map[string]interface{}{"failed_attempts": gorm.Expr("failed_attempts + 1")}
+	if record.FailedAttempts+1 >= maxFailedAttempts {
+		updates = map[string]interface{}{"failed_attempts": 0, "locked_until": now.Add(lockDuration)}
+	}
+	if err := db.Model(&models.UserMFA{}).Where("user_id = ?", record.UserID).Updates(updates).Error; err != nil {
+		return err
+	}
+	return ErrInvalidCode
+}
+
+func (s *MFAService) get(ctx context.Context, userID uint64) (*models.UserMFA, error) {
+	var record models.UserMFA
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotEnrolled
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *MFAService) enabled(ctx context.Context, userID uint64) (*models.UserMFA, error) {
+	record, err := s.get(ctx, userID)
+	if errors.Is(err, ErrNotEnrolled) || (err == nil && record.EnabledAt == nil) {
+		return nil, ErrNotEnabled
+	}
+	return record, err
+}
+
+// encrypt 使用 AES-GCM 加密 TOTP 密钥，结果为 base64(nonce + 密文)
+func (s *MFAService) encrypt(plaintext []byte) (string, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func (s *MFAService) decrypt(encoded string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("TOTP 密钥已损坏")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func (s *MFAService) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// replaceRecoveryCodes 删除用户原有的恢复码并生成新的一组，返回明文
+func replaceRecoveryCodes(tx *gorm.DB, userID uint64) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.MFARecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.MFARecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// newRecoveryCode 生成 "xxxxx-xxxxx" 格式的恢复码
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 11)
+	for i, v := range b {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryCodeAlphabet[int(v)%len(recoveryCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+// hashRecoveryCode 忽略大小写、空格和连字符后计算哈希
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
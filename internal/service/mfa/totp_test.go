@@ -0,0 +1,67 @@
+package mfa
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret RFC 6238 附录 B 中 SHA1 测试向量使用的密钥
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// 附录 B 中的验证码为 8 位，6 位验证码是它的后 6 位
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		want := tt.code[len(tt.code)-totpDigits:]
+		if got := totpCode(rfc6238Secret, totpStep(time.Unix(tt.unix, 0))); got != want {
+			t.Errorf("totpCode(T=%d) = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+	codeAt := func(step int64) string {
+		return totpCode(rfc6238Secret, step)
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		after    int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: codeAt(current), wantStep: current, wantOK: true},
+		{name: "previous step within skew", code: codeAt(current - totpSkew), wantStep: current - totpSkew, wantOK: true},
+		{name: "next step within skew", code: codeAt(current + totpSkew), wantStep: current + totpSkew, wantOK: true},
+		{name: "outside skew", code: codeAt(current - totpSkew - 1)},
+		{name: "future outside skew", code: codeAt(current + totpSkew + 1)},
+		{name: "surrounding spaces", code: " " + codeAt(current) + " ", wantStep: current, wantOK: true},
+		{name: "wrong code", code: "000000"},
+		{name: "wrong length", code: codeAt(current)[:totpDigits-1]},
+		// 已使用过的时间步（以及之前的）不能再次使用
+		{name: "replay of used step", code: codeAt(current), after: current},
+		{name: "replay of earlier step", code: codeAt(current - 1), after: current - 1},
+		{name: "later step after use", code: codeAt(current + 1), after: current, wantStep: current + 1, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := validateTOTP(rfc6238Secret, tt.code, now, tt.after)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Fatalf("validateTOTP = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/audit"
+	"qaqmall/models"
+)
+
+var ErrOrderNotRefundable = errors.New("只能对已支付、已发货的订单或者有待退款支付的已取消订单退款")
+
+// AdminListQuery 管理后台的订单查询参数，为空的条件不过滤
+type AdminListQuery struct {
+	pagination.Pagination
+	UserID      uint64
+	Status      models.OrderStatus
+	OrderNumber string
+}
+
+// AdminList 分页查询所有用户的订单，按创建时间倒序
+func (s *OrderService) AdminList(ctx context.Context, q AdminListQuery) ([]models.Order, int64, error) {
+	q.Pagination = q.Pagination.Normalize()
+	query := s.db.WithContext(ctx).Model(&models.Order{})
+	if q.UserID > 0 {
+		query = query.Where("user_id = ?", q.UserID)
+	}
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+	if q.OrderNumber != "" {
+		query = query.Where("order_number = ?", q.OrderNumber)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var orders []models.Order
+	if err := query.Order("created_at DESC, id DESC").
+		Offset(q.Offset()).
+		Limit(q.PageSize).
+		Preload("Items").
+		Find(&orders).Error; err != nil {
+		return nil, 0, err
+	}
+	return orders, total, nil
+}
+
+// AdminGet 获取任意用户的订单详情
+func (s *OrderService) AdminGet(ctx context.Context, orderID uint64) (*models.Order, error) {
+	var order models.Order
+	if err := s.db.WithContext(ctx).Preload("Items").Preload("Address").First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+// Refund 对已支付或已发货的订单全额退款：订单改为已退款，已支付和待退款的支付记录改为已退款，未发货的订单由状态变化的 Hook 恢复库存
+// 已取消的订单只处理待退款的支付记录（取消后才支付成功的款项），订单状态不变；没有待退款的支付记录时返回 ErrOrderNotRefundable
+func (s *OrderService) Refund(ctx context.Context, actor audit.Actor, orderID uint64, reason string) (*models.Order, error) {
+	var order models.Order
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+
+		before := order.Status
+		var amount float64
+		if order.Status == models.OrderStatusCancelled {
+			var refunded int
+			var err error
+			if amount, refunded, err = refundPayments(tx, order.ID, models.PaymentStatusRefundPending); err != nil {
+				return err
+			}
+			if refunded == 0 {
+				return ErrOrderNotRefundable
+			}
+		} else {
+			err := s.ChangeStatus(tx, &order, models.OrderStatusRefunded, adminActor(actor), reason)
+			if errors.Is(err, ErrInvalidTransition) {
+				return ErrOrderNotRefundable
+			}
+			if err != nil {
+				return err
+			}
+			if amount, _, err = refundPayments(tx, order.ID, models.PaymentStatusPaid, models.PaymentStatusRefundPending); err != nil {
+				return err
+			}
+		}
+
+		return audit.Record(tx, audit.Entry{
+			Actor:      actor,
+			Action:     models.AuditOrderRefund,
+			TargetType: models.AuditTargetOrder,
+			TargetID:   strconv.FormatUint(order.ID, 10),
+			Before:     map[string]interface{}{"status": before},
+			After:      map[string]interface{}{"status": order.Status, "amount": amount},
+			Reason:     reason,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// refundPayments 把订单中状态为 statuses 的支付记录改为已退款，返回退款的总金额和支付记录数
+func refundPayments(tx *gorm.DB, orderID uint64, statuses ...models.PaymentStatus) (float64, int, error) {
+	var payments []models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status IN ?", orderID, statuses).
+		Find(&payments).Error; err != nil {
+		return 0, 0, err
+	}
+	if len(payments) == 0 {
+		return 0, 0, nil
+	}
+
+	var amount float64
+	ids := make([]uint64, 0, len(payments))
+	for _, p := range payments {
+		amount += p.Amount
+		ids = append(ids, p.ID)
+	}
+	if err := tx.Model(&models.Payment{}).
+		Where("id IN ?", ids).
+		Update("status", models.PaymentStatusRefunded).Error; err != nil {
+		return 0, 0, err
+	}
+	return amount, len(payments), nil
+}
+
+// Ship 将已支付的订单标记为已发货
+func (s *OrderService) Ship(ctx context.Context, actor audit.Actor, orderID uint64, reason string) (*models.Order, error) {
+	return s.Transition(ctx, orderID, models.OrderStatusShipped, adminActor(actor), reason)
+}
+
+// Complete 将已发货的订单标记为已完成
+func (s *OrderService) Complete(ctx context.Context, actor audit.Actor, orderID uint64, reason string) (*models.Order, error) {
+	return s.Transition(ctx, orderID, models.OrderStatusCompleted, adminActor(actor), reason)
+}
+
+// adminActor 管理员或客服发起的状态变化
+func adminActor(actor audit.Actor) Actor {
+	return Actor{Type: models.OrderActorAdmin, UserID: actor.UserID}
+}
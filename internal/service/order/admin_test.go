@@ -0,0 +1,145 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/service/audit"
+	"qaqmall/models"
+)
+
+func createPayment(t *testing.T, db *gorm.DB, order *models.Order, status models.PaymentStatus) *models.Payment {
+	t.Helper()
+	var count int64
+	db.Model(&models.Payment{}).Count(&count)
+	payment := models.Payment{
+		PaymentNumber: fmt.Sprintf("P%d", count+1),
+		OrderID:       order.ID,
+		UserID:        order.UserID,
+		Amount:        order.TotalAmount,
+		PaymentMethod: models.PaymentMethodAlipay,
+		Status:        status,
+	}
+	if err := db.Create(&payment).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &payment
+}
+
+func paymentStatus(t *testing.T, db *gorm.DB, payment *models.Payment) models.PaymentStatus {
+	t.Helper()
+	var reloaded models.Payment
+	if err := db.First(&reloaded, payment.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return reloaded.Status
+}
+
+func TestRefund(t *testing.T) {
+	admin := audit.Actor{UserID: 100}
+	tests := []struct {
+		name       string
+		status     models.OrderStatus
+		payments   []models.PaymentStatus
+		wantErr    error
+		wantStatus models.OrderStatus
+		wantStock  int
+		// 退款后各支付记录的状态
+		wantPayments []models.PaymentStatus
+	}{
+		{
+			name:         "paid",
+			status:       models.OrderStatusPaid,
+			payments:     []models.PaymentStatus{models.PaymentStatusPaid, models.PaymentStatusRefundPending, models.PaymentStatusCancelled},
+			wantStatus:   models.OrderStatusRefunded,
+			wantStock:    13,
+			wantPayments: []models.PaymentStatus{models.PaymentStatusRefunded, models.PaymentStatusRefunded, models.PaymentStatusCancelled},
+		},
+		{
+			name:         "shipped keeps stock",
+			status:       models.OrderStatusShipped,
+			payments:     []models.PaymentStatus{models.PaymentStatusPaid},
+			wantStatus:   models.OrderStatusRefunded,
+			wantStock:    10,
+			wantPayments: []models.PaymentStatus{models.PaymentStatusRefunded},
+		},
+		{
+			// 取消时已经恢复过库存，只处理取消后才支付成功的款项
+			name:         "cancelled with refund_pending payment",
+			status:       models.OrderStatusCancelled,
+			payments:     []models.PaymentStatus{models.PaymentStatusCancelled, models.PaymentStatusRefundPending},
+			wantStatus:   models.OrderStatusCancelled,
+			wantStock:    10,
+			wantPayments: []models.PaymentStatus{models.PaymentStatusCancelled, models.PaymentStatusRefunded},
+		},
+		{
+			name:         "cancelled without refund_pending payment",
+			status:       models.OrderStatusCancelled,
+			payments:     []models.PaymentStatus{models.PaymentStatusCancelled},
+			wantErr:      ErrOrderNotRefundable,
+			wantStatus:   models.OrderStatusCancelled,
+			wantStock:    10,
+			wantPayments: []models.PaymentStatus{models.PaymentStatusCancelled},
+		},
+		{
+			name:         "pending",
+			status:       models.OrderStatusPending,
+			payments:     []models.PaymentStatus{models.PaymentStatusPending},
+			wantErr:      ErrOrderNotRefundable,
+			wantStatus:   models.OrderStatusPending,
+			wantStock:    10,
+			wantPayments: []models.PaymentStatus{models.PaymentStatusPending},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newTestService(t)
+			order := createOrder(t, db, tt.status)
+			var payments []*models.Payment
+			for _, status := range tt.payments {
+				payments = append(payments, createPayment(t, db, order, status))
+			}
+
+			_, err := s.Refund(context.Background(), admin, order.ID, "test")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			var reloaded models.Order
+			if err := db.First(&reloaded, order.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if reloaded.Status != tt.wantStatus {
+				t.Fatalf("status = %s, want %s", reloaded.Status, tt.wantStatus)
+			}
+			if stock := productStock(t, db, order); stock != tt.wantStock {
+				t.Fatalf("stock = %d, want %d", stock, tt.wantStock)
+			}
+			for i, p := range payments {
+				if got := paymentStatus(t, db, p); got != tt.wantPayments[i] {
+					t.Fatalf("payment %d status = %s, want %s", i, got, tt.wantPayments[i])
+				}
+			}
+
+			// 失败时不写入审计记录
+			wantLogs := int64(1)
+			if tt.wantErr != nil {
+				wantLogs = 0
+			}
+			var logs int64
+			db.Model(&models.AuditLog{}).Where("action = ?", models.AuditOrderRefund).Count(&logs)
+			if logs != wantLogs {
+				t.Fatalf("audit logs = %d, want %d", logs, wantLogs)
+			}
+		})
+	}
+
+	s, _ := newTestService(t)
+	if _, err := s.Refund(context.Background(), admin, 1, "test"); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("err = %v, want ErrOrderNotFound", err)
+	}
+}
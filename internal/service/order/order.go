@@ -0,0 +1,234 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/authz"
+	"qaqmall/models"
+)
+
+var (
+	ErrOrderNotFound       = errors.New("订单不存在")
+	ErrOrderForbidden      = errors.New("无权操作该订单")
+	ErrOrderNotCancellable = errors.New("只能取消待支付的订单")
+	ErrInvalidAddress      = errors.New("无效的收货地址")
+	ErrAddressForbidden    = errors.New("无权使用该地址")
+	ErrProductNotFound     = errors.New("商品不存在")
+	ErrProductOffSale      = errors.New("已下架")
+	ErrInsufficientStock   = errors.New("库存不足")
+	ErrEmptyItems          = errors.New("订单中没有商品")
+	ErrInvalidQuantity     = errors.New("商品数量必须大于0")
+)
+
+// orderTTL 待支付订单的有效期，过期后由定时任务取消
+const orderTTL = 30 * time.Minute
+
+// Item 下单的商品及数量
+type Item struct {
+	ProductID uint64
+	Quantity  int
+}
+
+// CreateInput 创建订单的参数
+type CreateInput struct {
+	AddressID uint64
+	Items     []Item
+	Remark    string
+}
+
+// OrderService 订单业务逻辑，HTTP 接口和AI助手的工具调用共用
+// 订单和收货地址的权限由 authz 按授权策略检查；订单状态只能通过 ChangeStatus 按状态机修改，见 state.go
+type OrderService struct {
+	db    *gorm.DB
+	authz *authz.Authorizer
+	hooks hooks
+}
+
+func NewOrderService(db *gorm.DB, authorizer *authz.Authorizer) *OrderService {
+	s := &OrderService{db: db, authz: authorizer}
+	s.OnTransition(models.OrderStatusCancelled, restoreStock)
+	s.OnTransition(models.OrderStatusRefunded, restoreStock)
+	return s
+}
+
+// List 获取用户最近的订单，status 为空时不过滤状态，limit 不大于0时返回全部
+func (s *OrderService) List(ctx context.Context, userID uint64, status models.OrderStatus, limit int) ([]models.Order, error) {
+	query := s.db.WithContext(ctx).Where("user_id = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var orders []models.Order
+	if err := query.Order("created_at DESC, id DESC").Preload("Items").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// Create 为 sub 创建订单并扣减库存，商品下架或库存不足时返回包含商品名的错误
+func (s *OrderService) Create(ctx context.Context, sub authz.Subject, in CreateInput) (*models.Order, error) {
+	var order *models.Order
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = s.create(tx, sub, in)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// CreateFromCart 使用购物车中已选中的商品创建订单，成功后从购物车移除这些商品
+func (s *OrderService) CreateFromCart(ctx context.Context, sub authz.Subject, addressID uint64, remark string) (*models.Order, error) {
+	var order *models.Order
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var cartItems []models.CartItem
+		if err := tx.Where("user_id = ? AND selected = ?", sub.ID, true).Find(&cartItems).Error; err != nil {
+			return err
+		}
+
+		in := CreateInput{AddressID: addressID, Remark: remark}
+		ids := make([]uint64, 0, len(cartItems))
+		for _, item := range cartItems {
+			in.Items = append(in.Items, Item{ProductID: item.ProductID, Quantity: item.Quantity})
+			ids = append(ids, item.ID)
+		}
+
+		var err error
+		if order, err = s.create(tx, sub, in); err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.CartItem{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// Cancel 取消待支付的订单，库存由状态变化的 Hook 恢复
+func (s *OrderService) Cancel(ctx context.Context, sub authz.Subject, orderID uint64) (*models.Order, error) {
+	var order models.Order
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.authz.Load(tx.Preload("Items"), sub, authz.ActCancel, &order, orderID); err != nil {
+			return orderError(err)
+		}
+		err := s.ChangeStatus(tx, &order, models.OrderStatusCancelled, Actor{Type: models.OrderActorUser, UserID: sub.ID}, "用户取消")
+		if errors.Is(err, ErrInvalidTransition) {
+			return ErrOrderNotCancellable
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// orderError 将权限检查的错误转换为订单的错误
+func orderError(err error) error {
+	switch {
+	case errors.Is(err, authz.ErrNotFound):
+		return ErrOrderNotFound
+	case errors.Is(err, authz.ErrForbidden):
+		return ErrOrderForbidden
+	default:
+		return err
+	}
+}
+
+// addressError 将收货地址权限检查的错误转换为订单的错误
+func addressError(err error) error {
+	switch {
+	case errors.Is(err, authz.ErrNotFound):
+		return ErrInvalidAddress
+	case errors.Is(err, authz.ErrForbidden):
+		return ErrAddressForbidden
+	default:
+		return err
+	}
+}
+
+func (s *OrderService) create(tx *gorm.DB, sub authz.Subject, in CreateInput) (*models.Order, error) {
+	if len(in.Items) == 0 {
+		return nil, ErrEmptyItems
+	}
+
+	// 验证地址
+	var address models.Address
+	if err := s.authz.Load(tx, sub, authz.ActUse, &address, in.AddressID); err != nil {
+		return nil, addressError(err)
+	}
+
+	// 生成订单号
+	order := models.Order{
+		OrderNumber: fmt.Sprintf("%s%d", time.Now().Format("20060102150405"), sub.ID),
+		UserID:      sub.ID,
+		Status:      models.OrderStatusPending,
+		AddressID:   in.AddressID,
+		Remark:      in.Remark,
+		ExpiredAt:   time.Now().Add(orderTTL),
+	}
+	if err := tx.Create(&order).Error; err != nil {
+		return nil, err
+	}
+	if err := recordStatus(tx, order.ID, "", order.Status, Actor{Type: models.OrderActorUser, UserID: sub.ID}, ""); err != nil {
+		return nil, err
+	}
+
+	// 处理订单项
+	for _, item := range in.Items {
+		if item.Quantity <= 0 {
+			return nil, ErrInvalidQuantity
+		}
+
+		var product models.Product
+		if err := tx.First(&product, item.ProductID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrProductNotFound
+			}
+			return nil, err
+		}
+		if !product.IsOnSale {
+			return nil, fmt.Errorf("商品 %s %w", product.Name, ErrProductOffSale)
+		}
+		if product.Stock < item.Quantity {
+			return nil, fmt.Errorf("商品 %s %w", product.Name, ErrInsufficientStock)
+		}
+
+		orderItem := models.OrderItem{
+			OrderID:      order.ID,
+			ProductID:    product.ID,
+			ProductName:  product.Name,
+			ProductImage: product.ImageURL,
+			Price:        product.Price,
+			Quantity:     item.Quantity,
+		}
+		if err := tx.Create(&orderItem).Error; err != nil {
+			return nil, err
+		}
+
+		// 扣减库存
+		if err := tx.Model(&product).Update("stock", product.Stock-item.Quantity).Error; err != nil {
+			return nil, err
+		}
+
+		order.Items = append(order.Items, orderItem)
+		order.TotalAmount += product.Price * float64(item.Quantity)
+	}
+
+	// 更新订单总金额
+	if err := tx.Model(&order).Update("total_amount", order.TotalAmount).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
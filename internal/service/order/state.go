@@ -0,0 +1,167 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"qaqmall/models"
+)
+
+var ErrInvalidTransition = errors.New("订单当前的状态不允许该操作")
+
+// transitions 订单状态机：每个状态可以变为的状态，已完成、已取消、已退款的订单不能再变化
+var transitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderStatusPending: {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:    {models.OrderStatusShipped, models.OrderStatusRefunded},
+	models.OrderStatusShipped: {models.OrderStatusCompleted, models.OrderStatusRefunded},
+}
+
+// CanTransition 订单能否从 from 变为 to
+func CanTransition(from, to models.OrderStatus) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Actor 订单状态变化的发起方，Type 为 models.OrderActorUser 等，系统发起时 UserID 为 0
+type Actor struct {
+	Type   string
+	UserID uint64
+}
+
+// SystemActor 定时任务、支付回调等由系统发起的状态变化
+var SystemActor = Actor{Type: models.OrderActorSystem}
+
+// Transition 一次订单状态变化，传给 Hook
+type Transition struct {
+	Order  *models.Order
+	From   models.OrderStatus
+	To     models.OrderStatus
+	Actor  Actor
+	Reason string
+}
+
+// Hook 订单状态变化时调用，在修改状态的事务中执行，返回错误时整个修改回滚
+type Hook func(tx *gorm.DB, t Transition) error
+
+// hooks 按变化后的状态订阅的 Hook，键为空表示订阅所有变化
+type hooks struct {
+	mu       sync.RWMutex
+	byStatus map[models.OrderStatus][]Hook
+}
+
+func (h *hooks) add(to models.OrderStatus, hook Hook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.byStatus == nil {
+		h.byStatus = make(map[models.OrderStatus][]Hook)
+	}
+	h.byStatus[to] = append(h.byStatus[to], hook)
+}
+
+func (h *hooks) run(tx *gorm.DB, t Transition) error {
+	h.mu.RLock()
+	list := append(append([]Hook{}, h.byStatus[t.To]...), h.byStatus[""]...)
+	h.mu.RUnlock()
+	for _, hook := range list {
+		if err := hook(tx, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnTransition 订阅订单变为 to 状态的变化，to 为空时订阅所有变化
+// 应在启动时注册；Hook 按注册顺序在修改状态的事务中执行
+func (s *OrderService) OnTransition(to models.OrderStatus, hook Hook) {
+	s.hooks.add(to, hook)
+}
+
+// Transition 修改订单状态，见 ChangeStatus
+func (s *OrderService) Transition(ctx context.Context, orderID uint64, to models.OrderStatus, actor Actor, reason string) (*models.Order, error) {
+	var order models.Order
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+		return s.ChangeStatus(tx, &order, to, actor, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// ChangeStatus 在调用方的事务中把 order 改为 to 状态，写入状态变化记录并执行订阅的 Hook
+// 状态机不允许该变化，或者订单的状态已被并发修改时返回 ErrInvalidTransition
+func (s *OrderService) ChangeStatus(tx *gorm.DB, order *models.Order, to models.OrderStatus, actor Actor, reason string) error {
+	from := order.Status
+	if !CanTransition(from, to) {
+		return ErrInvalidTransition
+	}
+
+	// 按原状态条件更新，避免与支付回调、定时任务等并发修改时重复变化
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, from).
+		Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTransition
+	}
+	order.Status = to
+
+	if err := recordStatus(tx, order.ID, from, to, actor, reason); err != nil {
+		return err
+	}
+	return s.hooks.run(tx, Transition{Order: order, From: from, To: to, Actor: actor, Reason: reason})
+}
+
+// History 订单的状态变化记录，按时间正序
+func (s *OrderService) History(ctx context.Context, orderID uint64) ([]models.OrderStatusHistory, error) {
+	var history []models.OrderStatusHistory
+	if err := s.db.WithContext(ctx).Where("order_id = ?", orderID).
+		Order("id").Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func recordStatus(tx *gorm.DB, orderID uint64, from, to models.OrderStatus, actor Actor, reason string) error {
+	return tx.Create(&models.OrderStatusHistory{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorType:  actor.Type,
+		ActorID:    actor.UserID,
+		Reason:     reason,
+	}).Error
+}
+
+// restoreStock 订单取消或退款时恢复商品库存；已发货的商品不会回到仓库，退款时不恢复
+func restoreStock(tx *gorm.DB, t Transition) error {
+	if t.From == models.OrderStatusShipped {
+		return nil
+	}
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", t.Order.ID).Find(&items).Error; err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
+			UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/testutil"
+	"qaqmall/models"
+)
+
+func newTestService(t *testing.T) (*OrderService, *gorm.DB) {
+	t.Helper()
+	db := testutil.NewSQLite(t, &models.Category{}, &models.Product{}, &models.Order{}, &models.OrderItem{},
+		&models.OrderStatusHistory{}, &models.Payment{}, &models.AuditLog{})
+	return NewOrderService(db, nil), db
+}
+
+// createOrder 创建 status 状态的订单，包含库存为10的商品 3 件
+func createOrder(t *testing.T, db *gorm.DB, status models.OrderStatus) *models.Order {
+	t.Helper()
+	product := models.Product{Name: "p", Price: 10, Stock: 10}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	order := models.Order{
+		OrderNumber: fmt.Sprintf("T%d", product.ID),
+		UserID:      1,
+		Status:      status,
+		TotalAmount: 30,
+		ExpiredAt:   time.Now().Add(orderTTL),
+		Items:       []models.OrderItem{{ProductID: product.ID, ProductName: "p", Price: 10, Quantity: 3}},
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &order
+}
+
+func productStock(t *testing.T, db *gorm.DB, order *models.Order) int {
+	t.Helper()
+	var product models.Product
+	if err := db.First(&product, order.Items[0].ProductID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return product.Stock
+}
+
+func TestCanTransition(t *testing.T) {
+	statuses := []models.OrderStatus{
+		models.OrderStatusPending,
+		models.OrderStatusPaid,
+		models.OrderStatusShipped,
+		models.OrderStatusCompleted,
+		models.OrderStatusCancelled,
+		models.OrderStatusRefunded,
+	}
+	allowed := map[[2]models.OrderStatus]bool{
+		{models.OrderStatusPending, models.OrderStatusPaid}:      true,
+		{models.OrderStatusPending, models.OrderStatusCancelled}: true,
+		{models.OrderStatusPaid, models.OrderStatusShipped}:      true,
+		{models.OrderStatusPaid, models.OrderStatusRefunded}:     true,
+		{models.OrderStatusShipped, models.OrderStatusCompleted}: true,
+		{models.OrderStatusShipped, models.OrderStatusRefunded}:  true,
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			if got, want := CanTransition(from, to), allowed[[2]models.OrderStatus{from, to}]; got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestChangeStatusHooks(t *testing.T) {
+	tests := []struct {
+		name      string
+		from, to  models.OrderStatus
+		wantErr   error
+		wantStock int
+	}{
+		{name: "pay", from: models.OrderStatusPending, to: models.OrderStatusPaid, wantStock: 10},
+		{name: "cancel restores stock", from: models.OrderStatusPending, to: models.OrderStatusCancelled, wantStock: 13},
+		{name: "refund before shipping restores stock", from: models.OrderStatusPaid, to: models.OrderStatusRefunded, wantStock: 13},
+		{name: "refund after shipping keeps stock", from: models.OrderStatusShipped, to: models.OrderStatusRefunded, wantStock: 10},
+		{name: "complete", from: models.OrderStatusShipped, to: models.OrderStatusCompleted, wantStock: 10},
+		{name: "invalid", from: models.OrderStatusCancelled, to: models.OrderStatusPaid, wantErr: ErrInvalidTransition, wantStock: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newTestService(t)
+			var calls []Transition
+			s.OnTransition("", func(tx *gorm.DB, tr Transition) error {
+				calls = append(calls, tr)
+				return nil
+			})
+			order := createOrder(t, db, tt.from)
+
+			err := s.ChangeStatus(db, order, tt.to, SystemActor, "test")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if stock := productStock(t, db, order); stock != tt.wantStock {
+				t.Fatalf("stock = %d, want %d", stock, tt.wantStock)
+			}
+			if tt.wantErr != nil {
+				if len(calls) != 0 {
+					t.Fatalf("hooks called on invalid transition: %+v", calls)
+				}
+				return
+			}
+			if len(calls) != 1 || calls[0].From != tt.from || calls[0].To != tt.to {
+				t.Fatalf("hook calls = %+v", calls)
+			}
+			var history models.OrderStatusHistory
+			if err := db.Where("order_id = ?", order.ID).First(&history).Error; err != nil {
+				t.Fatal(err)
+			}
+			if history.FromStatus != tt.from || history.ToStatus != tt.to {
+				t.Fatalf("history = %s -> %s", history.FromStatus, history.ToStatus)
+			}
+		})
+	}
+}
+
+func TestChangeStatusHookError(t *testing.T) {
+	s, db := newTestService(t)
+	hookErr := errors.New("hook failed")
+	s.OnTransition(models.OrderStatusPaid, func(*gorm.DB, Transition) error {
+		return hookErr
+	})
+	order := createOrder(t, db, models.OrderStatusPending)
+
+	// Hook 返回错误时整个修改回滚
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return s.ChangeStatus(tx, order, models.OrderStatusPaid, SystemActor, "test")
+	})
+	if !errors.Is(err, hookErr) {
+		t.Fatalf("err = %v, want hook error", err)
+	}
+	var reloaded models.Order
+	if err := db.First(&reloaded, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Status != models.OrderStatusPending {
+		t.Fatalf("status = %s, want pending", reloaded.Status)
+	}
+}
+
+func TestTransitionConcurrentChange(t *testing.T) {
+	s, db := newTestService(t)
+	order := createOrder(t, db, models.OrderStatusPending)
+
+	// 状态已被其他请求修改时按原状态条件更新不到记录
+	stale := *order
+	if err := s.ChangeStatus(db, order, models.OrderStatusCancelled, SystemActor, "timeout"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ChangeStatus(db, &stale, models.OrderStatusPaid, SystemActor, "paid"); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("err = %v, want ErrInvalidTransition", err)
+	}
+	if _, err := s.Transition(context.Background(), order.ID+100, models.OrderStatusPaid, SystemActor, ""); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("err = %v, want ErrOrderNotFound", err)
+	}
+}
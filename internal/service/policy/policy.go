@@ -0,0 +1,465 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/authz"
+	"qaqmall/internal/service/audit"
+	"qaqmall/models"
+)
+
+var (
+	ErrInvalidRole      = errors.New("角色名只能包含小写字母、数字、下划线和连字符，以字母开头，最长10个字符")
+	ErrInvalidObject    = errors.New("资源路径必须以 / 开头")
+	ErrInvalidAction    = errors.New("操作不能为空，且必须是有效的正则表达式，例如 GET 或 (GET)|(POST)")
+	ErrPolicyExists     = errors.New("策略已存在")
+	ErrPolicyNotFound   = errors.New("策略不存在")
+	ErrProtectedPolicy  = errors.New("不能删除管理员对 /admin/* 的权限，否则将无法再管理权限")
+	ErrRoleCycle        = errors.New("角色继承不能形成循环")
+	ErrInvalidType      = errors.New("资源类型只能是 order、address 或 payment")
+	ErrInvalidCondition = errors.New("条件无效，只能使用 r2.sub.ID、r2.sub.Role、r2.res.Owner、r2.res.Status 和比较、逻辑运算，结果必须是布尔值")
+)
+
+// resourceTypes 支持资源级别权限检查的资源类型
+var resourceTypes = map[string]bool{
+	models.ResourceOrder:   true,
+	models.ResourceAddress: true,
+	models.ResourcePayment: true,
+}
+
+// rolePattern 角色名，长度与 users.role 一致；不能是纯数字，纯数字的主体是用户ID
+var rolePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,9}$`)
+
+// protectedObject 管理员对该路径的权限不能删除
+const protectedObject = "/admin/*"
+
+// Store 权限策略的存储和检查，由 middleware.CasbinPolicies 实现
+// 修改在调用方的事务中进行，提交后调用 Reload 使修改在所有实例上生效
+type Store interface {
+	Policies() ([][]string, error)
+	ResourcePolicies() ([][]string, error)
+	RoleLinks() ([][]string, error)
+	Exists(tx *gorm.DB, ptype string, rule []string) (bool, error)
+	Add(tx *gorm.DB, ptype string, rule []string) error
+	Remove(tx *gorm.DB, ptype string, rule []string) error
+	InheritedRoles(role string) ([]string, error)
+	Check(role, obj, act string) (bool, []string, error)
+	ValidateCondition(cond string) error
+	EnforceResource(sub authz.Subject, res authz.Attributes, act string) (bool, error)
+	Reload() error
+}
+
+// Policy 权限策略：Role 可以对路径 Object（支持 * 通配）执行 Action（正则，匹配请求方法）
+type Policy struct {
+	Role   string `json:"role"`
+	Object string `json:"object"`
+	Action string `json:"action"`
+}
+
+func (p Policy) rule() []string {
+	return []string{p.Role, p.Object, p.Action}
+}
+
+// ResourcePolicy 资源级别的策略：Role 可以对类型为 Type 的资源执行 Action（正则），且满足条件 Condition
+// 条件中 r2.sub 为发起操作的用户（ID、Role），r2.res 为资源（Owner、Status），例如 r2.sub.ID == r2.res.Owner，为 true 时不限制
+type ResourcePolicy struct {
+	Role      string `json:"role"`
+	Type      string `json:"type"`
+	Action    string `json:"action"`
+	Condition string `json:"condition"`
+}
+
+func (p ResourcePolicy) rule() []string {
+	return []string{p.Role, p.Type, p.Action, p.Condition}
+}
+
+// RoleLink 角色继承：Role 拥有 Parent 的所有权限
+type RoleLink struct {
+	Role   string `json:"role"`
+	Parent string `json:"parent"`
+}
+
+func (l RoleLink) rule() []string {
+	return []string{l.Role, l.Parent}
+}
+
+// Role 角色及其继承的角色和直接拥有的权限
+type Role struct {
+	Name             string           `json:"name"`
+	Parents          []string         `json:"parents"`
+	Policies         []Policy         `json:"policies"`
+	ResourcePolicies []ResourcePolicy `json:"resource_policies"`
+}
+
+// CheckResult 权限检查的结果，Matched 为允许访问时匹配的策略
+type CheckResult struct {
+	Allowed bool    `json:"allowed"`
+	Matched *Policy `json:"matched,omitempty"`
+}
+
+// PolicyService 在运行时管理权限策略和角色，所有修改都会写入审计记录
+type PolicyService struct {
+	db    *gorm.DB
+	store Store
+}
+
+func NewPolicyService(db *gorm.DB, store Store) *PolicyService {
+	return &PolicyService{db: db, store: store}
+}
+
+// ListPolicies 查询权限策略，role 为空时返回全部
+func (s *PolicyService) ListPolicies(role string) ([]Policy, error) {
+	rules, err := s.store.Policies()
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]Policy, 0, len(rules))
+	for _, rule := range rules {
+		if role != "" && rule[0] != role {
+			continue
+		}
+		policies = append(policies, Policy{Role: rule[0], Object: rule[1], Action: rule[2]})
+	}
+	return policies, nil
+}
+
+// AddPolicy 添加权限策略
+func (s *PolicyService) AddPolicy(ctx context.Context, actor audit.Actor, p Policy, reason string) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	return s.update(ctx, func(tx *gorm.DB) error {
+		exists, err := s.store.Exists(tx, "p", p.rule())
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrPolicyExists
+		}
+		if err := s.store.Add(tx, "p", p.rule()); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.Entry{
+			Actor:      actor,
+			Action:     models.AuditPolicyAdd,
+			TargetType: models.AuditTargetPolicy,
+			TargetID:   strings.Join(p.rule(), ", "),
+			After:      p,
+			Reason:     reason,
+		})
+	})
+}
+
+// RemovePolicy 删除权限策略
+func (s *PolicyService) RemovePolicy(ctx context.Context, actor audit.Actor, p Policy, reason string) error {
+	if p.Role == models.RoleAdmin && p.Object == protectedObject {
+		return ErrProtectedPolicy
+	}
+	return s.update(ctx, func(tx *gorm.DB) error {
+		exists, err := s.store.Exists(tx, "p", p.rule())
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrPolicyNotFound
+		}
+		if err := s.store.Remove(tx, "p", p.rule()); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.Entry{
+			Actor:      actor,
+			Action:     models.AuditPolicyRemove,
+			TargetType: models.AuditTargetPolicy,
+			TargetID:   strings.Join(p.rule(), ", "),
+			Before:     p,
+			Reason:     reason,
+		})
+	})
+}
+
+// ListResourcePolicies 查询资源级别的策略，role 为空时返回全部
+func (s *PolicyService) ListResourcePolicies(role string) ([]ResourcePolicy, error) {
+	rules, err := s.store.ResourcePolicies()
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]ResourcePolicy, 0, len(rules))
+	for _, rule := range rules {
+		if role != "" && rule[0] != role {
+			continue
+		}
+		policies = append(policies, ResourcePolicy{Role: rule[0], Type: rule[1], Action: rule[2], Condition: rule[3]})
+	}
+	return policies, nil
+}
+
+// AddResourcePolicy 添加资源级别的策略
+func (s *PolicyService) AddResourcePolicy(ctx context.Context, actor audit.Actor, p ResourcePolicy, reason string) error {
+	if err := s.validateResourcePolicy(p); err != nil {
+		return err
+	}
+	return s.update(ctx, func(tx *gorm.DB) error {
+		exists, err := s.store.Exists(tx, "p2", p.rule())
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrPolicyExists
+		}
+		if err := s.store.Add(tx, "p2", p.rule()); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.Entry{
+			Actor:      actor,
+			Action:     models.AuditPolicyAdd,
+			TargetType: models.AuditTargetResourcePolicy,
+			TargetID:   strings.Join(p.rule(), ", "),
+			After:      p,
+			Reason:     reason,
+		})
+	})
+}
+
+// RemoveResourcePolicy 删除资源级别的策略
+func (s *PolicyService) RemoveResourcePolicy(ctx context.Context, actor audit.Actor, p ResourcePolicy, reason string) error {
+	return s.update(ctx, func(tx *gorm.DB) error {
+		exists, err := s.store.Exists(tx, "p2", p.rule())
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrPolicyNotFound
+		}
+		if err := s.store.Remove(tx, "p2", p.rule()); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.Entry{
+			Actor:      actor,
+			Action:     models.AuditPolicyRemove,
+			TargetType: models.AuditTargetResourcePolicy,
+			TargetID:   strings.Join(p.rule(), ", "),
+			Before:     p,
+			Reason:     reason,
+		})
+	})
+}
+
+// CheckResource 检查角色为 role 的用户 userID 能否对资源执行操作，只检查不执行
+func (s *PolicyService) CheckResource(role string, userID uint64, res authz.Attributes, act string) (bool, error) {
+	if role == "" {
+		return false, ErrInvalidRole
+	}
+	if !resourceTypes[res.Type] {
+		return false, ErrInvalidType
+	}
+	if act == "" {
+		return false, ErrInvalidAction
+	}
+	return s.store.EnforceResource(authz.Subject{ID: userID, Role: role}, res, act)
+}
+
+// ListRoleLinks 查询角色继承规则
+func (s *PolicyService) ListRoleLinks() ([]RoleLink, error) {
+	rules, err := s.store.RoleLinks()
+	if err != nil {
+		return nil, err
+	}
+	links := make([]RoleLink, 0, len(rules))
+	for _, rule := range rules {
+		links = append(links, RoleLink{Role: rule[0], Parent: rule[1]})
+	}
+	return links, nil
+}
+
+// AddRoleLink 使 Role 继承 Parent 的所有权限
+func (s *PolicyService) AddRoleLink(ctx context.Context, actor audit.Actor, l RoleLink, reason string) error {
+	if !rolePattern.MatchString(l.Role) || !rolePattern.MatchString(l.Parent) {
+		return ErrInvalidRole
+	}
+	if l.Role == l.Parent {
+		return ErrRoleCycle
+	}
+	// Parent 已经直接或间接继承了 Role 时会形成循环
+	inherited, err := s.store.InheritedRoles(l.Parent)
+	if err != nil {
+		return err
+	}
+	for _, role := range inherited {
+		if role == l.Role {
+			return ErrRoleCycle
+		}
+	}
+
+	return s.update(ctx, func(tx *gorm.DB) error {
+		exists, err := s.store.Exists(tx, "g", l.rule())
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrPolicyExists
+		}
+		if err := s.store.Add(tx, "g", l.rule()); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.Entry{
+			Actor:      actor,
+			Action:     models.AuditRoleLinkAdd,
+			TargetType: models.AuditTargetRole,
+			TargetID:   l.Role,
+			After:      l,
+			Reason:     reason,
+		})
+	})
+}
+
+// RemoveRoleLink 删除角色继承
+func (s *PolicyService) RemoveRoleLink(ctx context.Context, actor audit.Actor, l RoleLink, reason string) error {
+	if !rolePattern.MatchString(l.Role) || !rolePattern.MatchString(l.Parent) {
+		return ErrInvalidRole
+	}
+	return s.update(ctx, func(tx *gorm.DB) error {
+		exists, err := s.store.Exists(tx, "g", l.rule())
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrPolicyNotFound
+		}
+		if err := s.store.Remove(tx, "g", l.rule()); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.Entry{
+			Actor:      actor,
+			Action:     models.AuditRoleLinkRemove,
+			TargetType: models.AuditTargetRole,
+			TargetID:   l.Role,
+			Before:     l,
+			Reason:     reason,
+		})
+	})
+}
+
+// Roles 列出所有角色：内置角色、有权限策略的角色和出现在继承规则中的角色，按名称排序
+func (s *PolicyService) Roles() ([]Role, error) {
+	policies, err := s.ListPolicies("")
+	if err != nil {
+		return nil, err
+	}
+	resourcePolicies, err := s.ListResourcePolicies("")
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.ListRoleLinks()
+	if err != nil {
+		return nil, err
+	}
+
+	roles := map[string]*Role{}
+	role := func(name string) *Role {
+		r, ok := roles[name]
+		if !ok {
+			r = &Role{Name: name, Parents: []string{}, Policies: []Policy{}, ResourcePolicies: []ResourcePolicy{}}
+			roles[name] = r
+		}
+		return r
+	}
+	role(models.RoleUser)
+	role(models.RoleAdmin)
+	for _, p := range policies {
+		r := role(p.Role)
+		r.Policies = append(r.Policies, p)
+	}
+	for _, p := range resourcePolicies {
+		r := role(p.Role)
+		r.ResourcePolicies = append(r.ResourcePolicies, p)
+	}
+	for _, l := range links {
+		r := role(l.Role)
+		r.Parents = append(r.Parents, l.Parent)
+		role(l.Parent)
+	}
+
+	result := make([]Role, 0, len(roles))
+	for _, r := range roles {
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Check 检查角色能否对路径执行操作（包括继承的权限），不需要真的发起请求
+func (s *PolicyService) Check(role, obj, act string) (*CheckResult, error) {
+	if role == "" {
+		return nil, ErrInvalidRole
+	}
+	if !strings.HasPrefix(obj, "/") {
+		return nil, ErrInvalidObject
+	}
+	if act == "" {
+		return nil, ErrInvalidAction
+	}
+
+	allowed, explain, err := s.store.Check(role, obj, strings.ToUpper(act))
+	if err != nil {
+		return nil, err
+	}
+	result := &CheckResult{Allowed: allowed}
+	if allowed && len(explain) == 3 {
+		result.Matched = &Policy{Role: explain[0], Object: explain[1], Action: explain[2]}
+	}
+	return result, nil
+}
+
+// update 在事务中修改策略，提交后重新加载并通知其他实例
+// 数据库中的修改已经提交，重新加载失败只影响内存中的策略，下次加载时会生效
+func (s *PolicyService) update(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	if err := s.db.WithContext(ctx).Transaction(fn); err != nil {
+		return err
+	}
+	if err := s.store.Reload(); err != nil {
+		log.Printf("重新加载授权策略失败: %v", err)
+	}
+	return nil
+}
+
+func (s *PolicyService) validateResourcePolicy(p ResourcePolicy) error {
+	if !rolePattern.MatchString(p.Role) {
+		return ErrInvalidRole
+	}
+	if !resourceTypes[p.Type] {
+		return ErrInvalidType
+	}
+	if p.Action == "" {
+		return ErrInvalidAction
+	}
+	if _, err := regexp.Compile(p.Action); err != nil {
+		return ErrInvalidAction
+	}
+	if p.Condition == "" || s.store.ValidateCondition(p.Condition) != nil {
+		return ErrInvalidCondition
+	}
+	return nil
+}
+
+func (p Policy) validate() error {
+	if !rolePattern.MatchString(p.Role) {
+		return ErrInvalidRole
+	}
+	if !strings.HasPrefix(p.Object, "/") {
+		return ErrInvalidObject
+	}
+	if p.Action == "" {
+		return ErrInvalidAction
+	}
+	if _, err := regexp.Compile(p.Action); err != nil {
+		return ErrInvalidAction
+	}
+	return nil
+}
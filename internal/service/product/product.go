@@ -0,0 +1,284 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/pagination"
+	"qaqmall/models"
+)
+
+var (
+	ErrProductNotFound  = errors.New("商品不存在")
+	ErrCategoryNotFound = errors.New("商品分类不存在")
+	ErrInvalidProduct   = errors.New("无效的商品信息")
+)
+
+// sortColumns 允许排序的字段
+var sortColumns = map[string]string{
+	"id":         "products.id",
+	"created_at": "products.created_at",
+	"price":      "products.price",
+	"stock":      "products.stock",
+	"name":       "products.name",
+}
+
+// ProductInput 创建、修改商品的参数
+type ProductInput struct {
+	Name        string
+	Description string
+	Price       float64
+	Stock       int
+	ImageURL    string
+	IsOnSale    bool
+	CategoryIDs []uint64
+}
+
+// Query 商品列表查询参数，商品列表和商品搜索共用
+type Query struct {
+	pagination.Pagination
+	Keyword    string
+	MinPrice   float64
+	MaxPrice   float64
+	CategoryID uint64
+	OnlyOnSale bool
+	SortBy     string
+	Desc       bool
+}
+
+// Indexer 商品检索索引，商品创建、修改、删除成功后同步更新
+type Indexer interface {
+	ProductSaved(ctx context.Context, product *models.Product)
+	ProductDeleted(ctx context.Context, id uint64)
+}
+
+// ProductService 商品业务逻辑，HTTP 和 gRPC 共用
+// indexer 为 nil 时不维护检索索引
+type ProductService struct {
+	db      *gorm.DB
+	indexer Indexer
+}
+
+func NewProductService(db *gorm.DB, indexer Indexer) *ProductService {
+	return &ProductService{db: db, indexer: indexer}
+}
+
+// ListCategories 获取分类列表，onlyActive 为 true 时只返回下面有在售商品的分类
+func (s *ProductService) ListCategories(ctx context.Context, onlyActive bool) ([]models.Category, error) {
+	query := s.db.WithContext(ctx).Model(&models.Category{}).Where("categories.deleted_at IS NULL")
+	if onlyActive {
+		query = query.Where(`EXISTS (SELECT 1 FROM product_categories pc
+			JOIN products p ON p.id = pc.product_id
+			WHERE pc.category_id = categories.id AND p.is_on_sale = ? AND p.deleted_at IS NULL)`, true)
+	}
+
+	var categories []models.Category
+	if err := query.Order("categories.id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// Get 获取商品详情
+func (s *ProductService) Get(ctx context.Context, id uint64) (*models.Product, error) {
+	var product models.Product
+	if err := s.db.WithContext(ctx).Preload("Categories").First(&product, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	return &product, nil
+}
+
+// List 分页查询商品，支持关键词、价格区间、分类过滤和排序
+func (s *ProductService) List(ctx context.Context, q Query) ([]models.Product, int64, error) {
+	q.Pagination = q.Pagination.Normalize()
+
+	query := s.db.WithContext(ctx).Model(&models.Product{}).Where("products.deleted_at IS NULL")
+	if keyword := strings.TrimSpace(q.Keyword); keyword != "" {
+		like := "%" + keyword + "%"
+		query = query.Where("products.name LIKE ? OR products.description LIKE ?", like, like)
+	}
+	if q.MinPrice > 0 {
+		query = query.Where("products.price >= ?", q.MinPrice)
+	}
+	if q.MaxPrice > 0 {
+		query = query.Where("products.price <= ?", q.MaxPrice)
+	}
+	if q.OnlyOnSale {
+		query = query.Where("products.is_on_sale = ?", true)
+	}
+	if q.CategoryID > 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM product_categories pc WHERE pc.product_id = products.id AND pc.category_id = ?)", q.CategoryID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := "products.id"
+	if column, ok := sortColumns[q.SortBy]; ok {
+		order = column
+	}
+	if q.Desc {
+		order += " DESC"
+	}
+
+	var products []models.Product
+	if err := query.Preload("Categories").
+		Order(order).
+		Offset(q.Offset()).
+		Limit(q.PageSize).
+		Find(&products).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return products, total, nil
+}
+
+// Create 创建商品并关联分类
+func (s *ProductService) Create(ctx context.Context, in ProductInput) (*models.Product, error) {
+	if err := validate(in); err != nil {
+		return nil, err
+	}
+
+	product := models.Product{}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		categories, err := loadCategories(tx, in.CategoryIDs)
+		if err != nil {
+			return err
+		}
+
+		apply(&product, in)
+		product.Categories = categories
+		return tx.Create(&product).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reload(ctx, product.ID)
+}
+
+// Update 修改商品信息，分类关联整体替换
+func (s *ProductService) Update(ctx context.Context, id uint64, in ProductInput) (*models.Product, error) {
+	if err := validate(in); err != nil {
+		return nil, err
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.First(&product, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrProductNotFound
+			}
+			return err
+		}
+
+		categories, err := loadCategories(tx, in.CategoryIDs)
+		if err != nil {
+			return err
+		}
+
+		apply(&product, in)
+		if err := tx.Save(&product).Error; err != nil {
+			return err
+		}
+		return tx.Model(&product).Association("Categories").Replace(categories)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reload(ctx, id)
+}
+
+// Delete 删除商品及其分类关联
+func (s *ProductService) Delete(ctx context.Context, id uint64) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.First(&product, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrProductNotFound
+			}
+			return err
+		}
+
+		if err := tx.Model(&product).Association("Categories").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&product).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.indexer != nil {
+		s.indexer.ProductDeleted(ctx, id)
+	}
+	return nil
+}
+
+// reload 重新加载保存后的商品并同步检索索引
+func (s *ProductService) reload(ctx context.Context, id uint64) (*models.Product, error) {
+	product, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.indexer != nil {
+		s.indexer.ProductSaved(ctx, product)
+	}
+	return product, nil
+}
+
+func validate(in ProductInput) error {
+	if strings.TrimSpace(in.Name) == "" || in.Price < 0 || in.Stock < 0 {
+		return ErrInvalidProduct
+	}
+	return nil
+}
+
+func apply(product *models.Product, in ProductInput) {
+	product.Name = in.Name
+	product.Description = in.Description
+	product.Price = in.Price
+	product.Stock = in.Stock
+	product.ImageURL = in.ImageURL
+	product.IsOnSale = in.IsOnSale
+}
+
+// loadCategories 按ID加载分类，有不存在的分类时返回 ErrCategoryNotFound
+func loadCategories(tx *gorm.DB, ids []uint64) ([]models.Category, error) {
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var categories []models.Category
+	if err := tx.Where("id IN ?", ids).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	if len(categories) != len(ids) {
+		return nil, ErrCategoryNotFound
+	}
+	return categories, nil
+}
+
+func uniqueIDs(ids []uint64) []uint64 {
+	seen := make(map[uint64]bool, len(ids))
+	result := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
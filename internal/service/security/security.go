@@ -0,0 +1,309 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"qaqmall/config"
+	"qaqmall/internal/pagination"
+	"qaqmall/models"
+)
+
+var (
+	ErrLocked             = errors.New("登录失败次数过多，请稍后再试")
+	ErrEmptyLockoutTarget = errors.New("用户名和IP不能同时为空")
+	ErrLockoutNotFound    = errors.New("没有对应的登录失败记录")
+)
+
+// maxBackoffShift 锁定时长翻倍的次数上限，避免位移溢出
+const maxBackoffShift = 30
+
+// LockedError 用户名或 IP 被锁定，errors.Is(err, ErrLocked) 为 true
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("登录失败次数过多，请在%d秒后再试", RetryAfterSeconds(e.RetryAfter))
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// RetryAfterSeconds 向上取整的秒数，用于 Retry-After 响应头
+func RetryAfterSeconds(d time.Duration) int {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// EventQuery 安全事件的查询参数，为空的条件不过滤
+type EventQuery struct {
+	pagination.Pagination
+	Type     string
+	Username string
+	IP       string
+}
+
+// Lockout 当前被锁定的用户名或 IP，两者只有一个不为空
+type Lockout struct {
+	Username    string    `json:"username,omitempty"`
+	IP          string    `json:"ip,omitempty"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// SecurityService 登录防暴力破解，HTTP 和 gRPC 共用
+// 分别按用户名和客户端 IP 统计连续登录失败的次数，达到上限后锁定，锁定时长随失败次数指数增长；
+// 每次锁定和解除都记录在 security_events 中。计数保存在数据库中，多个实例共享
+type SecurityService struct {
+	db  *gorm.DB
+	cfg config.LoginProtectionConfig
+}
+
+func NewSecurityService(db *gorm.DB, cfg config.LoginProtectionConfig) *SecurityService {
+	return &SecurityService{db: db, cfg: cfg}
+}
+
+// CheckLogin 检查用户名和 IP 是否被锁定，被锁定时返回 *LockedError，RetryAfter 取两者中较晚的解锁时间
+func (s *SecurityService) CheckLogin(ctx context.Context, username, ip string) error {
+	var throttles []models.LoginThrottle
+	now := time.Now()
+	if err := s.db.WithContext(ctx).
+		Where("throttle_key IN ? AND locked_until > ?", s.keys(username, ip), now).
+		Find(&throttles).Error; err != nil {
+		return err
+	}
+
+	var retryAfter time.Duration
+	for _, t := range throttles {
+		if d := t.LockedUntil.Sub(now); d > retryAfter {
+			retryAfter = d
+		}
+	}
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// RecordLoginFailure 记录一次登录失败，用户名和 IP 的失败次数分别达到上限时锁定
+// 无论用户名是否存在都会计数，不能通过是否被锁定判断用户名是否注册过
+func (s *SecurityService) RecordLoginFailure(ctx context.Context, username, ip string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if name := normalizeUsername(username); name != "" {
+			if err := s.recordFailure(tx, userKey(name), s.cfg.MaxFailures, name, ip); err != nil {
+				return err
+			}
+		}
+		if ip != "" {
+			if err := s.recordFailure(tx, ipKey(ip), s.cfg.IPMaxFailures, normalizeUsername(username), ip); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RecordLoginSuccess 登录成功后清除该用户名的失败计数；IP 的计数保留，避免用一个自己的账号反复重置
+func (s *SecurityService) RecordLoginSuccess(ctx context.Context, username string) error {
+	name := normalizeUsername(username)
+	if name == "" {
+		return nil
+	}
+	return s.db.WithContext(ctx).
+		Where("throttle_key = ?", userKey(name)).
+		Delete(&models.LoginThrottle{}).Error
+}
+
+// ListEvents 分页查询安全事件，按时间倒序
+func (s *SecurityService) ListEvents(ctx context.Context, q EventQuery) ([]models.SecurityEvent, int64, error) {
+	q.Pagination = q.Pagination.Normalize()
+	query := s.db.WithContext(ctx).Model(&models.SecurityEvent{})
+	if q.Type != "" {
+		query = query.Where("type = ?", q.Type)
+	}
+	if q.Username != "" {
+		query = query.Where("username = ?", normalizeUsername(q.Username))
+	}
+	if q.IP != "" {
+		query = query.Where("ip = ?", q.IP)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []models.SecurityEvent
+	if err := query.Order("id DESC").
+		Offset(q.Offset()).
+		Limit(q.PageSize).
+		Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// ListLockouts 查询当前被锁定的用户名和 IP，按解锁时间排序
+func (s *SecurityService) ListLockouts(ctx context.Context) ([]Lockout, error) {
+	var throttles []models.LoginThrottle
+	if err := s.db.WithContext(ctx).
+		Where("locked_until > ?", time.Now()).
+		Order("locked_until").
+		Find(&throttles).Error; err != nil {
+		return nil, err
+	}
+
+	lockouts := make([]Lockout, 0, len(throttles))
+	for _, t := range throttles {
+		lockout := Lockout{Failures: t.Failures, LockedUntil: *t.LockedUntil}
+		if name, ok := strings.CutPrefix(t.ThrottleKey, "user:"); ok {
+			lockout.Username = name
+		} else {
+			lockout.IP = strings.TrimPrefix(t.ThrottleKey, "ip:")
+		}
+		lockouts = append(lockouts, lockout)
+	}
+	return lockouts, nil
+}
+
+// ClearLockout 解除用户名和（或）IP 的锁定并清零失败计数，记录操作的管理员
+func (s *SecurityService) ClearLockout(ctx context.Context, username, ip string, operatorID uint64) error {
+	username = normalizeUsername(username)
+	keys := s.keys(username, ip)
+	if len(keys) == 0 {
+		return ErrEmptyLockoutTarget
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("throttle_key IN ?", keys).Delete(&models.LoginThrottle{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrLockoutNotFound
+		}
+		return tx.Create(&models.SecurityEvent{
+			Type:       models.SecurityEventLockoutCleared,
+			Username:   username,
+			IP:         ip,
+			OperatorID: operatorID,
+		}).Error
+	})
+}
+
+// PurgeStale 清除已解锁且超过 failure_window 没有再失败的计数，返回清除的条数
+func (s *SecurityService) PurgeStale(ctx context.Context) (int64, error) {
+	now := time.Now()
+	result := s.db.WithContext(ctx).
+		Where("(locked_until IS NULL OR locked_until <= ?) AND last_failed_at <= ?", now, now.Add(-s.cfg.FailureWindow)).
+		Delete(&models.LoginThrottle{})
+	return result.RowsAffected, result.Error
+}
+
+// recordFailure 在事务中递增 key 的失败次数，达到 limit 时锁定并记录事件
+// 距离上次失败（或上次锁定结束）超过 failure_window 的，从头计数
+func (s *SecurityService) recordFailure(tx *gorm.DB, key string, limit int, username, ip string) error {
+	now := time.Now()
+	// 先插入空记录，再加锁读取，保证并发的失败请求依次计数
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.LoginThrottle{ThrottleKey: key, LastFailedAt: now}).Error; err != nil {
+		return err
+	}
+	var throttle models.LoginThrottle
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("throttle_key = ?", key).
+		First(&throttle).Error; err != nil {
+		return err
+	}
+
+	last := throttle.LastFailedAt
+	if throttle.LockedUntil != nil && throttle.LockedUntil.After(last) {
+		last = *throttle.LockedUntil
+	}
+	if now.Sub(last) > s.cfg.FailureWindow {
+		throttle.Failures = 0
+		throttle.LockedUntil = nil
+	}
+	throttle.Failures++
+	throttle.LastFailedAt = now
+
+	var event *models.SecurityEvent
+	if throttle.Failures >= limit {
+		lockedUntil := now.Add(s.lockoutDuration(throttle.Failures - limit))
+		throttle.LockedUntil = &lockedUntil
+		event = &models.SecurityEvent{
+			Type:        models.SecurityEventLoginLockout,
+			Username:    username,
+			IP:          ip,
+			Failures:    throttle.Failures,
+			LockedUntil: &lockedUntil,
+			Detail:      lockoutDetail(key),
+		}
+	}
+
+	if err := tx.Model(&throttle).Updates(map[string]interface{}{
+		"failures":       throttle.Failures,
+		"last_failed_at": throttle.LastFailedAt,
+		"locked_until":   throttle.LockedUntil,
+	}).Error; err != nil {
+		return err
+	}
+	if event != nil {
+		return tx.Create(event).Error
+	}
+	return nil
+}
+
+// lockoutDuration 第 n 次超出上限（从0开始）的锁定时长：base_lockout * 2^n，最长 max_lockout
+func (s *SecurityService) lockoutDuration(n int) time.Duration {
+	if n > maxBackoffShift {
+		n = maxBackoffShift
+	}
+	d := s.cfg.BaseLockout << n
+	if d <= 0 || d > s.cfg.MaxLockout {
+		return s.cfg.MaxLockout
+	}
+	return d
+}
+
+func (s *SecurityService) keys(username, ip string) []string {
+	var keys []string
+	if name := normalizeUsername(username); name != "" {
+		keys = append(keys, userKey(name))
+	}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	return keys
+}
+
+// normalizeUsername 用户名不区分大小写计数，避免改变大小写绕过限制
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func lockoutDetail(key string) string {
+	if strings.HasPrefix(key, "ip:") {
+		return "同一IP连续登录失败"
+	}
+	return "同一用户名连续登录失败"
+}
+
+func userKey(username string) string {
+	return "user:" + username
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
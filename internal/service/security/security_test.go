@@ -0,0 +1,150 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"qaqmall/config"
+	"qaqmall/internal/testutil"
+	"qaqmall/models"
+)
+
+func newTestService(t *testing.T) *SecurityService {
+	t.Helper()
+	db := testutil.NewSQLite(t, &models.LoginThrottle{}, &models.SecurityEvent{})
+	return NewSecurityService(db, config.LoginProtectionConfig{
+		MaxFailures:   3,
+		IPMaxFailures: 100,
+		FailureWindow: 15 * time.Minute,
+		BaseLockout:   time.Minute,
+		MaxLockout:    time.Hour,
+	})
+}
+
+func TestLockoutDuration(t *testing.T) {
+	s := newTestService(t)
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{2, 4 * time.Minute},
+		{5, 32 * time.Minute},
+		// 超过 max_lockout 后不再增长
+		{6, time.Hour},
+		{10, time.Hour},
+		// 位移次数很大时也不会溢出成负数或0
+		{maxBackoffShift, time.Hour},
+		{maxBackoffShift + 1, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := s.lockoutDuration(tt.n); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+// lockedFor 返回用户名当前剩余的锁定时长，没有锁定时返回0
+func lockedFor(t *testing.T, s *SecurityService, username string) time.Duration {
+	t.Helper()
+	err := s.CheckLogin(context.Background(), username, "")
+	if err == nil {
+		return 0
+	}
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatal(err)
+	}
+	return locked.RetryAfter
+}
+
+func TestLoginLockoutGrowthAndReset(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	fail := func() {
+		t.Helper()
+		if err := s.RecordLoginFailure(ctx, "Alice", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 达到上限前不锁定
+	for i := 0; i < 2; i++ {
+		fail()
+	}
+	if d := lockedFor(t, s, "alice"); d != 0 {
+		t.Fatalf("locked for %v before reaching max failures", d)
+	}
+
+	// 达到上限后锁定，之后每次失败锁定时长翻倍；用户名不区分大小写
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		fail()
+		if d := lockedFor(t, s, "ALICE"); d <= want-time.Second || d > want {
+			t.Fatalf("locked for %v, want about %v", d, want)
+		}
+	}
+	var events int64
+	s.db.Model(&models.SecurityEvent{}).Where("type = ?", models.SecurityEventLoginLockout).Count(&events)
+	if events != 3 {
+		t.Fatalf("lockout events = %d, want 3", events)
+	}
+
+	// 登录成功后清除用户名的计数，重新从头计数
+	if err := s.RecordLoginSuccess(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if d := lockedFor(t, s, "alice"); d != 0 {
+		t.Fatalf("locked for %v after successful login", d)
+	}
+	fail()
+	if d := lockedFor(t, s, "alice"); d != 0 {
+		t.Fatalf("locked for %v after first failure since reset", d)
+	}
+
+	// IP 的计数不因登录成功而清除
+	var throttle models.LoginThrottle
+	if err := s.db.Where("throttle_key = ?", ipKey("10.0.0.1")).First(&throttle).Error; err != nil {
+		t.Fatal(err)
+	}
+	if throttle.Failures != 6 {
+		t.Fatalf("ip failures = %d, want 6", throttle.Failures)
+	}
+}
+
+func TestLockoutCappedAtMax(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	for i := 0; i < 3+maxBackoffShift+5; i++ {
+		if err := s.RecordLoginFailure(ctx, "bob", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := lockedFor(t, s, "bob"); d <= time.Hour-time.Second || d > time.Hour {
+		t.Fatalf("locked for %v, want about %v", d, time.Hour)
+	}
+}
+
+func TestFailureWindowResetsCount(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := s.RecordLoginFailure(ctx, "carol", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 上次失败已超过 failure_window，重新计数
+	if err := s.db.Model(&models.LoginThrottle{}).Where("throttle_key = ?", userKey("carol")).
+		Update("last_failed_at", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RecordLoginFailure(ctx, "carol", ""); err != nil {
+		t.Fatal(err)
+	}
+	if d := lockedFor(t, s, "carol"); d != 0 {
+		t.Fatalf("locked for %v after failure window", d)
+	}
+}
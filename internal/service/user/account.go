@@ -0,0 +1,299 @@
+package user
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"qaqmall/internal/mail"
+	"qaqmall/internal/service/auth"
+	"qaqmall/models"
+)
+
+var (
+	ErrInvalidAccountToken = errors.New("链接无效或已过期")
+	ErrEmailNotSet         = errors.New("未设置邮箱")
+	ErrEmailVerified       = errors.New("邮箱已验证")
+	ErrEmptyPassword       = errors.New("密码不能为空")
+	ErrTooFrequent         = errors.New("请求过于频繁，请稍后再试")
+)
+
+// RequestEmailVerification 向用户当前的邮箱发送验证邮件，之前发送的验证链接随即失效
+func (s *UserService) RequestEmailVerification(ctx context.Context, userID uint64) error {
+	user, err := s.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return ErrEmailNotSet
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailVerified
+	}
+
+	token, err := s.issueAccountToken(ctx, user, models.AccountTokenVerifyEmail, s.account.VerifyEmailExpire)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "验证你的 qaqmall 邮箱",
+		Body: fmt.Sprintf("%s，你好：\n\n请打开以下链接验证邮箱，链接 %s 内有效：\n%s\n\n如果不是你本人操作，请忽略这封邮件。\n",
+			user.Username, humanDuration(s.account.VerifyEmailExpire), accountLink(s.account.VerifyEmailURL, token)),
+	})
+}
+
+// VerifyEmail 使用邮件中的 token 验证邮箱，token 只能使用一次
+// 发送验证邮件后修改过邮箱的，旧邮箱的链接不再有效
+func (s *UserService) VerifyEmail(ctx context.Context, token string) (*models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := s.claimAccountToken(tx, models.AccountTokenVerifyEmail, token)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ? AND deleted_at IS NULL", record.UserID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidAccountToken
+			}
+			return err
+		}
+		if user.Email != record.Email {
+			return ErrInvalidAccountToken
+		}
+		if user.EmailVerifiedAt != nil {
+			return nil
+		}
+
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		return tx.Model(&user).Update("email_verified_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RequestPasswordReset 向使用该邮箱且已验证邮箱的用户发送重置密码邮件
+// 为了不泄露邮箱是否注册过，邮箱不存在、未验证或发送过于频繁时同样返回 nil，邮件在后台发送
+func (s *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil
+	}
+
+	var users []models.User
+	if err := s.db.WithContext(ctx).
+		Where("email = ? AND email_verified_at IS NOT NULL AND deleted_at IS NULL", email).
+		Find(&users).Error; err != nil {
+		return err
+	}
+
+	for i := range users {
+		user := &users[i]
+		token, err := s.issueAccountToken(ctx, user, models.AccountTokenResetPassword, s.account.PasswordResetExpire)
+		if errors.Is(err, ErrTooFrequent) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		msg := mail.Message{
+			To:      user.Email,
+			Subject: "重置你的 qaqmall 密码",
+			Body: fmt.Sprintf("%s，你好：\n\n请打开以下链接重置密码，链接 %s 内有效，只能使用一次：\n%s\n\n如果不是你本人操作，请忽略这封邮件，你的密码不会改变。\n",
+				user.Username, humanDuration(s.account.PasswordResetExpire), accountLink(s.account.ResetPasswordURL, token)),
+		}
+		go func() {
+			if err := s.mailer.Send(context.Background(), msg); err != nil {
+				log.Printf("发送重置密码邮件失败 user_id=%d: %v", user.ID, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// ResetPassword 使用邮件中的 token 重置密码，token 只能使用一次
+// 发送邮件后修改过邮箱的，旧邮箱的链接不再有效；重置后该用户所有的登录会话随即失效，需要使用新密码重新登录
+func (s *UserService) ResetPassword(ctx context.Context, token, password string) error {
+	if password == "" {
+		return ErrEmptyPassword
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	var userID uint64
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := s.claimAccountToken(tx, models.AccountTokenResetPassword, token)
+		if err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.Where("id = ? AND deleted_at IS NULL", record.UserID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidAccountToken
+			}
+			return err
+		}
+		if user.Email != record.Email {
+			return ErrInvalidAccountToken
+		}
+
+		if err := tx.Model(&user).Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+
+		userID = user.ID
+		return auth.RevokeSessions(tx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+	s.tokens.SessionsRevoked(userID)
+	return nil
+}
+
+// PurgeExpiredAccountTokens 清除已过期的邮箱验证和重置密码 token，返回清除的条数
+func (s *UserService) PurgeExpiredAccountTokens(ctx context.Context) (int64, error) {
+	result := s.db.WithContext(ctx).
+		Where("expires_at <= ?", time.Now()).
+		Delete(&models.AccountToken{})
+	return result.RowsAffected, result.Error
+}
+
+// issueAccountToken 为用户签发一个用于 purpose 的 token，同一用途之前未使用的 token 随即失效
+// 距离上次签发不足 resend_interval 时返回 ErrTooFrequent
+func (s *UserService) issueAccountToken(ctx context.Context, user *models.User, purpose string, ttl time.Duration) (string, error) {
+	token, err := s.newAccountToken(purpose)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var recent int64
+		if err := tx.Model(&models.AccountToken{}).
+			Where("user_id = ? AND purpose = ? AND created_at > ?", user.ID, purpose, time.Now().Add(-s.account.ResendInterval)).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent > 0 {
+			return ErrTooFrequent
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.AccountToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.AccountToken{
+			UserID:    user.ID,
+			Purpose:   purpose,
+			Email:     user.Email,
+			TokenHash: hashAccountToken(token),
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// claimAccountToken 校验 token 的签名和用途，并在事务中将其标记为已使用
+// 条件更新保证并发请求时只有一个能使用该 token
+func (s *UserService) claimAccountToken(tx *gorm.DB, purpose, token string) (*models.AccountToken, error) {
+	if !s.validAccountTokenSignature(purpose, token) {
+		return nil, ErrInvalidAccountToken
+	}
+
+	var record models.AccountToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", hashAccountToken(token), purpose).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAccountToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	result := tx.Model(&record).
+		Where("used_at IS NULL AND expires_at > ?", now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidAccountToken
+	}
+	return &record, nil
+}
+
+// newAccountToken 生成 "随机串.签名" 格式的 token，签名绑定用途，验证邮箱的 token 不能用于重置密码
+func (s *UserService) newAccountToken(purpose string) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	return nonce + "." + s.signAccountToken(purpose, nonce), nil
+}
+
+// validAccountTokenSignature 不访问数据库先校验签名，伪造的 token 直接拒绝
+func (s *UserService) validAccountTokenSignature(purpose, token string) bool {
+	nonce, sig, ok := strings.Cut(token, ".")
+	if !ok || nonce == "" {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.signAccountToken(purpose, nonce)))
+}
+
+func (s *UserService) signAccountToken(purpose, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(s.account.TokenSecret))
+	mac.Write([]byte(purpose + ":" + nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// humanDuration 邮件中显示的有效期
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%d小时", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%d分钟", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+func accountLink(base, token string) string {
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,210 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"qaqmall/internal/service/audit"
+	"qaqmall/internal/service/auth"
+	"qaqmall/models"
+)
+
+var (
+	ErrUserDisabled     = errors.New("账号已被禁用")
+	ErrCannotModifySelf = errors.New("不能对自己的账号执行该操作")
+	ErrInvalidRole      = errors.New("角色不存在")
+)
+
+// 用户状态，用于列表过滤
+const (
+	StatusActive   = "active"
+	StatusDisabled = "disabled"
+)
+
+// maxRoleLength 与 users.role 的字段长度一致
+const maxRoleLength = 10
+
+// RoleStore 保存用户与角色的对应关系（授权策略中的分组规则）
+type RoleStore interface {
+	// Assign 在调用方的事务中把用户的角色改为 role
+	Assign(tx *gorm.DB, userID uint64, role string) error
+	// Reload 事务提交后重新加载，使修改生效
+	Reload() error
+	// Exists 角色是否存在
+	Exists(role string) bool
+}
+
+// UserDetail 管理后台查看的用户详情
+type UserDetail struct {
+	*models.User
+	MFAEnabled bool `json:"mfa_enabled"`
+}
+
+// AdminGet 获取用户详情，包括是否开启了二次验证
+func (s *UserService) AdminGet(ctx context.Context, userID uint64) (*UserDetail, error) {
+	user, err := s.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.mfa.Enabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &UserDetail{User: user, MFAEnabled: enabled}, nil
+}
+
+// Disable 禁用用户，用户所有的登录会话随即失效，禁用期间不能登录
+func (s *UserService) Disable(ctx context.Context, actor audit.Actor, userID uint64, reason string) (*models.User, error) {
+	if actor.UserID == userID {
+		return nil, ErrCannotModifySelf
+	}
+	return s.adminUpdate(ctx, userID, func(tx *gorm.DB, user *models.User) error {
+		if user.DisabledAt != nil {
+			return nil
+		}
+		before := userState(user)
+		now := time.Now()
+		if err := tx.Model(user).Update("disabled_at", now).Error; err != nil {
+			return err
+		}
+		if err := auth.RevokeSessions(tx, user.ID); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.Entry{
+			Actor:      actor,
+			Action:     models.AuditUserDisable,
+			TargetType: models.AuditTargetUser,
+			TargetID:   strconv.FormatUint(user.ID, 10),
+			Before:     before,
+			After:      userState(user),
+			Reason:     reason,
+		})
+	})
+}
+
+// Enable 解除禁用
+func (s *UserService) Enable(ctx context.Context, actor audit.Actor, userID uint64, reason string) (*models.User, error) {
+	return s.adminUpdate(ctx, userID, func(tx *gorm.DB, user *models.User) error {
+		if user.DisabledAt == nil {
+			return nil
+		}
+		before := userState(user)
+		if err := tx.Model(user).Update("disabled_at", nil).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.Entry{
+			Actor:      actor,
+			Action:     models.AuditUserEnable,
+			TargetType: models.AuditTargetUser,
+			TargetID:   strconv.FormatUint(user.ID, 10),
+			Before:     before,
+			After:      userState(user),
+			Reason:     reason,
+		})
+	})
+}
+
+// ForceLogout 使用户在所有设备上退出登录
+func (s *UserService) ForceLogout(ctx context.Context, actor audit.Actor, userID uint64, reason string) error {
+	_, err := s.adminUpdate(ctx, userID, func(tx *gorm.DB, user *models.User) error {
+		if err := auth.RevokeSessions(tx, user.ID); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.Entry{
+			Actor:      actor,
+			Action:     models.AuditUserLogout,
+			TargetType: models.AuditTargetUser,
+			TargetID:   strconv.FormatUint(user.ID, 10),
+			Reason:     reason,
+		})
+	})
+	return err
+}
+
+// ChangeRole 修改用户角色，users.role 与授权策略在同一个事务中修改
+// 已签发的 token 中带有旧角色，修改后用户所有的登录会话随即失效
+func (s *UserService) ChangeRole(ctx context.Context, actor audit.Actor, userID uint64, role, reason string) (*models.User, error) {
+	if actor.UserID == userID {
+		return nil, ErrCannotModifySelf
+	}
+	if role == "" || len(role) > maxRoleLength || !s.roles.Exists(role) {
+		return nil, ErrInvalidRole
+	}
+
+	changed := false
+	user, err := s.adminUpdate(ctx, userID, func(tx *gorm.DB, user *models.User) error {
+		if user.Role == role {
+			return nil
+		}
+		before := userState(user)
+		if err := tx.Model(user).Update("role", role).Error; err != nil {
+			return err
+		}
+		if err := s.roles.Assign(tx, user.ID, role); err != nil {
+			return err
+		}
+		if err := auth.RevokeSessions(tx, user.ID); err != nil {
+			return err
+		}
+		changed = true
+		return audit.Record(tx, audit.Entry{
+			Actor:      actor,
+			Action:     models.AuditUserRoleChange,
+			TargetType: models.AuditTargetUser,
+			TargetID:   strconv.FormatUint(user.ID, 10),
+			Before:     before,
+			After:      userState(user),
+			Reason:     reason,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 数据库中的修改已经提交，重新加载失败只影响内存中的策略，下次加载时会生效
+	if changed {
+		if err := s.roles.Reload(); err != nil {
+			log.Printf("重新加载授权策略失败 user_id=%d: %v", userID, err)
+		}
+	}
+	return user, nil
+}
+
+// adminUpdate 在事务中锁定用户后执行 fn，返回修改后的用户
+func (s *UserService) adminUpdate(ctx context.Context, userID uint64, fn func(tx *gorm.DB, user *models.User) error) (*models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND deleted_at IS NULL", userID).
+			First(&user).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		return fn(tx, &user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// fn 可能吊销了用户的会话
+	s.tokens.SessionsRevoked(user.ID)
+	return &user, nil
+}
+
+// userAuditState 审计记录中保存的用户状态
+type userAuditState struct {
+	Role       string     `json:"role"`
+	DisabledAt *time.Time `json:"disabled_at"`
+}
+
+func userState(user *models.User) userAuditState {
+	return userAuditState{Role: user.Role, DisabledAt: user.DisabledAt}
+}
@@ -0,0 +1,93 @@
+package user
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/models"
+)
+
+// maxUsernameLength 与 users.username 的长度一致
+const maxUsernameLength = 20
+
+// ExternalUserInput 第三方登录自动注册的用户
+// Username 为期望的用户名，被占用时加上随机后缀；Email 只有 EmailVerified 为 true 时才会保存
+type ExternalUserInput struct {
+	Username      string
+	Email         string
+	EmailVerified bool
+}
+
+// CreateExternalUser 在调用方的事务中为第三方登录创建用户，用于与关联第三方账号一起提交
+// 第三方登录的用户没有密码，不能使用用户名密码登录，可以通过找回密码设置密码
+func CreateExternalUser(tx *gorm.DB, in ExternalUserInput) (*models.User, error) {
+	username, err := availableUsername(tx, in.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		Username: username,
+		Role:     models.RoleUser,
+	}
+	if in.EmailVerified && in.Email != "" {
+		now := time.Now()
+		user.Email = in.Email
+		user.EmailVerifiedAt = &now
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// availableUsername 去掉用户名中的特殊字符，被占用（包括已删除的用户）时依次尝试加上随机数字后缀
+func availableUsername(tx *gorm.DB, hint string) (string, error) {
+	base := sanitizeUsername(hint)
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+
+		n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			return "", err
+		}
+		suffix := fmt.Sprintf("_%06d", n.Int64())
+		candidate = truncate(base, maxUsernameLength-len(suffix)) + suffix
+	}
+	return "", errors.New("无法生成可用的用户名")
+}
+
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			b.WriteRune(r)
+		}
+	}
+	return truncate(b.String(), maxUsernameLength)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
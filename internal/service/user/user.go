@@ -0,0 +1,319 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/mail"
+	"qaqmall/internal/pagination"
+	"qaqmall/internal/service/auth"
+	"qaqmall/internal/service/mfa"
+	"qaqmall/internal/service/security"
+	"qaqmall/models"
+)
+
+var (
+	ErrEmptyCredentials = errors.New("用户名和密码不能为空")
+	ErrUserExists       = errors.New("用户名已存在")
+	ErrUserNotFound     = errors.New("用户不存在")
+	// ErrInvalidCredentials 用户名不存在和密码错误返回同一个错误，不泄露用户名是否注册过
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	ErrMFARequired        = errors.New("该账号已开启二次验证，请使用支持二次验证的登录方式")
+)
+
+// dummyPasswordHash 用户名不存在时用于比对的哈希，使响应时间与密码错误时一致
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("qaqmall-dummy-password"), bcrypt.DefaultCost)
+
+// RegisterInput 注册参数
+type RegisterInput struct {
+	Username string
+	Password string
+	Email    string
+	Phone    string
+}
+
+// ListQuery 用户列表查询参数
+type ListQuery struct {
+	pagination.Pagination
+	Search string
+	Role   string
+	// Status 为 active 或 disabled，为空时不过滤
+	Status string
+}
+
+// LoginResult 登录结果
+// 用户开启了二次验证时只返回 Challenge，需要调用 CompleteMFALogin 提交验证码换取 Tokens
+type LoginResult struct {
+	User      *models.User
+	Tokens    *auth.TokenPair
+	Challenge *auth.MFAChallenge
+}
+
+// UserService 用户业务逻辑，HTTP 和 gRPC 共用
+// 邮箱验证和找回密码见 account.go
+type UserService struct {
+	db       *gorm.DB
+	tokens   *auth.TokenService
+	mfa      *mfa.MFAService
+	security *security.SecurityService
+	mailer   mail.Mailer
+	account  config.AccountConfig
+	roles    RoleStore
+}
+
+func NewUserService(db *gorm.DB, tokens *auth.TokenService, mfa *mfa.MFAService, security *security.SecurityService, mailer mail.Mailer, account config.AccountConfig, roles RoleStore) *UserService {
+	return &UserService{db: db, tokens: tokens, mfa: mfa, security: security, mailer: mailer, account: account, roles: roles}
+}
+
+// Register 注册用户，新用户角色固定为 user；填写了邮箱时发送验证邮件，发送失败不影响注册
+func (s *UserService) Register(ctx context.Context, in RegisterInput) (*models.User, error) {
+	if in.Username == "" || in.Password == "" {
+		return nil, ErrEmptyCredentials
+	}
+
+	db := s.db.WithContext(ctx)
+
+	// 检查用户名是否已存在
+	var existingUser models.User
+	if err := db.Where("username = ?", in.Username).First(&existingUser).Error; err == nil {
+		return nil, ErrUserExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// 加密密码
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		Username: in.Username,
+		Password: string(hashedPassword),
+		Role:     models.RoleUser,
+		Email:    in.Email,
+		Phone:    in.Phone,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return nil, err
+	}
+
+	if user.Email != "" {
+		if err := s.RequestEmailVerification(ctx, user.ID); err != nil {
+			log.Printf("发送验证邮件失败 user_id=%d: %v", user.ID, err)
+		}
+	}
+
+	return &user, nil
+}
+
+// Authenticate 校验用户名密码，ip 为客户端地址，用于按 IP 统计登录失败
+// 用户名或 IP 被锁定时返回 *security.LockedError；用户名不存在和密码错误都返回 ErrInvalidCredentials
+// 密码正确但账号被禁用时返回 ErrUserDisabled
+func (s *UserService) Authenticate(ctx context.Context, username, password, ip string) (*models.User, error) {
+	if err := s.security.CheckLogin(ctx, username, ip); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err := s.db.WithContext(ctx).Where("username = ? AND deleted_at IS NULL", username).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	hash := dummyPasswordHash
+	if err == nil {
+		hash = []byte(user.Password)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || err != nil {
+		if err := s.security.RecordLoginFailure(ctx, username, ip); err != nil {
+			log.Printf("记录登录失败次数失败 username=%q ip=%s: %v", username, ip, err)
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+
+	if err := s.security.RecordLoginSuccess(ctx, username); err != nil {
+		log.Printf("清除登录失败次数失败 username=%q: %v", username, err)
+	}
+	return &user, nil
+}
+
+// Login 校验用户名密码并开始一个新的登录会话，返回用户和签发的 access token、refresh token
+// 用户开启了二次验证时不签发token，而是返回二次验证 token
+func (s *UserService) Login(ctx context.Context, username, password, ip string) (*LoginResult, error) {
+	user, err := s.Authenticate(ctx, username, password, ip)
+	if err != nil {
+		return nil, err
+	}
+	return s.StartSession(ctx, user)
+}
+
+// StartSession 为已通过身份验证（密码或第三方登录）的用户开始登录会话
+// 用户开启了二次验证时不签发token，而是返回二次验证 token；账号被禁用时返回 ErrUserDisabled
+func (s *UserService) StartSession(ctx context.Context, user *models.User) (*LoginResult, error) {
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+	enabled, err := s.mfa.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		challenge, err := s.tokens.IssueMFAChallenge(user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{User: user, Challenge: challenge}, nil
+	}
+
+	pair, err := s.tokens.IssuePair(ctx, user, false)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{User: user, Tokens: pair}, nil
+}
+
+// CompleteMFALogin 校验二次验证 token 和验证码（或恢复码），通过后开始登录会话
+func (s *UserService) CompleteMFALogin(ctx context.Context, challengeToken, code string) (*LoginResult, error) {
+	userID, err := s.tokens.ParseMFAChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfa.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	user, err := s.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// 二次验证期间账号可能被禁用
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+	pair, err := s.tokens.IssuePair(ctx, user, true)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{User: user, Tokens: pair}, nil
+}
+
+// AccessToken 只签发 access token，用于不支持 refresh token 的 gRPC 登录，由调用方通过 RenewToken 续期
+// gRPC 登录不支持二次验证，开启了二次验证的用户返回 ErrMFARequired；被禁用的用户返回 ErrUserDisabled
+func (s *UserService) AccessToken(ctx context.Context, user *models.User) (string, time.Time, error) {
+	if user.DisabledAt != nil {
+		return "", time.Time{}, ErrUserDisabled
+	}
+	enabled, err := s.mfa.Enabled(ctx, user.ID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if enabled {
+		return "", time.Time{}, ErrMFARequired
+	}
+	return s.tokens.Generate(user.ID, user.Username, user.Role, user.TokenVersion, false, time.Time{})
+}
+
+// Get 获取用户信息
+func (s *UserService) Get(ctx context.Context, userID uint64) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ? AND deleted_at IS NULL", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Update 更新用户的邮箱和手机号，修改邮箱后需要重新验证
+func (s *UserService) Update(ctx context.Context, userID uint64, email, phone string) (*models.User, error) {
+	user, err := s.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Email != email {
+		user.EmailVerifiedAt = nil
+	}
+	user.Email = email
+	user.Phone = phone
+
+	if err := s.db.WithContext(ctx).Save(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// List 分页查询用户列表，支持按用户名、邮箱、手机号搜索和按角色、状态过滤
+func (s *UserService) List(ctx context.Context, q ListQuery) ([]models.User, int64, error) {
+	q.Pagination = q.Pagination.Normalize()
+
+	query := s.db.WithContext(ctx).Model(&models.User{}).Where("deleted_at IS NULL")
+	if search := strings.TrimSpace(q.Search); search != "" {
+		like := "%" + search + "%"
+		query = query.Where("username LIKE ? OR email LIKE ? OR phone LIKE ?", like, like, like)
+	}
+	if q.Role != "" {
+		query = query.Where("role = ?", q.Role)
+	}
+	switch q.Status {
+	case StatusActive:
+		query = query.Where("disabled_at IS NULL")
+	case StatusDisabled:
+		query = query.Where("disabled_at IS NOT NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	if err := query.Order("id").Offset(q.Offset()).Limit(q.PageSize).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// Delete 删除用户，token 不为空时一并吊销
+// 用户的订单、会话等记录仍然引用该用户，只设置 deleted_at 并吊销所有会话
+func (s *UserService) Delete(ctx context.Context, userID uint64, token string) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND deleted_at IS NULL", userID).
+			Update("deleted_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		return auth.RevokeSessions(tx, userID)
+	})
+	if err != nil {
+		return err
+	}
+	s.tokens.SessionsRevoked(userID)
+
+	if token != "" {
+		claims, err := s.tokens.Parse(token)
+		if err == nil && claims.UserID == userID {
+			return s.tokens.Revoke(ctx, claims.ID, claims.ExpiresAt)
+		}
+	}
+
+	return nil
+}
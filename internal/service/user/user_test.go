@@ -0,0 +1,93 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/service/auth"
+	"qaqmall/internal/service/mfa"
+	"qaqmall/internal/service/security"
+	"qaqmall/internal/testutil"
+	"qaqmall/models"
+)
+
+// newTestService 使用开启外键约束的内存 SQLite，refresh_tokens 与 init_database.sql 一样引用 users
+func newTestService(t *testing.T) (*UserService, *auth.TokenService, *gorm.DB) {
+	t.Helper()
+	db := testutil.NewSQLite(t, &models.User{}, &models.UserMFA{}, &models.LoginThrottle{}, &models.SecurityEvent{}, &models.RevokedToken{})
+	if err := db.Exec("PRAGMA foreign_keys = ON").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(`CREATE TABLE refresh_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		family_id TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at DATETIME NOT NULL,
+		session_expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		revoked_at DATETIME,
+		mfa NUMERIC NOT NULL DEFAULT false,
+		created_at DATETIME
+	)`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.JWT.Secret = "user-test-secret"
+	keys, err := auth.NewKeyring(cfg.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := auth.NewTokenService(db, cfg.JWT, keys, auth.NewDBRevocationStore(db))
+	users := NewUserService(db, tokens, mfa.NewMFAService(db, cfg.MFA), security.NewSecurityService(db, cfg.LoginProtection), nil, cfg.Account, nil)
+	return users, tokens, db
+}
+
+func TestDeleteAfterLogin(t *testing.T) {
+	s, tokens, db := newTestService(t)
+	ctx := context.Background()
+
+	created, err := s.Register(ctx, RegisterInput{Username: "alice", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.Login(ctx, "alice", "password", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 登录后 refresh_tokens 引用了该用户，删除不能违反外键约束
+	if err := s.Delete(ctx, created.ID, result.Tokens.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+
+	var deleted models.User
+	if err := db.First(&deleted, created.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if deleted.DeletedAt == nil {
+		t.Fatal("deleted_at not set")
+	}
+	if _, err := s.Get(ctx, created.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("get: err = %v, want ErrUserNotFound", err)
+	}
+	if err := s.Delete(ctx, created.ID, ""); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("delete twice: err = %v, want ErrUserNotFound", err)
+	}
+
+	// 会话全部吊销
+	if _, err := tokens.Verify(ctx, result.Tokens.AccessToken); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Fatalf("access token: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := tokens.Refresh(ctx, result.Tokens.RefreshToken); err == nil {
+		t.Fatal("refresh token still valid")
+	}
+	if _, err := s.Login(ctx, "alice", "password", "127.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("login: err = %v, want ErrInvalidCredentials", err)
+	}
+}
@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"context"
+	"log"
+
+	"qaqmall/internal/service/security"
+)
+
+// SecurityJobs 登录防护相关的定时任务
+type SecurityJobs struct {
+	security *security.SecurityService
+}
+
+func NewSecurityJobs(security *security.SecurityService) *SecurityJobs {
+	return &SecurityJobs{security: security}
+}
+
+// PurgeStale 清除已解锁且不再有失败记录的登录失败计数
+func (j *SecurityJobs) PurgeStale() {
+	n, err := j.security.PurgeStale(context.Background())
+	if err != nil {
+		log.Printf("清除登录失败计数失败: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("已清除 %d 条过期的登录失败计数", n)
+	}
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"context"
+	"log"
+
+	"qaqmall/internal/service/auth"
+	"qaqmall/internal/service/identity"
+	"qaqmall/internal/service/user"
+)
+
+// TokenJobs token相关的定时任务
+type TokenJobs struct {
+	tokens     *auth.TokenService
+	users      *user.UserService
+	identities *identity.IdentityService
+}
+
+func NewTokenJobs(tokens *auth.TokenService, users *user.UserService, identities *identity.IdentityService) *TokenJobs {
+	return &TokenJobs{tokens: tokens, users: users, identities: identities}
+}
+
+// PurgeExpired 清除已过期的吊销记录、refresh token、邮箱验证和重置密码 token 以及第三方登录的授权请求
+func (j *TokenJobs) PurgeExpired() {
+	ctx := context.Background()
+	revocations, refreshTokens, err := j.tokens.PurgeExpired(ctx)
+	if err != nil {
+		log.Printf("清除过期token记录失败: %v", err)
+		return
+	}
+	accountTokens, err := j.users.PurgeExpiredAccountTokens(ctx)
+	if err != nil {
+		log.Printf("清除过期账号token失败: %v", err)
+		return
+	}
+	oidcStates, err := j.identities.PurgeExpiredStates(ctx)
+	if err != nil {
+		log.Printf("清除过期第三方登录请求失败: %v", err)
+		return
+	}
+	if revocations > 0 || refreshTokens > 0 || accountTokens > 0 || oidcStates > 0 {
+		log.Printf("已清除过期token记录 revocations=%d refresh_tokens=%d account_tokens=%d oidc_states=%d", revocations, refreshTokens, accountTokens, oidcStates)
+	}
+}
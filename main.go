@@ -1,22 +1,61 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 
+	addressv1 "qaqmall/api/address/v1"
+	aiqueryv1 "qaqmall/api/ai_query/v1"
+	authv1 "qaqmall/api/auth/v1"
+	cartv1 "qaqmall/api/cart/v1"
+	productv1 "qaqmall/api/product/v1"
+	userv1 "qaqmall/api/user/v1"
+	"qaqmall/config"
 	"qaqmall/handlers"
+	"qaqmall/internal/authz"
+	"qaqmall/internal/llm"
+	"qaqmall/internal/mail"
+	"qaqmall/internal/oidc"
+	"qaqmall/internal/policywatch"
+	"qaqmall/internal/retrieval"
+	"qaqmall/internal/rpc"
+	"qaqmall/internal/service/address"
+	aiquery "qaqmall/internal/service/ai_query"
+	"qaqmall/internal/service/aitool"
+	"qaqmall/internal/service/audit"
+	"qaqmall/internal/service/auth"
+	"qaqmall/internal/service/cart"
+	"qaqmall/internal/service/conversation"
+	"qaqmall/internal/service/guardrail"
+	"qaqmall/internal/service/identity"
+	"qaqmall/internal/service/mfa"
+	"qaqmall/internal/service/order"
+	"qaqmall/internal/service/policy"
+	"qaqmall/internal/service/product"
+	"qaqmall/internal/service/security"
+	"qaqmall/internal/service/user"
 	"qaqmall/jobs"
 	"qaqmall/middleware"
 )
 
 func main() {
+	// 加载配置
+	cfg, err := config.Load("")
+	if err != nil {
+		log.Fatal("Failed to load config:", err)
+	}
+
 	// 连接数据库
-	dsn := "root:123456@tcp(127.0.0.1:3306)/qaqmall?charset=utf8mb4&parseTime=True&loc=Local"
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(mysql.Open(cfg.Database.DSN()), &gorm.Config{})
 	if err != nil {
 		log.Fatal("Failed to connect database:", err)
 	}
@@ -25,14 +64,97 @@ func main() {
 	if err := middleware.InitCasbin(db); err != nil {
 		log.Fatal("Failed to initialize Casbin:", err)
 	}
+	if cfg.RBAC.Watcher == config.RBACWatcherRedis {
+		policyWatcher, err := policywatch.NewRedisWatcher(cfg.Redis, cfg.RBAC.Channel)
+		if err != nil {
+			log.Fatal("Failed to initialize policy watcher:", err)
+		}
+		defer policyWatcher.Close()
+		if err := middleware.SetWatcher(policyWatcher); err != nil {
+			log.Fatal("Failed to initialize policy watcher:", err)
+		}
+	}
+	if cfg.RBAC.ReloadInterval > 0 {
+		go middleware.RunPolicyReloader(context.Background(), cfg.RBAC.ReloadInterval)
+	}
+
+	// 初始化服务
+	keyring, err := auth.NewKeyring(cfg.JWT)
+	if err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+	revocations, err := auth.NewRevocationBackend(cfg, db)
+	if err != nil {
+		log.Fatal("Failed to initialize token revocation store:", err)
+	}
+	if cfg.Revocation.Cache {
+		cachedRevocations := auth.NewCachedRevocationStore(revocations, cfg.Revocation.CacheSize)
+		go cachedRevocations.Run(context.Background(), cfg.Revocation.SyncInterval)
+		revocations = cachedRevocations
+	}
+	tokenService := auth.NewTokenService(db, cfg.JWT, keyring, revocations)
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatal("Failed to initialize mailer:", err)
+	}
+	mfaService := mfa.NewMFAService(db, cfg.MFA)
+	securityService := security.NewSecurityService(db, cfg.LoginProtection)
+	userService := user.NewUserService(db, tokenService, mfaService, securityService, mailer, cfg.Account, middleware.NewCasbinRoles())
+	auditService := audit.NewAuditService(db)
+	policies := middleware.NewCasbinPolicies()
+	policyService := policy.NewPolicyService(db, policies)
+	authorizer := authz.NewAuthorizer(policies)
+	identityService := identity.NewIdentityService(db, userService, cfg.OIDC)
+	productIndex, err := retrieval.NewIndex(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize retrieval index:", err)
+	}
+	productRetriever := retrieval.NewProductRetriever(db, productIndex)
+	go productRetriever.Run(context.Background(), cfg.Retrieval.RefreshInterval)
+	productService := product.NewProductService(db, productRetriever)
+	cartService := cart.NewCartService(db)
+	addressService := address.NewAddressService(db, authorizer)
+	aiQueryService := aiquery.NewAIQueryService(db, aiquery.NewLocalModel())
+	llmProvider, err := llm.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize LLM provider:", err)
+	}
+	conversationService := conversation.NewConversationService(db, cfg.LLM.HistoryTokenBudget)
+	orderService := order.NewOrderService(db, authorizer)
+	toolService := aitool.NewToolService(db, productService, cartService, orderService, addressService)
+	guardrailService := guardrail.NewGuardrailService(db, cfg.Guardrail.DailyTokenQuota)
+
+	// 启动 gRPC 服务
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(rpc.AuthInterceptor(tokenService, cfg.Server.GRPCServiceToken, policies, cfg.MFA.RequireForAdmin)))
+	authv1.RegisterAuthServiceServer(grpcServer, rpc.NewAuthServer(tokenService, userService))
+	userv1.RegisterUserServiceServer(grpcServer, rpc.NewUserServer(userService))
+	productv1.RegisterProductServiceServer(grpcServer, rpc.NewProductServer(productService))
+	cartv1.RegisterCartServiceServer(grpcServer, rpc.NewCartServer(cartService))
+	addressv1.RegisterAddressServiceServer(grpcServer, rpc.NewAddressServer(addressService))
+	aiqueryv1.RegisterAIQueryServiceServer(grpcServer, rpc.NewAIQueryServer(aiQueryService))
+
+	lis, err := net.Listen("tcp", cfg.Server.GRPCAddr())
+	if err != nil {
+		log.Fatal("Failed to listen gRPC port:", err)
+	}
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatal("Failed to start gRPC server:", err)
+		}
+	}()
 
 	// 创建Gin引擎
 	r := gin.New()
+	// 只信任配置的代理转发的 X-Forwarded-For，否则客户端可以伪造 IP 绕过限流和登录锁定
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("Invalid trusted proxies:", err)
+	}
 
 	// 添加中间件
 	r.Use(middleware.Logger())
 	r.Use(gin.Recovery())
 	r.Use(middleware.CORS())
+	r.Use(middleware.RateLimitMiddleware(cfg.RateLimit.RequestsPerMinute))
 
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
@@ -42,16 +164,26 @@ func main() {
 	})
 
 	// 初始化处理器
-	userHandler := handlers.NewUserHandler(db)
-	productHandler := handlers.NewProductHandler(db)
-	cartHandler := handlers.NewCartHandler(db)
-	addressHandler := handlers.NewAddressHandler(db)
-	orderHandler := handlers.NewOrderHandler(db)
-	paymentHandler := handlers.NewPaymentHandler(db)
-	aiQueryHandler := handlers.NewAIQueryHandler(db)
+	userHandler := handlers.NewUserHandler(userService, tokenService)
+	keyHandler := handlers.NewKeyHandler(tokenService)
+	mfaHandler := handlers.NewMFAHandler(mfaService)
+	securityHandler := handlers.NewSecurityHandler(securityService)
+	adminUserHandler := handlers.NewAdminUserHandler(userService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	policyHandler := handlers.NewPolicyHandler(policyService)
+	adminOrderHandler := handlers.NewAdminOrderHandler(orderService)
+	identityHandler := handlers.NewIdentityHandler(identityService)
+	productHandler := handlers.NewProductHandler(productService)
+	cartHandler := handlers.NewCartHandler(cartService)
+	addressHandler := handlers.NewAddressHandler(addressService)
+	orderHandler := handlers.NewOrderHandler(db, orderService, authorizer)
+	paymentHandler := handlers.NewPaymentHandler(db, authorizer, orderService)
+	aiQueryHandler := handlers.NewAIQueryHandler(db, llmProvider, conversationService, toolService, productRetriever, guardrailService, cfg.Retrieval.TopK)
 
 	// 初始化定时任务
-	orderJobs := jobs.NewOrderJobs(db)
+	orderJobs := jobs.NewOrderJobs(db, orderService)
+	tokenJobs := jobs.NewTokenJobs(tokenService, userService, identityService)
+	securityJobs := jobs.NewSecurityJobs(securityService)
 
 	// 启动定时任务
 	go func() {
@@ -60,23 +192,70 @@ func main() {
 			orderJobs.CancelExpiredOrders()
 		}
 	}()
+	go func() {
+		ticker := time.NewTicker(cfg.Revocation.SweepInterval)
+		for range ticker.C {
+			tokenJobs.PurgeExpired()
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		for range ticker.C {
+			securityJobs.PurgeStale()
+		}
+	}()
+
+	// 用户相关路由，登录、注册和找回密码共用一个更严格的限流
+	authLimit := middleware.RateLimitMiddleware(cfg.RateLimit.AuthRequestsPerMinute)
+	r.POST("/register", authLimit, userHandler.Register)
+	r.POST("/login", authLimit, userHandler.Login)
+	r.POST("/login/mfa", authLimit, userHandler.LoginMFA)
+	r.POST("/token/refresh", userHandler.RefreshToken)
+	r.POST("/email/verify", userHandler.VerifyEmail)
+	r.POST("/password/forgot", authLimit, userHandler.ForgotPassword)
+	r.POST("/password/reset", authLimit, userHandler.ResetPassword)
+	r.GET("/.well-known/jwks.json", keyHandler.JWKS)
 
-	// 用户相关路由
-	r.POST("/register", userHandler.Register)
-	r.POST("/login", userHandler.Login)
+	// 第三方登录
+	r.GET("/oauth/providers", identityHandler.ListProviders)
+	r.GET("/oauth/:provider/login", authLimit, identityHandler.Login)
+	r.GET("/oauth/:provider/callback", authLimit, identityHandler.Callback)
+	if cfg.OIDC.Mock.Enabled {
+		mockProvider, err := oidc.NewMockProvider(cfg.OIDC.Mock)
+		if err != nil {
+			log.Fatal("Failed to initialize mock OIDC provider:", err)
+		}
+		issuer, err := url.Parse(cfg.OIDC.Mock.Issuer)
+		if err != nil {
+			log.Fatal("Invalid mock OIDC issuer:", err)
+		}
+		log.Printf("已开启测试身份提供方 %s，任何人都能以任意用户登录，不要在生产环境使用", cfg.OIDC.Mock.Issuer)
+		r.Any(strings.TrimSuffix(issuer.Path, "/")+"/*path", gin.WrapH(mockProvider))
+	}
 
 	// 需要认证的路由组
 	auth := r.Group("/")
-	auth.Use(middleware.Auth(db))
+	auth.Use(middleware.Auth(tokenService))
 	{
 		// 用户管理
 		auth.POST("/logout", userHandler.Logout)
+		auth.POST("/logout/all", userHandler.LogoutAll)
 		auth.GET("/user/info", userHandler.GetUserInfo)
 		auth.PUT("/user/info", userHandler.UpdateUserInfo)
 		auth.DELETE("/user", userHandler.DeleteUser)
+		auth.POST("/user/email/verification", userHandler.RequestEmailVerification)
+		auth.GET("/user/mfa", mfaHandler.GetStatus)
+		auth.POST("/user/mfa/enroll", mfaHandler.Enroll)
+		auth.POST("/user/mfa/activate", mfaHandler.Activate)
+		auth.POST("/user/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+		auth.POST("/user/mfa/disable", mfaHandler.Disable)
+		auth.GET("/user/identities", identityHandler.ListIdentities)
+		auth.POST("/user/identities/:provider", identityHandler.Link)
+		auth.DELETE("/user/identities/:provider", identityHandler.Unlink)
 
 		// 购物车管理
 		auth.GET("/cart/items", cartHandler.ListCart)
+		auth.GET("/cart/count", cartHandler.CountCart)
 		auth.POST("/cart/items", cartHandler.AddToCart)
 		auth.PUT("/cart/items/:id", cartHandler.UpdateCartItem)
 		auth.DELETE("/cart/items/:id", cartHandler.RemoveFromCart)
@@ -84,8 +263,10 @@ func main() {
 
 		// 地址管理
 		auth.GET("/addresses", addressHandler.ListAddresses)
+		auth.GET("/addresses/:id", addressHandler.GetAddress)
 		auth.POST("/addresses", addressHandler.CreateAddress)
 		auth.PUT("/addresses/:id", addressHandler.UpdateAddress)
+		auth.POST("/addresses/:id/default", addressHandler.SetDefaultAddress)
 		auth.DELETE("/addresses/:id", addressHandler.DeleteAddress)
 
 		// 订单管理
@@ -101,26 +282,87 @@ func main() {
 
 		// AI 查询
 		auth.POST("/ai/query", aiQueryHandler.Query)
+		auth.POST("/ai/query/stream", aiQueryHandler.QueryStream)
+		auth.POST("/ai/conversations", aiQueryHandler.CreateConversation)
+		auth.GET("/ai/conversations", aiQueryHandler.ListConversations)
+		auth.GET("/ai/conversations/:id", aiQueryHandler.GetConversation)
+		auth.POST("/ai/conversations/:id/messages", aiQueryHandler.ContinueConversation)
+		auth.POST("/ai/conversations/:id/messages/stream", aiQueryHandler.ContinueConversationStream)
+		auth.DELETE("/ai/conversations/:id", aiQueryHandler.DeleteConversation)
+		auth.GET("/ai/actions", aiQueryHandler.ListActions)
+		auth.POST("/ai/actions/:id/confirm", aiQueryHandler.ConfirmAction)
+		auth.POST("/ai/actions/:id/reject", aiQueryHandler.RejectAction)
+		auth.GET("/ai/usage", aiQueryHandler.GetUsage)
 	}
 
 	// 需要管理员权限的路由组
 	admin := auth.Group("/admin")
 	admin.Use(middleware.RBACMiddleware())
+	if cfg.MFA.RequireForAdmin {
+		admin.Use(middleware.RequireMFA())
+	}
 	{
 		// 商品管理
 		admin.POST("/products", productHandler.CreateProduct)
 		admin.PUT("/products/:id", productHandler.UpdateProduct)
 		admin.DELETE("/products/:id", productHandler.DeleteProduct)
+
+		// AI 工具调用审计
+		admin.GET("/ai/tool-calls", aiQueryHandler.ListToolCalls)
+
+		// AI 拦截审核
+		admin.GET("/ai/moderation-events", aiQueryHandler.ListModerationEvents)
+		admin.POST("/ai/moderation-events/:id/review", aiQueryHandler.ReviewModerationEvent)
+
+		// 登录安全
+		admin.GET("/security/events", securityHandler.ListEvents)
+		admin.GET("/security/lockouts", securityHandler.ListLockouts)
+		admin.DELETE("/security/lockouts", securityHandler.ClearLockout)
+
+		// 用户管理
+		admin.GET("/users", adminUserHandler.ListUsers)
+		admin.GET("/users/:id", adminUserHandler.GetUser)
+		admin.POST("/users/:id/disable", adminUserHandler.DisableUser)
+		admin.POST("/users/:id/enable", adminUserHandler.EnableUser)
+		admin.POST("/users/:id/logout", adminUserHandler.LogoutUser)
+		admin.PUT("/users/:id/role", adminUserHandler.ChangeRole)
+
+		// 审计记录
+		admin.GET("/audit-logs", auditHandler.ListLogs)
+
+		// 权限策略
+		admin.GET("/policies", policyHandler.ListPolicies)
+		admin.POST("/policies", policyHandler.AddPolicy)
+		admin.DELETE("/policies", policyHandler.RemovePolicy)
+		admin.POST("/policies/check", policyHandler.Check)
+		admin.GET("/policies/resources", policyHandler.ListResourcePolicies)
+		admin.POST("/policies/resources", policyHandler.AddResourcePolicy)
+		admin.DELETE("/policies/resources", policyHandler.RemoveResourcePolicy)
+		admin.POST("/policies/resources/check", policyHandler.CheckResource)
+		admin.GET("/roles", policyHandler.ListRoles)
+		admin.GET("/roles/links", policyHandler.ListRoleLinks)
+		admin.POST("/roles/links", policyHandler.AddRoleLink)
+		admin.DELETE("/roles/links", policyHandler.RemoveRoleLink)
+
+		// 订单管理和退款，客服（operator）默认可以使用；发货、完成订单默认只有管理员可以使用
+		admin.GET("/orders", adminOrderHandler.ListOrders)
+		admin.GET("/orders/:id", adminOrderHandler.GetOrder)
+		admin.GET("/orders/:id/history", adminOrderHandler.GetOrderHistory)
+		admin.POST("/orders/:id/ship", adminOrderHandler.ShipOrder)
+		admin.POST("/orders/:id/complete", adminOrderHandler.CompleteOrder)
+		admin.POST("/refunds", adminOrderHandler.Refund)
 	}
 
 	// 不需要认证的路由
 	r.GET("/products", productHandler.ListProducts)
+	r.GET("/products/:id", productHandler.GetProduct)
+	r.GET("/categories", productHandler.ListCategories)
 
 	// 支付回调接口（不需要认证）
 	r.POST("/payments/callback", paymentHandler.PaymentCallback)
 
 	// 启动服务器
-	if err := r.Run(":8888"); err != nil {
+	if err := r.Run(cfg.Server.Addr()); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
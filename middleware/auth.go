@@ -1,18 +1,16 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
-	"gorm.io/gorm"
 
-	"qaqmall/models"
+	"qaqmall/internal/service/auth"
 )
 
-func Auth(db *gorm.DB) gin.HandlerFunc {
+func Auth(tokens *auth.TokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 从请求头中获取token
 		authHeader := c.GetHeader("Authorization")
@@ -30,41 +28,29 @@ func Auth(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 检查token是否在黑名单中
-		tokenString := parts[1]
-		var blacklistedToken models.TokenBlacklist
-		if err := db.Where("token = ? AND expired_at > ?", tokenString, time.Now()).First(&blacklistedToken).Error; err == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "token已失效"})
-			c.Abort()
-			return
-		}
-
-		// 解析token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// 验证签名算法
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte("your-secret-key"), nil
-		})
-
+		// 校验token（包括吊销检查）
+		claims, err := tokens.Verify(c.Request.Context(), parts[1])
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
+			switch {
+			case errors.Is(err, auth.ErrTokenRevoked):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "token已失效"})
+			case errors.Is(err, auth.ErrInvalidToken):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "token校验失败"})
+			}
 			c.Abort()
 			return
 		}
 
-		// 验证token并获取claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			// 将用户信息存储到上下文中
-			c.Set("user_id", uint64(claims["user_id"].(float64)))
-			c.Set("username", claims["username"].(string))
-			c.Set("role", claims["role"].(string))
-			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
-			c.Abort()
-			return
-		}
+		// 将用户信息存储到上下文中
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("role", claims.Role)
+		c.Set("token", parts[1])
+		c.Set("token_id", claims.ID)
+		c.Set("token_expires_at", claims.ExpiresAt)
+		c.Set("mfa", claims.MFA)
+		c.Next()
 	}
 }
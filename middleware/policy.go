@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/util"
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+	"github.com/casbin/govaluate"
+	"gorm.io/gorm"
+
+	"qaqmall/internal/authz"
+)
+
+// txAdapter 返回绑定到事务上的适配器，策略的修改与事务一起提交或回滚；表已在 InitCasbin 时创建，不再迁移
+// 通过它修改的策略不会进入内存，事务提交后需要调用 ReloadPolicy
+func txAdapter(tx *gorm.DB) (*gormadapter.Adapter, error) {
+	db := tx.Session(&gorm.Session{})
+	gormadapter.TurnOffAutoMigrate(db)
+	return gormadapter.NewAdapterByDB(db)
+}
+
+// CasbinPolicies 通过 Casbin 管理权限策略（p、p2 规则）和角色继承（g 规则），实现 policy.Store、authz.Enforcer 和 rpc.Enforcer
+type CasbinPolicies struct{}
+
+func NewCasbinPolicies() *CasbinPolicies {
+	return &CasbinPolicies{}
+}
+
+func (*CasbinPolicies) Policies() ([][]string, error) {
+	return enforcer.GetPolicy()
+}
+
+// ResourcePolicies 返回资源级别的策略（p2 规则）
+func (*CasbinPolicies) ResourcePolicies() ([][]string, error) {
+	return enforcer.GetNamedPolicy("p2")
+}
+
+// RoleLinks 返回角色之间的继承规则，不包括用户与角色的对应关系
+func (*CasbinPolicies) RoleLinks() ([][]string, error) {
+	rules, err := enforcer.GetNamedGroupingPolicy("g")
+	if err != nil {
+		return nil, err
+	}
+	links := make([][]string, 0, len(rules))
+	for _, rule := range rules {
+		if !isUserSubject(rule[0]) {
+			links = append(links, rule)
+		}
+	}
+	return links, nil
+}
+
+// Exists 在事务中查询规则是否存在，ptype 为 p 或 g
+func (*CasbinPolicies) Exists(tx *gorm.DB, ptype string, rule []string) (bool, error) {
+	query := tx.Model(&gormadapter.CasbinRule{}).Where("ptype = ?", ptype)
+	for i := 0; i < 6; i++ {
+		value := ""
+		if i < len(rule) {
+			value = rule[i]
+		}
+		query = query.Where(fmt.Sprintf("v%d = ?", i), value)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (*CasbinPolicies) Add(tx *gorm.DB, ptype string, rule []string) error {
+	adapter, err := txAdapter(tx)
+	if err != nil {
+		return err
+	}
+	return adapter.AddPolicy(ptype, ptype, rule)
+}
+
+func (*CasbinPolicies) Remove(tx *gorm.DB, ptype string, rule []string) error {
+	adapter, err := txAdapter(tx)
+	if err != nil {
+		return err
+	}
+	return adapter.RemovePolicy(ptype, ptype, rule)
+}
+
+// InheritedRoles 返回角色直接或间接继承的所有角色
+func (*CasbinPolicies) InheritedRoles(role string) ([]string, error) {
+	return enforcer.GetImplicitRolesForUser(role)
+}
+
+// Check 检查角色是否有权限，返回匹配的策略
+func (*CasbinPolicies) Check(role, obj, act string) (bool, []string, error) {
+	return enforcer.EnforceEx(role, obj, act)
+}
+
+// ValidateCondition 使用空的用户和资源试算一次条件，条件有语法错误、引用了不存在的属性或者结果不是布尔值时返回错误
+func (*CasbinPolicies) ValidateCondition(cond string) error {
+	expr, err := govaluate.NewEvaluableExpression(util.EscapeAssertion(cond))
+	if err != nil {
+		return err
+	}
+	result, err := expr.Evaluate(map[string]interface{}{
+		"r2_sub": authz.Subject{},
+		"r2_res": authz.Attributes{},
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := result.(bool); !ok {
+		return errors.New("条件的结果不是布尔值")
+	}
+	return nil
+}
+
+// EnforceResource 按资源属性检查权限，实现 authz.Enforcer
+func (*CasbinPolicies) EnforceResource(sub authz.Subject, res authz.Attributes, act string) (bool, error) {
+	return enforcer.Enforce(casbin.NewEnforceContext("2"), sub, res, act)
+}
+
+// EnforceUser 按用户的角色检查权限，实现 rpc.Enforcer
+func (*CasbinPolicies) EnforceUser(userID uint64, obj, act string) (bool, error) {
+	return EnforceUser(userID, obj, act)
+}
+
+func (*CasbinPolicies) Reload() error {
+	return ReloadPolicy()
+}
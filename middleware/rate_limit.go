@@ -1,36 +1,50 @@
 package middleware
 
 import (
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// IPRateLimiter 按客户端 IP 的滑动窗口限流
 type IPRateLimiter struct {
 	sync.Mutex
 	requests map[string][]time.Time
 	window   time.Duration
 	limit    int
+	// lastSweep 上次清理所有 IP 的时间，每个窗口最多清理一次
+	lastSweep time.Time
 }
 
 func NewIPRateLimiter(window time.Duration, limit int) *IPRateLimiter {
 	return &IPRateLimiter{
-		requests: make(map[string][]time.Time),
-		window:   window,
-		limit:    limit,
+		requests:  make(map[string][]time.Time),
+		window:    window,
+		limit:     limit,
+		lastSweep: time.Now(),
 	}
 }
 
+// prune 去掉窗口之外的请求时间，返回仍在窗口内的部分
+func (rl *IPRateLimiter) prune(times []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(times) && now.Sub(times[i]) > rl.window {
+		i++
+	}
+	return times[i:]
+}
+
+// cleanOld 删除窗口内没有请求的 IP，避免长期运行后占用的内存不断增长
 func (rl *IPRateLimiter) cleanOld(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.window {
+		return
+	}
+	rl.lastSweep = now
 	for ip, times := range rl.requests {
-		var valid []time.Time
-		for _, t := range times {
-			if now.Sub(t) <= rl.window {
-				valid = append(valid, t)
-			}
-		}
-		if len(valid) == 0 {
+		if valid := rl.prune(times, now); len(valid) == 0 {
 			delete(rl.requests, ip)
 		} else {
 			rl.requests[ip] = valid
@@ -38,29 +52,33 @@ func (rl *IPRateLimiter) cleanOld(now time.Time) {
 	}
 }
 
-func (rl *IPRateLimiter) isAllowed(ip string) bool {
+// allow 判断 ip 是否还能发起请求，不能时返回需要等待的时间
+func (rl *IPRateLimiter) allow(ip string) (bool, time.Duration) {
 	rl.Lock()
 	defer rl.Unlock()
 
 	now := time.Now()
 	rl.cleanOld(now)
 
-	times := rl.requests[ip]
+	times := rl.prune(rl.requests[ip], now)
 	if len(times) < rl.limit {
 		rl.requests[ip] = append(times, now)
-		return true
+		return true, 0
 	}
 
-	return false
+	rl.requests[ip] = times
+	return false, rl.window - now.Sub(times[0])
 }
 
+// RateLimitMiddleware 每个 IP 每分钟最多 requestsPerMinute 个请求，超出时返回 429 和 Retry-After
+// 同一个限流器的计数由挂载它的所有路由共享
 func RateLimitMiddleware(requestsPerMinute int) gin.HandlerFunc {
 	limiter := NewIPRateLimiter(time.Minute, requestsPerMinute)
 
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		if !limiter.isAllowed(ip) {
-			c.JSON(429, gin.H{"error": "请求过于频繁，请稍后再试"})
+		if ok, wait := limiter.allow(c.ClientIP()); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "请求过于频繁，请稍后再试"})
 			c.Abort()
 			return
 		}
@@ -1,15 +1,68 @@
 package middleware
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/persist"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+
+	"qaqmall/models"
+)
+
+var (
+	enforcer *casbin.SyncedEnforcer
+	watcher  persist.Watcher
 )
 
-var enforcer *casbin.Enforcer
+// defaultPolicies 首次启动（还没有任何权限策略）时写入的默认策略，之后通过 /admin/policies 接口管理
+var defaultPolicies = [][]string{
+	{models.RoleAdmin, "/admin/*", "(GET)|(POST)|(PUT)|(DELETE)"},
+	{models.RoleAdmin, "/products*", "(GET)|(POST)|(PUT)|(DELETE)"},
+	{models.RoleAdmin, "/users*", "(GET)|(POST)|(PUT)|(DELETE)"},
+	{models.RoleUser, "/products*", "GET"},
+	// 客服：查看订单和退款
+	{models.RoleOperator, "/admin/orders*", "GET"},
+	{models.RoleOperator, "/admin/refunds", "POST"},
+}
+
+// 资源条件：资源属于发起操作的用户
+const ownerCondition = "r2.sub.ID == r2.res.Owner"
+
+// defaultResourcePolicies 资源级别的默认策略（p2 规则）：角色、资源类型、操作（正则）、条件
+// 还没有任何 p2 规则时写入，之后通过 /admin/policies/resources 接口管理
+var defaultResourcePolicies = [][]string{
+	{models.RoleUser, models.ResourceOrder, "^(read|update|cancel|pay)$", ownerCondition},
+	{models.RoleUser, models.ResourcePayment, "^read$", ownerCondition},
+	{models.RoleUser, models.ResourceAddress, "^(read|use|update|delete)$", ownerCondition},
+	// 客服和管理员可以查看所有用户的订单、支付记录和收货地址
+	{models.RoleOperator, models.ResourceOrder, "^read$", "true"},
+	{models.RoleOperator, models.ResourcePayment, "^read$", "true"},
+	{models.RoleOperator, models.ResourceAddress, "^read$", "true"},
+}
+
+// upgradedResourcePolicies 旧版本写入的默认策略及其替换后的策略，启动时旧策略仍然存在则替换
+// 管理员修改过的策略不会被替换
+var upgradedResourcePolicies = []struct {
+	old, new []string
+}{
+	{
+		old: []string{models.RoleUser, models.ResourceAddress, "^(read|use)$", ownerCondition},
+		new: []string{models.RoleUser, models.ResourceAddress, "^(read|use|update|delete)$", ownerCondition},
+	},
+}
+
+// defaultRoleLinks 与 defaultResourcePolicies 一起写入：管理员继承客服，客服继承普通用户，都可以操作自己的资源
+var defaultRoleLinks = [][]string{
+	{models.RoleAdmin, models.RoleOperator},
+	{models.RoleOperator, models.RoleUser},
+}
 
 func InitCasbin(db *gorm.DB) error {
 	adapter, err := gormadapter.NewAdapterByDB(db)
@@ -17,7 +70,7 @@ func InitCasbin(db *gorm.DB) error {
 		return err
 	}
 
-	enforcer, err = casbin.NewEnforcer("config/rbac_model.conf", adapter)
+	enforcer, err = casbin.NewSyncedEnforcer("config/rbac_model.conf", adapter)
 	if err != nil {
 		return err
 	}
@@ -27,45 +80,102 @@ func InitCasbin(db *gorm.DB) error {
 		return err
 	}
 
-	// 添加默认策略
-	_, err = enforcer.AddPolicy("admin", "/admin/*", "(GET)|(POST)|(PUT)|(DELETE)")
+	// 只在没有任何权限策略时添加默认策略，管理员删除的默认策略不会在重启后恢复
+	policies, err := enforcer.GetPolicy()
 	if err != nil {
 		return err
 	}
+	if len(policies) == 0 {
+		if _, err := enforcer.AddPolicies(defaultPolicies); err != nil {
+			return err
+		}
+	}
 
-	_, err = enforcer.AddPolicy("admin", "/products*", "(GET)|(POST)|(PUT)|(DELETE)")
+	// 资源级别的策略单独判断，从旧版本升级时同样会写入
+	resourcePolicies, err := enforcer.GetNamedPolicy("p2")
 	if err != nil {
 		return err
 	}
-
-	_, err = enforcer.AddPolicy("user", "/products*", "GET")
-	if err != nil {
+	if len(resourcePolicies) == 0 {
+		if _, err := enforcer.AddNamedPolicies("p2", defaultResourcePolicies); err != nil {
+			return err
+		}
+		if _, err := enforcer.AddGroupingPoliciesEx(defaultRoleLinks); err != nil {
+			return err
+		}
+	}
+	if err := syncUserRoles(db); err != nil {
 		return err
 	}
 
-	_, err = enforcer.AddPolicy("admin", "/users*", "(GET)|(POST)|(PUT)|(DELETE)")
-	if err != nil {
-		return err
+	for _, p := range upgradedResourcePolicies {
+		ok, err := enforcer.HasNamedPolicy("p2", p.old)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if _, err := enforcer.UpdateNamedPolicy("p2", p.old, p.new); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// syncUserRoles 为 users.role 不是普通用户、但还没有分组策略的用户写入 g 规则
+// 权限按分组策略检查，初始化脚本创建的管理员和旧版本中修改过角色的用户需要补上
+func syncUserRoles(db *gorm.DB) error {
+	var users []models.User
+	if err := db.Select("id", "role").
+		Where("role <> ? AND deleted_at IS NULL", models.RoleUser).
+		Find(&users).Error; err != nil {
+		return err
+	}
+
+	var rules [][]string
+	for _, u := range users {
+		roles, err := enforcer.GetRolesForUser(strconv.FormatUint(u.ID, 10))
+		if err != nil {
+			return err
+		}
+		if len(roles) == 0 {
+			rules = append(rules, []string{strconv.FormatUint(u.ID, 10), u.Role})
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	_, err := enforcer.AddGroupingPoliciesEx(rules)
+	return err
+}
+
+// SetWatcher 设置多实例之间同步策略的 watcher，收到其他实例的通知时重新加载策略
+func SetWatcher(w persist.Watcher) error {
+	watcher = w
+	return w.SetUpdateCallback(func(string) {
+		if err := enforcer.LoadPolicy(); err != nil {
+			log.Printf("重新加载授权策略失败: %v", err)
+		}
+	})
+}
+
+// RBACMiddleware 按用户在授权策略中的角色（g 规则）检查权限，不使用 token 中的角色
 func RBACMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
+		userID, exists := c.Get("user_id")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户角色信息"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
 			c.Abort()
 			return
 		}
 
-		roleName := role.(string)
 		path := c.Request.URL.Path
 		method := c.Request.Method
 
 		// 检查权限
-		ok, err := enforcer.Enforce(roleName, path, method)
+		ok, err := EnforceUser(userID.(uint64), path, method)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "权限检查失败"})
 			c.Abort()
@@ -82,18 +192,131 @@ func RBACMiddleware() gin.HandlerFunc {
 	}
 }
 
-func UpdateUserRole(userID uint64, newRole string) error {
-	// 删除旧的角色
-	_, err := enforcer.DeleteRolesForUser(string(userID))
+// EnforceUser 以用户ID为主体检查权限，通过分组策略（g 规则）得到用户的角色
+// 没有分组规则的用户（注册后没有修改过角色）是普通用户
+func EnforceUser(userID uint64, obj, act string) (bool, error) {
+	sub := strconv.FormatUint(userID, 10)
+	roles, err := enforcer.GetRolesForUser(sub)
 	if err != nil {
-		return err
+		return false, err
 	}
+	if len(roles) == 0 {
+		sub = models.RoleUser
+	}
+	return enforcer.Enforce(sub, obj, act)
+}
 
-	// 添加新的角色
-	_, err = enforcer.AddRoleForUser(string(userID), newRole)
+// RequireMFA 要求 token 在登录时通过了二次验证，用于管理后台等敏感接口
+func RequireMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("mfa") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":        "该操作需要开启二次验证，并在登录时完成验证",
+				"mfa_required": true,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// UpdateUserRole 在调用方的事务中把用户的分组策略（g 规则）改为 newRole，与 users.role 的修改一起提交
+// 事务提交后需要调用 ReloadPolicy 使内存中的策略生效
+func UpdateUserRole(tx *gorm.DB, userID uint64, newRole string) error {
+	adapter, err := txAdapter(tx)
 	if err != nil {
 		return err
 	}
 
+	sub := strconv.FormatUint(userID, 10)
+	// 删除旧的角色
+	if err := adapter.RemoveFilteredPolicy("g", "g", 0, sub); err != nil {
+		return err
+	}
+	// 添加新的角色
+	return adapter.AddPolicy("g", "g", []string{sub, newRole})
+}
+
+// ReloadPolicy 从数据库重新加载策略，并通知其他实例重新加载
+func ReloadPolicy() error {
+	if err := enforcer.LoadPolicy(); err != nil {
+		return err
+	}
+	if watcher != nil {
+		if err := watcher.Update(); err != nil {
+			log.Printf("通知其他实例重新加载授权策略失败: %v", err)
+		}
+	}
 	return nil
 }
+
+// RunPolicyReloader 每隔 interval 从数据库重新加载策略，直到 ctx 取消
+func RunPolicyReloader(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := enforcer.LoadPolicy(); err != nil {
+				log.Printf("定期加载授权策略失败: %v", err)
+			}
+		}
+	}
+}
+
+// RoleExists 角色是否存在：内置角色、在策略中有权限或者继承了其他角色的角色
+func RoleExists(role string) bool {
+	if role == models.RoleUser || role == models.RoleAdmin {
+		return true
+	}
+	if isUserSubject(role) {
+		return false
+	}
+	subjects, err := enforcer.GetAllSubjects()
+	if err != nil {
+		return false
+	}
+	for _, sub := range subjects {
+		if sub == role {
+			return true
+		}
+	}
+	links, err := enforcer.GetNamedGroupingPolicy("g")
+	if err != nil {
+		return false
+	}
+	for _, link := range links {
+		if link[0] == role {
+			return true
+		}
+	}
+	return false
+}
+
+// isUserSubject 分组策略中以用户ID为主体的规则（用户 -> 角色），其他的是角色之间的继承
+func isUserSubject(sub string) bool {
+	_, err := strconv.ParseUint(sub, 10, 64)
+	return err == nil
+}
+
+// CasbinRoles 通过 Casbin 的分组策略保存用户角色，实现 user.RoleStore
+type CasbinRoles struct{}
+
+func NewCasbinRoles() *CasbinRoles {
+	return &CasbinRoles{}
+}
+
+func (*CasbinRoles) Assign(tx *gorm.DB, userID uint64, role string) error {
+	return UpdateUserRole(tx, userID, role)
+}
+
+func (*CasbinRoles) Reload() error {
+	return ReloadPolicy()
+}
+
+func (*CasbinRoles) Exists(role string) bool {
+	return RoleExists(role)
+}
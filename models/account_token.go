@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// 账号 token 的用途
+const (
+	AccountTokenVerifyEmail   = "verify_email"
+	AccountTokenResetPassword = "reset_password"
+)
+
+// AccountToken 邮件中发送的一次性 token，用于验证邮箱和重置密码，只保存哈希
+type AccountToken struct {
+	ID        uint64    `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint64    `json:"user_id" gorm:"not null;index"`
+	Purpose   string    `json:"purpose" gorm:"size:20;not null"`
+	// Email 发送的邮箱，验证邮箱和重置密码时必须与用户当前的邮箱一致
+	Email     string     `json:"email" gorm:"size:128;not null"`
+	TokenHash string     `json:"-" gorm:"size:64;not null;unique"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+func (AccountToken) TableName() string {
+	return "account_tokens"
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// 被拦截内容的来源
+const (
+	ModerationSourceQuery   = "query"   // 用户的问题
+	ModerationSourceProduct = "product" // 放入上下文的商品信息
+	ModerationSourceQuota   = "quota"   // 超出每日 token 额度
+)
+
+// AIModerationEvent AI助手拦截的请求，供管理员审核
+type AIModerationEvent struct {
+	ID         uint64     `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint64     `json:"user_id" gorm:"not null;index"`
+	Source     string     `json:"source" gorm:"size:20;not null"`
+	Reason     string     `json:"reason" gorm:"size:100;not null"`
+	Content    string     `json:"content" gorm:"type:text"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	ReviewedBy uint64     `json:"reviewed_by,omitempty" gorm:"not null;default:0"`
+}
+
+// AITokenUsage 用户每天的AI token 用量，Day 为 2006-01-02 格式的日期
+type AITokenUsage struct {
+	UserID    uint64    `json:"user_id" gorm:"primaryKey"`
+	Day       string    `json:"day" gorm:"primaryKey;size:10"`
+	Tokens    int       `json:"tokens" gorm:"not null;default:0"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (AIModerationEvent) TableName() string {
+	return "ai_moderation_events"
+}
+
+func (AITokenUsage) TableName() string {
+	return "ai_token_usage"
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// AIToolCallStatus AI助手工具调用的状态
+type AIToolCallStatus string
+
+const (
+	AIToolCallPending  AIToolCallStatus = "pending"  // 等待用户确认
+	AIToolCallExecuted AIToolCallStatus = "executed" // 已执行
+	AIToolCallFailed   AIToolCallStatus = "failed"   // 执行失败
+	AIToolCallRejected AIToolCallStatus = "rejected" // 用户已拒绝
+	AIToolCallExpired  AIToolCallStatus = "expired"  // 超时未确认
+)
+
+// AIToolCall AI助手的一次工具调用，同时作为审计日志和待确认操作的存储
+// 只读工具直接执行，有副作用的工具先记录为 pending，用户确认后才执行
+type AIToolCall struct {
+	ID             uint64           `json:"id" gorm:"primaryKey"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	UserID         uint64           `json:"user_id" gorm:"not null;index"`
+	ConversationID uint64           `json:"conversation_id" gorm:"not null;default:0"`
+	Tool           string           `json:"tool" gorm:"size:50;not null"`
+	Arguments      string           `json:"arguments" gorm:"type:text;not null"`
+	Status         AIToolCallStatus `json:"status" gorm:"size:20;not null;index"`
+	Result         string           `json:"result,omitempty" gorm:"type:text"`
+	Error          string           `json:"error,omitempty" gorm:"size:255"`
+	ExpiresAt      *time.Time       `json:"expires_at,omitempty"`
+	ExecutedAt     *time.Time       `json:"executed_at,omitempty"`
+}
+
+func (AIToolCall) TableName() string {
+	return "ai_tool_calls"
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// 审计操作
+const (
+	AuditUserDisable    = "user.disable"     // 禁用用户
+	AuditUserEnable     = "user.enable"      // 启用用户
+	AuditUserLogout     = "user.logout"      // 强制用户退出登录
+	AuditUserRoleChange = "user.role_change" // 修改用户角色
+	AuditPolicyAdd      = "policy.add"       // 添加权限策略
+	AuditPolicyRemove   = "policy.remove"    // 删除权限策略
+	AuditRoleLinkAdd    = "role.link_add"    // 添加角色继承
+	AuditRoleLinkRemove = "role.link_remove" // 删除角色继承
+	AuditOrderRefund    = "order.refund"     // 订单退款
+)
+
+// 审计对象类型
+const (
+	AuditTargetUser           = "user"
+	AuditTargetPolicy         = "policy"
+	AuditTargetResourcePolicy = "resource_policy"
+	AuditTargetRole           = "role"
+	AuditTargetOrder          = "order"
+)
+
+// AuditLog 管理员操作的审计记录，与操作在同一个事务中写入
+// Before、After 为操作前后的状态（JSON），没有时为空
+type AuditLog struct {
+	ID         uint64    `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+	ActorID    uint64    `json:"actor_id" gorm:"not null;index"`
+	IP         string    `json:"ip" gorm:"size:64"`
+	Action     string    `json:"action" gorm:"size:64;not null;index"`
+	TargetType string    `json:"target_type" gorm:"size:32;not null"`
+	TargetID   string    `json:"target_id" gorm:"size:191;not null"`
+	Before     string    `json:"before,omitempty" gorm:"type:text"`
+	After      string    `json:"after,omitempty" gorm:"type:text"`
+	Reason     string    `json:"reason,omitempty" gorm:"size:255"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
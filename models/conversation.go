@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Conversation AI助手会话
+type Conversation struct {
+	ID        uint64     `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
+	UserID    uint64     `json:"user_id" gorm:"not null;index"`
+	Title     string     `json:"title" gorm:"size:100"`
+
+	// 关联
+	Messages []Message `json:"messages,omitempty" gorm:"foreignKey:ConversationID"`
+}
+
+// Message 会话中的一条消息，Role 为 user 或 assistant
+type Message struct {
+	ID             uint64    `json:"id" gorm:"primaryKey"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID uint64    `json:"conversation_id" gorm:"not null;index"`
+	Role           string    `json:"role" gorm:"size:20;not null"`
+	Content        string    `json:"content" gorm:"type:text;not null"`
+	Tokens         int       `json:"tokens" gorm:"not null;default:0"`
+}
+
+func (Conversation) TableName() string {
+	return "conversations"
+}
+
+func (Message) TableName() string {
+	return "messages"
+}
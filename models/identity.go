@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// UserIdentity 关联到本地用户的第三方账号，同一身份提供方的同一 Subject 只能关联一个用户，一个用户在每个身份提供方只能关联一个账号
+type UserIdentity struct {
+	ID        uint64    `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint64    `json:"user_id" gorm:"not null;uniqueIndex:idx_user_identities_user_provider"`
+	Provider  string    `json:"provider" gorm:"size:32;not null;uniqueIndex:idx_user_identities_user_provider;uniqueIndex:idx_user_identities_provider_subject"`
+	// Subject id_token 中的 sub
+	Subject string `json:"subject" gorm:"size:191;not null;uniqueIndex:idx_user_identities_provider_subject"`
+	// Email 最近一次登录时身份提供方返回的邮箱，仅供展示
+	Email       string     `json:"email" gorm:"size:128"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// OIDCState 跳转到身份提供方时保存的授权请求，回调时按 state 取出并删除，只能使用一次
+// UserID 不为0时表示已登录用户关联第三方账号，否则为第三方登录
+type OIDCState struct {
+	// StateHash state 的 SHA-256，state 本身只出现在跳转地址中
+	StateHash    string    `gorm:"primaryKey;size:64"`
+	Provider     string    `gorm:"size:32;not null"`
+	Nonce        string    `gorm:"size:64;not null"`
+	CodeVerifier string    `gorm:"size:128;not null"`
+	UserID       uint64    `gorm:"not null;default:0"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+}
+
+func (OIDCState) TableName() string {
+	return "oidc_states"
+}
@@ -16,6 +16,13 @@ const (
 	OrderStatusRefunded  OrderStatus = "refunded"  // 已退款
 )
 
+// 订单状态变化的发起方
+const (
+	OrderActorUser   = "user"   // 下单的用户
+	OrderActorAdmin  = "admin"  // 管理员或客服
+	OrderActorSystem = "system" // 定时任务、支付回调等
+)
+
 // Order 订单模型
 type Order struct {
 	ID          uint64      `json:"id" gorm:"primaryKey"`
@@ -53,6 +60,19 @@ type OrderItem struct {
 	Product Product `json:"product" gorm:"foreignKey:ProductID"`
 }
 
+// OrderStatusHistory 订单状态的变化记录，与状态修改在同一个事务中写入
+// 创建订单时写入一条 FromStatus 为空的记录；ActorID 为 0 表示由系统发起
+type OrderStatusHistory struct {
+	ID         uint64      `json:"id" gorm:"primaryKey"`
+	OrderID    uint64      `json:"order_id" gorm:"not null;index"`
+	FromStatus OrderStatus `json:"from_status" gorm:"size:20;not null"`
+	ToStatus   OrderStatus `json:"to_status" gorm:"size:20;not null"`
+	ActorType  string      `json:"actor_type" gorm:"size:16;not null"`
+	ActorID    uint64      `json:"actor_id" gorm:"not null"`
+	Reason     string      `json:"reason,omitempty" gorm:"size:255"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
 // TableName 指定表名
 func (Order) TableName() string {
 	return "orders"
@@ -62,3 +82,8 @@ func (Order) TableName() string {
 func (OrderItem) TableName() string {
 	return "order_items"
 }
+
+// TableName 指定表名
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
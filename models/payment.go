@@ -20,6 +20,9 @@ const (
 	PaymentStatusPaid      PaymentStatus = "paid"      // 已支付
 	PaymentStatusCancelled PaymentStatus = "cancelled" // 已取消
 	PaymentStatusRefunded  PaymentStatus = "refunded"  // 已退款
+
+	// PaymentStatusRefundPending 支付成功时订单已不是待支付状态（例如已超时取消），需要人工退款
+	PaymentStatusRefundPending PaymentStatus = "refund_pending"
 )
 
 // Payment 支付记录模型
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// RefreshToken 服务端保存的 refresh token，只保存哈希
+// 同一次登录轮换出的 refresh token 属于同一个 FamilyID，检测到重复使用时整个 family 一起吊销
+type RefreshToken struct {
+	ID               uint64     `json:"id" gorm:"primaryKey"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UserID           uint64     `json:"user_id" gorm:"not null;index"`
+	FamilyID         string     `json:"family_id" gorm:"size:32;not null;index"`
+	TokenHash        string     `json:"-" gorm:"size:64;not null;unique"`
+	ExpiresAt        time.Time  `json:"expires_at" gorm:"not null"`
+	SessionExpiresAt time.Time  `json:"session_expires_at" gorm:"not null"`
+	UsedAt           *time.Time `json:"used_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	// MFA 登录时是否通过了二次验证，轮换出的 access token 沿用该状态
+	MFA bool `json:"mfa" gorm:"not null;default:false"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
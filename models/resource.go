@@ -0,0 +1,22 @@
+package models
+
+// 受保护的资源类型，与授权策略（p2 规则）中的 type 对应
+const (
+	ResourceOrder   = "order"
+	ResourceAddress = "address"
+	ResourcePayment = "payment"
+)
+
+// 以下方法实现 authz.Resource，用于资源级别的权限检查
+
+func (o Order) ResourceType() string   { return ResourceOrder }
+func (o Order) ResourceOwner() uint64  { return o.UserID }
+func (o Order) ResourceStatus() string { return string(o.Status) }
+
+func (a Address) ResourceType() string   { return ResourceAddress }
+func (a Address) ResourceOwner() uint64  { return a.UserID }
+func (a Address) ResourceStatus() string { return "" }
+
+func (p Payment) ResourceType() string   { return ResourcePayment }
+func (p Payment) ResourceOwner() uint64  { return p.UserID }
+func (p Payment) ResourceStatus() string { return string(p.Status) }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// RevokedToken 已吊销的 access token，以 jti 为主键，token 过期后由定时任务清除
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"column:jti;primaryKey;size:32"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
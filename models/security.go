@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// 安全事件类型
+const (
+	SecurityEventLoginLockout   = "login_lockout"   // 连续登录失败被锁定
+	SecurityEventLockoutCleared = "lockout_cleared" // 管理员解除锁定
+)
+
+// LoginThrottle 登录失败计数，ThrottleKey 为 "user:用户名" 或 "ip:地址"
+// LockedUntil 不为空且晚于当前时间时，该用户名或 IP 不能登录
+type LoginThrottle struct {
+	ThrottleKey  string     `json:"key" gorm:"primaryKey;size:191"`
+	Failures     int        `json:"failures" gorm:"not null;default:0"`
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty" gorm:"index"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
+
+// SecurityEvent 安全事件记录，供管理员查看
+// 用户名锁定时 IP 为最后一次失败请求的来源，IP 锁定时 Username 为最后一次尝试的用户名
+type SecurityEvent struct {
+	ID          uint64     `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"index"`
+	Type        string     `json:"type" gorm:"size:32;not null"`
+	Username    string     `json:"username" gorm:"size:191;index"`
+	IP          string     `json:"ip" gorm:"size:64;index"`
+	Failures    int        `json:"failures" gorm:"not null;default:0"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	OperatorID  uint64     `json:"operator_id,omitempty" gorm:"not null;default:0"`
+	Detail      string     `json:"detail" gorm:"size:255"`
+}
+
+func (SecurityEvent) TableName() string {
+	return "security_events"
+}
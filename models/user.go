@@ -2,16 +2,29 @@ package models
 
 import "time"
 
+// 内置角色，其他角色由授权策略定义
+const (
+	RoleUser     = "user"
+	RoleAdmin    = "admin"
+	RoleOperator = "operator" // 客服
+)
+
 type User struct {
 	ID        uint64     `json:"id" gorm:"primaryKey"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
 	Username  string     `json:"username" gorm:"size:20;not null;unique"`
-	Password  string     `json:"password" gorm:"size:60;not null"`
+	Password  string     `json:"-" gorm:"size:60;not null"`
 	Role      string     `json:"role" gorm:"size:10;not null;default:'user'"`
 	Email     string     `json:"email" gorm:"size:128"`
 	Phone     string     `json:"phone" gorm:"size:20"`
+	// EmailVerifiedAt 邮箱验证通过的时间，修改邮箱后清空
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// TokenVersion 递增后该用户已签发的 access token 全部失效
+	TokenVersion int `json:"-" gorm:"not null;default:0"`
+	// DisabledAt 被管理员禁用的时间，禁用期间不能登录
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
 }
 
 func (User) TableName() string {
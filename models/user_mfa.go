@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// UserMFA 用户绑定的 TOTP 验证器，EnabledAt 为空表示已生成密钥但还没有确认绑定
+type UserMFA struct {
+	UserID    uint64    `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Secret 加密后的 TOTP 密钥
+	Secret    string     `json:"-" gorm:"size:255;not null"`
+	EnabledAt *time.Time `json:"enabled_at,omitempty"`
+	// LastUsedStep 最近一次通过验证的时间步，同一时间步的验证码不能重复使用
+	LastUsedStep int64 `json:"-" gorm:"not null;default:0"`
+	// FailedAttempts 连续验证失败的次数，达到上限后锁定到 LockedUntil
+	FailedAttempts int        `json:"-" gorm:"not null;default:0"`
+	LockedUntil    *time.Time `json:"-"`
+}
+
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// MFARecoveryCode 二次验证的恢复码，只保存哈希，每个只能使用一次
+type MFARecoveryCode struct {
+	ID        uint64     `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint64     `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}